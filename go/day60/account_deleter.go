@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// AccountDeleterは削除の猶予期間を過ぎたアカウントを物理削除するバックグラウンド処理です。
+// 削除したユーザーのセッションは、このインスタンスの拒否リストにすぐ加えます。
+type AccountDeleter struct {
+	repo     *TodoRepository
+	sessions *SessionRegistry
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewAccountDeleter(repo *TodoRepository, sessions *SessionRegistry, interval time.Duration) *AccountDeleter {
+	return &AccountDeleter{
+		repo:     repo,
+		sessions: sessions,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Runはctxがキャンセルされるまで削除ジョブを動かします。
+func (d *AccountDeleter) Run(ctx context.Context) {
+	log.Printf("Account deleter started (interval: %s)", d.interval)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Account deleter stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnceは削除日時を過ぎたアカウントがなくなるまで1件ずつ物理削除します。
+// 1件ごとにトランザクションを分けるので、途中で失敗してもそれまでの削除は確定します。
+func (d *AccountDeleter) runOnce(ctx context.Context) {
+	now := d.now()
+	for ctx.Err() == nil {
+		userID, revoked, err := d.repo.DeleteDueAccount(ctx, now)
+		if err != nil {
+			log.Printf("Account deleter: failed to delete account: %v", err)
+			return
+		}
+		if userID == 0 {
+			return
+		}
+		d.sessions.Revoke(revoked...)
+		log.Printf("Account deleter: deleted user %d", userID)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultAccountDeletionGraceはアカウント削除の申請から物理削除までの猶予期間の既定値です。
+const defaultAccountDeletionGrace = 7 * 24 * time.Hour
+
+// exportProfileは個人データのエクスポートのprofile.jsonの中身です。
+type exportProfile struct {
+	User  User   `json:"user"`
+	Lists []List `json:"lists"`
+	Tags  []Tag  `json:"tags"`
+}
+
+// exportMeはユーザーの個人データ（プロフィール・自分が作成したTODO・その監査ログ）をZIPで返します。
+//
+//	profile.json    ユーザー情報と、所属するリスト・タグ
+//	todos.json      自分が作成したTODO（ゴミ箱のものも含む）
+//	audit_log.json  自分が作成したTODOの監査ログ
+func (h *MeHandler) exportMe(c *gin.Context) error {
+	userID := currentUserID(c)
+	user, err := h.repo.FindUserByID(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+	lists, err := h.repo.FindListsByUser(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+	tags, err := h.repo.FindTagsByUser(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	// ここから先は本文を送り始めるので、失敗してもステータスは変えられない
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d-%s.zip"`, userID, time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	err = writeZipJSON(zw, "profile.json", exportProfile{User: user, Lists: lists, Tags: tags})
+	if err == nil {
+		err = writeZipEntry(zw, "todos.json", func(w io.Writer) error {
+			enc := &jsonTodoEncoder{w: w}
+			if err := enc.Begin(); err != nil {
+				return err
+			}
+			if err := h.repo.ExportOwnTodos(c.Request.Context(), userID, enc.Encode); err != nil {
+				return err
+			}
+			return enc.End()
+		})
+	}
+	if err == nil {
+		err = writeZipEntry(zw, "audit_log.json", func(w io.Writer) error {
+			// TODOと同じく、全件をメモリに載せずに配列を1要素ずつ書く
+			sep := "["
+			err := h.repo.ExportAuditLogs(c.Request.Context(), userID, func(e AuditEntry) error {
+				b, err := json.Marshal(e)
+				if err != nil {
+					return err
+				}
+				if _, err := io.WriteString(w, sep+"\n"); err != nil {
+					return err
+				}
+				sep = ","
+				_, err = w.Write(b)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if sep == "[" {
+				_, err = io.WriteString(w, "[]\n")
+			} else {
+				_, err = io.WriteString(w, "\n]\n")
+			}
+			return err
+		})
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// 途中までのZIPは壊れているので、ログに残して接続を打ち切る
+		log.Printf("Account export failed for user %d: %v", userID, err)
+		c.Abort()
+	}
+	return nil
+}
+
+// writeZipEntryはZIPにnameのファイルを追加し、writeで中身を書き込みます。
+func writeZipEntry(zw *zip.Writer, name string, write func(io.Writer) error) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	return write(w)
+}
+
+// writeZipJSONはvをインデント付きのJSONとしてZIPに追加します。
+func writeZipJSON(zw *zip.Writer, name string, v any) error {
+	return writeZipEntry(zw, name, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	})
+}
+
+type DeleteMeInput struct {
+	// Passwordはパスワードでログインするユーザーの再確認に使います
+	Password string `json:"password"`
+	// CodeとRecoveryCodeは、パスワードの無いユーザー（OIDCで作られたユーザー）が2要素認証で再確認するときに使います
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// recentLoginWindowは、パスワードの無いユーザーがログインし直したばかりとみなすセッションの経過時間です。
+const recentLoginWindow = 10 * time.Minute
+
+// deleteMeはアカウントの削除を申請します。本人確認のため、reconfirmUserで再確認します。
+// 猶予期間が過ぎるとAccountDeleterが物理削除します。それまではDELETE /api/v1/me/deletionで取り消せます。
+func (h *MeHandler) deleteMe(c *gin.Context) error {
+	var input DeleteMeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	userID := currentUserID(c)
+	if err := h.reconfirmUser(c, input); err != nil {
+		return err
+	}
+
+	scheduledAt, err := h.repo.RequestAccountDeletion(c.Request.Context(), userID, time.Now().Add(h.deletionGrace))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusAccepted, gin.H{"deletion_scheduled_at": scheduledAt})
+	return nil
+}
+
+// reconfirmUserはアカウントの削除の前に、ログインしているのが本人であることを確かめます。
+//   - パスワードがあるユーザーはパスワードを再入力します。
+//   - パスワードの無いユーザー（OIDCで作られたユーザー）は、2要素認証が有効ならコードかリカバリーコードを入力します。
+//     有効でなければ、IdPでログインし直してrecentLoginWindow以内に始めたセッションから申請します。
+func (h *MeHandler) reconfirmUser(c *gin.Context, input DeleteMeInput) error {
+	ctx := c.Request.Context()
+	p := currentPrincipal(c)
+	user, err := h.repo.FindUserByID(ctx, p.UserID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash != "" {
+		if input.Password == "" {
+			return fmt.Errorf("%w: password is required", ErrInvalidInput)
+		}
+		err := checkPassword(user, input.Password)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return fmt.Errorf("%w: password is incorrect", ErrForbidden)
+		}
+		return err
+	}
+
+	mfa, err := h.repo.TOTPEnabled(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if mfa {
+		if input.Code == "" && input.RecoveryCode == "" {
+			return fmt.Errorf("%w: code or recovery_code is required", ErrInvalidInput)
+		}
+		err := h.repo.VerifySecondFactor(ctx, user.ID, input.Code, input.RecoveryCode)
+		if errors.Is(err, ErrUnauthenticated) {
+			return fmt.Errorf("%w: %v", ErrForbidden, err)
+		}
+		return err
+	}
+
+	sessions, err := h.repo.FindSessions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.ID == p.SessionID && time.Since(s.CreatedAt) <= recentLoginWindow {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: sign in again with your identity provider within %s to confirm", ErrForbidden, recentLoginWindow)
+}
+
+// cancelDeletionはアカウント削除の申請を取り消します。
+func (h *MeHandler) cancelDeletion(c *gin.Context) error {
+	if err := h.repo.CancelAccountDeletion(c.Request.Context(), currentUserID(c)); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// getPendingDeletionsは削除を申請中のアカウントを返します。
+func (h *AdminHandler) getPendingDeletions(c *gin.Context) error {
+	deletions, err := h.repo.FindPendingDeletions(c.Request.Context())
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, deletions)
+	return nil
+}
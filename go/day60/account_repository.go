@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// PendingDeletionは削除を申請中のアカウントです（管理者向けの一覧で使います）。
+type PendingDeletion struct {
+	UserID      int       `json:"user_id"`
+	Email       string    `json:"email"`
+	RequestedAt time.Time `json:"requested_at"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// AuditEntryは監査ログの1行です。
+type AuditEntry struct {
+	ID        int             `json:"id"`
+	TodoID    int             `json:"todo_id"`
+	Operation string          `json:"operation"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// RequestAccountDeletionはアカウントの削除を申請し、物理削除される日時を返します。
+// 既に申請中の場合は最初の申請の日時を変えずにそのまま返します。
+func (r *TodoRepository) RequestAccountDeletion(ctx context.Context, userID int, scheduledAt time.Time) (time.Time, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var scheduled time.Time
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE users SET
+			deletion_requested_at = COALESCE(deletion_requested_at, NOW()),
+			deletion_scheduled_at = COALESCE(deletion_scheduled_at, $2)
+		WHERE id = $1
+		RETURNING deletion_scheduled_at`, userID, scheduledAt).Scan(&scheduled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return scheduled, ErrNotFound
+	}
+	return scheduled, err
+}
+
+// CancelAccountDeletionはアカウント削除の申請を取り消します。申請していなければErrNotFoundです。
+func (r *TodoRepository) CancelAccountDeletion(ctx context.Context, userID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users SET deletion_requested_at = NULL, deletion_scheduled_at = NULL
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindPendingDeletionsは削除を申請中のアカウントを、削除が近い順に返します。
+func (r *TodoRepository) FindPendingDeletions(ctx context.Context) ([]PendingDeletion, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, email, deletion_requested_at, deletion_scheduled_at FROM users
+		WHERE deletion_scheduled_at IS NOT NULL
+		ORDER BY deletion_scheduled_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletions := []PendingDeletion{}
+	for rows.Next() {
+		var d PendingDeletion
+		if err := rows.Scan(&d.UserID, &d.Email, &d.RequestedAt, &d.ScheduledAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+// listHeirsQueryは$1のユーザーが所有する共有リストごとに、所有者を引き継ぐメンバーを1人ずつ選びます（list_id, user_id）。
+const listHeirsQuery = `
+	SELECT list_id, user_id FROM (
+		SELECT lm.list_id, lm.user_id, row_number() OVER (
+			PARTITION BY lm.list_id
+			ORDER BY CASE lm.role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 ELSE 2 END, lm.created_at, lm.user_id
+		) AS heir_rank
+		FROM list_members lm
+		JOIN lists l ON l.id = lm.list_id
+		WHERE l.owner_id = $1 AND NOT l.is_personal AND lm.user_id <> $1
+	) ranked
+	WHERE heir_rank = 1`
+
+// DeleteDueAccountは削除日時を過ぎたアカウントを1件物理削除し、削除したユーザーのIDと取り消したセッションのIDを返します。対象が無ければ0です。
+//
+// 他のメンバーがいる共有リストは、残るメンバー（owner、editor、viewerの順、同じロールなら古い順）に所有者を移してから削除します。
+// 残る共有リストにユーザーが作ったTODOと繰り返しは、リストの所有者のものにして残します（リストから項目が消えないように）。
+// それ以外はfk_userなどの外部キーのCASCADEで、ユーザーのTODO・個人リスト・タグ・リマインダーなどが一緒に削除されます。
+// 監査ログは外部キーを持たないので、削除するTODOの分を明示的に削除します。他のユーザーのTODOへのコメントは本文を消して削除済みにします。
+// セッションは取り消してから残すので（user_idはNULLになる）、発行済みのJWTは各インスタンスの拒否リストで期限まで拒否されます。
+func (r *TodoRepository) DeleteDueAccount(ctx context.Context, now time.Time) (int, []string, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var userID int
+	var revoked []string
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			SELECT id FROM users
+			WHERE deletion_scheduled_at <= $1
+			ORDER BY deletion_scheduled_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`, now).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// 後継者を先にownerにしてから所有者を移す。後継者はownerから選ぶので、ownerにしても選ばれる人は変わらない
+		if _, err := tx.ExecContext(ctx, "UPDATE list_members SET role = 'owner' WHERE (list_id, user_id) IN ("+listHeirsQuery+")", userID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE lists SET owner_id = heirs.user_id FROM ("+listHeirsQuery+") heirs WHERE lists.id = heirs.list_id", userID); err != nil {
+			return err
+		}
+		// 所有者を移した後なので、ユーザーが所有していないリストはすべて削除後も残る
+		for _, table := range []string{"todos", "todo_series"} {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE `+table+` SET user_id = (SELECT owner_id FROM lists WHERE lists.id = `+table+`.list_id)
+				WHERE user_id = $1 AND list_id IN (SELECT id FROM lists WHERE owner_id <> $1)`, userID); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM todo_audit_logs WHERE todo_id IN (SELECT id FROM todos WHERE user_id = $1)", userID); err != nil {
+			return err
+		}
+		// 他のユーザーのTODOに残るコメントは、スレッドを保つために削除済みとして本文だけ消す（投稿者はSET NULLになる）
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comment_revisions WHERE comment_id IN (SELECT id FROM comments WHERE user_id = $1)", userID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE comments SET body = '', deleted_at = COALESCE(deleted_at, NOW()) WHERE user_id = $1", userID); err != nil {
+			return err
+		}
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE sessions SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING id`, userID)
+		if err != nil {
+			return err
+		}
+		if revoked, err = scanSessionIDs(rows); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return userID, revoked, nil
+}
+
+// ExportOwnTodosはユーザーが作成したTODOを、ゴミ箱にあるものも含めてID順に1件ずつemitに渡します（個人データのエクスポート用）。
+func (r *TodoRepository) ExportOwnTodos(ctx context.Context, userID int, emit func(TodoRecord) error) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT todos.id, todos.name, todos.list_id, todos.parent_id, todos.completed, todos.due_at,
+			`+exportRecurrenceColumn+`,
+			COALESCE((
+				SELECT json_agg(tg.name ORDER BY tg.name) FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id
+				WHERE tt.todo_id = todos.id AND tg.user_id = $1
+			), '[]'),
+			todos.deleted_at
+		FROM todos
+		WHERE todos.user_id = $1
+		ORDER BY todos.id`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rec TodoRecord
+		var parentID sql.NullInt64
+		var dueAt, deletedAt sql.NullTime
+		var tags []byte
+		if err := rows.Scan(&rec.ID, &rec.Name, &rec.ListID, &parentID, &rec.Completed, &dueAt, &rec.Recurrence, &tags, &deletedAt); err != nil {
+			return err
+		}
+		rec.ParentID = nullIntPtr(parentID)
+		if dueAt.Valid {
+			rec.DueAt = &dueAt.Time
+		}
+		if deletedAt.Valid {
+			rec.DeletedAt = &deletedAt.Time
+		}
+		if err := json.Unmarshal(tags, &rec.Tags); err != nil {
+			return err
+		}
+		if err := emit(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportAuditLogsはユーザーが作成したTODOの監査ログを古い順に1件ずつemitに渡します。
+func (r *TodoRepository) ExportAuditLogs(ctx context.Context, userID int, emit func(AuditEntry) error) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.todo_id, a.operation, a.details, a.created_at
+		FROM todo_audit_logs a
+		JOIN todos ON todos.id = a.todo_id
+		WHERE todos.user_id = $1
+		ORDER BY a.id`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.TodoID, &e.Operation, &details, &e.CreatedAt); err != nil {
+			return err
+		}
+		if details != nil {
+			e.Details = json.RawMessage(details)
+		}
+		if err := emit(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
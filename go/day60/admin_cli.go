@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// サーバーのバイナリはサブコマンドで運用の作業もできます。
+// 接続先などの設定はserveと同じ環境変数（DB_HOSTなど）から読み、DBの操作はTodoRepositoryを通すので、
+// 最初の管理者の作成やパスワードの再設定にpsqlやその場限りのGoのプログラムは要りません。
+
+const adminUsage = `Usage: server [command]
+
+Commands:
+  serve                                      Start the HTTP and gRPC servers (default)
+  user create --email EMAIL [--role ROLE] [--generate-password]
+                                             Create a user (roles: user, admin)
+  user reset-password --email EMAIL [--generate-password]
+                                             Set a new password and sign out all sessions
+  user set-role --email EMAIL --role ROLE    Change the role and sign out all sessions
+  jwt rotate [--revoke-sessions]             Print a new JWT_SECRET
+  db check                                   Check the connection, migrations and admin users
+
+Passwords are read from the first line of stdin unless --generate-password is given.
+Database settings are read from DB_HOST, DB_PORT, DB_USER, DB_PASSWORD and DB_NAME.
+`
+
+// requiredSchemaVersionはこのバイナリが前提とするマイグレーションのバージョンです。db/migrationsにマイグレーションを足したら、
+// sqlite_migrationsにも同じバージョンのマイグレーションを足して更新してください。
+const requiredSchemaVersion = 23
+
+// userRolesはusers.roleに入れられる値です。
+var userRoles = []string{"user", "admin"}
+
+// errAdminUsageはサブコマンドや引数が正しくないときのエラーです。使い方を表示して終了コード2で終わります。
+var errAdminUsage = errors.New("invalid usage")
+
+// AdminCLIはサーバーのバイナリのサブコマンドを実行します。
+type AdminCLI struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// OpenDBはDBに接続します。DBを使うサブコマンドだけが呼びます
+	OpenDB func() (*sql.DB, error)
+	// Serveはserveサブコマンドの本体です
+	Serve func()
+}
+
+// Runはサブコマンドを実行し、終了コード（成功は0、使い方の誤りは2、それ以外の失敗は1）を返します。
+func (a *AdminCLI) Run(args []string) int {
+	err := a.run(args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errAdminUsage):
+		if msg := strings.TrimSuffix(err.Error(), ": "+errAdminUsage.Error()); msg != errAdminUsage.Error() {
+			fmt.Fprintln(a.Stderr, msg)
+		}
+		fmt.Fprint(a.Stderr, adminUsage)
+		return 2
+	default:
+		fmt.Fprintln(a.Stderr, "error:", err)
+		return 1
+	}
+}
+
+func (a *AdminCLI) run(args []string) error {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	command := strings.Join(args[:min(2, len(args))], " ")
+	ctx := context.Background()
+	switch {
+	case args[0] == "serve" && len(args) == 1:
+		a.Serve()
+		return nil
+	case args[0] == "help" || args[0] == "-h" || args[0] == "--help":
+		fmt.Fprint(a.Stdout, adminUsage)
+		return nil
+	case command == "user create":
+		return a.createUser(ctx, args[2:])
+	case command == "user reset-password":
+		return a.resetPassword(ctx, args[2:])
+	case command == "user set-role":
+		return a.setRole(ctx, args[2:])
+	case command == "jwt rotate":
+		return a.rotateJWTSecret(ctx, args[2:])
+	case command == "db check":
+		if len(args) > 2 {
+			return errAdminUsage
+		}
+		return a.checkDB(ctx)
+	}
+	return fmt.Errorf("unknown command %q: %w", command, errAdminUsage)
+}
+
+// newAdminFlagSetはサブコマンドのFlagSetを作ります。エラーはparseAdminFlagsがまとめて表示するので、ここでは出力しません。
+func newAdminFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseAdminFlagsはフラグを読みます。フラグ以外の引数は受け付けません。
+func parseAdminFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %v: %w", fs.Name(), err, errAdminUsage)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected argument %q: %w", fs.Name(), fs.Arg(0), errAdminUsage)
+	}
+	return nil
+}
+
+func validateRole(role string) error {
+	if !slices.Contains(userRoles, role) {
+		return fmt.Errorf("role must be one of %s: %w", strings.Join(userRoles, ", "), errAdminUsage)
+	}
+	return nil
+}
+
+// repoはDBに接続してリポジトリを返します。
+func (a *AdminCLI) repo() (*TodoRepository, func(), error) {
+	conn, err := a.OpenDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewTodoRepository(conn), func() { conn.Close() }, nil
+}
+
+// passwordは新しいパスワードを決めます。generateなら作って表示し、そうでなければ標準入力の1行目を読みます。
+// 長さなどの条件はサインアップと同じです。
+func (a *AdminCLI) password(email string, generate bool) (string, error) {
+	var password string
+	if generate {
+		b := make([]byte, 18)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		password = base64.RawURLEncoding.EncodeToString(b)
+	} else {
+		fmt.Fprint(a.Stderr, "Password: ")
+		line, err := bufio.NewReader(a.Stdin).ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			return "", errors.New("could not read the password from stdin")
+		}
+		password = strings.TrimRight(line, "\r\n")
+		fmt.Fprintln(a.Stderr)
+	}
+	if err := binding.Validator.ValidateStruct(SignupInput{Email: email, Password: password}); err != nil {
+		return "", fmt.Errorf("%v: %w", err, errAdminUsage)
+	}
+	return password, nil
+}
+
+func (a *AdminCLI) createUser(ctx context.Context, args []string) error {
+	fs := newAdminFlagSet("user create")
+	email := fs.String("email", "", "")
+	role := fs.String("role", "user", "")
+	generate := fs.Bool("generate-password", false, "")
+	if err := parseAdminFlags(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return fmt.Errorf("--email is required: %w", errAdminUsage)
+	}
+	if err := validateRole(*role); err != nil {
+		return err
+	}
+	password, err := a.password(*email, *generate)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	repo, done, err := a.repo()
+	if err != nil {
+		return err
+	}
+	defer done()
+	user, err := repo.CreateUser(ctx, User{Email: *email, PasswordHash: string(hash), Role: *role})
+	var conflict *ConflictError
+	if errors.As(translateDBError(err), &conflict) {
+		return errors.New(conflictMessage(conflict.Constraint))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Created user #%d %s (role %s)\n", user.ID, user.Email, user.Role)
+	if *generate {
+		fmt.Fprintf(a.Stdout, "Password: %s\n", password)
+	}
+	return nil
+}
+
+// findUserはメールアドレスでユーザーを探します。
+func findUser(ctx context.Context, repo *TodoRepository, email string) (User, error) {
+	if email == "" {
+		return User{}, fmt.Errorf("--email is required: %w", errAdminUsage)
+	}
+	user, err := repo.FindUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("user %s does not exist", email)
+	}
+	return user, err
+}
+
+func (a *AdminCLI) resetPassword(ctx context.Context, args []string) error {
+	fs := newAdminFlagSet("user reset-password")
+	email := fs.String("email", "", "")
+	generate := fs.Bool("generate-password", false, "")
+	if err := parseAdminFlags(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return fmt.Errorf("--email is required: %w", errAdminUsage)
+	}
+	password, err := a.password(*email, *generate)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	repo, done, err := a.repo()
+	if err != nil {
+		return err
+	}
+	defer done()
+	user, err := findUser(ctx, repo, *email)
+	if err != nil {
+		return err
+	}
+	if err := repo.UpdateUserPassword(ctx, user.ID, string(hash)); err != nil {
+		return err
+	}
+	// 古いパスワードで始めたセッションは使えなくする（サーバーは拒否リストの再読み込みで反映する）
+	revoked, err := repo.RevokeUserSessions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Reset the password of %s and revoked %d session(s)\n", user.Email, len(revoked))
+	if *generate {
+		fmt.Fprintf(a.Stdout, "Password: %s\n", password)
+	}
+	return nil
+}
+
+func (a *AdminCLI) setRole(ctx context.Context, args []string) error {
+	fs := newAdminFlagSet("user set-role")
+	email := fs.String("email", "", "")
+	role := fs.String("role", "", "")
+	if err := parseAdminFlags(fs, args); err != nil {
+		return err
+	}
+	if err := validateRole(*role); err != nil {
+		return err
+	}
+
+	repo, done, err := a.repo()
+	if err != nil {
+		return err
+	}
+	defer done()
+	user, err := findUser(ctx, repo, *email)
+	if err != nil {
+		return err
+	}
+	if user.Role == *role {
+		fmt.Fprintf(a.Stdout, "%s already has role %s\n", user.Email, user.Role)
+		return nil
+	}
+	if user.Role == "admin" {
+		// 最後の管理者を外すと、このコマンド以外で管理者を作れなくなる
+		admins, err := repo.CountUsersByRole(ctx, "admin")
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return fmt.Errorf("%s is the last admin", user.Email)
+		}
+	}
+	if err := repo.UpdateUserRole(ctx, user.ID, *role); err != nil {
+		return err
+	}
+	// JWTはロールを含むので、発行済みのセッションを取り消して新しいロールでログインし直させる
+	revoked, err := repo.RevokeUserSessions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Changed the role of %s from %s to %s and revoked %d session(s)\n", user.Email, user.Role, *role, len(revoked))
+	return nil
+}
+
+// rotateJWTSecretは新しいJWTの秘密鍵を作って表示します。秘密鍵は環境変数で渡すので、設定の入れ替えは運用者が行います。
+// 今の秘密鍵をJWT_PREVIOUS_SECRETに移しておけば、発行済みのJWTは期限切れ（最長でsessionTTL）まで使えます。
+// 漏洩したときは--revoke-sessionsで全セッションを取り消し、JWT_PREVIOUS_SECRETは設定しません。
+func (a *AdminCLI) rotateJWTSecret(ctx context.Context, args []string) error {
+	fs := newAdminFlagSet("jwt rotate")
+	revoke := fs.Bool("revoke-sessions", false, "")
+	if err := parseAdminFlags(fs, args); err != nil {
+		return err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "JWT_SECRET=%s\n", base64.RawURLEncoding.EncodeToString(b))
+
+	if !*revoke {
+		fmt.Fprintf(a.Stderr, "Set JWT_PREVIOUS_SECRET to the current JWT_SECRET and JWT_SECRET to the value above, then restart the servers.\n"+
+			"Tokens signed with the previous secret stay valid until they expire (%s); remove JWT_PREVIOUS_SECRET after that.\n", sessionTTL)
+		return nil
+	}
+	repo, done, err := a.repo()
+	if err != nil {
+		return err
+	}
+	defer done()
+	revoked, err := repo.RevokeAllSessions(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stderr, "Revoked %d session(s). Set JWT_SECRET to the value above without JWT_PREVIOUS_SECRET, then restart the servers.\n", len(revoked))
+	return nil
+}
+
+// checkDBはDBに接続でき、マイグレーションが最新まで適用済みで、管理者が1人以上いるかを確かめます。
+// どれかが満たされていなければ失敗します（デプロイ前の確認やヘルスチェック用）。
+func (a *AdminCLI) checkDB(ctx context.Context) error {
+	conn, err := a.OpenDB()
+	if err != nil {
+		fmt.Fprintf(a.Stdout, "connection  FAIL  %v\n", err)
+		return errors.New("database check failed")
+	}
+	defer conn.Close()
+	repo := NewTodoRepository(conn)
+	ok := true
+	report := func(name string, passed bool, format string, args ...any) {
+		status := "ok"
+		if !passed {
+			status, ok = "FAIL", false
+		}
+		fmt.Fprintf(a.Stdout, "%-10s  %-4s  %s\n", name, status, fmt.Sprintf(format, args...))
+	}
+
+	var serverVersion string
+	query, product := repo.dialect.ServerVersion()
+	if err := conn.QueryRowContext(ctx, query).Scan(&serverVersion); err != nil {
+		report("connection", false, "%v", err)
+		return errors.New("database check failed")
+	}
+	report("connection", true, "%s %s", product, serverVersion)
+
+	version, dirty, err := repo.SchemaVersion(ctx)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		report("migrations", false, "no migrations applied (want version %d)", requiredSchemaVersion)
+	case err != nil:
+		report("migrations", false, "%v", err)
+	case dirty:
+		report("migrations", false, "version %d is dirty; fix it and run migrate force", version)
+	case version < requiredSchemaVersion:
+		report("migrations", false, "version %d is behind %d; run migrate up", version, requiredSchemaVersion)
+	default:
+		report("migrations", true, "version %d", version)
+	}
+
+	admins, err := repo.CountUsersByRole(ctx, "admin")
+	switch {
+	case err != nil:
+		report("admins", false, "%v", err)
+	case admins == 0:
+		report("admins", false, "no admin users; run user create --role admin")
+	default:
+		report("admins", true, "%d admin user(s)", admins)
+	}
+
+	if !ok {
+		return errors.New("database check failed")
+	}
+	return nil
+}
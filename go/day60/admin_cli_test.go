@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminCLIUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"unknown"},
+		{"serve", "now"},
+		{"user"},
+		{"user", "create"},
+		{"user", "create", "--email", "a@example.com", "--role", "owner"},
+		{"user", "create", "--email", "not-an-email", "--generate-password"},
+		{"user", "reset-password"},
+		{"user", "set-role", "--email", "a@example.com"},
+		{"jwt", "rotate", "now"},
+		{"db", "check", "--verbose"},
+	} {
+		var stderr bytes.Buffer
+		cli := &AdminCLI{
+			Stdin:  strings.NewReader("password123\n"),
+			Stdout: &bytes.Buffer{},
+			Stderr: &stderr,
+			// 使い方の誤りはDBに接続する前に見つける
+			OpenDB: func() (*sql.DB, error) {
+				t.Errorf("%v: connected to the database", args)
+				return nil, errors.New("unexpected")
+			},
+		}
+		assert.Equal(t, 2, cli.Run(args), "%v", args)
+		assert.Contains(t, stderr.String(), "Usage: server", "%v", args)
+	}
+
+	// パスワードの条件はサインアップと同じ
+	var stderr bytes.Buffer
+	cli := &AdminCLI{Stdin: strings.NewReader("short\n"), Stdout: &bytes.Buffer{}, Stderr: &stderr}
+	assert.Equal(t, 2, cli.Run([]string{"user", "create", "--email", "a@example.com"}))
+	assert.Contains(t, stderr.String(), "'min' tag")
+}
+
+func TestAdminCLIServeByDefault(t *testing.T) {
+	served := 0
+	cli := &AdminCLI{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}, Serve: func() { served++ }}
+	assert.Equal(t, 0, cli.Run(nil))
+	assert.Equal(t, 0, cli.Run([]string{"serve"}))
+	assert.Equal(t, 2, served)
+}
+
+func TestRotateJWTSecret(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	cli := &AdminCLI{Stdout: &stdout, Stderr: &stderr}
+	assert.Equal(t, 0, cli.Run([]string{"jwt", "rotate"}))
+	secret, ok := strings.CutPrefix(strings.TrimSpace(stdout.String()), "JWT_SECRET=")
+	if assert.True(t, ok, stdout.String()) {
+		b, err := base64.RawURLEncoding.DecodeString(secret)
+		assert.NoError(t, err)
+		assert.Len(t, b, 32)
+	}
+	assert.Contains(t, stderr.String(), "JWT_PREVIOUS_SECRET")
+}
+
+func TestPreviousJWTSecret(t *testing.T) {
+	defer func(current, previous []byte) { jwtSecret, jwtPreviousSecret = current, previous }(jwtSecret, jwtPreviousSecret)
+	sessions := NewSessionRegistry(nil, time.Minute)
+	user := User{ID: 7, Role: "user"}
+
+	jwtSecret = []byte("old-secret")
+	token, err := issueToken(user, "session-a", time.Now().Add(time.Hour))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// 入れ替えた後も、前の秘密鍵を設定している間は発行済みのJWTを受け付ける
+	jwtSecret, jwtPreviousSecret = []byte("new-secret"), []byte("old-secret")
+	_, err = authenticate(context.Background(), nil, sessions, "Bearer "+token)
+	assert.NoError(t, err)
+	fresh, err := issueToken(user, "session-b", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	_, err = authenticate(context.Background(), nil, sessions, "Bearer "+fresh)
+	assert.NoError(t, err)
+
+	jwtPreviousSecret = nil
+	_, err = authenticate(context.Background(), nil, sessions, "Bearer "+token)
+	var authErr *AuthError
+	assert.ErrorAs(t, err, &authErr)
+}
+
+// requiredSchemaVersionをマイグレーションの追加に合わせて更新し忘れないように確かめる
+// SQLite用のマイグレーションも同じバージョンまでそろっていなければならない
+func TestRequiredSchemaVersion(t *testing.T) {
+	for _, dir := range []string{"../db/migrations", "sqlite_migrations"} {
+		entries, err := os.ReadDir(dir)
+		if !assert.NoError(t, err) {
+			return
+		}
+		latest := 0
+		for _, e := range entries {
+			prefix, _, _ := strings.Cut(e.Name(), "_")
+			if v, err := strconv.Atoi(prefix); err == nil {
+				latest = max(latest, v)
+			}
+		}
+		assert.Equal(t, latest, requiredSchemaVersion, dir)
+	}
+}
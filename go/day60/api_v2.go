@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// /api/v2のTODOはv1と同じリポジトリのメソッドを使い、表現（DTO）だけを変えています。
+// v1のTodoとの違い:
+//   - nameはtitle、user_idはowner_id
+//   - completed（真偽値）はstatus（open/done）
+//   - tagsはタグ名の配列
+//   - recurrenceは繰り返さないTODOでもnullとして常に含む
+//   - 一覧はページ分けしたオブジェクト（gRPCのListTodosと同じページトークン）
+
+const (
+	TodoStatusOpen = "open"
+	TodoStatusDone = "done"
+)
+
+// TodoV2は/api/v2のTODOの表現です。
+type TodoV2 struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Status     string     `json:"status"`
+	OwnerID    int        `json:"owner_id"`
+	ListID     int        `json:"list_id"`
+	ParentID   *int       `json:"parent_id"`
+	DueAt      *time.Time `json:"due_at"`
+	Recurrence *string    `json:"recurrence"`
+	Tags       []string   `json:"tags"`
+}
+
+// TodoPageV2はGET /api/v2/todosのレスポンスです。next_page_tokenは次のページがあるときだけ含みます。
+type TodoPageV2 struct {
+	Items         []TodoV2 `json:"items"`
+	NextPageToken string   `json:"next_page_token,omitempty"`
+}
+
+// CreateTodoV2InputはPOST /api/v2/todosのリクエストです。
+type CreateTodoV2Input struct {
+	Title      string     `json:"title" binding:"required"`
+	ListID     int        `json:"list_id"`
+	ParentID   *int       `json:"parent_id"`
+	DueAt      *time.Time `json:"due_at"`
+	Recurrence string     `json:"recurrence"`
+}
+
+// UpdateTodoV2InputはPUT /api/v2/todos/:idのリクエストです。v1と同じく、due_atを省略すると期限を外します。
+type UpdateTodoV2Input struct {
+	Title string     `json:"title" binding:"required"`
+	DueAt *time.Time `json:"due_at"`
+}
+
+// todoToV2はTodoを/api/v2の表現に変換します。
+func todoToV2(t Todo) TodoV2 {
+	v := TodoV2{
+		ID:       t.ID,
+		Title:    t.Name,
+		Status:   TodoStatusOpen,
+		OwnerID:  t.UserID,
+		ListID:   t.ListID,
+		ParentID: t.ParentID,
+		DueAt:    t.DueAt,
+		Tags:     make([]string, 0, len(t.Tags)),
+	}
+	if t.Completed {
+		v.Status = TodoStatusDone
+	}
+	if t.Recurrence != "" {
+		recurrence := t.Recurrence
+		v.Recurrence = &recurrence
+	}
+	for _, tag := range t.Tags {
+		v.Tags = append(v.Tags, tag.Name)
+	}
+	return v
+}
+
+// toTodoは作成のリクエストをTodoに変換します。繰り返し規則は検証して正規化した形にします。
+func (in CreateTodoV2Input) toTodo(userID int) (Todo, error) {
+	t := Todo{Name: in.Title, UserID: userID, ListID: in.ListID, ParentID: in.ParentID, DueAt: in.DueAt}
+	if in.Recurrence != "" {
+		rule, err := ParseRecurrenceRule(in.Recurrence)
+		if err != nil {
+			return Todo{}, err
+		}
+		t.Recurrence = rule.String()
+	}
+	return t, nil
+}
+
+// TodoV2Handlerは/api/v2/todosのハンドラです。
+type TodoV2Handler struct {
+	repo *TodoRepository
+}
+
+func NewTodoV2Handler(repo *TodoRepository) *TodoV2Handler {
+	return &TodoV2Handler{repo: repo}
+}
+
+// getTodosはTODOをID順にページ分けして返します。
+// 絞り込み（tag・tag_match・list_id）はv1と同じで、page_sizeとpage_tokenでページを選びます。
+func (h *TodoV2Handler) getTodos(c *gin.Context) error {
+	filter := TodoFilter{
+		Tags:     c.QueryArray("tag"),
+		TagMatch: c.DefaultQuery("tag_match", TagMatchAny),
+	}
+	if filter.TagMatch != TagMatchAny && filter.TagMatch != TagMatchAll {
+		return fmt.Errorf("%w: tag_match must be %q or %q", ErrInvalidInput, TagMatchAny, TagMatchAll)
+	}
+	listID, err := optionalIDQuery(c, "list_id")
+	if err != nil {
+		return err
+	}
+	filter.ListID = listID
+
+	pageSize := defaultPageSize
+	if value := c.Query("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize <= 0 {
+			return fmt.Errorf("%w: page_size must be a positive integer", ErrInvalidInput)
+		}
+		pageSize = min(pageSize, maxPageSize)
+	}
+	if token := c.Query("page_token"); token != "" {
+		if filter.AfterID, err = decodePageToken(token); err != nil {
+			return err
+		}
+	}
+	// 1件多く読んで、次のページがあるかを確かめる
+	filter.Limit = pageSize + 1
+
+	todos, err := h.repo.FindAll(c.Request.Context(), currentUserID(c), filter)
+	if err != nil {
+		return err
+	}
+	page := TodoPageV2{Items: make([]TodoV2, 0, len(todos))}
+	if len(todos) > pageSize {
+		todos = todos[:pageSize]
+		page.NextPageToken = encodePageToken(todos[len(todos)-1].ID)
+	}
+	for _, t := range todos {
+		page.Items = append(page.Items, todoToV2(t))
+	}
+	c.JSON(http.StatusOK, page)
+	return nil
+}
+
+func (h *TodoV2Handler) createTodo(c *gin.Context) error {
+	var input CreateTodoV2Input
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	todo, err := input.toTodo(currentUserID(c))
+	if err != nil {
+		return err
+	}
+	created, err := h.repo.CreateTodoWithAudit(c.Request.Context(), todo)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, todoToV2(created))
+	return nil
+}
+
+func (h *TodoV2Handler) getTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	todo, err := h.repo.FindTodo(c.Request.Context(), currentUserID(c), id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, todoToV2(todo))
+	return nil
+}
+
+func (h *TodoV2Handler) updateTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input UpdateTodoV2Input
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	userID := currentUserID(c)
+	if _, err := h.repo.UpdateTodoWithAudit(c.Request.Context(), userID, Todo{ID: id, Name: input.Title, DueAt: input.DueAt}); err != nil {
+		return err
+	}
+	todo, err := h.repo.FindTodo(c.Request.Context(), userID, id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, todoToV2(todo))
+	return nil
+}
+
+func (h *TodoV2Handler) deleteTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DeleteTodoWithAudit(c.Request.Context(), currentUserID(c), id); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
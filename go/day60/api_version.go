@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIDeprecationは非推奨にしたルートで告知する内容です。ゼロの項目のヘッダーは付けません。
+type APIDeprecation struct {
+	// Sinceは非推奨にした日時（Deprecationヘッダー、RFC 9745）
+	Since time.Time
+	// Sunsetは提供を終える予定の日時（Sunsetヘッダー、RFC 8594）
+	Sunset time.Time
+}
+
+// parseOptionalDateは日付（2006-01-02、UTCの0時）またはRFC 3339の日時を読み取ります。空ならゼロ値です。
+func parseOptionalDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// deprecatedRouteは非推奨のルートにDeprecation・Sunsetヘッダーと、後継のバージョンのURLを示すLinkヘッダーを付けます。
+// 後継のURLはパスのfromをtoに置き換えたものです（/api/v1/todos/1 → /api/v2/todos/1）。
+func deprecatedRoute(dep APIDeprecation, from, to string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !dep.Since.IsZero() {
+			c.Header("Deprecation", fmt.Sprintf("@%d", dep.Since.Unix()))
+		}
+		if !dep.Sunset.IsZero() {
+			c.Header("Sunset", dep.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if successor, ok := strings.CutPrefix(c.Request.URL.Path, from); ok {
+			c.Header("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, to, successor))
+		}
+		c.Next()
+	}
+}
+
+// APIUsageはAPIのバージョンごとの利用状況を数えます。v1をいつ廃止できるかの判断に使います。
+// 数はこのプロセスが起動してからのものです（再起動で0に戻り、複数台ならそれぞれで数えます）。
+type APIUsage struct {
+	mu       sync.Mutex
+	since    time.Time
+	versions map[string]*versionUsage
+}
+
+type versionUsage struct {
+	requests int64
+	last     time.Time
+	users    map[int]struct{}
+	routes   map[string]int64
+}
+
+func NewAPIUsage() *APIUsage {
+	return &APIUsage{since: time.Now(), versions: map[string]*versionUsage{}}
+}
+
+// recordはversionへのリクエストを1件数えます。userIDが0なら利用者には数えません。
+func (u *APIUsage) record(version, route string, userID int, at time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	v, ok := u.versions[version]
+	if !ok {
+		v = &versionUsage{users: map[int]struct{}{}, routes: map[string]int64{}}
+		u.versions[version] = v
+	}
+	v.requests++
+	v.last = at
+	if userID != 0 {
+		v.users[userID] = struct{}{}
+	}
+	v.routes[route]++
+}
+
+// middlewareはグループのルートへのリクエストをversionの利用として数えます。
+// 認証に失敗したリクエストも数えるので、認証ミドルウェアより前に置きます（ユーザーはハンドラの後で読む）。
+func (u *APIUsage) middleware(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		userID := 0
+		if p, ok := c.Get(principalKey); ok {
+			userID = p.(*Principal).UserID
+		}
+		u.record(version, c.Request.Method+" "+c.FullPath(), userID, time.Now())
+	}
+}
+
+// RouteUsageはルートごとのリクエスト数です。
+type RouteUsage struct {
+	Route    string `json:"route"`
+	Requests int64  `json:"requests"`
+}
+
+// VersionUsageは1つのバージョンの利用状況です。
+type VersionUsage struct {
+	Version       string       `json:"version"`
+	Requests      int64        `json:"requests"`
+	Users         int          `json:"users"`
+	LastRequestAt time.Time    `json:"last_request_at"`
+	Routes        []RouteUsage `json:"routes"`
+}
+
+// APIUsageReportはGET /api/v1/admin/api-usageのレスポンスです。
+type APIUsageReport struct {
+	Since    time.Time      `json:"since"`
+	Versions []VersionUsage `json:"versions"`
+}
+
+// reportは数えた結果を返します。バージョンは名前順、ルートはリクエスト数の多い順です。
+func (u *APIUsage) report() APIUsageReport {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	report := APIUsageReport{Since: u.since, Versions: []VersionUsage{}}
+	for name, v := range u.versions {
+		usage := VersionUsage{Version: name, Requests: v.requests, Users: len(v.users), LastRequestAt: v.last, Routes: []RouteUsage{}}
+		for route, n := range v.routes {
+			usage.Routes = append(usage.Routes, RouteUsage{Route: route, Requests: n})
+		}
+		sort.Slice(usage.Routes, func(i, j int) bool {
+			if usage.Routes[i].Requests != usage.Routes[j].Requests {
+				return usage.Routes[i].Requests > usage.Routes[j].Requests
+			}
+			return usage.Routes[i].Route < usage.Routes[j].Route
+		})
+		report.Versions = append(report.Versions, usage)
+	}
+	sort.Slice(report.Versions, func(i, j int) bool { return report.Versions[i].Version < report.Versions[j].Version })
+	return report
+}
+
+func (u *APIUsage) getReport(c *gin.Context) error {
+	c.JSON(http.StatusOK, u.report())
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecatedRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	dep := APIDeprecation{Since: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), Sunset: time.Date(2027, 5, 1, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60))}
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/v1/todos/:id", deprecatedRoute(dep, "/api/v1", "/api/v2"), ok)
+	router.GET("/api/v1/undated", deprecatedRoute(APIDeprecation{}, "/api/v1", "/api/v2"), ok)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/todos/42?x=1", nil))
+	assert.Equal(t, "@1793491200", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Sat, 01 May 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</api/v2/todos/42>; rel="successor-version"`, w.Header().Get("Link"))
+
+	// 日時を設定していなければ後継のURLだけを示す
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/undated", nil))
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, w.Header().Get("Sunset"))
+	assert.Equal(t, `</api/v2/undated>; rel="successor-version"`, w.Header().Get("Link"))
+}
+
+func TestParseOptionalDate(t *testing.T) {
+	d, err := parseOptionalDate("2027-05-01")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2027, 5, 1, 0, 0, 0, 0, time.UTC), d)
+	d, err = parseOptionalDate("2027-05-01T09:00:00+09:00")
+	assert.NoError(t, err)
+	assert.True(t, d.Equal(time.Date(2027, 5, 1, 0, 0, 0, 0, time.UTC)))
+	d, err = parseOptionalDate("")
+	assert.NoError(t, err)
+	assert.True(t, d.IsZero())
+	_, err = parseOptionalDate("next year")
+	assert.Error(t, err)
+}
+
+func TestAPIUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	usage := NewAPIUsage()
+	router := gin.New()
+	v1 := router.Group("/api/v1", usage.middleware("v1"), func(c *gin.Context) {
+		// 認証ミドルウェアの代わり。ヘッダーが無ければ401で止める
+		if c.GetHeader("X-User") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set(principalKey, &Principal{UserID: len(c.GetHeader("X-User"))})
+	})
+	v1.GET("/todos", func(c *gin.Context) { c.Status(http.StatusOK) })
+	v1.GET("/tags", func(c *gin.Context) { c.Status(http.StatusOK) })
+	v2 := router.Group("/api/v2", usage.middleware("v2"))
+	v2.GET("/todos", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, req := range []struct{ path, user string }{
+		{"/api/v1/todos", "a"},
+		{"/api/v1/todos", "bb"},
+		{"/api/v1/todos", ""},
+		{"/api/v1/tags", "a"},
+		{"/api/v2/todos", ""},
+		{"/api/v1/missing", "a"},
+	} {
+		r := httptest.NewRequest("GET", req.path, nil)
+		if req.user != "" {
+			r.Header.Set("X-User", req.user)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	report := usage.report()
+	if !assert.Len(t, report.Versions, 2) {
+		return
+	}
+	v1Usage := report.Versions[0]
+	assert.Equal(t, "v1", v1Usage.Version)
+	// 認証に失敗したリクエストも数え、存在しないルートは数えない
+	assert.Equal(t, int64(4), v1Usage.Requests)
+	assert.Equal(t, 2, v1Usage.Users)
+	assert.Equal(t, []RouteUsage{{"GET /api/v1/todos", 3}, {"GET /api/v1/tags", 1}}, v1Usage.Routes)
+	assert.Equal(t, "v2", report.Versions[1].Version)
+	assert.Equal(t, int64(1), report.Versions[1].Requests)
+	assert.Equal(t, 0, report.Versions[1].Users)
+}
+
+func TestTodoToV2(t *testing.T) {
+	parentID := 3
+	due := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	v := todoToV2(Todo{
+		ID: 5, Name: "買い物", UserID: 7, ListID: 2, ParentID: &parentID, Completed: true, DueAt: &due,
+		Recurrence: "FREQ=DAILY", Tags: []Tag{{ID: 1, Name: "home"}, {ID: 2, Name: "errands"}},
+	})
+	assert.Equal(t, 5, v.ID)
+	assert.Equal(t, "買い物", v.Title)
+	assert.Equal(t, TodoStatusDone, v.Status)
+	assert.Equal(t, 7, v.OwnerID)
+	assert.Equal(t, 2, v.ListID)
+	assert.Equal(t, &parentID, v.ParentID)
+	assert.Equal(t, &due, v.DueAt)
+	if assert.NotNil(t, v.Recurrence) {
+		assert.Equal(t, "FREQ=DAILY", *v.Recurrence)
+	}
+	assert.Equal(t, []string{"home", "errands"}, v.Tags)
+
+	v = todoToV2(Todo{ID: 6, Name: "x"})
+	assert.Equal(t, TodoStatusOpen, v.Status)
+	assert.Nil(t, v.Recurrence)
+	assert.Equal(t, []string{}, v.Tags)
+}
+
+func TestCreateTodoV2InputToTodo(t *testing.T) {
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	todo, err := CreateTodoV2Input{Title: "定例", ListID: 2, DueAt: &due, Recurrence: "freq=weekly;byday=mo"}.toTodo(7)
+	assert.NoError(t, err)
+	assert.Equal(t, Todo{Name: "定例", UserID: 7, ListID: 2, DueAt: &due, Recurrence: "FREQ=WEEKLY;BYDAY=MO"}, todo)
+
+	_, err = CreateTodoV2Input{Title: "x", Recurrence: "FREQ=HOURLY"}.toTodo(7)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 添付ファイルの既定の制限
+const (
+	defaultAttachmentMaxSize = 10 << 20  // 1ファイルの上限（10 MB）
+	defaultAttachmentQuota   = 100 << 20 // ユーザーごとの合計の上限（100 MB）
+	defaultAttachmentURLTTL  = 15 * time.Minute
+	maxAttachmentNameLength  = 255
+)
+
+// allowedAttachmentTypesは添付できるファイルの種類です。中身から判定した値で判断します。
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// AttachmentLimitsは添付ファイルの制限です。0の項目は既定値を使います。
+type AttachmentLimits struct {
+	MaxSize int64         // 1ファイルの上限（バイト）
+	Quota   int64         // ユーザーごとの合計の上限（バイト）
+	URLTTL  time.Duration // ダウンロード用URLの有効期間
+}
+
+// AttachmentHandlerはTODOの添付ファイルを扱います。
+type AttachmentHandler struct {
+	repo   *TodoRepository
+	blobs  BlobStore
+	limits AttachmentLimits
+}
+
+func NewAttachmentHandler(repo *TodoRepository, blobs BlobStore, limits AttachmentLimits) *AttachmentHandler {
+	if limits.MaxSize == 0 {
+		limits.MaxSize = defaultAttachmentMaxSize
+	}
+	if limits.Quota == 0 {
+		limits.Quota = defaultAttachmentQuota
+	}
+	if limits.URLTTL == 0 {
+		limits.URLTTL = defaultAttachmentURLTTL
+	}
+	return &AttachmentHandler{repo: repo, blobs: blobs, limits: limits}
+}
+
+// uploadAttachmentはmultipart/form-dataのfileフィールドのファイルをTODOに添付します。
+// Content-Typeはクライアントの申告値ではなく中身から判定し、画像・PDF・テキスト以外は受け付けません。
+func (h *AttachmentHandler) uploadAttachment(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	tooLarge := fmt.Errorf("%w: file must be at most %d MB", ErrTooLarge, h.limits.MaxSize>>20)
+	// multipartの境界やヘッダの分として少し余裕を持たせる
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.limits.MaxSize+64<<10)
+	header, err := c.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return tooLarge
+	}
+	if err != nil {
+		return fmt.Errorf("%w: file is required", ErrInvalidInput)
+	}
+	if header.Size > h.limits.MaxSize {
+		return tooLarge
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !allowedAttachmentTypes[mediaType] {
+		return fmt.Errorf("%w: unsupported file type %s", ErrInvalidInput, mediaType)
+	}
+
+	userID := currentUserID(c)
+	if err := h.repo.CheckAttachmentUpload(c.Request.Context(), userID, todoID, header.Size, h.limits.Quota); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("todos/%d/%s", todoID, uuid.NewString())
+	ctx := c.Request.Context()
+	if err := h.blobs.Put(ctx, key, io.MultiReader(bytes.NewReader(head), f), header.Size, contentType); err != nil {
+		return err
+	}
+	attachment, err := h.repo.CreateAttachment(ctx, Attachment{
+		TodoID:      todoID,
+		UserID:      userID,
+		Filename:    attachmentName(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		BlobKey:     key,
+	}, h.limits.Quota)
+	if err != nil {
+		// 登録できなかったファイルはどこからも参照されないので消しておく
+		if delErr := h.blobs.Delete(ctx, key); delErr != nil {
+			log.Printf("Failed to delete orphaned blob %s: %v", key, delErr)
+		}
+		return err
+	}
+	if err := h.sign(&attachment); err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, attachment)
+	return nil
+}
+
+// getAttachmentsはTODOの添付ファイルの一覧を、それぞれのダウンロード用URL付きで返します。
+func (h *AttachmentHandler) getAttachments(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	attachments, err := h.repo.FindAttachments(c.Request.Context(), currentUserID(c), todoID)
+	if err != nil {
+		return err
+	}
+	for i := range attachments {
+		if err := h.sign(&attachments[i]); err != nil {
+			return err
+		}
+	}
+	c.JSON(http.StatusOK, attachments)
+	return nil
+}
+
+// getAttachmentは添付ファイルを1件、ダウンロード用URL付きで返します。URLの期限が切れたら取り直します。
+func (h *AttachmentHandler) getAttachment(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	id, err := idParam(c, "attachmentId")
+	if err != nil {
+		return err
+	}
+	attachment, err := h.repo.FindAttachment(c.Request.Context(), currentUserID(c), todoID, id)
+	if err != nil {
+		return err
+	}
+	if err := h.sign(&attachment); err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, attachment)
+	return nil
+}
+
+func (h *AttachmentHandler) deleteAttachment(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	id, err := idParam(c, "attachmentId")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DeleteAttachment(c.Request.Context(), currentUserID(c), todoID, id); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// signは添付ファイルに期限付きのダウンロード用URLを付けます。
+func (h *AttachmentHandler) sign(a *Attachment) error {
+	expiresAt := time.Now().Add(h.limits.URLTTL)
+	url, err := h.blobs.SignedURL(a.BlobKey, a.Filename, a.ContentType, h.limits.URLTTL)
+	if err != nil {
+		return err
+	}
+	a.DownloadURL = url
+	a.URLExpiresAt = &expiresAt
+	return nil
+}
+
+// attachmentNameはアップロードされたファイル名からディレクトリ部分と制御文字を取り除きます。
+func attachmentName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	for utf8.RuneCountInString(name) > maxAttachmentNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// serveBlobはLocalBlobStoreの署名付きURLのダウンロードを処理します。認証の代わりに署名と期限を検証します。
+func serveBlob(store *LocalBlobStore) AppHandler {
+	return func(c *gin.Context) error {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		dl, err := store.Verify(key, c.Request.URL.Query())
+		if err != nil {
+			return err
+		}
+		c.Header("Content-Type", dl.ContentType)
+		c.Header("Content-Disposition", contentDisposition(dl.Filename))
+		// ブラウザに中身から種類を推測させない（アップロードされたHTMLなどを実行させないため）
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "private, no-store")
+		c.File(dl.Path)
+		return nil
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AttachmentはTODOの添付ファイルです。中身はBlobStoreのBlobKeyに置かれています。
+type Attachment struct {
+	ID          int       `json:"id"`
+	TodoID      int       `json:"todo_id"`
+	UserID      int       `json:"user_id"` // アップロードしたユーザー
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	BlobKey     string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	// DownloadURLは期限付きのダウンロード用URL（URLExpiresAtまで有効）
+	DownloadURL  string     `json:"download_url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+const attachmentColumns = "id, todo_id, user_id, filename, content_type, size_bytes, blob_key, created_at"
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.TodoID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.BlobKey, &a.CreatedAt)
+	return a, err
+}
+
+// checkAttachmentQuotaはユーザーがsizeバイトを追加しても容量の上限（quota）を超えないかを確認します。
+func checkAttachmentQuota(ctx context.Context, q querier, userID int, size, quota int64) error {
+	var used int64
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(SUM(size_bytes), 0) FROM attachments WHERE user_id = $1", userID).Scan(&used)
+	if err != nil {
+		return err
+	}
+	if used+size > quota {
+		return fmt.Errorf("%w: storage quota exceeded (%d of %d bytes used)", ErrTooLarge, used, quota)
+	}
+	return nil
+}
+
+// CheckAttachmentUploadはアップロードの前に、TODOのeditor以上であることと容量の上限を確認します。
+// BlobStoreへの書き込みを無駄にしないための事前確認で、最終的な確認はCreateAttachmentが行います。
+func (r *TodoRepository) CheckAttachmentUpload(ctx context.Context, userID, todoID int, size, quota int64) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleEditor); err != nil {
+		return err
+	}
+	return checkAttachmentQuota(ctx, r.db, userID, size, quota)
+}
+
+// CreateAttachmentはBlobStoreに保存済みのファイルを添付ファイルとして登録し、監査ログを記録します。
+// 同じユーザーの同時アップロードで容量の上限を超えないよう、ユーザーの行をロックしてから確認します。
+func (r *TodoRepository) CreateAttachment(ctx context.Context, a Attachment, quota int64) (Attachment, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		if _, err := requireTodoRole(ctx, tx, a.TodoID, a.UserID, RoleEditor); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", a.UserID); err != nil {
+			return err
+		}
+		if err := checkAttachmentQuota(ctx, tx, a.UserID, a.Size, quota); err != nil {
+			return err
+		}
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO attachments (todo_id, user_id, filename, content_type, size_bytes, blob_key)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at`,
+			a.TodoID, a.UserID, a.Filename, a.ContentType, a.Size, a.BlobKey).Scan(&a.ID, &a.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return insertAuditLog(ctx, tx, a.TodoID, "attach", map[string]any{"attachment_id": a.ID, "filename": a.Filename})
+	})
+	return a, err
+}
+
+// FindAttachmentsはTODOの添付ファイルを古い順に返します。リストのメンバーなら閲覧できます。
+func (r *TodoRepository) FindAttachments(ctx context.Context, userID, todoID int) ([]Attachment, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleViewer); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE todo_id = $1 ORDER BY id", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// FindAttachmentはTODOの添付ファイルを1件返します。
+func (r *TodoRepository) FindAttachment(ctx context.Context, userID, todoID, id int) (Attachment, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleViewer); err != nil {
+		return Attachment{}, err
+	}
+	a, err := scanAttachment(r.db.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = $1 AND todo_id = $2", id, todoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrNotFound
+	}
+	return a, err
+}
+
+// DeleteAttachmentは添付ファイルを削除し、監査ログを記録します。リストのeditor以上が実行できます。
+// BlobStoreの中身はトリガーでblob_deletionsに積まれ、パージジョブが削除します。
+func (r *TodoRepository) DeleteAttachment(ctx context.Context, userID, todoID, id int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		if _, err := requireTodoRole(ctx, tx, todoID, userID, RoleEditor); err != nil {
+			return err
+		}
+		var filename string
+		err := tx.QueryRowContext(ctx, "DELETE FROM attachments WHERE id = $1 AND todo_id = $2 RETURNING filename", id, todoID).Scan(&filename)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return insertAuditLog(ctx, tx, todoID, "detach", map[string]any{"attachment_id": id, "filename": filename})
+	})
+}
+
+// BlobDeletionはBlobStoreから削除を待っているBLOBです。
+type BlobDeletion struct {
+	ID  int
+	Key string
+}
+
+// FindBlobDeletionsは削除を待っているBLOBを古い順にlimit件まで返します。
+func (r *TodoRepository) FindBlobDeletions(ctx context.Context, limit int) ([]BlobDeletion, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT id, blob_key FROM blob_deletions ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []BlobDeletion
+	for rows.Next() {
+		var d BlobDeletion
+		if err := rows.Scan(&d.ID, &d.Key); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+// CompleteBlobDeletionsはBlobStoreから削除したBLOBを削除待ちから外します。
+func (r *TodoRepository) CompleteBlobDeletions(ctx context.Context, ids []int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "DELETE FROM blob_deletions WHERE id = ANY($1)", ids)
+	return err
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlobStoreは添付ファイルの中身を置く場所です。
+// 実装は環境変数BLOB_STOREで選びます（local / s3）。
+type BlobStore interface {
+	// Putはkeyにsizeバイトの中身を保存します。
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Deleteはkeyの中身を削除します。既に無い場合もエラーにしません。
+	Delete(ctx context.Context, key string) error
+	// SignedURLはttlの間だけ有効なダウンロード用URLを返します。ダウンロード時のファイル名はfilenameになります。
+	SignedURL(key, filename, contentType string, ttl time.Duration) (string, error)
+}
+
+// newBlobStoreFromEnvは環境変数の設定からBlobStoreを作成します。
+// ローカルの署名付きURLの署名にはsecretを使います。
+func newBlobStoreFromEnv(secret []byte) (BlobStore, error) {
+	switch kind := getEnv("BLOB_STORE", "local"); kind {
+	case "local":
+		return NewLocalBlobStore(getEnv("BLOB_DIR", "data/blobs"), getEnv("PUBLIC_BASE_URL", ""), secret)
+	case "s3":
+		bucket := getEnv("S3_BUCKET", "")
+		if bucket == "" {
+			return nil, fmt.Errorf("S3_BUCKET is required for BLOB_STORE=s3")
+		}
+		pathStyle, err := strconv.ParseBool(getEnv("S3_PATH_STYLE", "false"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PATH_STYLE: %w", err)
+		}
+		return NewS3BlobStore(S3Config{
+			Endpoint:        getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:          getEnv("S3_REGION", "us-east-1"),
+			Bucket:          bucket,
+			AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+			PathStyle:       pathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", kind)
+	}
+}
+
+// errBlobSignatureは署名付きURLの署名が不正、または期限切れであることを表します。
+var errBlobSignature = fmt.Errorf("%w: invalid or expired download link", ErrForbidden)
+
+// LocalBlobStoreはローカルのディレクトリにファイルを置くBlobStoreです。開発環境とテスト向けです。
+// 署名付きURLは/blobs/<key>?expires=...&sig=...の形で、ServeBlobが署名を検証して中身を返します。
+type LocalBlobStore struct {
+	dir     string
+	baseURL string // 署名付きURLの前に付けるURL（空ならパスだけを返す）
+	secret  []byte
+	now     func() time.Time
+}
+
+func NewLocalBlobStore(dir, baseURL string, secret []byte) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), secret: secret, now: time.Now}, nil
+}
+
+// pathはkeyのファイルのパスを返します。keyがディレクトリの外を指す場合はエラーです。
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("%w: invalid blob key", ErrInvalidInput)
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: invalid blob key", ErrInvalidInput)
+	}
+	return filepath.Join(s.dir, cleaned), nil
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	// 書き込み途中のファイルが見えないよう、一時ファイルに書いてからリネームする
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("blob %s: wrote %d bytes, expected %d", key, n, size)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) SignedURL(key, filename, contentType string, ttl time.Duration) (string, error) {
+	expires := strconv.FormatInt(s.now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("name", filename)
+	q.Set("type", contentType)
+	q.Set("sig", s.sign(key, expires, filename, contentType))
+	return s.baseURL + "/blobs/" + key + "?" + q.Encode(), nil
+}
+
+func (s *LocalBlobStore) sign(key, expires, filename, contentType string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	io.WriteString(mac, strings.Join([]string{key, expires, filename, contentType}, "\n"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BlobDownloadは署名を検証したダウンロードの内容です。
+type BlobDownload struct {
+	Path        string
+	Filename    string
+	ContentType string
+}
+
+// Verifyは署名付きURLのクエリを検証し、返すファイルを決めます。署名が不正または期限切れならerrBlobSignatureです。
+func (s *LocalBlobStore) Verify(key string, q url.Values) (BlobDownload, error) {
+	expires, filename, contentType := q.Get("expires"), q.Get("name"), q.Get("type")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || s.now().Unix() > unix {
+		return BlobDownload{}, errBlobSignature
+	}
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(s.sign(key, expires, filename, contentType))) {
+		return BlobDownload{}, errBlobSignature
+	}
+	path, err := s.path(key)
+	if err != nil {
+		return BlobDownload{}, err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return BlobDownload{}, ErrNotFound
+	}
+	return BlobDownload{Path: path, Filename: filename, ContentType: contentType}, nil
+}
+
+// S3ConfigはS3互換ストレージへの接続設定です。
+type S3Config struct {
+	Endpoint        string // 例: https://s3.amazonaws.com, http://localhost:9000（MinIO）
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyleがtrueならURLを<endpoint>/<bucket>/<key>にする（MinIOなど）。falseなら<bucket>.<endpointのホスト>/<key>
+	PathStyle bool
+}
+
+// S3BlobStoreはS3互換のオブジェクトストレージにファイルを置くBlobStoreです。
+// SDKには依存せず、リクエストにAWS Signature Version 4で署名します。
+type S3BlobStore struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3BlobStore(cfg S3Config) (*S3BlobStore, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	return &S3BlobStore{cfg: cfg, endpoint: endpoint, client: &http.Client{Timeout: time.Minute}, now: time.Now}, nil
+}
+
+// objectURLはkeyのオブジェクトのURLを返します。
+func (s *S3BlobStore) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	escaped := s3EscapePath(key)
+	if s.cfg.PathStyle {
+		prefix := strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket
+		u.Path = prefix + "/" + key
+		u.RawPath = prefix + "/" + escaped
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escaped
+	}
+	return &u
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	return s.do(req, http.StatusOK)
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	// S3は存在しないオブジェクトの削除にも204を返す
+	return s.do(req, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
+
+// doはリクエストに署名して送り、okのいずれでもないステータスならエラーを返します。
+func (s *S3BlobStore) do(req *http.Request, ok ...int) error {
+	s.signRequest(req, s.now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// s3UnsignedPayloadは本文のハッシュを署名に含めないことを表すx-amz-content-sha256の値です（本文をストリームで送るため）。
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// signRequestはリクエストにAuthorizationヘッダで署名します。
+func (s *S3BlobStore) signRequest(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	signedHeaders, canonicalHeaders := canonicalS3Headers(headers)
+	scope := s.scope(now)
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalS3Query(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+	signature := s.signature(now, scope, canonical)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func (s *S3BlobStore) SignedURL(key, filename, contentType string, ttl time.Duration) (string, error) {
+	return s.presign(key, filename, contentType, ttl, s.now()), nil
+}
+
+// presignはクエリ文字列で署名したGETのURLを返します。
+func (s *S3BlobStore) presign(key, filename, contentType string, ttl time.Duration, now time.Time) string {
+	u := s.objectURL(key)
+	scope := s.scope(now)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", now.UTC().Format("20060102T150405Z"))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if filename != "" {
+		q.Set("response-content-disposition", contentDisposition(filename))
+	}
+	if contentType != "" {
+		q.Set("response-content-type", contentType)
+	}
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalS3Query(q),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	u.RawQuery = canonicalS3Query(q) + "&X-Amz-Signature=" + s.signature(now, scope, canonical)
+	return u.String()
+}
+
+func (s *S3BlobStore) scope(now time.Time) string {
+	return now.UTC().Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// signatureは正規リクエストからSigV4の署名を計算します。
+func (s *S3BlobStore) signature(now time.Time, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.UTC().Format("20060102T150405Z"),
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), now.UTC().Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalS3Headersは署名するヘッダの名前の一覧と、正規化したヘッダ（名前順）を返します。
+func canonicalS3Headers(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + headers[name] + "\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+// canonicalS3QueryはSigV4の規則でクエリを並べてエスケープします。
+func canonicalS3Query(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapeはSigV4の規則（RFC 3986の非予約文字以外をすべて%XX）でエスケープします。
+func s3Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3EscapePathはオブジェクトのキーを/を残してエスケープします。
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// contentDispositionはダウンロード時のファイル名を指定するContent-Dispositionの値を返します。
+func contentDisposition(filename string) string {
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, asciiFilename(filename), url.PathEscape(filename))
+}
+
+// asciiFilenameはfilenameパラメータ用に、ASCII以外と引用符を_に置き換えます（元の名前はfilename*で渡す）。
+func asciiFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,157 @@
+// loadgenはTODO APIに負荷をかけて、スループット・エラーの内訳・レイテンシのパーセンタイルを表示します。
+//
+//	loadgen -url http://localhost:8080 -users 100 -rate 200 -duration 1m -threshold 'p99<500ms' -threshold 'error_rate<1%'
+//
+// -accounts seedgen（既定）ならseedgenが作ったユーザーでログインします。-presetと-seedはseedgenと同じ値にし、
+// seedgenは-truncateを付けて読み込んでおいてください（メールアドレスにIDが入るため）。
+// -accounts signupなら毎回新しいユーザーを登録します。
+//
+// -thresholdの条件を1つでも満たさなければ終了コード1で終わるので、リリース前のCIでそのまま使えます。
+// 負荷をかける前の準備（ログインなど）に失敗したときは終了コード2です。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"2026learning_curriculum_design_doc/day60/loadgen"
+	"2026learning_curriculum_design_doc/day60/seedgen"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8080", "base URL of the server")
+	users := flag.Int("users", 10, "number of users to log in as")
+	accountSource := flag.String("accounts", "seedgen", "where the users come from (seedgen, signup)")
+	preset := flag.String("preset", "demo", "seedgen preset the database was loaded with")
+	seed := flag.Uint64("seed", 1, "seedgen seed the database was loaded with; also used for the scenario mix")
+	mixFlag := flag.String("mix", "list=70,create=20,update=10", "scenario weights")
+	rate := flag.Float64("rate", 0, "requests per second; 0 sends as fast as -concurrency workers can")
+	concurrency := flag.Int("concurrency", 10, "number of workers when -rate is 0")
+	duration := flag.Duration("duration", 30*time.Second, "how long to run; 0 runs until -requests are sent")
+	requests := flag.Int("requests", 0, "stop after this many requests; 0 means no limit")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout per request")
+	output := flag.String("o", "table", "output format (table, json)")
+	jsonFile := flag.String("json", "", "also write the JSON report to this file")
+	var thresholds []loadgen.Threshold
+	flag.Func("threshold", "fail when not met, e.g. p99<500ms, create.p999<2s, error_rate<1%, rps>100 (repeatable)", func(s string) error {
+		t, err := loadgen.ParseThreshold(s)
+		if err == nil {
+			thresholds = append(thresholds, t)
+		}
+		return err
+	})
+	flag.Parse()
+
+	mix, err := loadgen.ParseMix(*mixFlag)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *output != "table" && *output != "json" {
+		fatalf("unknown output format %q (choose from table, json)", *output)
+	}
+	cfg := loadgen.Config{
+		BaseURL:     *url,
+		Mix:         mix,
+		Rate:        *rate,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Requests:    *requests,
+		Timeout:     *timeout,
+		Seed:        *seed,
+	}
+	switch *accountSource {
+	case "seedgen":
+		cfg.Accounts, err = seedgenAccounts(*preset, *seed, *users)
+	case "signup":
+		cfg.Accounts, cfg.Signup = signupAccounts(*users), true
+	default:
+		err = fmt.Errorf("unknown account source %q (choose from seedgen, signup)", *accountSource)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := loadgen.Run(ctx, cfg)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if *output == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteTable(os.Stdout)
+	}
+	if err == nil && *jsonFile != "" {
+		err = writeFile(*jsonFile, report.WriteJSON)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if violations := loadgen.Check(report, thresholds); len(violations) > 0 {
+		fmt.Fprintln(os.Stderr, "\nThresholds not met:")
+		for _, v := range violations {
+			fmt.Fprintf(os.Stderr, "  %s\n", v)
+		}
+		os.Exit(1)
+	}
+}
+
+// seedgenAccountsはseedgenが生成するユーザーのうち先頭のn人を返します。
+func seedgenAccounts(preset string, seed uint64, n int) ([]loadgen.Account, error) {
+	cfg, ok := seedgen.Presets[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q", preset)
+	}
+	cfg.Seed = seed
+	if n > cfg.Users {
+		return nil, fmt.Errorf("preset %q has only %d users", preset, cfg.Users)
+	}
+	g, err := seedgen.New(cfg, seedgen.IDs{})
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]loadgen.Account, 0, n)
+	for u := range g.Users() {
+		if len(accounts) == n {
+			break
+		}
+		accounts = append(accounts, loadgen.Account{Email: u.Email, Password: seedgen.Password})
+	}
+	return accounts, nil
+}
+
+// signupAccountsは実行ごとに重ならないメールアドレスのアカウントを作ります。
+func signupAccounts(n int) []loadgen.Account {
+	runID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	accounts := make([]loadgen.Account, n)
+	for i := range accounts {
+		accounts[i] = loadgen.Account{Email: fmt.Sprintf("loadgen-%s-%d@example.com", runID, i), Password: "loadgen-" + runID}
+	}
+	return accounts
+}
+
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "loadgen: "+format+"\n", args...)
+	os.Exit(2)
+}
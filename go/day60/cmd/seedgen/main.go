@@ -0,0 +1,107 @@
+// seedgenは負荷試験やデモ用の架空のデータを生成してPostgreSQLに読み込みます。
+//
+//	seedgen -preset load-1m -seed 42 -truncate
+//
+// 接続先はDATABASE_URL、無ければサーバーと同じDB_HOST・DB_PORT・DB_USER・DB_PASSWORD・DB_NAMEです。
+// 生成したユーザーのパスワードはすべてpassword123です。
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"2026learning_curriculum_design_doc/day60/seedgen"
+)
+
+func main() {
+	presets := make([]string, 0, len(seedgen.Presets))
+	for name := range seedgen.Presets {
+		presets = append(presets, name)
+	}
+	slices.Sort(presets)
+
+	preset := flag.String("preset", "demo", "size and distribution preset ("+strings.Join(presets, ", ")+")")
+	users := flag.Int("users", 0, "number of users (overrides the preset)")
+	todos := flag.Int("todos", 0, "average number of todos per user (overrides the preset)")
+	teams := flag.Int("teams", 0, "number of shared lists (overrides the preset)")
+	teamSize := flag.Int("team-size", 0, "members per shared list (overrides the preset)")
+	shared := flag.Float64("shared", 0, "fraction of a member's todos put in the shared list (overrides the preset)")
+	seed := flag.Uint64("seed", 1, "random seed; the same seed generates the same data")
+	now := flag.String("now", seedgen.DefaultNow.Format(time.RFC3339), "reference time for due dates and audit history (RFC 3339)")
+	truncate := flag.Bool("truncate", false, "delete all users, lists and todos before loading so that IDs start at 1")
+	flag.Parse()
+
+	cfg, ok := seedgen.Presets[*preset]
+	if !ok {
+		fatalf("unknown preset %q (choose from %s)", *preset, strings.Join(presets, ", "))
+	}
+	// 明示したフラグだけプリセットの値を上書きする
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "users":
+			cfg.Users = *users
+		case "todos":
+			cfg.TodosPerUser = *todos
+		case "teams":
+			cfg.Teams = *teams
+		case "team-size":
+			cfg.TeamSize = *teamSize
+		case "shared":
+			cfg.SharedRatio = *shared
+		}
+	})
+	cfg.Seed = *seed
+	var err error
+	if cfg.Now, err = time.Parse(time.RFC3339, *now); err != nil {
+		fatalf("invalid -now: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatalf("%v", err)
+	}
+
+	db, err := sql.Open("pgx", databaseURL())
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	started := time.Now()
+	stats, err := seedgen.Load(ctx, db, cfg, seedgen.LoadOptions{Truncate: *truncate})
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("Loaded %d users, %d lists, %d list members, %d tags, %d todos, %d todo tags and %d audit logs in %s\n",
+		stats.Users, stats.Lists, stats.ListMembers, stats.Tags, stats.Todos, stats.TodoTags, stats.AuditLogs, time.Since(started).Round(time.Millisecond))
+	fmt.Printf("All users have the password %s\n", seedgen.Password)
+}
+
+func databaseURL() string {
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		return url
+	}
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"), getEnv("DB_USER", "user"), getEnv("DB_PASSWORD", "password"), getEnv("DB_NAME", "todo_db"), getEnv("DB_PORT", "5433"))
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "seedgen: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,22 @@
+// todoctlはTODO APIのコマンドラインクライアントです。使い方は todoctl help を参照してください。
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"2026learning_curriculum_design_doc/day60/todoctl"
+)
+
+func main() {
+	configPath := os.Getenv("TODOCTL_CONFIG")
+	if configPath == "" {
+		var err error
+		if configPath, err = todoctl.DefaultConfigPath(); err != nil {
+			fmt.Fprintf(os.Stderr, "todoctl: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	app := &todoctl.App{ConfigPath: configPath, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	os.Exit(app.Run(os.Args[1:]))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CommentはTODOへのコメントです。Repliesに返信がぶら下がります。
+type Comment struct {
+	ID       int  `json:"id"`
+	TodoID   int  `json:"todo_id"`
+	ParentID *int `json:"parent_id"`
+	// UserIDとAuthorEmailは投稿者（アカウントが削除されていればnullと空文字）
+	UserID      *int       `json:"user_id"`
+	AuthorEmail string     `json:"author_email"`
+	Body        string     `json:"body"`
+	CreatedAt   time.Time  `json:"created_at"`
+	EditedAt    *time.Time `json:"edited_at"`
+	// Deletedは削除済みのコメント。返信のスレッドを保つために本文を空にして残る
+	Deleted  bool       `json:"deleted"`
+	Mentions []string   `json:"mentions"` // 言及されたユーザーのメールアドレス
+	Replies  []*Comment `json:"replies"`
+}
+
+// CommentRevisionはコメントの編集前の本文です。
+type CommentRevision struct {
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"` // この本文が書かれた日時
+}
+
+// Mentionはユーザーが言及されたコメントです。
+type Mention struct {
+	CommentID   int       `json:"comment_id"`
+	TodoID      int       `json:"todo_id"`
+	TodoName    string    `json:"todo_name"`
+	AuthorEmail string    `json:"author_email"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// mentionPatternは本文中の@メールアドレスです。直前が英数字の場合（メールアドレスの一部など）は言及とみなしません。
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.@])@([\w.%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,})`)
+
+// ParseMentionsは本文で言及されたメールアドレスを、出現順に重複なく小文字で返します。
+func ParseMentions(body string) []string {
+	var emails []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.ToLower(strings.TrimRight(m[1], "."))
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// buildCommentThreadsはID順のコメントを返信のツリーにして、トップレベルのコメントを返します。
+// 親が見つからないコメントはトップレベルに置きます。
+func buildCommentThreads(comments []Comment) []*Comment {
+	byID := make(map[int]*Comment, len(comments))
+	for i := range comments {
+		comments[i].Replies = []*Comment{}
+		byID[comments[i].ID] = &comments[i]
+	}
+	roots := []*Comment{}
+	for i := range comments {
+		c := &comments[i]
+		if c.ParentID != nil {
+			if parent, ok := byID[*c.ParentID]; ok {
+				parent.Replies = append(parent.Replies, c)
+				continue
+			}
+		}
+		roots = append(roots, c)
+	}
+	return roots
+}
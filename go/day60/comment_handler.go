@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CommentHandlerはTODOのコメントと言及を扱います。
+type CommentHandler struct {
+	repo *TodoRepository
+}
+
+func NewCommentHandler(repo *TodoRepository) *CommentHandler {
+	return &CommentHandler{repo: repo}
+}
+
+type CommentInput struct {
+	Body     string `json:"body" binding:"required,max=10000"`
+	ParentID *int   `json:"parent_id"` // 返信先のコメント（省略時はトップレベル）
+}
+
+type UpdateCommentInput struct {
+	Body string `json:"body" binding:"required,max=10000"`
+}
+
+// commentParamsはパスのTODOのIDとコメントのIDを返します。
+func commentParams(c *gin.Context) (int, int, error) {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return 0, 0, err
+	}
+	commentID, err := idParam(c, "commentId")
+	if err != nil {
+		return 0, 0, err
+	}
+	return todoID, commentID, nil
+}
+
+func (h *CommentHandler) getComments(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	comments, err := h.repo.FindComments(c.Request.Context(), currentUserID(c), todoID)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, comments)
+	return nil
+}
+
+// createCommentはコメントを投稿します。本文の@メールアドレスはリストのメンバーへの言及として記録されます。
+func (h *CommentHandler) createComment(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	comment, err := h.repo.CreateComment(c.Request.Context(), currentUserID(c), todoID, input.ParentID, input.Body)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, comment)
+	return nil
+}
+
+func (h *CommentHandler) updateComment(c *gin.Context) error {
+	todoID, commentID, err := commentParams(c)
+	if err != nil {
+		return err
+	}
+	var input UpdateCommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	comment, err := h.repo.UpdateComment(c.Request.Context(), currentUserID(c), todoID, commentID, input.Body)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, comment)
+	return nil
+}
+
+func (h *CommentHandler) deleteComment(c *gin.Context) error {
+	todoID, commentID, err := commentParams(c)
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DeleteComment(c.Request.Context(), currentUserID(c), todoID, commentID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// getCommentHistoryはコメントの編集履歴（編集前の本文）を返します。
+func (h *CommentHandler) getCommentHistory(c *gin.Context) error {
+	todoID, commentID, err := commentParams(c)
+	if err != nil {
+		return err
+	}
+	revisions, err := h.repo.FindCommentHistory(c.Request.Context(), currentUserID(c), todoID, commentID)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, revisions)
+	return nil
+}
+
+// getMentionsはログインユーザーが言及されたコメントを返します。
+func (h *CommentHandler) getMentions(c *gin.Context) error {
+	mentions, err := h.repo.FindMentions(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, mentions)
+	return nil
+}
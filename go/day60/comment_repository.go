@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// commentColumnsはコメントを読むクエリのSELECT句です（comments c、投稿者users uをLEFT JOINする前提）。scanCommentと列の順番を合わせてください。
+const commentColumns = `c.id, c.todo_id, c.parent_id, c.user_id, COALESCE(u.email, ''), c.body, c.created_at, c.edited_at, c.deleted_at IS NOT NULL,
+	COALESCE((
+		SELECT json_agg(mu.email ORDER BY mu.email) FROM comment_mentions cm JOIN users mu ON mu.id = cm.user_id
+		WHERE cm.comment_id = c.id
+	), '[]')`
+
+func scanComment(row rowScanner) (Comment, error) {
+	// 1件だけ返すとき（作成・編集）も、返信はnullではなく空の配列にする
+	c := Comment{Replies: []*Comment{}}
+	var parentID, userID sql.NullInt64
+	var editedAt sql.NullTime
+	var mentions []byte
+	if err := row.Scan(&c.ID, &c.TodoID, &parentID, &userID, &c.AuthorEmail, &c.Body, &c.CreatedAt, &editedAt, &c.Deleted, &mentions); err != nil {
+		return c, err
+	}
+	c.ParentID = nullIntPtr(parentID)
+	c.UserID = nullIntPtr(userID)
+	if editedAt.Valid {
+		c.EditedAt = &editedAt.Time
+	}
+	err := json.Unmarshal(mentions, &c.Mentions)
+	return c, err
+}
+
+func findComment(ctx context.Context, q querier, id int) (Comment, error) {
+	return scanComment(q.QueryRowContext(ctx, "SELECT "+commentColumns+" FROM comments c LEFT JOIN users u ON u.id = c.user_id WHERE c.id = $1", id))
+}
+
+// syncMentionsはコメントの本文で言及されたユーザーを記録し直します。
+// 言及として記録するのはTODOのリストのメンバー（コメントを読めるユーザー）だけで、投稿者自身は除きます。
+func syncMentions(ctx context.Context, q querier, commentID, listID, authorID int, body string) error {
+	emails := ParseMentions(body)
+	if emails == nil {
+		emails = []string{}
+	}
+	const mentioned = `
+		SELECT u.id FROM users u
+		JOIN list_members lm ON lm.user_id = u.id AND lm.list_id = $2
+		WHERE lower(u.email) = ANY($3::text[]) AND u.id <> $4`
+	if _, err := q.ExecContext(ctx, `DELETE FROM comment_mentions WHERE comment_id = $1 AND user_id NOT IN (`+mentioned+`)`,
+		commentID, listID, emails, authorID); err != nil {
+		return err
+	}
+	// WHERE TRUEはSQLiteでSELECTの後のON CONFLICTを結合の条件と区別するため
+	_, err := q.ExecContext(ctx, `INSERT INTO comment_mentions (comment_id, user_id) SELECT $1, id FROM (`+mentioned+`) m WHERE TRUE
+		ON CONFLICT (comment_id, user_id) DO NOTHING`, commentID, listID, emails, authorID)
+	return err
+}
+
+// CreateCommentはTODOにコメントを投稿します（parentIDがあればそのコメントへの返信）。リストのeditor以上が実行できます。
+func (r *TodoRepository) CreateComment(ctx context.Context, userID, todoID int, parentID *int, body string) (Comment, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var comment Comment
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		listID, err := requireTodoRole(ctx, tx, todoID, userID, RoleEditor)
+		if err != nil {
+			return err
+		}
+		if parentID != nil {
+			var exists bool
+			err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM comments WHERE id = $1 AND todo_id = $2 AND deleted_at IS NULL)",
+				*parentID, todoID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("%w: parent comment %d not found on this todo", ErrInvalidInput, *parentID)
+			}
+		}
+
+		var id int
+		err = tx.QueryRowContext(ctx, "INSERT INTO comments (todo_id, parent_id, user_id, body) VALUES ($1, $2, $3, $4) RETURNING id",
+			todoID, parentID, userID, body).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if err := syncMentions(ctx, tx, id, listID, userID, body); err != nil {
+			return err
+		}
+		if err := insertAuditLog(ctx, tx, todoID, "comment", map[string]any{"action": "create", "comment_id": id}); err != nil {
+			return err
+		}
+		comment, err = findComment(ctx, tx, id)
+		return err
+	})
+	return comment, err
+}
+
+// lockCommentはTODOのコメントを行ロックして投稿者を返します。削除済みのコメントはErrNotFoundです。
+func lockComment(ctx context.Context, tx *sql.Tx, todoID, commentID int) (authorID sql.NullInt64, body string, writtenAt time.Time, err error) {
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id, body, COALESCE(edited_at, created_at) FROM comments
+		WHERE id = $1 AND todo_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`, commentID, todoID).Scan(&authorID, &body, &writtenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNotFound
+	}
+	return authorID, body, writtenAt, err
+}
+
+// UpdateCommentはコメントの本文を編集します。編集前の本文は履歴に残ります。
+// 投稿者本人が、リストのeditor以上である間だけ編集できます。
+func (r *TodoRepository) UpdateComment(ctx context.Context, userID, todoID, commentID int, body string) (Comment, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var comment Comment
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		listID, err := requireTodoRole(ctx, tx, todoID, userID, RoleEditor)
+		if err != nil {
+			return err
+		}
+		authorID, oldBody, writtenAt, err := lockComment(ctx, tx, todoID, commentID)
+		if err != nil {
+			return err
+		}
+		if !authorID.Valid || int(authorID.Int64) != userID {
+			return fmt.Errorf("%w: only the author can edit a comment", ErrForbidden)
+		}
+
+		if body != oldBody {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO comment_revisions (comment_id, body, created_at) VALUES ($1, $2, $3)",
+				commentID, oldBody, writtenAt); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE comments SET body = $1, edited_at = NOW() WHERE id = $2", body, commentID); err != nil {
+				return err
+			}
+			if err := syncMentions(ctx, tx, commentID, listID, userID, body); err != nil {
+				return err
+			}
+			if err := insertAuditLog(ctx, tx, todoID, "comment", map[string]any{"action": "edit", "comment_id": commentID}); err != nil {
+				return err
+			}
+		}
+		comment, err = findComment(ctx, tx, commentID)
+		return err
+	})
+	return comment, err
+}
+
+// DeleteCommentはコメントを削除します。投稿者本人か、リストのownerが実行できます。
+// 返信のスレッドを保つために行は残し、本文・編集履歴・言及を消します。
+func (r *TodoRepository) DeleteComment(ctx context.Context, userID, todoID, commentID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		listID, err := requireTodoRole(ctx, tx, todoID, userID, RoleViewer)
+		if err != nil {
+			return err
+		}
+		authorID, _, _, err := lockComment(ctx, tx, todoID, commentID)
+		if err != nil {
+			return err
+		}
+		if !authorID.Valid || int(authorID.Int64) != userID {
+			role, err := listRole(ctx, tx, listID, userID)
+			if err != nil {
+				return err
+			}
+			if !role.Allows(RoleOwner) {
+				return fmt.Errorf("%w: only the author or a list owner can delete a comment", ErrForbidden)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE comments SET body = '', deleted_at = NOW() WHERE id = $1", commentID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comment_revisions WHERE comment_id = $1", commentID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comment_mentions WHERE comment_id = $1", commentID); err != nil {
+			return err
+		}
+		return insertAuditLog(ctx, tx, todoID, "comment", map[string]any{"action": "delete", "comment_id": commentID})
+	})
+}
+
+// FindCommentsはTODOのコメントを返信のスレッドにして返します。リストのメンバーなら閲覧できます。
+func (r *TodoRepository) FindComments(ctx context.Context, userID, todoID int) ([]*Comment, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleViewer); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+commentColumns+` FROM comments c LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.todo_id = $1
+		ORDER BY c.id`, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildCommentThreads(comments), nil
+}
+
+// FindCommentHistoryはコメントの編集前の本文を古い順に返します。
+func (r *TodoRepository) FindCommentHistory(ctx context.Context, userID, todoID, commentID int) ([]CommentRevision, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleViewer); err != nil {
+		return nil, err
+	}
+	var exists bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM comments WHERE id = $1 AND todo_id = $2 AND deleted_at IS NULL)",
+		commentID, todoID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT body, created_at FROM comment_revisions WHERE comment_id = $1 ORDER BY id", commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []CommentRevision{}
+	for rows.Next() {
+		var rev CommentRevision
+		if err := rows.Scan(&rev.Body, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// FindMentionsはユーザーが言及されたコメントを新しい順に返します。
+// 削除されたコメントや、ゴミ箱にあるTODO・メンバーでなくなったリストのコメントは含めません。
+func (r *TodoRepository) FindMentions(ctx context.Context, userID int) ([]Mention, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.id, t.id, t.name, COALESCE(u.email, ''), c.body, c.created_at
+		FROM comment_mentions cm
+		JOIN comments c ON c.id = cm.comment_id AND c.deleted_at IS NULL
+		JOIN todos t ON t.id = c.todo_id AND t.deleted_at IS NULL
+		JOIN list_members lm ON lm.list_id = t.list_id AND lm.user_id = cm.user_id
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE cm.user_id = $1
+		ORDER BY c.created_at DESC, c.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []Mention{}
+	for rows.Next() {
+		var m Mention
+		if err := rows.Scan(&m.CommentID, &m.TodoID, &m.TodoName, &m.AuthorEmail, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{"@alice@example.com please check", []string{"alice@example.com"}},
+		{"cc @Bob@Example.COM, @alice@example.com and @bob@example.com.", []string{"bob@example.com", "alice@example.com"}},
+		{"(@carol.smith+todo@mail.example.co.jp)", []string{"carol.smith+todo@mail.example.co.jp"}},
+		// メールアドレスそのものや@だけの名前は言及ではない
+		{"mail dave@example.com or @dave", nil},
+		{"foo@@erin@example.com", nil},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, ParseMentions(tc.body), tc.body)
+	}
+}
+
+func TestBuildCommentThreads(t *testing.T) {
+	comments := []Comment{
+		{ID: 1},
+		{ID: 2, ParentID: intPtr(1)},
+		{ID: 3},
+		{ID: 4, ParentID: intPtr(2)},
+		{ID: 5, ParentID: intPtr(1)},
+		{ID: 6, ParentID: intPtr(99)},
+	}
+	roots := buildCommentThreads(comments)
+	if !assert.Len(t, roots, 3) {
+		return
+	}
+	assert.Equal(t, []int{1, 3, 6}, []int{roots[0].ID, roots[1].ID, roots[2].ID})
+	if assert.Len(t, roots[0].Replies, 2) {
+		assert.Equal(t, 2, roots[0].Replies[0].ID)
+		assert.Equal(t, 5, roots[0].Replies[1].ID)
+		assert.Equal(t, 4, roots[0].Replies[0].Replies[0].ID)
+	}
+	assert.Empty(t, roots[1].Replies)
+}
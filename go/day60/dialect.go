@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Dialectは対応しているDB（PostgreSQLとSQLite）ごとのSQLの違いを吸収します。
+//
+// リポジトリのクエリはPostgreSQLの書き方（$1のプレースホルダ、= ANY($1)、RETURNING、ON CONFLICT、FOR UPDATE）で
+// 1つだけ書きます。SQLiteでは接続（sqliteDriver）が実行の前にrebindSQLiteで書き換えるので、ほとんどのクエリはそのまま動きます。
+// 書き換えでは済まない違い（日時の計算や配列の展開）だけを、このインターフェースのメソッドでクエリに埋め込みます。
+type Dialect interface {
+	// NameはDB_DRIVERの値（postgresかsqlite）です
+	Name() string
+	// ServerVersionはDBのバージョンを返すクエリと、表示用の製品名です（db check用）
+	ServerVersion() (query, product string)
+	// Elementsは配列のパラメータ（Goのスライス）を、valueという1列の行の集まりとしてFROM句に書ける式にします
+	Elements(placeholder, elemType string) string
+	// AddMinutesは日時の式に分の式を足した日時の式を返します
+	AddMinutes(timestamp, minutes string) string
+	// IsUndefinedTableはテーブルが無いことによるエラーならtrueを返します
+	IsUndefinedTable(err error) bool
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) ServerVersion() (string, string) { return "SHOW server_version", "PostgreSQL" }
+
+func (postgresDialect) Elements(placeholder, elemType string) string {
+	return fmt.Sprintf("unnest(%s::%s[]) AS value", placeholder, elemType)
+}
+
+func (postgresDialect) AddMinutes(timestamp, minutes string) string {
+	return fmt.Sprintf("(%s)::timestamptz + make_interval(mins => %s)", timestamp, minutes)
+}
+
+func (postgresDialect) IsUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42P01"
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) ServerVersion() (string, string) { return "SELECT sqlite_version()", "SQLite" }
+
+// Elementsのスライスはsqliteconn.CheckNamedValueがJSONの配列にして渡すので、json_eachで展開する
+func (sqliteDialect) Elements(placeholder, elemType string) string {
+	return fmt.Sprintf("json_each(%s)", placeholder)
+}
+
+func (sqliteDialect) AddMinutes(timestamp, minutes string) string {
+	return fmt.Sprintf("strftime(%s, %s, (%s) || ' minutes')", sqliteTimeFormat, timestamp, minutes)
+}
+
+func (sqliteDialect) IsUndefinedTable(err error) bool {
+	return isSQLiteNoSuchTable(err)
+}
+
+// dialectOfはdbのドライバに対応するDialectを返します。dbがnil（DBを使わないテスト）ならPostgreSQLです。
+func dialectOf(db *sql.DB) Dialect {
+	if db == nil {
+		return postgresDialect{}
+	}
+	if isSQLite(db) {
+		return sqliteDialect{}
+	}
+	return postgresDialect{}
+}
+
+// translateDBErrorはDBドライバのエラーをドメインエラーに変換します。それ以外のエラーはそのまま返します。
+//   - ユニーク制約違反（PostgreSQLの23505とSQLiteのSQLITE_CONSTRAINT_UNIQUE）: ConflictError
+//   - コンテキストの期限切れとstatement_timeoutによる取り消し（57014）: ErrTimeout
+//   - ロック待ちの打ち切り（PostgreSQLの55P03とSQLiteのSQLITE_BUSY・SQLITE_LOCKED）: ErrUnavailable
+func translateDBError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return &ConflictError{Constraint: pgErr.ConstraintName, Err: err}
+		case "57014":
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		case "55P03":
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	}
+	if translated, ok := translateSQLiteError(err); ok {
+		return translated
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebindSQLite(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id FROM todos WHERE id = $1 AND user_id = $2", "SELECT id FROM todos WHERE id = ?1 AND user_id = ?2"},
+		{"SELECT id FROM users WHERE id = ANY($1) ORDER BY id", "SELECT id FROM users WHERE id IN (SELECT value FROM json_each(?1)) ORDER BY id"},
+		{"UPDATE sessions SET last_seen_at = $2 WHERE id = ANY($1::text[]::uuid[])", "UPDATE sessions SET last_seen_at = ?2 WHERE id IN (SELECT value FROM json_each(?1))"},
+		{"SELECT id FROM lists WHERE id = $1 FOR UPDATE", "SELECT id FROM lists WHERE id = ?1"},
+		{"SELECT id FROM reminders LIMIT 10 FOR UPDATE OF reminders SKIP LOCKED", "SELECT id FROM reminders LIMIT 10"},
+		{"UPDATE user_totp SET locked_until = $3::timestamptz", "UPDATE user_totp SET locked_until = ?3"},
+		{"SELECT array_to_json(scopes), json_agg(name) FROM t", "SELECT json(scopes), json_group_array(name) FROM t"},
+		{"UPDATE comments SET deleted_at = NOW()", "UPDATE comments SET deleted_at = strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')"},
+		// 文字列リテラルの中は書き換えない
+		{"SELECT 'costs $1::text, it''s NOW()' WHERE x = $1", "SELECT 'costs $1::text, it''s NOW()' WHERE x = ?1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, rebindSQLite(tt.query), tt.query)
+	}
+}
+
+func TestTranslateDBError(t *testing.T) {
+	err := translateDBError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
+	var conflict *ConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, "users_email_key", conflict.Constraint)
+	}
+	assert.ErrorIs(t, err, ErrConflict)
+	other := &pgconn.PgError{Code: "23503"}
+	assert.Same(t, other, translateDBError(other))
+	assert.NoError(t, translateDBError(nil))
+
+	// 期限切れ（コンテキストとstatement_timeout）は504、ロック待ちの打ち切りは503にする
+	assert.ErrorIs(t, translateDBError(fmt.Errorf("query: %w", context.DeadlineExceeded)), ErrTimeout)
+	assert.ErrorIs(t, translateDBError(&pgconn.PgError{Code: "57014"}), ErrTimeout)
+	assert.ErrorIs(t, translateDBError(&pgconn.PgError{Code: "55P03"}), ErrUnavailable)
+	assert.NotErrorIs(t, translateDBError(context.Canceled), ErrTimeout)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ドメインエラー
+// リポジトリやハンドラはこれらを(必要ならfmt.Errorfの%wでラップして)返し、
+// HTTPステータスへの変換はerrorHandlerが一箇所で行います。
+var (
+	// ErrNotFoundは対象のリソースが存在しない、または操作ユーザーから見えない場合のエラーです。
+	ErrNotFound = errors.New("resource not found")
+	// ErrForbiddenはリソースは見えるが、操作に必要な権限(ロール)がない場合のエラーです。
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalidInputはパスパラメータやクエリなどの入力値が不正な場合のエラーです。
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrTooLargeはアップロードするファイルが大きすぎる、または容量の上限を超える場合のエラーです。
+	ErrTooLarge = errors.New("too large")
+	// ErrUnauthenticatedは外部のIDプロバイダでのログインなど、認証に失敗した場合のエラーです。
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrConflictはユニーク制約に違反した場合のエラーです。DBのエラーはtranslateDBErrorでConflictErrorに変換します。
+	ErrConflict = errors.New("conflict")
+	// ErrTimeoutはDBの問い合わせが期限（REQUEST_TIMEOUT、DB_QUERY_TIMEOUT、PostgreSQLのstatement_timeout）までに終わらなかった場合のエラーです。
+	ErrTimeout = errors.New("timeout")
+	// ErrUnavailableはロック待ちが続くなど、DBが一時的に処理できない場合のエラーです。時間をおけば成功する見込みがあります。
+	ErrUnavailable = errors.New("temporarily unavailable")
+)
+
+// ConflictErrorはどのユニーク制約に違反したかを持つErrConflictです。
+// ConstraintはPostgreSQLの制約名で、SQLiteでも同じ名前にそろえます（conflictMessagesを引くため）。
+type ConflictError struct {
+	Constraint string
+	Err        error // DBドライバのエラー
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("unique constraint %s violated: %v", e.Constraint, e.Err)
+}
+
+func (e *ConflictError) Unwrap() []error {
+	return []error{ErrConflict, e.Err}
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// graphqlErrorはextensions.codeに分類を入れて返すGraphQLのエラーです。
+type graphqlError struct {
+	message string
+	code    string
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// toGraphQLErrorはリゾルバーが返したエラーをGraphQLのエラーに変換します。
+// 分類はHTTPのerrorHandlerと同じで、extensions.codeで区別できるようにします。
+func toGraphQLError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var gqlErr *graphqlError
+	if errors.As(err, &gqlErr) {
+		return err
+	}
+	log.Printf("Error occurred: %v", err)
+
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) || errors.Is(err, ErrInvalidInput) {
+		return &graphqlError{message: err.Error(), code: "BAD_USER_INPUT"}
+	}
+	if errors.Is(err, ErrTooLarge) {
+		return &graphqlError{message: err.Error(), code: "PAYLOAD_TOO_LARGE"}
+	}
+	if errors.Is(err, ErrForbidden) {
+		return &graphqlError{message: err.Error(), code: "FORBIDDEN"}
+	}
+	if errors.Is(err, ErrUnauthenticated) || errors.Is(err, sql.ErrNoRows) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return &graphqlError{message: "Unauthorized", code: "UNAUTHENTICATED"}
+	}
+	if errors.Is(err, ErrNotFound) {
+		return &graphqlError{message: "Not Found", code: "NOT_FOUND"}
+	}
+	dbErr := translateDBError(err)
+	var conflict *ConflictError
+	if errors.As(dbErr, &conflict) {
+		return &graphqlError{message: conflictMessage(conflict.Constraint), code: "CONFLICT"}
+	}
+	if errors.Is(dbErr, ErrTimeout) {
+		return &graphqlError{message: "The database did not respond in time", code: "TIMEOUT"}
+	}
+	if errors.Is(dbErr, ErrUnavailable) {
+		return &graphqlError{message: "The database is busy, please retry", code: "SERVICE_UNAVAILABLE"}
+	}
+	return &graphqlError{message: "Internal Server Error", code: "INTERNAL_SERVER_ERROR"}
+}
+
+// graphqlRequestはリゾルバーがコンテキストから取り出す、GraphQLの1リクエストの状態です。
+type graphqlRequest struct {
+	repo      *TodoRepository
+	principal *Principal
+	loaders   *graphqlLoaders
+}
+
+type graphqlRequestKey struct{}
+
+func graphqlRequestFrom(ctx context.Context) *graphqlRequest {
+	return ctx.Value(graphqlRequestKey{}).(*graphqlRequest)
+}
+
+// resolveはリゾルバーのエラーをtoGraphQLErrorで変換します。バッチ読み込みのサンクを返す場合はサンクのエラーも変換します。
+func resolve(fn func(p graphql.ResolveParams, req *graphqlRequest) (any, error)) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		result, err := fn(p, graphqlRequestFrom(p.Context))
+		if err != nil {
+			return nil, toGraphQLError(err)
+		}
+		if thunk, ok := result.(func() (any, error)); ok {
+			return func() (any, error) {
+				v, err := thunk()
+				return v, toGraphQLError(err)
+			}, nil
+		}
+		return result, nil
+	}
+}
+
+// graphqlIDはID型の引数を正の整数として読み取ります。
+func graphqlID(value any, name string) (int, error) {
+	s, _ := value.(string)
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidInput, name)
+	}
+	return id, nil
+}
+
+// optionalGraphQLIDは省略可能なID型の引数を読み取ります。省略時は0です。
+func optionalGraphQLID(args map[string]any, name string) (int, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		return 0, nil
+	}
+	return graphqlID(value, name)
+}
+
+// graphqlTimeは省略可能なDateTime型の引数を読み取ります。
+func graphqlTime(args map[string]any, name string) *time.Time {
+	if t, ok := args[name].(time.Time); ok {
+		return &t
+	}
+	return nil
+}
+
+// newGraphQLSchemaはGraphQLのスキーマを作ります。
+func newGraphQLSchema() (graphql.Schema, error) {
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "TODOの作成者など、ログインユーザーから見える他のユーザーです。",
+		Fields: graphql.Fields{
+			"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"email": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	listType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "List",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"isPersonal": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"role": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "ログインユーザーのロール（owner、editor、viewer）",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return string(p.Source.(List).Role), nil
+				},
+			},
+			"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	})
+
+	meType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Me",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"email":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"role":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"timezone":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"lists": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(listType))),
+				Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+					return req.repo.FindListsByUser(p.Context, req.principal.UserID)
+				}),
+			},
+		},
+	})
+
+	todoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Todo",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"completed":  &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"dueAt":      &graphql.Field{Type: graphql.DateTime},
+			"recurrence": &graphql.Field{Type: graphql.String},
+			"tags": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Description: "ログインユーザーが付けたタグの名前",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					todo := p.Source.(Todo)
+					names := make([]string, 0, len(todo.Tags))
+					for _, tag := range todo.Tags {
+						names = append(names, tag.Name)
+					}
+					return names, nil
+				},
+			},
+			"list": &graphql.Field{
+				Type: graphql.NewNonNull(listType),
+				Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+					thunk := req.loaders.lists.load(p.Source.(Todo).ListID)
+					return func() (any, error) {
+						list, ok, err := thunk()
+						if err == nil && !ok {
+							err = ErrNotFound
+						}
+						return list, err
+					}, nil
+				}),
+			},
+			"creator": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+					thunk := req.loaders.users.load(p.Source.(Todo).UserID)
+					return func() (any, error) {
+						user, ok, err := thunk()
+						if err == nil && !ok {
+							err = ErrNotFound
+						}
+						return user, err
+					}, nil
+				}),
+			},
+		},
+	})
+	// 親とサブタスクはTodo自身を参照するので、型を作ってから追加する
+	todoType.AddFieldConfig("parent", &graphql.Field{
+		Type:        todoType,
+		Description: "親TODO。ルートのTODO、または親がゴミ箱にある場合はnull",
+		Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+			todo := p.Source.(Todo)
+			if todo.ParentID == nil {
+				return nil, nil
+			}
+			thunk := req.loaders.todos.load(*todo.ParentID)
+			return func() (any, error) {
+				parent, ok, err := thunk()
+				if err != nil || !ok {
+					return nil, err
+				}
+				return parent, nil
+			}, nil
+		}),
+	})
+	todoType.AddFieldConfig("subtasks", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(todoType))),
+		Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+			thunk := req.loaders.subtasks.load(p.Source.(Todo).ID)
+			return func() (any, error) {
+				subtasks, _, err := thunk()
+				if subtasks == nil {
+					subtasks = []Todo{}
+				}
+				return subtasks, err
+			}, nil
+		}),
+	})
+
+	todoEdgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TodoEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(todoType)},
+		},
+	})
+	todoConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TodoConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(todoEdgeType)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+
+	tagMatchEnum := graphql.NewEnum(graphql.EnumConfig{
+		Name: "TagMatch",
+		Values: graphql.EnumValueConfigMap{
+			"ANY": &graphql.EnumValueConfig{Value: TagMatchAny, Description: "いずれかのタグを持つ"},
+			"ALL": &graphql.EnumValueConfig{Value: TagMatchAll, Description: "すべてのタグを持つ"},
+		},
+	})
+	todoFilterInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "TodoFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"listId":   &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"tags":     &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"tagMatch": &graphql.InputObjectFieldConfig{Type: tagMatchEnum, DefaultValue: TagMatchAny},
+		},
+	})
+	createTodoInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateTodoInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"listId":     &graphql.InputObjectFieldConfig{Type: graphql.ID, Description: "省略すると個人リスト"},
+			"parentId":   &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"dueAt":      &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"recurrence": &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "繰り返し規則（RRULEのサブセット）"},
+		},
+	})
+	updateTodoInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UpdateTodoInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"dueAt": &graphql.InputObjectFieldConfig{Type: graphql.DateTime, Description: "省略すると期限なし"},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type: graphql.NewNonNull(meType),
+				Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+					// RESTの/meと同じく、プロフィールはログインセッションでだけ読める
+					if req.principal.IsToken() {
+						return nil, fmt.Errorf("%w: me requires a login session", ErrForbidden)
+					}
+					return req.repo.FindUserByID(p.Context, req.principal.UserID)
+				}),
+			},
+			"todos": &graphql.Field{
+				Type:        graphql.NewNonNull(todoConnectionType),
+				Description: "閲覧できるTODOをID順に返します。afterには前のページのpageInfo.endCursorを渡します。",
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: todoFilterInput},
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolve(resolveTodos),
+			},
+			"todo": &graphql.Field{
+				Type:        todoType,
+				Description: "閲覧できるTODOを1件返します。見えない場合はnullです。",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+					id, err := graphqlID(p.Args["id"], "id")
+					if err != nil {
+						return nil, err
+					}
+					todo, err := req.repo.FindTodo(p.Context, req.principal.UserID, id)
+					if errors.Is(err, ErrNotFound) {
+						return nil, nil
+					}
+					return todo, err
+				}),
+			},
+		},
+	})
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createTodo": &graphql.Field{
+				Type: graphql.NewNonNull(todoType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createTodoInput)},
+				},
+				Resolve: resolve(resolveCreateTodo),
+			},
+			"updateTodo": &graphql.Field{
+				Type: graphql.NewNonNull(todoType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateTodoInput)},
+				},
+				Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+					id, err := graphqlID(p.Args["id"], "id")
+					if err != nil {
+						return nil, err
+					}
+					input := p.Args["input"].(map[string]any)
+					name, _ := input["name"].(string)
+					if name == "" {
+						return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+					}
+					userID := req.principal.UserID
+					if _, err := req.repo.UpdateTodoWithAudit(p.Context, userID, Todo{ID: id, Name: name, DueAt: graphqlTime(input, "dueAt")}); err != nil {
+						return nil, err
+					}
+					return req.repo.FindTodo(p.Context, userID, id)
+				}),
+			},
+			"deleteTodo": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "TODOをサブタスクごとゴミ箱に入れ、そのIDを返します。",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolve(func(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+					id, err := graphqlID(p.Args["id"], "id")
+					if err != nil {
+						return nil, err
+					}
+					if err := req.repo.DeleteTodoWithAudit(p.Context, req.principal.UserID, id); err != nil {
+						return nil, err
+					}
+					return id, nil
+				}),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType, Mutation: mutationType})
+}
+
+// resolveTodosはtodosのコネクションを返します。カーソルはgRPCのListTodosのページトークンと同じ形式です。
+func resolveTodos(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+	filter := TodoFilter{TagMatch: TagMatchAny}
+	if input, ok := p.Args["filter"].(map[string]any); ok {
+		listID, err := optionalGraphQLID(input, "listId")
+		if err != nil {
+			return nil, err
+		}
+		filter.ListID = listID
+		if tags, ok := input["tags"].([]any); ok {
+			for _, tag := range tags {
+				filter.Tags = append(filter.Tags, tag.(string))
+			}
+		}
+		if match, ok := input["tagMatch"].(string); ok {
+			filter.TagMatch = match
+		}
+	}
+	first, _ := p.Args["first"].(int)
+	if first <= 0 || first > maxPageSize {
+		return nil, fmt.Errorf("%w: first must be between 1 and %d", ErrInvalidInput, maxPageSize)
+	}
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		afterID, err := decodePageToken(after)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterID = afterID
+	}
+	// 1件多く読んで、次のページがあるかを確かめる
+	filter.Limit = first + 1
+
+	todos, err := req.repo.FindAll(p.Context, req.principal.UserID, filter)
+	if err != nil {
+		return nil, err
+	}
+	hasNext := len(todos) > first
+	if hasNext {
+		todos = todos[:first]
+	}
+	edges := make([]map[string]any, 0, len(todos))
+	for _, t := range todos {
+		edges = append(edges, map[string]any{"cursor": encodePageToken(t.ID), "node": t})
+	}
+	pageInfo := map[string]any{"hasNextPage": hasNext, "endCursor": nil}
+	if len(todos) > 0 {
+		pageInfo["endCursor"] = encodePageToken(todos[len(todos)-1].ID)
+	}
+	return map[string]any{"edges": edges, "pageInfo": pageInfo}, nil
+}
+
+func resolveCreateTodo(p graphql.ResolveParams, req *graphqlRequest) (any, error) {
+	input := p.Args["input"].(map[string]any)
+	name, _ := input["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	todo := Todo{Name: name, UserID: req.principal.UserID, DueAt: graphqlTime(input, "dueAt")}
+	listID, err := optionalGraphQLID(input, "listId")
+	if err != nil {
+		return nil, err
+	}
+	todo.ListID = listID
+	parentID, err := optionalGraphQLID(input, "parentId")
+	if err != nil {
+		return nil, err
+	}
+	if parentID != 0 {
+		todo.ParentID = &parentID
+	}
+	if recurrence, _ := input["recurrence"].(string); recurrence != "" {
+		rule, err := ParseRecurrenceRule(recurrence)
+		if err != nil {
+			return nil, err
+		}
+		todo.Recurrence = rule.String()
+	}
+	created, err := req.repo.CreateTodoWithAudit(p.Context, todo)
+	if err != nil {
+		return nil, err
+	}
+	created.Tags = []Tag{}
+	return created, nil
+}
+
+// GraphQLHandlerはPOST /graphqlでGraphQLのクエリを実行します。
+type GraphQLHandler struct {
+	repo   *TodoRepository
+	schema graphql.Schema
+	limits GraphQLLimits
+}
+
+func NewGraphQLHandler(repo *TodoRepository, limits GraphQLLimits) *GraphQLHandler {
+	if limits.MaxDepth == 0 {
+		limits.MaxDepth = defaultGraphQLMaxDepth
+	}
+	if limits.MaxComplexity == 0 {
+		limits.MaxComplexity = defaultGraphQLMaxComplexity
+	}
+	schema, err := newGraphQLSchema()
+	if err != nil {
+		// スキーマはコードで組み立てているので、ここで失敗するのはプログラムの誤り
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	return &GraphQLHandler{repo: repo, schema: schema, limits: limits}
+}
+
+type GraphQLInput struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlErrorResponseは実行する前に拒否したリクエストのレスポンスです。
+// graphqlErrorのextensionsはgqlerrors.Errorに包まないと出力されません。
+func graphqlErrorResponse(c *gin.Context, status int, err error) {
+	var located *gqlerrors.Error
+	if !errors.As(err, &located) {
+		located = gqlerrors.NewLocatedError(err, nil)
+	}
+	c.JSON(status, &graphql.Result{Errors: gqlerrors.FormatErrors(located)})
+}
+
+// serveはクエリを解析して深さと複雑さを確かめてから実行します。
+// パーソナルアクセストークンでは、queryにtodos:read、mutationにtodos:writeのスコープが必要です。
+func (h *GraphQLHandler) serve(c *gin.Context) error {
+	var input GraphQLInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(input.Query), Name: "GraphQL request"})})
+	if err != nil {
+		graphqlErrorResponse(c, http.StatusBadRequest, err)
+		return nil
+	}
+	op, err := selectOperation(doc, input.OperationName)
+	if err != nil {
+		graphqlErrorResponse(c, http.StatusBadRequest, err)
+		return nil
+	}
+	if err := h.limits.check(analyzeQuery(doc, op, input.Variables)); err != nil {
+		graphqlErrorResponse(c, http.StatusBadRequest, err)
+		return nil
+	}
+	principal := currentPrincipal(c)
+	scope := ScopeTodosRead
+	if op.Operation == ast.OperationTypeMutation {
+		scope = ScopeTodosWrite
+	}
+	if !principal.HasScope(scope) {
+		graphqlErrorResponse(c, http.StatusForbidden, &graphqlError{message: "Token is missing scope " + scope, code: "FORBIDDEN"})
+		return nil
+	}
+
+	req := &graphqlRequest{repo: h.repo, principal: principal, loaders: newGraphQLLoaders(c.Request.Context(), h.repo, principal.UserID)}
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  input.Query,
+		OperationName:  input.OperationName,
+		VariableValues: input.Variables,
+		Context:        context.WithValue(c.Request.Context(), graphqlRequestKey{}, req),
+	})
+	c.JSON(http.StatusOK, result)
+	return nil
+}
+
+// selectOperationは実行する操作を選びます。複数の操作がある場合はoperationNameが必要です。
+func selectOperation(doc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil, &graphqlError{message: "operationName is required when the document has multiple operations", code: "BAD_USER_INPUT"}
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			found = op
+		}
+	}
+	if found == nil {
+		return nil, &graphqlError{message: "operation not found", code: "BAD_USER_INPUT"}
+	}
+	return found, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	defaultGraphQLMaxDepth      = 10
+	defaultGraphQLMaxComplexity = 5000
+	// graphqlListCostはfirstの無いリストのフィールド（subtasks、listsなど）の要素数の見積もりです。
+	graphqlListCost = 10
+)
+
+// GraphQLLimitsはGraphQLのクエリの上限です。0の項目は既定値を使います。
+type GraphQLLimits struct {
+	MaxDepth      int // フィールドの入れ子の深さ
+	MaxComplexity int // 返しうるフィールドの数の見積もり
+}
+
+// graphqlListFieldsはリストを返すフィールドです。子のコストにgraphqlListCostを掛けます。
+var graphqlListFields = map[string]bool{
+	"subtasks": true,
+	"lists":    true,
+}
+
+// graphqlConnectionFieldsはfirstでページの大きさを指定するフィールドです。子のコストにfirst（省略時は既定値）を掛けます。
+var graphqlConnectionFields = map[string]bool{
+	"todos": true,
+}
+
+// QueryCostはクエリを実行せずに見積もった深さと複雑さです。
+type QueryCost struct {
+	Depth      int
+	Complexity int
+}
+
+// queryAnalyzerはクエリの深さと複雑さを見積もります。
+// 複雑さは選択したフィールドごとに1で、リストやコネクションの子はその要素数の見積もりを掛けて数えます。
+// __schemaなどのイントロスペクションのフィールドは数えません。
+type queryAnalyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	visiting  map[string]bool // 展開中のフラグメント（循環の検出用。循環自体は後の検証でエラーになる）
+}
+
+// analyzeQueryは操作の深さと複雑さを見積もります。
+func analyzeQuery(doc *ast.Document, op *ast.OperationDefinition, variables map[string]any) QueryCost {
+	a := &queryAnalyzer{fragments: map[string]*ast.FragmentDefinition{}, variables: variables, visiting: map[string]bool{}}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			a.fragments[frag.Name.Value] = frag
+		}
+	}
+	depth, complexity := a.selectionSet(op.SelectionSet)
+	return QueryCost{Depth: depth, Complexity: complexity}
+}
+
+func (a *queryAnalyzer) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	maxDepth, total := 0, 0
+	for _, selection := range set.Selections {
+		var depth, complexity int
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			childDepth, childComplexity := a.selectionSet(s.SelectionSet)
+			depth = childDepth + 1
+			complexity = 1 + a.multiplier(s)*childComplexity
+		case *ast.InlineFragment:
+			depth, complexity = a.selectionSet(s.SelectionSet)
+		case *ast.FragmentSpread:
+			frag, ok := a.fragments[s.Name.Value]
+			if !ok || a.visiting[s.Name.Value] {
+				continue
+			}
+			a.visiting[s.Name.Value] = true
+			depth, complexity = a.selectionSet(frag.SelectionSet)
+			delete(a.visiting, s.Name.Value)
+		}
+		maxDepth = max(maxDepth, depth)
+		total += complexity
+	}
+	return maxDepth, total
+}
+
+// multiplierはフィールドの子が何回現れうるかの見積もりです。
+func (a *queryAnalyzer) multiplier(field *ast.Field) int {
+	name := field.Name.Value
+	if graphqlConnectionFields[name] {
+		first := defaultPageSize
+		for _, arg := range field.Arguments {
+			if arg.Name.Value == "first" {
+				if n, ok := a.intValue(arg.Value); ok && n > 0 {
+					first = min(n, maxPageSize)
+				}
+			}
+		}
+		return first
+	}
+	if graphqlListFields[name] {
+		return graphqlListCost
+	}
+	return 1
+}
+
+func (a *queryAnalyzer) intValue(value ast.Value) (int, bool) {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil
+	case *ast.Variable:
+		// JSONの数値はfloat64になる
+		if f, ok := a.variables[v.Name.Value].(float64); ok {
+			return int(f), true
+		}
+	}
+	return 0, false
+}
+
+// checkは見積もりが上限を超えていればエラーを返します。
+func (limits GraphQLLimits) check(cost QueryCost) error {
+	if cost.Depth > limits.MaxDepth {
+		return &graphqlError{
+			message: fmt.Sprintf("query depth %d exceeds the limit of %d", cost.Depth, limits.MaxDepth),
+			code:    "QUERY_TOO_DEEP",
+		}
+	}
+	if cost.Complexity > limits.MaxComplexity {
+		return &graphqlError{
+			message: fmt.Sprintf("query complexity %d exceeds the limit of %d", cost.Complexity, limits.MaxComplexity),
+			code:    "QUERY_TOO_COMPLEX",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// batchLoaderはGraphQLのリゾルバーが要求したキーを集め、1回の問い合わせでまとめて読み込みます。
+//
+// loadはキーを登録してサンクを返すだけで、問い合わせは最初のサンクが呼ばれたときに、それまでに登録されたキーの分をまとめて行います。
+// graphql-goはサンクを同じ深さのフィールドの解決がすべて終わってから呼ぶので、一覧のTODOごとの親・作成者・サブタスクは
+// 深さごとに1回の問い合わせになります（N+1を避ける）。読み込んだ結果はリクエストの間キャッシュします。
+type batchLoader[V any] struct {
+	fetch func(keys []int) (map[int]V, error)
+
+	mu      sync.Mutex
+	pending []int
+	done    map[int]bool
+	values  map[int]V
+	errs    map[int]error
+}
+
+func newBatchLoader[V any](fetch func(keys []int) (map[int]V, error)) *batchLoader[V] {
+	return &batchLoader[V]{fetch: fetch, done: map[int]bool{}, values: map[int]V{}, errs: map[int]error{}}
+}
+
+// loadはキーを次の問い合わせに加え、値を返すサンクを返します。キーに対応する値が無ければサンクのokはfalseです。
+func (l *batchLoader[V]) load(key int) func() (V, bool, error) {
+	l.mu.Lock()
+	if !l.done[key] && !slices.Contains(l.pending, key) {
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, bool, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if !l.done[key] {
+			l.flush()
+		}
+		v, ok := l.values[key]
+		return v, ok, l.errs[key]
+	}
+}
+
+// flushは登録済みのキーをまとめて読み込みます。l.muを持って呼びます。
+func (l *batchLoader[V]) flush() {
+	keys := l.pending
+	l.pending = nil
+	values, err := l.fetch(keys)
+	for _, key := range keys {
+		l.done[key] = true
+		if err != nil {
+			l.errs[key] = err
+			continue
+		}
+		if v, ok := values[key]; ok {
+			l.values[key] = v
+		}
+	}
+}
+
+// graphqlLoadersはGraphQLの1リクエストで使うローダーです。
+type graphqlLoaders struct {
+	todos    *batchLoader[Todo]   // IDで引くTODO（親TODO）
+	subtasks *batchLoader[[]Todo] // 親TODOのIDで引くサブタスク
+	users    *batchLoader[User]
+	lists    *batchLoader[List]
+}
+
+func newGraphQLLoaders(ctx context.Context, repo *TodoRepository, userID int) *graphqlLoaders {
+	return &graphqlLoaders{
+		todos: newBatchLoader(func(ids []int) (map[int]Todo, error) {
+			todos, err := repo.FindAll(ctx, userID, TodoFilter{IDs: ids})
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int]Todo, len(todos))
+			for _, t := range todos {
+				byID[t.ID] = t
+			}
+			return byID, nil
+		}),
+		subtasks: newBatchLoader(func(parentIDs []int) (map[int][]Todo, error) {
+			todos, err := repo.FindAll(ctx, userID, TodoFilter{ParentIDs: parentIDs})
+			if err != nil {
+				return nil, err
+			}
+			byParent := make(map[int][]Todo, len(parentIDs))
+			for _, t := range todos {
+				byParent[*t.ParentID] = append(byParent[*t.ParentID], t)
+			}
+			return byParent, nil
+		}),
+		users: newBatchLoader(func(ids []int) (map[int]User, error) {
+			users, err := repo.FindUsersByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int]User, len(users))
+			for _, u := range users {
+				byID[u.ID] = u
+			}
+			return byID, nil
+		}),
+		// TODOが見えるならそのリストのメンバーなので、ログインユーザーのリストを1回読めば足りる
+		lists: newBatchLoader(func([]int) (map[int]List, error) {
+			lists, err := repo.FindListsByUser(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int]List, len(lists))
+			for _, l := range lists {
+				byID[l.ID] = l
+			}
+			return byID, nil
+		}),
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeQuery(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		variables      map[string]any
+		wantDepth      int
+		wantComplexity int
+	}{
+		{"flat", `{ me { id email } }`, nil, 2, 3},
+		// todos(first: 2): 1 + 2 * (edges(1 + node(1 + id + name)) + pageInfo(1 + hasNextPage))
+		{"connection", `{ todos(first: 2) { edges { node { id name } } pageInfo { hasNextPage } } }`, nil, 4, 1 + 2*(4+2)},
+		{"connection from variable", `query($n: Int) { todos(first: $n) { edges { cursor } } }`, map[string]any{"n": float64(3)}, 3, 1 + 3*2},
+		{"default page size", `{ todos { edges { cursor } } }`, nil, 3, 1 + defaultPageSize*2},
+		{"list field", `{ todo(id: 1) { subtasks { id } } }`, nil, 3, 1 + 1 + graphqlListCost},
+		{"fragments", `{ todo(id: 1) { ...f } } fragment f on Todo { id parent { id } }`, nil, 3, 1 + 1 + 2},
+		{"introspection is free", `{ __schema { types { name } } me { id } }`, nil, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if !assert.NoError(t, err) {
+				return
+			}
+			op, err := selectOperation(doc, "")
+			if !assert.NoError(t, err) {
+				return
+			}
+			cost := analyzeQuery(doc, op, tt.variables)
+			assert.Equal(t, tt.wantDepth, cost.Depth)
+			assert.Equal(t, tt.wantComplexity, cost.Complexity)
+		})
+	}
+
+	// 循環するフラグメントでも止まる（エラーは実行前の検証で返る）
+	doc, err := parser.Parse(parser.ParseParams{Source: `{ todo(id: 1) { ...a } } fragment a on Todo { parent { ...a } }`})
+	assert.NoError(t, err)
+	op, _ := selectOperation(doc, "")
+	assert.Equal(t, 2, analyzeQuery(doc, op, nil).Depth)
+}
+
+func TestBatchLoader(t *testing.T) {
+	var calls [][]int
+	loader := newBatchLoader(func(keys []int) (map[int]string, error) {
+		calls = append(calls, keys)
+		values := map[int]string{}
+		for _, k := range keys {
+			if k != 3 {
+				values[k] = "v" + string(rune('0'+k))
+			}
+		}
+		return values, nil
+	})
+
+	// サンクを呼ぶ前に登録したキーは1回の問い合わせにまとまる
+	a, b, missing, again := loader.load(1), loader.load(2), loader.load(3), loader.load(1)
+	v, ok, err := a()
+	assert.Equal(t, "v1", v)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	v, ok, _ = b()
+	assert.Equal(t, "v2", v)
+	assert.True(t, ok)
+	_, ok, err = missing()
+	assert.False(t, ok)
+	assert.NoError(t, err)
+	v, _, _ = again()
+	assert.Equal(t, "v1", v)
+	assert.Equal(t, [][]int{{1, 2, 3}}, calls)
+
+	// 読み込み済みのキーはキャッシュから返す
+	v, _, _ = loader.load(2)()
+	assert.Equal(t, "v2", v)
+	assert.Len(t, calls, 1)
+
+	failing := newBatchLoader(func(keys []int) (map[int]string, error) {
+		return nil, errors.New("db is down")
+	})
+	_, _, err = failing.load(1)()
+	assert.EqualError(t, err, "db is down")
+}
+
+func postGraphQL(router *gin.Engine, token, query string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]any{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGraphQLHandlerRejectsBeforeExecuting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sessions := NewSessionRegistry(nil, time.Minute)
+	router := gin.New()
+	// リポジトリがnilなので、実行まで進むとpanicする
+	handler := NewGraphQLHandler(nil, GraphQLLimits{MaxDepth: 3, MaxComplexity: 50})
+	router.POST("/graphql", authMiddleware(nil, sessions), errorHandler(handler.serve))
+
+	token, err := issueToken(User{ID: 7, Role: "user"}, "session-a", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	post := func(query string) (int, string) {
+		w := postGraphQL(router, token, query)
+		var body struct {
+			Errors []struct {
+				Message    string         `json:"message"`
+				Extensions map[string]any `json:"extensions"`
+			} `json:"errors"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if len(body.Errors) == 0 {
+			return w.Code, ""
+		}
+		code, _ := body.Errors[0].Extensions["code"].(string)
+		return w.Code, code
+	}
+
+	status, code := post(`{ todo(id: 1) { parent { parent { id } } } }`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "QUERY_TOO_DEEP", code)
+
+	status, code = post(`{ todos(first: 100) { edges { cursor } } }`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "QUERY_TOO_COMPLEX", code)
+
+	status, _ = post(`{ todos(`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, code = post(`query a { me { id } } query b { me { id } }`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "BAD_USER_INPUT", code)
+
+	w := postGraphQL(router, "", `{ me { id } }`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"2026learning_curriculum_design_doc/day60/todopb"
+)
+
+// grpcPublicMethodsは認証なしで呼べるgRPCのメソッドです（ログイン）。
+var grpcPublicMethods = map[string]bool{
+	todopb.AuthService_Login_FullMethodName:              true,
+	todopb.AuthService_VerifySecondFactor_FullMethodName: true,
+}
+
+// grpcMethodScopesはパーソナルアクセストークンで呼べるgRPCのメソッドと、必要なスコープです。
+// RESTのtokenRoutesと同じく、ここに無いメソッドはログインセッションが必要です。
+var grpcMethodScopes = map[string]string{
+	todopb.TodoService_GetTodo_FullMethodName:    ScopeTodosRead,
+	todopb.TodoService_ListTodos_FullMethodName:  ScopeTodosRead,
+	todopb.TodoService_WatchTodos_FullMethodName: ScopeTodosRead,
+	todopb.TodoService_CreateTodo_FullMethodName: ScopeTodosWrite,
+	todopb.TodoService_UpdateTodo_FullMethodName: ScopeTodosWrite,
+	todopb.TodoService_DeleteTodo_FullMethodName: ScopeTodosWrite,
+}
+
+// principalContextKeyは認証済みのPrincipalをgRPCのcontext.Contextに置くキーです。
+type principalContextKey struct{}
+
+// grpcPrincipalは認証済みの呼び出しのPrincipalを返します。grpcAuthorizeを通ったメソッドでだけ呼べます。
+func grpcPrincipal(ctx context.Context) *Principal {
+	return ctx.Value(principalContextKey{}).(*Principal)
+}
+
+// grpcAuthorizeはメタデータの"authorization"をauthMiddlewareと同じauthenticateで検証し、Principalを置いたコンテキストを返します。
+// パーソナルアクセストークンはgrpcMethodScopesで呼べるメソッドとスコープを制限します。
+func grpcAuthorize(ctx context.Context, repo *TodoRepository, sessions *SessionRegistry, method string) (context.Context, error) {
+	if grpcPublicMethods[method] {
+		return ctx, nil
+	}
+	var authHeader string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authHeader = values[0]
+		}
+	}
+	principal, err := authenticate(ctx, repo, sessions, authHeader)
+	if err != nil {
+		return nil, err
+	}
+	if principal.IsToken() {
+		scope, ok := grpcMethodScopes[method]
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "This method requires a login session")
+		}
+		if !principal.HasScope(scope) {
+			return nil, status.Error(codes.PermissionDenied, "Token is missing scope "+scope)
+		}
+	}
+	return context.WithValue(ctx, principalContextKey{}, principal), nil
+}
+
+// grpcErrorはハンドラが返したエラーをgRPCのステータスに変換します。
+// 変換の規則はHTTPのerrorHandlerと同じで、ステータスコードだけがgRPCのものになります。
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	log.Printf("Error occurred: %v", err)
+
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) || errors.Is(err, ErrInvalidInput) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, ErrTooLarge) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if errors.Is(err, ErrForbidden) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, ErrUnauthenticated) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if errors.Is(err, ErrNotFound) {
+		return status.Error(codes.NotFound, "Not Found")
+	}
+	dbErr := translateDBError(err)
+	var conflict *ConflictError
+	if errors.As(dbErr, &conflict) {
+		return status.Error(codes.AlreadyExists, conflictMessage(conflict.Constraint))
+	}
+	if errors.Is(dbErr, ErrTimeout) {
+		return status.Error(codes.DeadlineExceeded, "The database did not respond in time")
+	}
+	if errors.Is(dbErr, ErrUnavailable) {
+		return status.Error(codes.Unavailable, "The database is busy, please retry")
+	}
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return status.Error(codes.Unauthenticated, "Invalid email or password")
+	}
+	// ストリームの途中でクライアントが切断した、またはサーバーが停止した場合
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Internal, "Internal Server Error")
+}
+
+// authenticatedStreamはPrincipalを置いたコンテキストを返すgrpc.ServerStreamです。
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcUnaryInterceptorは単項のメソッドの認証・認可とエラーの変換を行います。
+func grpcUnaryInterceptor(repo *TodoRepository, sessions *SessionRegistry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := grpcAuthorize(ctx, repo, sessions, info.FullMethod)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		resp, err := handler(ctx, req)
+		return resp, grpcError(err)
+	}
+}
+
+// grpcStreamInterceptorはストリームのメソッドの認証・認可とエラーの変換を行います。
+func grpcStreamInterceptor(repo *TodoRepository, sessions *SessionRegistry) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := grpcAuthorize(ss.Context(), repo, sessions, info.FullMethod)
+		if err != nil {
+			return grpcError(err)
+		}
+		return grpcError(handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx}))
+	}
+}
+
+// grpcSessionClientはgRPCの呼び出し元のクライアントを返します。
+func grpcSessionClient(ctx context.Context) SessionClient {
+	var client SessionClient
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			client.UserAgent = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+	return client
+}
+
+// newGRPCServerはAuthServiceとTodoServiceを登録したgRPCサーバーを作ります。
+// WatchTodosのストリームはwatchIntervalごとに変更を確かめ、doneが閉じられると終わります（GracefulStopの前に閉じてください）。
+func newGRPCServer(repo *TodoRepository, sessions *SessionRegistry, watchInterval time.Duration, done <-chan struct{}) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcUnaryInterceptor(repo, sessions)),
+		grpc.StreamInterceptor(grpcStreamInterceptor(repo, sessions)),
+	)
+	todopb.RegisterAuthServiceServer(server, NewAuthGRPCServer(repo))
+	todopb.RegisterTodoServiceServer(server, NewTodoGRPCServer(repo, sessions, watchInterval, done))
+	return server
+}
+
+// stopGRPCServerはサーバーをGracefulStopし、ctxの期限までに終わらなければ実行中の呼び出しを打ち切ります。
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("gRPC server forced to stop")
+		server.Stop()
+		<-stopped
+	}
+}
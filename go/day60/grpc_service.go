@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"2026learning_curriculum_design_doc/day60/todopb"
+)
+
+const (
+	// defaultPageSizeとmaxPageSizeはListTodosの1ページの件数の既定値と上限です。
+	defaultPageSize = 50
+	maxPageSize     = 200
+	// watchBatchSizeはWatchTodosで1回に読む変更の件数です。溜まっていれば待たずに続けて読みます。
+	watchBatchSize = 100
+	// watchCommitLagはWatchTodosが読み直す直近の期間です。監査ログのIDはコミットの順ではないので、
+	// この期間に書かれた変更は、小さいIDの変更が後からコミットされていないか毎回読み直します（分単位、DB_QUERY_TIMEOUTより長くする）。
+	watchCommitLag = time.Minute
+)
+
+// AuthGRPCServerはgRPCのAuthServiceです。RESTの/loginと/login/2faと同じ処理でログインします。
+type AuthGRPCServer struct {
+	todopb.UnimplementedAuthServiceServer
+	repo *TodoRepository
+}
+
+func NewAuthGRPCServer(repo *TodoRepository) *AuthGRPCServer {
+	return &AuthGRPCServer{repo: repo}
+}
+
+func (s *AuthGRPCServer) Login(ctx context.Context, req *todopb.LoginRequest) (*todopb.LoginResponse, error) {
+	if req.GetEmail() == "" || req.GetPassword() == "" {
+		return nil, fmt.Errorf("%w: email and password are required", ErrInvalidInput)
+	}
+	result, err := loginWithPassword(ctx, s.repo, req.GetEmail(), req.GetPassword(), grpcSessionClient(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &todopb.LoginResponse{Token: result.Token, MfaRequired: result.MFARequired, ChallengeToken: result.ChallengeToken}, nil
+}
+
+func (s *AuthGRPCServer) VerifySecondFactor(ctx context.Context, req *todopb.VerifySecondFactorRequest) (*todopb.LoginResponse, error) {
+	if req.GetChallengeToken() == "" {
+		return nil, fmt.Errorf("%w: challenge_token is required", ErrInvalidInput)
+	}
+	input := SecondFactorInput{Code: req.GetCode(), RecoveryCode: req.GetRecoveryCode()}
+	result, err := loginWithSecondFactor(ctx, s.repo, req.GetChallengeToken(), input, grpcSessionClient(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &todopb.LoginResponse{Token: result.Token}, nil
+}
+
+// TodoGRPCServerはgRPCのTodoServiceです。RESTのTodoHandlerと同じリポジトリのメソッドを使います。
+type TodoGRPCServer struct {
+	todopb.UnimplementedTodoServiceServer
+	repo          *TodoRepository
+	sessions      *SessionRegistry
+	watchInterval time.Duration
+	done          <-chan struct{}
+}
+
+func NewTodoGRPCServer(repo *TodoRepository, sessions *SessionRegistry, watchInterval time.Duration, done <-chan struct{}) *TodoGRPCServer {
+	if watchInterval <= 0 {
+		watchInterval = time.Second
+	}
+	return &TodoGRPCServer{repo: repo, sessions: sessions, watchInterval: watchInterval, done: done}
+}
+
+// todoToProtoはTodoをgRPCのメッセージに変換します。
+func todoToProto(t Todo) *todopb.Todo {
+	pb := &todopb.Todo{
+		Id:         int64(t.ID),
+		Name:       t.Name,
+		UserId:     int64(t.UserID),
+		ListId:     int64(t.ListID),
+		Completed:  t.Completed,
+		Recurrence: t.Recurrence,
+		Tags:       make([]string, 0, len(t.Tags)),
+	}
+	if t.ParentID != nil {
+		parentID := int64(*t.ParentID)
+		pb.ParentId = &parentID
+	}
+	if t.DueAt != nil {
+		pb.DueAt = timestamppb.New(*t.DueAt)
+	}
+	for _, tag := range t.Tags {
+		pb.Tags = append(pb.Tags, tag.Name)
+	}
+	return pb
+}
+
+// protoTimeは省略可能なタイムスタンプを*time.Timeに変換します。
+func protoTime(ts *timestamppb.Timestamp) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	t := ts.AsTime()
+	return &t, nil
+}
+
+// protoIDはリクエストのIDを正の整数として読み取ります。
+func protoID(id int64, name string) (int, error) {
+	if id <= 0 || id > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidInput, name)
+	}
+	return int(id), nil
+}
+
+func (s *TodoGRPCServer) CreateTodo(ctx context.Context, req *todopb.CreateTodoRequest) (*todopb.Todo, error) {
+	if req.GetName() == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	todo := Todo{Name: req.GetName(), UserID: grpcPrincipal(ctx).UserID}
+	if req.GetListId() != 0 {
+		listID, err := protoID(req.GetListId(), "list_id")
+		if err != nil {
+			return nil, err
+		}
+		todo.ListID = listID
+	}
+	if req.ParentId != nil {
+		parentID, err := protoID(req.GetParentId(), "parent_id")
+		if err != nil {
+			return nil, err
+		}
+		todo.ParentID = &parentID
+	}
+	dueAt, err := protoTime(req.GetDueAt())
+	if err != nil {
+		return nil, err
+	}
+	todo.DueAt = dueAt
+	if req.GetRecurrence() != "" {
+		rule, err := ParseRecurrenceRule(req.GetRecurrence())
+		if err != nil {
+			return nil, err
+		}
+		todo.Recurrence = rule.String()
+	}
+	created, err := s.repo.CreateTodoWithAudit(ctx, todo)
+	if err != nil {
+		return nil, err
+	}
+	return todoToProto(created), nil
+}
+
+func (s *TodoGRPCServer) GetTodo(ctx context.Context, req *todopb.GetTodoRequest) (*todopb.Todo, error) {
+	id, err := protoID(req.GetId(), "id")
+	if err != nil {
+		return nil, err
+	}
+	todo, err := s.repo.FindTodo(ctx, grpcPrincipal(ctx).UserID, id)
+	if err != nil {
+		return nil, err
+	}
+	return todoToProto(todo), nil
+}
+
+func (s *TodoGRPCServer) UpdateTodo(ctx context.Context, req *todopb.UpdateTodoRequest) (*todopb.Todo, error) {
+	id, err := protoID(req.GetId(), "id")
+	if err != nil {
+		return nil, err
+	}
+	if req.GetName() == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	dueAt, err := protoTime(req.GetDueAt())
+	if err != nil {
+		return nil, err
+	}
+	userID := grpcPrincipal(ctx).UserID
+	if _, err := s.repo.UpdateTodoWithAudit(ctx, userID, Todo{ID: id, Name: req.GetName(), DueAt: dueAt}); err != nil {
+		return nil, err
+	}
+	todo, err := s.repo.FindTodo(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return todoToProto(todo), nil
+}
+
+func (s *TodoGRPCServer) DeleteTodo(ctx context.Context, req *todopb.DeleteTodoRequest) (*emptypb.Empty, error) {
+	id, err := protoID(req.GetId(), "id")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteTodoWithAudit(ctx, grpcPrincipal(ctx).UserID, id); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// encodePageTokenとdecodePageTokenはListTodosのページトークン（前のページの最後のTODOのID）を変換します。
+// クライアントには中身に依存させないため、不透明な文字列として返します。
+func encodePageToken(lastID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(lastID)))
+}
+
+func decodePageToken(token string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: page_token is invalid", ErrInvalidInput)
+	}
+	id, err := strconv.Atoi(string(b))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: page_token is invalid", ErrInvalidInput)
+	}
+	return id, nil
+}
+
+// ListTodosはTODOをID順にページ分けして返します。ページトークンは前のページの最後のIDなので、ページの間に追加・削除されても重複や抜けはありません。
+func (s *TodoGRPCServer) ListTodos(ctx context.Context, req *todopb.ListTodosRequest) (*todopb.ListTodosResponse, error) {
+	filter := TodoFilter{Tags: req.GetTags(), TagMatch: TagMatchAny}
+	if req.GetMatchAllTags() {
+		filter.TagMatch = TagMatchAll
+	}
+	if req.GetListId() != 0 {
+		listID, err := protoID(req.GetListId(), "list_id")
+		if err != nil {
+			return nil, err
+		}
+		filter.ListID = listID
+	}
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, fmt.Errorf("%w: page_size must not be negative", ErrInvalidInput)
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+	if req.GetPageToken() != "" {
+		afterID, err := decodePageToken(req.GetPageToken())
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterID = afterID
+	}
+	// 1件多く読んで、次のページがあるかを確かめる
+	filter.Limit = pageSize + 1
+
+	todos, err := s.repo.FindAll(ctx, grpcPrincipal(ctx).UserID, filter)
+	if err != nil {
+		return nil, err
+	}
+	resp := &todopb.ListTodosResponse{}
+	if len(todos) > pageSize {
+		todos = todos[:pageSize]
+		resp.NextPageToken = encodePageToken(todos[len(todos)-1].ID)
+	}
+	resp.Todos = make([]*todopb.Todo, 0, len(todos))
+	for _, t := range todos {
+		resp.Todos = append(resp.Todos, todoToProto(t))
+	}
+	return resp, nil
+}
+
+// WatchTodosは閲覧できるTODOの変更を監査ログから読み、送り続けます。
+// 新しい変更はwatchIntervalごとに確かめます。クライアントが切断するか、サーバーが停止するか、セッションが取り消されるまで終わりません。
+//
+// 監査ログのIDは書き込んだときに決まり、見えるのはコミットの後なので、IDの順に読むだけでは後からコミットされた小さいIDの変更を飛ばしてしまいます。
+// そこでwatchCommitLagより前の変更（floor以下）だけを読み終えたものとし、それより後は毎回読み直して、送ったIDで重複を除きます。
+// そのため変更はIDの順に届くとは限りません。
+func (s *TodoGRPCServer) WatchTodos(req *todopb.WatchTodosRequest, stream grpc.ServerStreamingServer[todopb.TodoEvent]) error {
+	ctx := stream.Context()
+	principal := grpcPrincipal(ctx)
+	if req.GetAfterEventId() < 0 {
+		return fmt.Errorf("%w: after_event_id must not be negative", ErrInvalidInput)
+	}
+	settled, err := s.repo.SettledTodoEventID(ctx, watchCommitLag)
+	if err != nil {
+		return err
+	}
+	// sentはfloorより後で、送った（または送らずに済ませた）変更のID
+	sent := map[int]bool{}
+	floor := int(req.GetAfterEventId())
+	if floor == 0 {
+		// 呼び出した時点までにコミットされた変更は送らない
+		latest, err := s.repo.LatestTodoEventID(ctx)
+		if err != nil {
+			return err
+		}
+		ids, err := s.repo.FindTodoEventIDs(ctx, settled, latest)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			sent[id] = true
+		}
+		floor = latest
+	}
+	// 再接続では、指定されたIDより前でも後からコミットされた変更を送るために読み直す（既に受け取った変更が重複して届くことがある）
+	floor = min(floor, settled)
+	// ここから後の変更が届くことをクライアントが確かめられるように、読み始める位置を決めてからヘッダーを送る
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	for {
+		// ストリームは開いたときにだけ認証するので、取り消されたセッションのストリームはここで終える
+		if principal.SessionID != "" && s.sessions.IsRevoked(principal.SessionID) {
+			return status.Error(codes.Unauthenticated, "session has been revoked")
+		}
+		// 読む前に決めておくと、このID以下の変更は続けて読むときにはすべて見える
+		settled, err := s.repo.SettledTodoEventID(ctx, watchCommitLag)
+		if err != nil {
+			return err
+		}
+		for after := floor; ; {
+			events, err := s.repo.FindTodoEvents(ctx, principal.UserID, after, watchBatchSize)
+			if err != nil {
+				return err
+			}
+			for _, e := range events {
+				if sent[e.ID] {
+					continue
+				}
+				pb := &todopb.TodoEvent{
+					EventId:    int64(e.ID),
+					Operation:  e.Operation,
+					TodoId:     int64(e.TodoID),
+					OccurredAt: timestamppb.New(e.CreatedAt),
+				}
+				if e.Todo != nil {
+					pb.Todo = todoToProto(*e.Todo)
+				}
+				if err := stream.Send(pb); err != nil {
+					return err
+				}
+				sent[e.ID] = true
+			}
+			if len(events) < watchBatchSize {
+				break
+			}
+			after = events[len(events)-1].ID
+		}
+		if settled > floor {
+			floor = settled
+			for id := range sent {
+				if id <= floor {
+					delete(sent, id)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-ticker.C:
+		}
+	}
+}
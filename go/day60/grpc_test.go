@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"2026learning_curriculum_design_doc/day60/todopb"
+)
+
+// startTestGRPCServerはメモリ上の接続でgRPCサーバーを起動し、つながったクライアントの接続を返します。
+func startTestGRPCServer(t *testing.T, repo *TodoRepository, sessions *SessionRegistry) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(repo, sessions, 50*time.Millisecond, make(chan struct{}))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCAuthInterceptor(t *testing.T) {
+	sessions := NewSessionRegistry(nil, time.Minute)
+	conn := startTestGRPCServer(t, nil, sessions)
+	todos := todopb.NewTodoServiceClient(conn)
+	auth := todopb.NewAuthServiceClient(conn)
+
+	token, err := issueToken(User{ID: 7, Role: "user"}, "session-a", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	// メタデータにトークンが無ければ呼べない
+	_, err = todos.GetTodo(context.Background(), &todopb.GetTodoRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "Authorization header is missing")
+
+	_, err = todos.GetTodo(withToken("not-a-jwt"), &todopb.GetTodoRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// 認証を通ると、ハンドラのErrInvalidInputがInvalidArgumentになる（DBには届かない）
+	_, err = todos.GetTodo(withToken(token), &todopb.GetTodoRequest{Id: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = todos.ListTodos(withToken(token), &todopb.ListTodosRequest{PageToken: "!!"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// ストリームもインターセプターを通る
+	stream, err := todos.WatchTodos(context.Background(), &todopb.WatchTodosRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// 取り消したセッションのJWTは拒否される
+	sessions.Revoke("session-a")
+	_, err = todos.GetTodo(withToken(token), &todopb.GetTodoRequest{Id: 0})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// ログインは認証なしで呼べる
+	_, err = auth.Login(context.Background(), &todopb.LoginRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = auth.VerifySecondFactor(context.Background(), &todopb.VerifySecondFactorRequest{ChallengeToken: "bad", Code: "123456"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("%w: id must be a positive integer", ErrInvalidInput), codes.InvalidArgument},
+		{fmt.Errorf("%w: todo", ErrNotFound), codes.NotFound},
+		{fmt.Errorf("%w: viewer", ErrForbidden), codes.PermissionDenied},
+		{ErrTooLarge, codes.ResourceExhausted},
+		{&AuthError{Message: "Invalid token"}, codes.Unauthenticated},
+		{bcrypt.ErrMismatchedHashAndPassword, codes.Unauthenticated},
+		{&pgconn.PgError{Code: "23505", ConstraintName: "tags_user_id_name_unique"}, codes.AlreadyExists},
+		{status.Error(codes.PermissionDenied, "Token is missing scope todos:write"), codes.PermissionDenied},
+		{fmt.Errorf("connection refused"), codes.Internal},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, status.Code(grpcError(tt.err)), tt.err.Error())
+	}
+	assert.NoError(t, grpcError(nil))
+	assert.Equal(t, "Tag with this name already exists",
+		status.Convert(grpcError(&pgconn.PgError{Code: "23505", ConstraintName: "tags_user_id_name_unique"})).Message())
+	assert.Equal(t, "User with this email already exists",
+		status.Convert(grpcError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})).Message())
+	assert.Equal(t, "Resource already exists",
+		status.Convert(grpcError(&pgconn.PgError{Code: "23505", ConstraintName: "some_other_unique"})).Message())
+	// 内部エラーの詳細はクライアントに返さない
+	assert.Equal(t, "Internal Server Error", status.Convert(grpcError(fmt.Errorf("connection refused"))).Message())
+}
+
+func TestPageToken(t *testing.T) {
+	id, err := decodePageToken(encodePageToken(42))
+	assert.NoError(t, err)
+	assert.Equal(t, 42, id)
+
+	for _, token := range []string{"!!", encodePageToken(0), "YWJj"} {
+		_, err := decodePageToken(token)
+		assert.ErrorIs(t, err, ErrInvalidInput, token)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// LoginWithIdentityは外部のIDプロバイダで認証したユーザーを返します。
+//
+// 紐付け済みのアカウントがあればそのユーザーです。無ければ、同じメールアドレスのユーザーに紐付けるか
+// （IDプロバイダがメールアドレスを確認済みの場合だけ）、パスワードを持たないユーザーをその場で作ります。
+// identity.Roleが空でなければ、ログインのたびにユーザーのロールをIDプロバイダのクレームに合わせます。
+func (r *TodoRepository) LoginWithIdentity(ctx context.Context, provider string, identity OIDCIdentity) (User, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var user User
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		var userID int
+		err := tx.QueryRowContext(ctx, `
+			UPDATE user_identities SET email = $3, last_login_at = NOW()
+			WHERE provider = $1 AND subject = $2
+			RETURNING user_id`, provider, identity.Subject, identity.Email).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			userID, err = linkIdentity(ctx, tx, provider, identity)
+		}
+		if err != nil {
+			return err
+		}
+
+		if identity.Role != "" {
+			if _, err := tx.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", identity.Role, userID); err != nil {
+				return err
+			}
+		}
+		user, err = scanUser(tx.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID))
+		return err
+	})
+	return user, err
+}
+
+// linkIdentityは未登録の外部アカウントを既存のユーザーに紐付けるか、新しいユーザーを作って紐付け、ユーザーIDを返します。
+func linkIdentity(ctx context.Context, tx *sql.Tx, provider string, identity OIDCIdentity) (int, error) {
+	var userID int
+	err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE lower(email) = lower($1) FOR UPDATE", identity.Email).Scan(&userID)
+	switch {
+	case err == nil:
+		// 確認されていないメールアドレスで既存のアカウントを乗っ取られないようにする
+		if !identity.EmailVerified {
+			return 0, fmt.Errorf("%w: email %s is registered but not verified by the identity provider", ErrUnauthenticated, identity.Email)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		role := identity.Role
+		if role == "" {
+			role = "user"
+		}
+		// パスワードでログインしないユーザーなのでpassword_hashは空にする（checkPasswordが常に失敗する）
+		err = tx.QueryRowContext(ctx, "INSERT INTO users (email, password_hash, role) VALUES ($1, '', $2) RETURNING id",
+			identity.Email, role).Scan(&userID)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := ensurePersonalList(ctx, tx, userID); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+		userID, provider, identity.Subject, identity.Email)
+	return userID, err
+}
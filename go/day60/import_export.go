@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// インポート・エクスポートのファイル形式
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// 同じ名前のTODOが既にある場合の扱い
+const (
+	DuplicateSkip   = "skip"   // その行を取り込まない
+	DuplicateRename = "rename" // "名前 (2)" のように空いている名前で取り込む
+	DuplicateFail   = "fail"   // その行をエラーにする（インポート全体が取り込まれない）
+)
+
+const (
+	// maxImportRowsは1回のインポートで取り込める行数の上限です。
+	maxImportRows = 5000
+	// maxImportBytesはインポートするファイルの大きさの上限です。
+	maxImportBytes = 10 << 20
+	// tagSeparatorはCSVの1つのセルに複数のタグを入れるときの区切り文字です。
+	tagSeparator = ";"
+)
+
+// exportColumnsはエクスポートするCSVの列です。
+// インポートではこのうちimportFieldsの列だけを読み、id・list_id・parent_idは無視します（新しいTODOとして作成します）。
+var exportColumns = []string{"id", "name", "list_id", "parent_id", "completed", "due_at", "recurrence", "tags"}
+
+// importFieldsはインポートで読む列（マッピング適用後の名前）です。
+var importFields = map[string]bool{"name": true, "completed": true, "due_at": true, "recurrence": true, "tags": true}
+
+// TodoRecordはエクスポート・インポートするTODO 1件分です。タグはユーザー自身のタグの名前です。
+type TodoRecord struct {
+	ID         int        `json:"id,omitempty"`
+	Name       string     `json:"name"`
+	ListID     int        `json:"list_id,omitempty"`
+	ParentID   *int       `json:"parent_id,omitempty"`
+	Completed  bool       `json:"completed"`
+	DueAt      *time.Time `json:"due_at"`
+	Recurrence string     `json:"recurrence,omitempty"`
+	Tags       []string   `json:"tags"`
+	// DeletedAtはゴミ箱に入れた日時です。個人データのエクスポートでだけ使います（CSVには出しません）。
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (rec TodoRecord) csvRow() []string {
+	row := []string{strconv.Itoa(rec.ID), rec.Name, strconv.Itoa(rec.ListID), "", strconv.FormatBool(rec.Completed), "", rec.Recurrence,
+		strings.Join(rec.Tags, tagSeparator)}
+	if rec.ParentID != nil {
+		row[3] = strconv.Itoa(*rec.ParentID)
+	}
+	if rec.DueAt != nil {
+		row[5] = rec.DueAt.Format(time.RFC3339)
+	}
+	return row
+}
+
+// todoEncoderはエクスポートするTODOを1件ずつ書き出します。Beginを最初に、Endを最後に1回だけ呼びます。
+type todoEncoder interface {
+	Begin() error
+	Encode(rec TodoRecord) error
+	End() error
+}
+
+// newTodoEncoderはformatに対応するエンコーダを返します。
+func newTodoEncoder(format string, w io.Writer) (todoEncoder, error) {
+	switch format {
+	case FormatCSV:
+		return &csvTodoEncoder{w: csv.NewWriter(w)}, nil
+	case FormatJSON:
+		return &jsonTodoEncoder{w: w}, nil
+	default:
+		return nil, fmt.Errorf("%w: format must be %q or %q", ErrInvalidInput, FormatCSV, FormatJSON)
+	}
+}
+
+// exportFlushRowsはエクスポート中にバッファをクライアントへ送り出す間隔（行数）です。
+const exportFlushRows = 100
+
+type csvTodoEncoder struct {
+	w *csv.Writer
+	n int
+}
+
+func (e *csvTodoEncoder) Begin() error {
+	return e.w.Write(exportColumns)
+}
+
+func (e *csvTodoEncoder) Encode(rec TodoRecord) error {
+	if err := e.w.Write(rec.csvRow()); err != nil {
+		return err
+	}
+	e.n++
+	if e.n%exportFlushRows == 0 {
+		e.w.Flush()
+		return e.w.Error()
+	}
+	return nil
+}
+
+func (e *csvTodoEncoder) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonTodoEncoderはTODOの配列を1要素ずつ書き出します（全件をメモリに載せずに済むように）。
+type jsonTodoEncoder struct {
+	w io.Writer
+	n int
+}
+
+func (e *jsonTodoEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonTodoEncoder) Encode(rec TodoRecord) error {
+	if rec.Tags == nil {
+		rec.Tags = []string{}
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if e.n == 0 {
+		sep = "\n"
+	}
+	e.n++
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonTodoEncoder) End() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+// importSourceはインポートするファイルの1行分です。列名はマッピング適用後の名前で、値はCSVなら文字列、JSONならデコードした値です。
+type importSource struct {
+	Row    int
+	Fields map[string]any
+}
+
+// columnMapperは入力の列名をインポートの列名に変換します。
+// mappingにあればその名前に、なければ小文字にして空白を_にした名前にします（"Due At" → "due_at"）。
+type columnMapper struct {
+	mapping map[string]string
+	ignored map[string]bool
+}
+
+func newColumnMapper(mapping map[string]string) *columnMapper {
+	m := &columnMapper{mapping: map[string]string{}, ignored: map[string]bool{}}
+	for from, to := range mapping {
+		m.mapping[strings.ToLower(strings.TrimSpace(from))] = strings.ToLower(strings.TrimSpace(to))
+	}
+	return m
+}
+
+// fieldは列名を変換します。インポートで読まない列なら空文字を返し、無視した列として記録します。
+func (m *columnMapper) field(column string) string {
+	key := strings.ToLower(strings.TrimSpace(column))
+	name, ok := m.mapping[key]
+	if !ok {
+		name = strings.ReplaceAll(key, " ", "_")
+	}
+	if !importFields[name] {
+		m.ignored[column] = true
+		return ""
+	}
+	return name
+}
+
+// ignoredColumnsは無視した列名を並べて返します。
+func (m *columnMapper) ignoredColumns() []string {
+	columns := []string{}
+	for c := range m.ignored {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// validateMappingはマッピング先がインポートで読む列であることを確認します。
+func validateMapping(mapping map[string]string) error {
+	for from, to := range mapping {
+		if !importFields[strings.ToLower(strings.TrimSpace(to))] {
+			return fmt.Errorf("%w: column %q is mapped to unknown field %q", ErrInvalidInput, from, to)
+		}
+	}
+	return nil
+}
+
+// parseImportはCSV（1行目がヘッダ）またはJSON（オブジェクトの配列）を読み、行ごとの値と無視した列名を返します。
+func parseImport(format string, r io.Reader, mapping map[string]string) ([]importSource, []string, error) {
+	if err := validateMapping(mapping); err != nil {
+		return nil, nil, err
+	}
+	mapper := newColumnMapper(mapping)
+	var sources []importSource
+	var err error
+	switch format {
+	case FormatCSV:
+		sources, err = parseImportCSV(r, mapper)
+	case FormatJSON:
+		sources, err = parseImportJSON(r, mapper)
+	default:
+		err = fmt.Errorf("%w: format must be %q or %q", ErrInvalidInput, FormatCSV, FormatJSON)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sources) > maxImportRows {
+		return nil, nil, fmt.Errorf("%w: at most %d rows can be imported at once", ErrInvalidInput, maxImportRows)
+	}
+	return sources, mapper.ignoredColumns(), nil
+}
+
+func parseImportCSV(r io.Reader, mapper *columnMapper) ([]importSource, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // 列数の違いは行ごとのエラーではなく空の値として扱う
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: CSV is empty", ErrInvalidInput)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSV: %w", ErrInvalidInput, err)
+	}
+	// Excelが付けるBOMを取り除く
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	fields := make([]string, len(header))
+	hasName := false
+	for i, column := range header {
+		fields[i] = mapper.field(column)
+		hasName = hasName || fields[i] == "name"
+	}
+	if !hasName {
+		return nil, fmt.Errorf("%w: CSV has no name column", ErrInvalidInput)
+	}
+
+	var sources []importSource
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid CSV: %w", ErrInvalidInput, err)
+		}
+		if len(sources) >= maxImportRows {
+			return nil, fmt.Errorf("%w: at most %d rows can be imported at once", ErrInvalidInput, maxImportRows)
+		}
+		values := map[string]any{}
+		for i, value := range record {
+			if i < len(fields) && fields[i] != "" {
+				values[fields[i]] = value
+			}
+		}
+		sources = append(sources, importSource{Row: row, Fields: values})
+	}
+	return sources, nil
+}
+
+func parseImportJSON(r io.Reader, mapper *columnMapper) ([]importSource, error) {
+	var objects []map[string]any
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&objects); err != nil {
+		return nil, fmt.Errorf("%w: JSON must be an array of objects: %w", ErrInvalidInput, err)
+	}
+	sources := make([]importSource, 0, len(objects))
+	for i, object := range objects {
+		values := map[string]any{}
+		for key, value := range object {
+			if field := mapper.field(key); field != "" {
+				values[field] = value
+			}
+		}
+		sources = append(sources, importSource{Row: i + 1, Fields: values})
+	}
+	return sources, nil
+}
+
+// decodeImportRecordは1行分の値をTodoRecordに変換します。
+// 期限にタイムゾーンが無い場合（"2026-01-02" や "2026-01-02 09:00"）はlocの時刻として扱います。
+func decodeImportRecord(fields map[string]any, loc *time.Location) (TodoRecord, error) {
+	var rec TodoRecord
+	name, err := stringField(fields, "name")
+	if err != nil {
+		return rec, err
+	}
+	rec.Name = strings.TrimSpace(name)
+	if rec.Name == "" {
+		return rec, errors.New("name is required")
+	}
+
+	switch v := fields["completed"].(type) {
+	case nil:
+	case bool:
+		rec.Completed = v
+	case string:
+		if rec.Completed, err = parseImportBool(v); err != nil {
+			return rec, err
+		}
+	default:
+		return rec, errors.New("completed must be a boolean")
+	}
+
+	dueAt, err := stringField(fields, "due_at")
+	if err != nil {
+		return rec, err
+	}
+	if dueAt = strings.TrimSpace(dueAt); dueAt != "" {
+		t, err := parseImportTime(dueAt, loc)
+		if err != nil {
+			return rec, err
+		}
+		rec.DueAt = &t
+	}
+
+	recurrence, err := stringField(fields, "recurrence")
+	if err != nil {
+		return rec, err
+	}
+	if recurrence = strings.TrimSpace(recurrence); recurrence != "" {
+		rule, err := ParseRecurrenceRule(recurrence)
+		if err != nil {
+			// 行ごとのエラーとして返すので "invalid input: " は付けない
+			return rec, errors.New(strings.TrimPrefix(err.Error(), ErrInvalidInput.Error()+": "))
+		}
+		if rec.DueAt == nil {
+			return rec, errors.New("due_at is required for a recurring todo")
+		}
+		rec.Recurrence = rule.String()
+	}
+
+	var tags []string
+	switch v := fields["tags"].(type) {
+	case nil:
+	case string:
+		tags = strings.Split(v, tagSeparator)
+	case []any:
+		for _, tag := range v {
+			s, ok := tag.(string)
+			if !ok {
+				return rec, errors.New("tags must be strings")
+			}
+			tags = append(tags, s)
+		}
+	default:
+		return rec, errors.New("tags must be a string or an array of strings")
+	}
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			if len([]rune(tag)) > 50 {
+				return rec, fmt.Errorf("tag %q is longer than 50 characters", tag)
+			}
+			rec.Tags = append(rec.Tags, tag)
+		}
+	}
+	rec.Tags = uniqueStrings(rec.Tags)
+	return rec, nil
+}
+
+// stringFieldは文字列の値を返します。値がなければ空文字です。
+func stringField(fields map[string]any, name string) (string, error) {
+	switch v := fields[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+}
+
+// parseImportBoolは表計算ソフトでよく使われる真偽値の表記を受け付けます。
+func parseImportBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "0", "no", "n":
+		return false, nil
+	case "true", "1", "yes", "y", "x", "done":
+		return true, nil
+	default:
+		return false, fmt.Errorf("completed must be true or false, got %q", s)
+	}
+}
+
+// importTimeLayoutsはタイムゾーンの無い期限の書式です。
+var importTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "2006/01/02 15:04", "2006/01/02"}
+
+func parseImportTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range importTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("due_at %q is not a valid date or RFC 3339 time", s)
+}
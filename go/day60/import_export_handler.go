@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportTodosはTODOをCSVまたはJSONで書き出します。全件を組み立ててから返すのではなく、DBから読みながら送ります。
+func (h *TodoHandler) exportTodos(c *gin.Context) error {
+	format := c.DefaultQuery("format", FormatCSV)
+	enc, err := newTodoEncoder(format, c.Writer)
+	if err != nil {
+		return err
+	}
+	listID, err := optionalIDQuery(c, "list_id")
+	if err != nil {
+		return err
+	}
+
+	// 最初の行を書くまではエラーを通常どおりerrorHandlerで返せるよう、ヘッダの送信を遅らせる
+	started := false
+	begin := func() error {
+		started = true
+		contentType := "text/csv; charset=utf-8"
+		if format == FormatJSON {
+			contentType = "application/json; charset=utf-8"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="todos-%s.%s"`, time.Now().Format("20060102"), format))
+		c.Status(http.StatusOK)
+		return enc.Begin()
+	}
+	rows := 0
+	err = h.repo.ExportTodos(c.Request.Context(), currentUserID(c), listID, func(rec TodoRecord) error {
+		if !started {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = begin()
+	}
+	if err == nil {
+		err = enc.End()
+	}
+	if err != nil && started {
+		// 既にステータスと本文の一部を送っているので、ログに残して接続を打ち切るしかない
+		log.Printf("Export failed after %d rows: %v", rows, err)
+		c.Abort()
+		return nil
+	}
+	return err
+}
+
+// importTodosはCSVまたはJSONのTODOをまとめて取り込みます。
+// ファイルは本文にそのまま、またはmultipart/form-dataのfileフィールドで送ります。
+//
+//	format=csv|json                  省略時はContent-Typeやファイル名の拡張子から判断する
+//	map[<列名>]=<name|completed|due_at|recurrence|tags>  列名の対応付け（例: map[タイトル]=name）
+//	on_duplicate=skip|rename|fail    名前が重複した行の扱い（既定値はfail）
+//	dry_run=true                     検証だけ行い、行ごとの結果を返す
+//	list_id=N                        取り込み先のリスト（省略時は個人リスト）
+func (h *TodoHandler) importTodos(c *gin.Context) error {
+	onDuplicate := c.DefaultQuery("on_duplicate", DuplicateFail)
+	if onDuplicate != DuplicateSkip && onDuplicate != DuplicateRename && onDuplicate != DuplicateFail {
+		return fmt.Errorf("%w: on_duplicate must be %q, %q or %q", ErrInvalidInput, DuplicateSkip, DuplicateRename, DuplicateFail)
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		return fmt.Errorf("%w: dry_run must be true or false", ErrInvalidInput)
+	}
+	listID, err := optionalIDQuery(c, "list_id")
+	if err != nil {
+		return err
+	}
+
+	body, format, err := importBody(c)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	sources, ignored, err := parseImport(format, body, c.QueryMap("map"))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return fmt.Errorf("%w: import file must be at most %d MB", ErrTooLarge, maxImportBytes>>20)
+	}
+	if err != nil {
+		return err
+	}
+
+	// タイムゾーンの無い期限はユーザーのタイムゾーンとして扱う
+	userID := currentUserID(c)
+	user, err := h.repo.FindUserByID(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	items := make([]ImportItem, len(sources))
+	for i, src := range sources {
+		rec, err := decodeImportRecord(src.Fields, loc)
+		items[i] = ImportItem{Row: src.Row, Record: rec, Err: err}
+	}
+
+	report, err := h.repo.ImportTodos(c.Request.Context(), userID, items, ImportOptions{
+		ListID:      listID,
+		OnDuplicate: onDuplicate,
+		DryRun:      dryRun,
+	})
+	report.IgnoredColumns = ignored
+	if errors.Is(err, errImportRejected) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("%d of %d rows are invalid; nothing was imported", report.Invalid, report.Total),
+			"report":  report,
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	status := http.StatusCreated
+	if dryRun {
+		status = http.StatusOK
+	}
+	c.JSON(status, report)
+	return nil
+}
+
+// importBodyはインポートするファイルとその形式を返します。
+func importBody(c *gin.Context) (io.ReadCloser, string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	format := c.Query("format")
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	if mediaType == "multipart/form-data" {
+		header, err := c.FormFile("file")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, "", fmt.Errorf("%w: import file must be at most %d MB", ErrTooLarge, maxImportBytes>>20)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: file is required", ErrInvalidInput)
+		}
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		f, err := header.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		return f, format, nil
+	}
+
+	if format == "" {
+		switch {
+		case strings.HasSuffix(mediaType, "json"):
+			format = FormatJSON
+		case strings.HasSuffix(mediaType, "csv"):
+			format = FormatCSV
+		default:
+			return nil, "", fmt.Errorf("%w: specify format=csv or format=json", ErrInvalidInput)
+		}
+	}
+	return c.Request.Body, format, nil
+}
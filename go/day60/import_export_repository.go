@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// インポートの行ごとの結果
+const (
+	ImportCreated = "created" // そのままの名前で作成した（ドライランでは作成できる）
+	ImportRenamed = "renamed" // 名前が重複したので別の名前で作成した
+	ImportSkipped = "skipped" // 名前が重複したので取り込まなかった
+	ImportInvalid = "invalid" // 値が不正、または名前が重複した（on_duplicate=fail）
+)
+
+// maxRenameAttemptsは重複した名前を付け直すときに試す番号の上限です。
+const maxRenameAttempts = 1000
+
+// errImportRejectedは不正な行があったためインポート全体を取り消したことを表します。
+var errImportRejected = fmt.Errorf("%w: import has invalid rows; nothing was imported", ErrInvalidInput)
+
+// exportRecurrenceColumnはエクスポートするrecurrenceの列です。
+// インポートではrecurrenceのある行ごとに新しい繰り返しを作るので、規則は繰り返しの最新の回（期限がlast_due_atの回）にだけ出し、
+// それより前の回は繰り返しの無いTODOとして出します。こうすればエクスポートしたファイルを取り込んでも繰り返しは1つです。
+const exportRecurrenceColumn = `COALESCE((
+				SELECT rule FROM todo_series
+				WHERE todo_series.id = todos.series_id AND todo_series.active AND todo_series.last_due_at = todos.due_at
+			), '')`
+
+// ExportTodosはユーザーが閲覧できるTODOをID順に1件ずつemitに渡します。listIDが0でなければそのリストのものだけです。
+// 全件をメモリに載せないよう、行を読みながら渡します。
+func (r *TodoRepository) ExportTodos(ctx context.Context, userID, listID int, emit func(TodoRecord) error) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT todos.id, todos.name, todos.list_id, todos.parent_id, todos.completed, todos.due_at,
+			`+exportRecurrenceColumn+`,
+			COALESCE((
+				SELECT json_agg(tg.name ORDER BY tg.name) FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id
+				WHERE tt.todo_id = todos.id AND tg.user_id = $1
+			), '[]')
+		FROM todos
+		WHERE `+visibleTodosCond+` AND ($2 = 0 OR todos.list_id = $2)
+		ORDER BY todos.id`, userID, listID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rec TodoRecord
+		var parentID sql.NullInt64
+		var dueAt sql.NullTime
+		var tags []byte
+		if err := rows.Scan(&rec.ID, &rec.Name, &rec.ListID, &parentID, &rec.Completed, &dueAt, &rec.Recurrence, &tags); err != nil {
+			return err
+		}
+		rec.ParentID = nullIntPtr(parentID)
+		if dueAt.Valid {
+			rec.DueAt = &dueAt.Time
+		}
+		if err := json.Unmarshal(tags, &rec.Tags); err != nil {
+			return err
+		}
+		if err := emit(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportItemはインポートする1行分です。値の変換に失敗した行はErrに理由が入ります。
+type ImportItem struct {
+	Row    int
+	Record TodoRecord
+	Err    error
+}
+
+// ImportOptionsはインポートの設定です。
+type ImportOptions struct {
+	ListID      int    // 取り込み先のリスト（0なら個人リスト）
+	OnDuplicate string // DuplicateSkip / DuplicateRename / DuplicateFail
+	DryRun      bool   // trueなら検証だけ行い、何も作成しない
+}
+
+// ImportRowResultはインポートの1行分の結果です。
+type ImportRowResult struct {
+	Row          int    `json:"row"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	ImportedName string `json:"imported_name,omitempty"`
+	TodoID       int    `json:"todo_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ImportReportはインポートの結果です。
+type ImportReport struct {
+	DryRun         bool              `json:"dry_run"`
+	Total          int               `json:"total"`
+	Created        int               `json:"created"`
+	Renamed        int               `json:"renamed"`
+	Skipped        int               `json:"skipped"`
+	Invalid        int               `json:"invalid"`
+	IgnoredColumns []string          `json:"ignored_columns"`
+	Rows           []ImportRowResult `json:"rows"`
+}
+
+func (rep *ImportReport) add(result ImportRowResult) {
+	rep.Total++
+	switch result.Status {
+	case ImportCreated:
+		rep.Created++
+	case ImportRenamed:
+		rep.Renamed++
+	case ImportSkipped:
+		rep.Skipped++
+	case ImportInvalid:
+		rep.Invalid++
+	}
+	rep.Rows = append(rep.Rows, result)
+}
+
+// ImportTodosはTODOをまとめて取り込みます。取り込み先リストのeditor以上が実行できます。
+//
+// 1つのトランザクションで実行し、不正な行が1つでもあれば何も取り込まずにerrImportRejectedを返します（レポートには全行の結果が入ります）。
+// 名前はTODO名のユニークルール（ゴミ箱を除く全体で一意）に従い、既存のTODOやファイル内の前の行と重複した場合はOnDuplicateに従います。
+// 作成したTODOには取り込み元の行番号付きで監査ログを残します。ドライランでは検証だけ行い、何も書き込みません。
+func (r *TodoRepository) ImportTodos(ctx context.Context, userID int, items []ImportItem, opts ImportOptions) (ImportReport, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	report := ImportReport{DryRun: opts.DryRun, Rows: []ImportRowResult{}}
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		listID := opts.ListID
+		if listID == 0 {
+			var err error
+			if listID, err = ensurePersonalList(ctx, tx, userID); err != nil {
+				return err
+			}
+		}
+		if err := requireListRole(ctx, tx, listID, userID, RoleEditor); err != nil {
+			return err
+		}
+
+		used := map[string]bool{} // このインポートで使った名前
+		for _, item := range items {
+			result := ImportRowResult{Row: item.Row, Name: item.Record.Name}
+			if item.Err != nil {
+				result.Status = ImportInvalid
+				result.Error = item.Err.Error()
+				report.add(result)
+				continue
+			}
+			name, status, err := resolveImportName(ctx, tx, item.Record.Name, opts.OnDuplicate, used)
+			if err != nil {
+				return err
+			}
+			result.Status = status
+			switch status {
+			case ImportSkipped:
+				report.add(result)
+				continue
+			case ImportInvalid:
+				result.Error = fmt.Sprintf("a todo named %q already exists", item.Record.Name)
+				report.add(result)
+				continue
+			}
+			used[name] = true
+			result.ImportedName = name
+
+			// ドライランと、既に取り消しが決まっている場合は書き込まない
+			if !opts.DryRun && report.Invalid == 0 {
+				id, err := r.importTodo(ctx, tx, userID, listID, name, item)
+				if err != nil {
+					return err
+				}
+				result.TodoID = id
+			}
+			report.add(result)
+		}
+		if report.Invalid > 0 && !opts.DryRun {
+			return errImportRejected
+		}
+		return nil
+	})
+	return report, err
+}
+
+// importTodoは1行分のTODOを作成し、完了状態とタグを反映します。
+func (r *TodoRepository) importTodo(ctx context.Context, tx *sql.Tx, userID, listID int, name string, item ImportItem) (int, error) {
+	rec := item.Record
+	todo, err := r.createTodoInTx(ctx, tx, Todo{
+		Name:       name,
+		UserID:     userID,
+		ListID:     listID,
+		DueAt:      rec.DueAt,
+		Recurrence: rec.Recurrence,
+	}, map[string]any{"import_row": item.Row})
+	if err != nil {
+		return 0, err
+	}
+	if rec.Completed {
+		if _, err := tx.ExecContext(ctx, "UPDATE todos SET completed = TRUE WHERE id = $1", todo.ID); err != nil {
+			return 0, err
+		}
+	}
+	if len(rec.Tags) > 0 {
+		// 無いタグはインポートしたユーザーのタグとして作成する
+		// WHERE TRUEはSQLiteでSELECTの後のON CONFLICTを結合の条件と区別するため
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tags (user_id, name) SELECT $1, value FROM `+r.dialect.Elements("$2", "text")+` WHERE TRUE
+			ON CONFLICT (user_id, name) DO NOTHING`, userID, rec.Tags)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO todo_tags (todo_id, tag_id)
+			SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3)`, todo.ID, userID, rec.Tags)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return todo.ID, nil
+}
+
+// resolveImportNameは取り込む名前と行の結果を決めます。名前が空いていればそのまま、重複していればpolicyに従います。
+func resolveImportName(ctx context.Context, q querier, name, policy string, used map[string]bool) (string, string, error) {
+	taken := func(n string) (bool, error) {
+		if used[n] {
+			return true, nil
+		}
+		var exists bool
+		err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE name = $1 AND deleted_at IS NULL)", n).Scan(&exists)
+		return exists, err
+	}
+
+	dup, err := taken(name)
+	if err != nil || !dup {
+		return name, ImportCreated, err
+	}
+	switch policy {
+	case DuplicateSkip:
+		return name, ImportSkipped, nil
+	case DuplicateRename:
+		for i := 2; i <= maxRenameAttempts; i++ {
+			candidate := fmt.Sprintf("%s (%d)", name, i)
+			dup, err := taken(candidate)
+			if err != nil {
+				return "", "", err
+			}
+			if !dup {
+				return candidate, ImportRenamed, nil
+			}
+		}
+		// 空いている名前が見つからなければ重複エラーとして扱う
+		return name, ImportInvalid, nil
+	default:
+		return name, ImportInvalid, nil
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	input := "\ufeffタイトル,Due At,Done,Notes,tags\n" +
+		"Buy milk,2026-03-01,yes,from the store,home; errands\n" +
+		"\"Call \"\"Bob\"\"\",,,,\n"
+	sources, ignored, err := parseImport(FormatCSV, strings.NewReader(input), map[string]string{"タイトル": "name", "done": "completed"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Notes"}, ignored)
+	if !assert.Len(t, sources, 2) {
+		return
+	}
+	assert.Equal(t, 1, sources[0].Row)
+	assert.Equal(t, map[string]any{"name": "Buy milk", "due_at": "2026-03-01", "completed": "yes", "tags": "home; errands"}, sources[0].Fields)
+	assert.Equal(t, `Call "Bob"`, sources[1].Fields["name"])
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := decodeImportRecord(sources[0].Fields, tokyo)
+	assert.NoError(t, err)
+	assert.True(t, rec.Completed)
+	assert.Equal(t, []string{"home", "errands"}, rec.Tags)
+	// タイムゾーンの無い日付はユーザーのタイムゾーンの0時
+	assert.True(t, rec.DueAt.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, tokyo)))
+}
+
+func TestParseImportErrors(t *testing.T) {
+	cases := []struct {
+		format  string
+		input   string
+		mapping map[string]string
+	}{
+		{FormatCSV, "", nil},
+		{FormatCSV, "title,due\nx,y\n", nil},
+		{FormatCSV, "name\nx\n", map[string]string{"name": "owner"}},
+		{FormatJSON, `{"name": "x"}`, nil},
+		{"xlsx", "name\nx\n", nil},
+	}
+	for _, tc := range cases {
+		_, _, err := parseImport(tc.format, strings.NewReader(tc.input), tc.mapping)
+		assert.True(t, errors.Is(err, ErrInvalidInput), "expected invalid input for %q, got %v", tc.input, err)
+	}
+}
+
+func TestDecodeImportRecord(t *testing.T) {
+	sources, _, err := parseImport(FormatJSON, strings.NewReader(`[
+		{"name": " Pay rent ", "due_at": "2026-03-01T09:00:00Z", "recurrence": "freq=monthly", "tags": ["home", "home"]},
+		{"name": ""},
+		{"name": "Chore", "recurrence": "FREQ=DAILY"},
+		{"name": "Chore", "completed": "maybe"},
+		{"name": "Chore", "due_at": "next week"},
+		{"name": "Chore", "tags": [1]}
+	]`), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rec, err := decodeImportRecord(sources[0].Fields, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, "Pay rent", rec.Name)
+	assert.Equal(t, "FREQ=MONTHLY", rec.Recurrence)
+	assert.Equal(t, []string{"home"}, rec.Tags)
+
+	for _, src := range sources[1:] {
+		_, err := decodeImportRecord(src.Fields, time.UTC)
+		assert.Error(t, err, "row %d", src.Row)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	due := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	parentID := 1
+	records := []TodoRecord{
+		{ID: 1, Name: "Pay rent", ListID: 1, DueAt: &due, Recurrence: "FREQ=MONTHLY", Tags: []string{"home"}},
+		{ID: 2, Name: "Sub, with comma", ListID: 1, ParentID: &parentID, Completed: true},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		var buf bytes.Buffer
+		enc, err := newTodoEncoder(format, &buf)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.NoError(t, enc.Begin())
+		for _, rec := range records {
+			assert.NoError(t, enc.Encode(rec))
+		}
+		assert.NoError(t, enc.End())
+		if format == FormatJSON {
+			assert.True(t, json.Valid(buf.Bytes()), buf.String())
+		}
+
+		// エクスポートしたファイルはそのままインポートできる（id・list_id・parent_idは無視される）
+		sources, ignored, err := parseImport(format, &buf, nil)
+		if !assert.NoError(t, err, format) || !assert.Len(t, sources, 2, format) {
+			continue
+		}
+		assert.ElementsMatch(t, []string{"id", "list_id", "parent_id"}, ignored, format)
+		for i, src := range sources {
+			rec, err := decodeImportRecord(src.Fields, time.UTC)
+			assert.NoError(t, err, format)
+			assert.Equal(t, records[i].Name, rec.Name, format)
+			assert.Equal(t, records[i].Completed, rec.Completed, format)
+			assert.Equal(t, records[i].Recurrence, rec.Recurrence, format)
+			assert.ElementsMatch(t, records[i].Tags, rec.Tags, format)
+		}
+	}
+}
+
+func TestEmptyJSONExport(t *testing.T) {
+	var buf bytes.Buffer
+	enc, _ := newTodoEncoder(FormatJSON, &buf)
+	assert.NoError(t, enc.Begin())
+	assert.NoError(t, enc.End())
+	var todos []TodoRecord
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &todos))
+	assert.Empty(t, todos)
+}
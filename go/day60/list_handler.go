@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// invitationSendTimeoutは招待の通知1件の送信にかける時間の上限です。
+const invitationSendTimeout = 10 * time.Second
+
+type ListHandler struct {
+	repo     *TodoRepository
+	notifier Notifier
+}
+
+func NewListHandler(repo *TodoRepository, notifier Notifier) *ListHandler {
+	return &ListHandler{repo: repo, notifier: notifier}
+}
+
+func (h *ListHandler) getLists(c *gin.Context) error {
+	lists, err := h.repo.FindListsByUser(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, lists)
+	return nil
+}
+
+func (h *ListHandler) createList(c *gin.Context) error {
+	var list List
+	if err := c.ShouldBindJSON(&list); err != nil {
+		return err
+	}
+	list.OwnerID = currentUserID(c)
+	list.IsPersonal = false
+
+	createdList, err := h.repo.CreateList(c.Request.Context(), list)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, createdList)
+	return nil
+}
+
+func (h *ListHandler) getMembers(c *gin.Context) error {
+	listID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	members, err := h.repo.FindListMembers(c.Request.Context(), currentUserID(c), listID)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, members)
+	return nil
+}
+
+type MemberRoleInput struct {
+	Role ListRole `json:"role" binding:"required,oneof=viewer editor owner"`
+}
+
+func (h *ListHandler) updateMember(c *gin.Context) error {
+	listID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	memberID, err := idParam(c, "userId")
+	if err != nil {
+		return err
+	}
+	var input MemberRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	if err := h.repo.UpdateMemberRole(c.Request.Context(), currentUserID(c), listID, memberID, input.Role); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (h *ListHandler) removeMember(c *gin.Context) error {
+	listID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	memberID, err := idParam(c, "userId")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.RemoveMember(c.Request.Context(), currentUserID(c), listID, memberID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (h *ListHandler) getListInvitations(c *gin.Context) error {
+	listID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	invitations, err := h.repo.FindListInvitations(c.Request.Context(), currentUserID(c), listID)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, invitations)
+	return nil
+}
+
+// inviteはメールアドレス宛ての招待を作成し、そのメールアドレスにNotifierで知らせます。
+// 招待されたユーザーはログイン後に GET /api/v1/invitations で確認し、承諾できます。
+func (h *ListHandler) invite(c *gin.Context) error {
+	listID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var inv ListInvitation
+	if err := c.ShouldBindJSON(&inv); err != nil {
+		return err
+	}
+	inv.ListID = listID
+	inv.InvitedBy = currentUserID(c)
+
+	createdInv, err := h.repo.CreateInvitation(c.Request.Context(), inv)
+	if err != nil {
+		return err
+	}
+	h.notifyInvitation(c.Request.Context(), createdInv)
+	c.JSON(http.StatusCreated, createdInv)
+	return nil
+}
+
+// notifyInvitationは招待を招待されたメールアドレスに知らせます。
+// 招待は作成済みで、GET /api/v1/invitations から承諾できるので、送信に失敗してもログに残すだけにします。
+// 途中でクライアントが切断しても送り終えるよう、リクエストのキャンセルは引き継ぎません。
+func (h *ListHandler) notifyInvitation(ctx context.Context, inv ListInvitation) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), invitationSendTimeout)
+	defer cancel()
+	n, err := h.repo.FindInvitationNotification(ctx, inv)
+	if err == nil {
+		err = h.notifier.NotifyInvitation(ctx, n)
+	}
+	if err != nil {
+		log.Printf("Failed to send invitation %d: %v", inv.ID, err)
+	}
+}
+
+func (h *ListHandler) cancelInvitation(c *gin.Context) error {
+	listID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	invitationID, err := idParam(c, "invitationId")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.CancelInvitation(c.Request.Context(), currentUserID(c), listID, invitationID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (h *ListHandler) getMyInvitations(c *gin.Context) error {
+	invitations, err := h.repo.FindInvitationsForUser(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, invitations)
+	return nil
+}
+
+func (h *ListHandler) acceptInvitation(c *gin.Context) error {
+	invitationID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.AcceptInvitation(c.Request.Context(), currentUserID(c), invitationID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (h *ListHandler) declineInvitation(c *gin.Context) error {
+	invitationID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DeclineInvitation(c.Request.Context(), currentUserID(c), invitationID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ListRoleはリストメンバーのロールです。
+// viewerは閲覧のみ、editorはTODOの作成・編集、ownerはさらにメンバー管理ができます。
+type ListRole string
+
+const (
+	RoleViewer ListRole = "viewer"
+	RoleEditor ListRole = "editor"
+	RoleOwner  ListRole = "owner"
+)
+
+var listRoleRank = map[ListRole]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+func (r ListRole) Valid() bool {
+	_, ok := listRoleRank[r]
+	return ok
+}
+
+// Allowsはこのロールがrequired以上の権限を持つかを返します。
+func (r ListRole) Allows(required ListRole) bool {
+	return r.Valid() && listRoleRank[r] >= listRoleRank[required]
+}
+
+type List struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name" binding:"required,max=100"`
+	OwnerID    int       `json:"owner_id"`
+	IsPersonal bool      `json:"is_personal"`
+	Role       ListRole  `json:"role"` // リクエストしたユーザーのロール
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ListMember struct {
+	UserID int      `json:"user_id"`
+	Email  string   `json:"email"`
+	Role   ListRole `json:"role"`
+}
+
+type ListInvitation struct {
+	ID        int       `json:"id"`
+	ListID    int       `json:"list_id"`
+	ListName  string    `json:"list_name,omitempty"`
+	Email     string    `json:"email" binding:"required,email"`
+	Role      ListRole  `json:"role" binding:"required,oneof=viewer editor owner"`
+	InvitedBy int       `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InvitationNotificationは招待されたメールアドレスに送る、リストへの招待の通知です。
+type InvitationNotification struct {
+	InvitationID int      `json:"invitation_id"`
+	ListID       int      `json:"list_id"`
+	ListName     string   `json:"list_name"`
+	Role         ListRole `json:"role"`
+	InvitedBy    string   `json:"invited_by"` // 招待したユーザーのメールアドレス
+	Email        string   `json:"email"`
+}
+
+// querierは*sql.DBと*sql.Txの共通部分です。トランザクション内外で同じ問い合わせ関数を使うために使います。
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// ensurePersonalListはユーザーの個人リストのIDを返します。まだ無ければownerとして作成します。
+func ensurePersonalList(ctx context.Context, q querier, userID int) (int, error) {
+	var listID int
+	err := q.QueryRowContext(ctx, `
+		INSERT INTO lists (name, owner_id, is_personal) VALUES ('Personal', $1, TRUE)
+		ON CONFLICT (owner_id) WHERE is_personal DO NOTHING
+		RETURNING id`, userID).Scan(&listID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 既に存在する
+		err = q.QueryRowContext(ctx, "SELECT id FROM lists WHERE owner_id = $1 AND is_personal", userID).Scan(&listID)
+		return listID, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO list_members (list_id, user_id, role) VALUES ($1, $2, $3)", listID, userID, RoleOwner)
+	return listID, err
+}
+
+// listRoleはユーザーのリストでのロールを返します。メンバーでなければErrNotFoundです。
+func listRole(ctx context.Context, q querier, listID, userID int) (ListRole, error) {
+	var role ListRole
+	err := q.QueryRowContext(ctx, "SELECT role FROM list_members WHERE list_id = $1 AND user_id = $2", listID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return role, err
+}
+
+// requireListRoleはユーザーがリストでrequired以上のロールを持つことを確認します。
+// メンバーでなければErrNotFound（リストの存在を漏らさない）、ロール不足ならErrForbiddenを返します。
+func requireListRole(ctx context.Context, q querier, listID, userID int, required ListRole) error {
+	role, err := listRole(ctx, q, listID, userID)
+	if err != nil {
+		return err
+	}
+	if !role.Allows(required) {
+		return fmt.Errorf("%w: %s role required", ErrForbidden, required)
+	}
+	return nil
+}
+
+// requireTodoRoleはTODOが属するリストでユーザーがrequired以上のロールを持つことを確認し、リストIDを返します。
+// ゴミ箱のTODOは存在しないものとして扱います。
+func requireTodoRole(ctx context.Context, q querier, todoID, userID int, required ListRole) (int, error) {
+	var listID int
+	var role ListRole
+	err := q.QueryRowContext(ctx, `
+		SELECT t.list_id, lm.role FROM todos t
+		JOIN list_members lm ON lm.list_id = t.list_id AND lm.user_id = $2
+		WHERE t.id = $1 AND t.deleted_at IS NULL`, todoID, userID).Scan(&listID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !role.Allows(required) {
+		return 0, fmt.Errorf("%w: %s role required", ErrForbidden, required)
+	}
+	return listID, nil
+}
+
+func (r *TodoRepository) FindListsByUser(ctx context.Context, userID int) ([]List, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT l.id, l.name, l.owner_id, l.is_personal, lm.role, l.created_at
+		FROM lists l JOIN list_members lm ON lm.list_id = l.id
+		WHERE lm.user_id = $1
+		ORDER BY l.is_personal DESC, l.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var l List
+		if err := rows.Scan(&l.ID, &l.Name, &l.OwnerID, &l.IsPersonal, &l.Role, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// CreateListはリストを作成し、作成者をownerとして登録します。
+func (r *TodoRepository) CreateList(ctx context.Context, list List) (List, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "INSERT INTO lists (name, owner_id) VALUES ($1, $2) RETURNING id, created_at",
+			list.Name, list.OwnerID).Scan(&list.ID, &list.CreatedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO list_members (list_id, user_id, role) VALUES ($1, $2, $3)",
+			list.ID, list.OwnerID, RoleOwner)
+		return err
+	})
+	list.Role = RoleOwner
+	return list, err
+}
+
+// FindListMembersはリストのメンバー一覧を返します。リストのメンバーであれば誰でも閲覧できます。
+func (r *TodoRepository) FindListMembers(ctx context.Context, userID, listID int) ([]ListMember, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if err := requireListRole(ctx, r.db, listID, userID, RoleViewer); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.email, lm.role FROM list_members lm
+		JOIN users u ON u.id = lm.user_id
+		WHERE lm.list_id = $1
+		ORDER BY u.id`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ListMember{}
+	for rows.Next() {
+		var m ListMember
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// ensureOtherOwnerは、memberIDがownerでなくなってもリストに別のownerが残ることを確認します。
+func ensureOtherOwner(ctx context.Context, tx *sql.Tx, listID, memberID int) error {
+	var others int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM list_members
+		WHERE list_id = $1 AND role = $2 AND user_id <> $3`, listID, RoleOwner, memberID).Scan(&others)
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return fmt.Errorf("%w: list must keep at least one owner", ErrInvalidInput)
+	}
+	return nil
+}
+
+// UpdateMemberRoleはメンバーのロールを変更します。ownerのみ実行できます。
+func (r *TodoRepository) UpdateMemberRole(ctx context.Context, actorID, listID, memberID int, role ListRole) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		if err := requireListRole(ctx, tx, listID, actorID, RoleOwner); err != nil {
+			return err
+		}
+		current, err := listRole(ctx, tx, listID, memberID)
+		if err != nil {
+			return err
+		}
+		if current == RoleOwner && role != RoleOwner {
+			if err := ensureOtherOwner(ctx, tx, listID, memberID); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE list_members SET role = $1 WHERE list_id = $2 AND user_id = $3", role, listID, memberID)
+		return err
+	})
+}
+
+// RemoveMemberはメンバーをリストから外します。ownerは誰でも外せ、それ以外のメンバーは自分自身のみ（退出）外せます。
+func (r *TodoRepository) RemoveMember(ctx context.Context, actorID, listID, memberID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		required := RoleOwner
+		if actorID == memberID {
+			required = RoleViewer
+		}
+		if err := requireListRole(ctx, tx, listID, actorID, required); err != nil {
+			return err
+		}
+		current, err := listRole(ctx, tx, listID, memberID)
+		if err != nil {
+			return err
+		}
+		if current == RoleOwner {
+			if err := ensureOtherOwner(ctx, tx, listID, memberID); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM list_members WHERE list_id = $1 AND user_id = $2", listID, memberID)
+		return err
+	})
+}
+
+// CreateInvitationはメールアドレス宛ての招待を作成します。ownerのみ実行できます。
+func (r *TodoRepository) CreateInvitation(ctx context.Context, inv ListInvitation) (ListInvitation, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if err := requireListRole(ctx, r.db, inv.ListID, inv.InvitedBy, RoleOwner); err != nil {
+		return inv, err
+	}
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO list_invitations (list_id, email, role, invited_by) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`, inv.ListID, inv.Email, inv.Role, inv.InvitedBy).Scan(&inv.ID, &inv.CreatedAt)
+	return inv, err
+}
+
+// FindInvitationNotificationは招待の通知の内容（リスト名と招待したユーザーのメールアドレス）を読み込みます。
+func (r *TodoRepository) FindInvitationNotification(ctx context.Context, inv ListInvitation) (InvitationNotification, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	n := InvitationNotification{InvitationID: inv.ID, ListID: inv.ListID, Role: inv.Role, Email: inv.Email}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT lists.name, users.email FROM lists, users WHERE lists.id = $1 AND users.id = $2`,
+		inv.ListID, inv.InvitedBy).Scan(&n.ListName, &n.InvitedBy)
+	return n, err
+}
+
+// FindListInvitationsはリストの未承諾の招待一覧を返します。ownerのみ閲覧できます。
+func (r *TodoRepository) FindListInvitations(ctx context.Context, userID, listID int) ([]ListInvitation, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if err := requireListRole(ctx, r.db, listID, userID, RoleOwner); err != nil {
+		return nil, err
+	}
+	return r.queryInvitations(ctx, `
+		SELECT i.id, i.list_id, l.name, i.email, i.role, i.invited_by, i.created_at
+		FROM list_invitations i JOIN lists l ON l.id = i.list_id
+		WHERE i.list_id = $1 ORDER BY i.id`, listID)
+}
+
+// CancelInvitationはリストのownerが招待を取り消します。
+func (r *TodoRepository) CancelInvitation(ctx context.Context, userID, listID, invitationID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if err := requireListRole(ctx, r.db, listID, userID, RoleOwner); err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, "DELETE FROM list_invitations WHERE id = $1 AND list_id = $2", invitationID, listID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// FindInvitationsForUserはユーザーのメールアドレス宛ての招待一覧を返します。
+func (r *TodoRepository) FindInvitationsForUser(ctx context.Context, userID int) ([]ListInvitation, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.queryInvitations(ctx, `
+		SELECT i.id, i.list_id, l.name, i.email, i.role, i.invited_by, i.created_at
+		FROM list_invitations i
+		JOIN lists l ON l.id = i.list_id
+		JOIN users u ON u.email = i.email
+		WHERE u.id = $1 ORDER BY i.id`, userID)
+}
+
+func (r *TodoRepository) queryInvitations(ctx context.Context, query string, args ...any) ([]ListInvitation, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []ListInvitation{}
+	for rows.Next() {
+		var i ListInvitation
+		if err := rows.Scan(&i.ID, &i.ListID, &i.ListName, &i.Email, &i.Role, &i.InvitedBy, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+// AcceptInvitationは自分宛ての招待を承諾し、招待のロールでリストのメンバーになります。
+// 既にメンバーの場合はロールを変えずに招待だけを消します。
+func (r *TodoRepository) AcceptInvitation(ctx context.Context, userID, invitationID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		var listID int
+		var role ListRole
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM list_invitations
+			WHERE id = $1 AND email = (SELECT email FROM users WHERE id = $2)
+			RETURNING list_id, role`, invitationID, userID).Scan(&listID, &role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO list_members (list_id, user_id, role) VALUES ($1, $2, $3)
+			ON CONFLICT (list_id, user_id) DO NOTHING`, listID, userID, role)
+		return err
+	})
+}
+
+// DeclineInvitationは自分宛ての招待を断ります。
+func (r *TodoRepository) DeclineInvitation(ctx context.Context, userID, invitationID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM list_invitations
+		WHERE id = $1 AND email = (SELECT email FROM users WHERE id = $2)`, invitationID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
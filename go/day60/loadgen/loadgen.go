@@ -0,0 +1,437 @@
+// Package loadgenはTODO APIに負荷をかけて、スループット・エラー・レイテンシのパーセンタイルを測ります。
+//
+// 複数のユーザーでログインし、一覧・作成・更新のシナリオを指定した割合で実行します。
+// 負荷のかけ方は2通りです。
+//   - Rateを指定すると、応答を待たずに一定の間隔でリクエストを送ります（オープンモデル）。
+//     レイテンシは送るはずだった時刻から測るので、サーバーが詰まって送信が遅れた分も含まれます
+//   - Rateが0なら、Concurrency個のワーカーがそれぞれ応答を待ってから次を送ります（クローズドモデル）
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// シナリオ。v2のTODOのAPIを使います
+const (
+	ScenarioList   = "list"   // GET /api/v2/todos
+	ScenarioCreate = "create" // POST /api/v2/todos
+	ScenarioUpdate = "update" // PUT /api/v2/todos/:id（まだTODOを知らないユーザーは代わりに作成する）
+)
+
+var scenarios = []string{ScenarioList, ScenarioCreate, ScenarioUpdate}
+
+// Mixはシナリオごとの重みです。
+type Mix map[string]int
+
+// DefaultMixは読み込みが多い一般的な使い方を想定した割合です。
+var DefaultMix = Mix{ScenarioList: 70, ScenarioCreate: 20, ScenarioUpdate: 10}
+
+// ParseMixは"list=70,create=20,update=10"の形の文字列を読みます。書かなかったシナリオは実行しません。
+func ParseMix(s string) (Mix, error) {
+	mix := Mix{}
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(value)
+		if !ok || err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix %q: want name=weight", part)
+		}
+		if !slices.Contains(scenarios, name) {
+			return nil, fmt.Errorf("unknown scenario %q (choose from %s)", name, strings.Join(scenarios, ", "))
+		}
+		mix[name] = weight
+	}
+	if mix.total() == 0 {
+		return nil, errors.New("mix must have a positive weight")
+	}
+	return mix, nil
+}
+
+func (m Mix) total() int {
+	total := 0
+	for _, w := range m {
+		total += w
+	}
+	return total
+}
+
+// pickは重みに従ってシナリオを選びます。
+func (m Mix) pick(r *rand.Rand) string {
+	n := r.IntN(m.total())
+	for _, name := range scenarios {
+		if n < m[name] {
+			return name
+		}
+		n -= m[name]
+	}
+	return ScenarioList
+}
+
+// Accountはログインに使うユーザーです。
+type Account struct {
+	Email    string
+	Password string
+}
+
+// Configは負荷のかけ方です。
+type Config struct {
+	BaseURL  string
+	Accounts []Account
+	// Signupならログインの前にAccountsを登録します。既に登録されているアカウントがあるとエラーになります
+	Signup bool
+	Mix    Mix
+	// Rateは1秒あたりのリクエスト数です。0ならConcurrencyのワーカーで送れるだけ送ります
+	Rate        float64
+	Concurrency int
+	// DurationかRequestsのどちらか先に達した方で終わります（0は制限なし、ただしどちらかは必要）
+	Duration time.Duration
+	Requests int
+	// Timeoutは1リクエストの制限時間です
+	Timeout time.Duration
+	// MaxInFlightはRateのときに同時に待てる応答の数です。超えた分は送らずにdroppedとして数えます
+	MaxInFlight int
+	// Seedはシナリオの選び方の乱数の種です
+	Seed uint64
+	// HTTPClientがnilなら、同時接続数に合わせた接続プールのクライアントを使います
+	HTTPClient *http.Client
+}
+
+func (c *Config) validate() error {
+	switch {
+	case c.BaseURL == "":
+		return errors.New("base URL is required")
+	case len(c.Accounts) == 0:
+		return errors.New("at least one account is required")
+	case c.Rate < 0:
+		return errors.New("rate must not be negative")
+	case c.Rate == 0 && c.Concurrency <= 0:
+		return errors.New("either a rate or a positive concurrency is required")
+	case c.Duration <= 0 && c.Requests <= 0:
+		return errors.New("either a duration or a number of requests is required")
+	}
+	if c.Mix == nil {
+		c.Mix = DefaultMix
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MaxInFlight <= 0 {
+		c.MaxInFlight = 1000
+	}
+	if c.HTTPClient == nil {
+		conns := c.Concurrency
+		if c.Rate > 0 {
+			conns = c.MaxInFlight
+		}
+		// 既定のTransportはホストごとに2接続しか再利用しないので、接続の作り直しまで測ってしまわないように広げる
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = max(conns, 2)
+		c.HTTPClient = &http.Client{Transport: transport}
+	}
+	return nil
+}
+
+// virtualUserはログイン済みのユーザーと、更新に使う既知のTODOのIDです。
+type virtualUser struct {
+	index   int
+	account Account
+	token   string
+
+	mu      sync.Mutex
+	todoIDs []int
+	created int
+}
+
+func (u *virtualUser) remember(ids ...int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, id := range ids {
+		if !slices.Contains(u.todoIDs, id) {
+			u.todoIDs = append(u.todoIDs, id)
+		}
+	}
+	// 覚えておくのは最近のものだけでよい
+	if len(u.todoIDs) > 200 {
+		u.todoIDs = slices.Delete(u.todoIDs, 0, len(u.todoIDs)-200)
+	}
+}
+
+func (u *virtualUser) randomTodo(r *rand.Rand) (int, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.todoIDs) == 0 {
+		return 0, false
+	}
+	return u.todoIDs[r.IntN(len(u.todoIDs))], true
+}
+
+func (u *virtualUser) nextTitle(runID string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.created++
+	// todos.nameは全体で一意なので、実行・ユーザー・連番を入れる
+	return fmt.Sprintf("loadgen %s u%d #%d", runID, u.index, u.created)
+}
+
+// runnerは1回の負荷試験の状態です。
+type runner struct {
+	cfg      Config
+	runID    string
+	users    []*virtualUser
+	recorder *recorder
+}
+
+// Runはアカウントでログインしてから負荷をかけ、結果を返します。ログインに失敗したときは負荷をかけずにエラーを返します。
+// ctxをキャンセルすると、その時点までの結果を返します。
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	r := &runner{cfg: cfg, runID: strconv.FormatInt(time.Now().UnixNano(), 36), recorder: newRecorder()}
+	if err := r.login(ctx); err != nil {
+		return nil, err
+	}
+
+	// stopは新しいリクエストを送るのをやめる合図です。送った後のリクエストはctxがキャンセルされない限り応答を待ちます
+	stop := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		stop, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	started := time.Now()
+	if cfg.Rate > 0 {
+		r.runOpen(ctx, stop)
+	} else {
+		r.runClosed(ctx, stop)
+	}
+	report := r.recorder.report(time.Since(started))
+	report.Mode, report.Target = "concurrency", float64(cfg.Concurrency)
+	if cfg.Rate > 0 {
+		report.Mode, report.Target = "rate", cfg.Rate
+	}
+	report.Users = len(r.users)
+	return report, nil
+}
+
+// loginは全アカウントでログイン（Signupなら登録も）します。bcryptの計算でサーバーに負荷をかけすぎないように、同時には数人ずつです。
+func (r *runner) login(ctx context.Context) error {
+	r.users = make([]*virtualUser, len(r.cfg.Accounts))
+	errs := make([]error, len(r.cfg.Accounts))
+	sem := make(chan struct{}, 8)
+	var wg sync.WaitGroup
+	for i, account := range r.cfg.Accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			credentials := map[string]string{"email": account.Email, "password": account.Password}
+			if r.cfg.Signup {
+				if _, err := r.send(ctx, http.MethodPost, "/signup", "", credentials, nil); err != nil {
+					errs[i] = fmt.Errorf("sign up as %s: %w", account.Email, err)
+					return
+				}
+			}
+			var resp struct {
+				Token string `json:"token"`
+			}
+			_, err := r.send(ctx, http.MethodPost, "/login", "", credentials, &resp)
+			if err == nil && resp.Token == "" {
+				// 2要素認証が有効なユーザーにはチャレンジトークンしか返らない
+				err = errors.New("two-factor authentication is enabled")
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("login as %s: %w", account.Email, err)
+				return
+			}
+			r.users[i] = &virtualUser{index: i, account: account, token: resp.Token}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// runOpenは一定の間隔でリクエストを送ります。送信の時刻は開始からの経過で決めるので、遅れても間隔は詰まりません。
+func (r *runner) runOpen(ctx, stop context.Context) {
+	interval := time.Duration(float64(time.Second) / r.cfg.Rate)
+	rng := rand.New(rand.NewPCG(r.cfg.Seed, 0))
+	inFlight := make(chan struct{}, r.cfg.MaxInFlight)
+	var wg sync.WaitGroup
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for i := 0; r.cfg.Requests == 0 || i < r.cfg.Requests; i++ {
+		scheduled := start.Add(time.Duration(i) * interval)
+		timer.Reset(time.Until(scheduled))
+		select {
+		case <-stop.Done():
+			wg.Wait()
+			return
+		case <-timer.C:
+		}
+		user := r.users[i%len(r.users)]
+		scenario := r.cfg.Mix.pick(rng)
+		seed := rng.Uint64()
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			// サーバーが遅くて応答待ちが溜まりすぎた。送らずに数える
+			r.recorder.record(scenario, 0, errDropped)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			scenario, err := r.do(ctx, user, scenario, rand.New(rand.NewPCG(seed, 1)))
+			if ctx.Err() == nil {
+				r.recorder.record(scenario, time.Since(scheduled), err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runClosedはConcurrency個のワーカーで、応答を受け取るたびに次のリクエストを送ります。
+func (r *runner) runClosed(ctx, stop context.Context) {
+	var sent atomic.Int64
+	var wg sync.WaitGroup
+	for w := range r.cfg.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(r.cfg.Seed, uint64(w)+1))
+			user := r.users[w%len(r.users)]
+			for stop.Err() == nil {
+				if r.cfg.Requests > 0 && sent.Add(1) > int64(r.cfg.Requests) {
+					return
+				}
+				started := time.Now()
+				scenario, err := r.do(ctx, user, r.cfg.Mix.pick(rng), rng)
+				if ctx.Err() != nil {
+					// 中断したときのリクエストは数えない
+					return
+				}
+				r.recorder.record(scenario, time.Since(started), err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// doはシナリオを1回実行し、実際に実行したシナリオを返します。
+func (r *runner) do(ctx context.Context, u *virtualUser, scenario string, rng *rand.Rand) (string, error) {
+	if scenario == ScenarioUpdate {
+		id, ok := u.randomTodo(rng)
+		if !ok {
+			scenario = ScenarioCreate
+		} else {
+			_, err := r.send(ctx, http.MethodPut, fmt.Sprintf("/api/v2/todos/%d", id), u.token, map[string]string{"title": u.nextTitle(r.runID)}, nil)
+			return scenario, err
+		}
+	}
+	switch scenario {
+	case ScenarioCreate:
+		var created struct {
+			ID int `json:"id"`
+		}
+		_, err := r.send(ctx, http.MethodPost, "/api/v2/todos", u.token, map[string]string{"title": u.nextTitle(r.runID)}, &created)
+		if err == nil {
+			u.remember(created.ID)
+		}
+		return scenario, err
+	default:
+		var page struct {
+			Items []struct {
+				ID int `json:"id"`
+			} `json:"items"`
+		}
+		_, err := r.send(ctx, http.MethodGet, "/api/v2/todos?page_size=50", u.token, nil, &page)
+		for _, item := range page.Items {
+			u.remember(item.ID)
+		}
+		return ScenarioList, err
+	}
+}
+
+// StatusErrorはサーバーが4xxか5xxを返したことを表します。
+type StatusError struct {
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d", e.Status)
+}
+
+var errDropped = errors.New("dropped")
+
+func (r *runner) send(ctx context.Context, method, path, token string, body, out any) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(r.cfg.BaseURL, "/")+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", "loadgen")
+	resp, err := r.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, &StatusError{Status: resp.StatusCode}
+	}
+	if out == nil {
+		// 接続を再利用できるようにボディを読み切る
+		_, err = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// errorKindはエラーの内訳に使う分類です。
+func errorKind(err error) string {
+	var statusErr *StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Error()
+	case errors.Is(err, errDropped):
+		return "dropped"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "connection error"
+	default:
+		return "other"
+	}
+}
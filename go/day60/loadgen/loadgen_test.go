@@ -0,0 +1,256 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServerはログインとv2のTODOのAPIだけを真似します。failEveryが正なら、その回数ごとの作成を500にします。
+type fakeServer struct {
+	mu        sync.Mutex
+	nextID    int
+	requests  map[string]int
+	failEvery int
+	creates   int
+	delay     time.Duration
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests[r.Method+" "+r.URL.Path]++
+	f.mu.Unlock()
+	time.Sleep(f.delay)
+	if r.URL.Path == "/login" {
+		json.NewEncoder(w).Encode(map[string]string{"token": "token"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/todos":
+		json.NewEncoder(w).Encode(map[string]any{"items": []map[string]int{}})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/todos":
+		f.mu.Lock()
+		f.creates++
+		fail := f.failEvery > 0 && f.creates%f.failEvery == 0
+		f.nextID++
+		id := f.nextID
+		f.mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]int{"id": id})
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/v2/todos/"):
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	fake := &fakeServer{requests: map[string]int{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+var testAccounts = []Account{{"a@example.com", "password123"}, {"b@example.com", "password123"}}
+
+func TestRunClosed(t *testing.T) {
+	fake, server := newFakeServer(t)
+	fake.failEvery = 4
+	report, err := Run(context.Background(), Config{
+		BaseURL:     server.URL,
+		Accounts:    testAccounts,
+		Mix:         Mix{ScenarioCreate: 1, ScenarioUpdate: 1},
+		Concurrency: 4,
+		Requests:    200,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "concurrency", report.Mode)
+	assert.Equal(t, 2, report.Users)
+	assert.Equal(t, 200, report.Total.Requests)
+	assert.Equal(t, 2, fake.requests["POST /login"])
+	assert.Equal(t, 200, fake.requests["POST /api/v2/todos"]+countPrefix(fake.requests, "PUT /api/v2/todos/"))
+
+	byName := map[string]ScenarioReport{}
+	for _, s := range report.Scenarios {
+		byName[s.Name] = s
+	}
+	assert.Equal(t, fake.creates, byName[ScenarioCreate].Requests)
+	assert.Equal(t, fake.creates/4, byName[ScenarioCreate].Errors)
+	assert.Equal(t, fake.creates/4, report.Total.ErrorsByKind["status 500"])
+	assert.Zero(t, byName[ScenarioUpdate].Errors)
+	assert.Greater(t, byName[ScenarioUpdate].Requests, 0)
+	assert.InDelta(t, float64(fake.creates/4)/200, report.Total.ErrorRate, 1e-9)
+	assert.Greater(t, report.Total.Latency.P50, 0.0)
+	assert.LessOrEqual(t, report.Total.Latency.P99, report.Total.Latency.Max)
+}
+
+func countPrefix(m map[string]int, prefix string) int {
+	n := 0
+	for k, v := range m {
+		if strings.HasPrefix(k, prefix) {
+			n += v
+		}
+	}
+	return n
+}
+
+func TestRunOpen(t *testing.T) {
+	fake, server := newFakeServer(t)
+	fake.delay = 20 * time.Millisecond
+	started := time.Now()
+	report, err := Run(context.Background(), Config{
+		BaseURL:  server.URL,
+		Accounts: testAccounts,
+		Mix:      Mix{ScenarioList: 1},
+		Rate:     200,
+		Requests: 40,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// 200 req/sで40件なら約200ms。応答の20msを待たずに次を送るので、直列に送るより早く終わる
+	assert.Less(t, time.Since(started), 40*fake.delay)
+	assert.Equal(t, "rate", report.Mode)
+	assert.Equal(t, 200.0, report.Target)
+	assert.Equal(t, 40, report.Total.Requests)
+	assert.Equal(t, 40, fake.requests["GET /api/v2/todos"])
+	assert.GreaterOrEqual(t, report.Total.Latency.P50, 20.0)
+}
+
+func TestRunDropsWhenSaturated(t *testing.T) {
+	fake, server := newFakeServer(t)
+	fake.delay = 200 * time.Millisecond
+	report, err := Run(context.Background(), Config{
+		BaseURL:     server.URL,
+		Accounts:    testAccounts,
+		Mix:         Mix{ScenarioList: 1},
+		Rate:        500,
+		Requests:    20,
+		MaxInFlight: 5,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 20, report.Total.Requests)
+	assert.Equal(t, 15, report.Total.ErrorsByKind["dropped"])
+	assert.Equal(t, 5, fake.requests["GET /api/v2/todos"])
+}
+
+func TestRunLoginFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	_, err := Run(context.Background(), Config{BaseURL: server.URL, Accounts: testAccounts, Concurrency: 1, Requests: 1})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "login as a@example.com: status 401")
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("list=70, create=20,update=10")
+	if assert.NoError(t, err) {
+		assert.Equal(t, DefaultMix, mix)
+	}
+	for _, s := range []string{"", "list", "list=-1", "delete=1", "list=0"} {
+		_, err := ParseMix(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 1000; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 500*time.Millisecond, percentile(latencies, 0.50))
+	assert.Equal(t, 990*time.Millisecond, percentile(latencies, 0.99))
+	assert.Equal(t, 999*time.Millisecond, percentile(latencies, 0.999))
+	assert.Equal(t, 7*time.Millisecond, percentile([]time.Duration{7 * time.Millisecond}, 0.999))
+}
+
+func TestThresholds(t *testing.T) {
+	for s, want := range map[string]Threshold{
+		"p99<500ms":       {Metric: "p99", Op: "<", Value: 500},
+		"create.p999<2s":  {Scenario: "create", Metric: "p999", Op: "<", Value: 2000},
+		"mean < 20":       {Metric: "mean", Op: "<", Value: 20},
+		"error_rate<1%":   {Metric: "error_rate", Op: "<", Value: 0.01},
+		"error_rate<0.05": {Metric: "error_rate", Op: "<", Value: 0.05},
+		"rps>100":         {Metric: "rps", Op: ">", Value: 100},
+	} {
+		got, err := ParseThreshold(s)
+		if assert.NoError(t, err, s) {
+			want.raw = s
+			assert.Equal(t, want, got)
+		}
+	}
+	for _, s := range []string{"p99", "p95<1s", "delete.p99<1s", "p99<fast", "rps>many"} {
+		_, err := ParseThreshold(s)
+		assert.Error(t, err, s)
+	}
+
+	report := &Report{
+		Total: ScenarioReport{Name: "total", Requests: 1000, ErrorRate: 0.02, Throughput: 150, Latency: Latency{P99: 300}},
+		Scenarios: []ScenarioReport{
+			{Name: "create", Latency: Latency{P999: 2500}},
+		},
+	}
+	var thresholds []Threshold
+	for _, s := range []string{"p99<500ms", "create.p999<2s", "error_rate<1%", "rps>100", "update.p99<1s"} {
+		th, _ := ParseThreshold(s)
+		thresholds = append(thresholds, th)
+	}
+	var violated []string
+	for _, v := range Check(report, thresholds) {
+		violated = append(violated, v.String())
+	}
+	assert.Equal(t, []string{"create.p999<2s: actual 2.5s", "error_rate<1%: actual 2.00%"}, violated)
+}
+
+func TestReportOutput(t *testing.T) {
+	rec := newRecorder()
+	for i := 1; i <= 10; i++ {
+		rec.record(ScenarioList, time.Duration(i)*time.Millisecond, nil)
+	}
+	rec.record(ScenarioCreate, 50*time.Millisecond, &StatusError{Status: http.StatusConflict})
+	rec.record(ScenarioCreate, 0, errDropped)
+	report := rec.report(2 * time.Second)
+	report.Mode, report.Target, report.Users = "rate", 6, 3
+
+	var table bytes.Buffer
+	if assert.NoError(t, report.WriteTable(&table)) {
+		out := table.String()
+		assert.Contains(t, out, "6 req/s, 3 users, 2.0s")
+		assert.Contains(t, out, "P99.9")
+		assert.Regexp(t, `create\s+2\s+1\.0\s+100\.00%`, out)
+		assert.Regexp(t, `total\s+12\s+6\.0\s+16\.67%`, out)
+		assert.Contains(t, out, "status 409")
+	}
+
+	var decoded map[string]any
+	var buf bytes.Buffer
+	if assert.NoError(t, report.WriteJSON(&buf)) && assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded)) {
+		total := decoded["total"].(map[string]any)
+		assert.Equal(t, 12.0, total["requests"])
+		assert.Equal(t, 50.0, total["latency_ms"].(map[string]any)["max"])
+		assert.Equal(t, map[string]any{"status 409": 1.0, "dropped": 1.0}, total["errors_by_kind"])
+	}
+}
@@ -0,0 +1,178 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Reportは負荷試験の結果です。レイテンシはミリ秒です。
+type Report struct {
+	Mode string `json:"mode"` // rateかconcurrency
+	// TargetはModeがrateなら1秒あたりのリクエスト数、concurrencyなら同時実行数です
+	Target          float64          `json:"target"`
+	Users           int              `json:"users"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Total           ScenarioReport   `json:"total"`
+	Scenarios       []ScenarioReport `json:"scenarios"`
+}
+
+// ScenarioReportはシナリオごと（Totalでは全体）の集計です。
+type ScenarioReport struct {
+	Name       string  `json:"name"`
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"error_rate"`
+	Throughput float64 `json:"throughput_rps"`
+	// ErrorsByKindはエラーの内訳（"status 500"・"timeout"・"connection error"・"dropped"など）です
+	ErrorsByKind map[string]int `json:"errors_by_kind"`
+	Latency      Latency        `json:"latency_ms"`
+}
+
+// Latencyはレイテンシの分布です（ミリ秒）。エラーになったリクエストも含みますが、送らなかったリクエストは含みません。
+type Latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p999"`
+	Max  float64 `json:"max"`
+}
+
+// recorderはリクエストの結果を集めます。パーセンタイルを正確に出すために、レイテンシはすべて覚えておきます。
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{latencies: map[string][]time.Duration{}, errors: map[string]map[string]int{}}
+}
+
+func (r *recorder) record(scenario string, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if r.errors[scenario] == nil {
+			r.errors[scenario] = map[string]int{}
+		}
+		r.errors[scenario][errorKind(err)]++
+	}
+	// 送らなかったリクエストにレイテンシは無い
+	if err == errDropped {
+		return
+	}
+	r.latencies[scenario] = append(r.latencies[scenario], latency)
+}
+
+func (r *recorder) report(elapsed time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := &Report{DurationSeconds: elapsed.Seconds()}
+	var all []time.Duration
+	allErrors := map[string]int{}
+	names := slices.Sorted(maps.Keys(r.latencies))
+	for name := range r.errors {
+		if _, ok := r.latencies[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		report.Scenarios = append(report.Scenarios, summarize(name, r.latencies[name], r.errors[name], elapsed))
+		all = append(all, r.latencies[name]...)
+		for kind, n := range r.errors[name] {
+			allErrors[kind] += n
+		}
+	}
+	report.Total = summarize("total", all, allErrors, elapsed)
+	return report
+}
+
+func summarize(name string, latencies []time.Duration, errors map[string]int, elapsed time.Duration) ScenarioReport {
+	s := ScenarioReport{Name: name, ErrorsByKind: map[string]int{}}
+	for kind, n := range errors {
+		s.ErrorsByKind[kind] = n
+		s.Errors += n
+	}
+	s.Requests = len(latencies) + errors["dropped"]
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+	}
+	if elapsed > 0 {
+		s.Throughput = float64(s.Requests) / elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return s
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	var sum time.Duration
+	for _, l := range sorted {
+		sum += l
+	}
+	s.Latency = Latency{
+		Mean: millis(sum / time.Duration(len(sorted))),
+		P50:  millis(percentile(sorted, 0.50)),
+		P90:  millis(percentile(sorted, 0.90)),
+		P99:  millis(percentile(sorted, 0.99)),
+		P999: millis(percentile(sorted, 0.999)),
+		Max:  millis(sorted[len(sorted)-1]),
+	}
+	return s
+}
+
+// percentileはソート済みのsortedのpパーセンタイルを最近傍順位法で返します。
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func millis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// WriteJSONは結果をJSONで書き出します。
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteTableは結果を表にして書き出します。
+func (r *Report) WriteTable(w io.Writer) error {
+	target := fmt.Sprintf("%g req/s", r.Target)
+	if r.Mode == "concurrency" {
+		target = fmt.Sprintf("%g workers", r.Target)
+	}
+	fmt.Fprintf(w, "%s, %d users, %.1fs\n\n", target, r.Users, r.DurationSeconds)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "SCENARIO\tREQUESTS\tRPS\tERRORS\tMEAN\tP50\tP90\tP99\tP99.9\tMAX\t")
+	for _, s := range append(slices.Clone(r.Scenarios), r.Total) {
+		l := s.Latency
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.2f%%\t%s\t%s\t%s\t%s\t%s\t%s\t\n", s.Name, s.Requests, s.Throughput, s.ErrorRate*100,
+			formatMillis(l.Mean), formatMillis(l.P50), formatMillis(l.P90), formatMillis(l.P99), formatMillis(l.P999), formatMillis(l.Max))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(r.Total.ErrorsByKind) > 0 {
+		fmt.Fprintln(w, "\nErrors:")
+		for _, kind := range slices.Sorted(maps.Keys(r.Total.ErrorsByKind)) {
+			fmt.Fprintf(w, "  %-18s %d\n", kind, r.Total.ErrorsByKind[kind])
+		}
+	}
+	return nil
+}
+
+func formatMillis(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,136 @@
+package loadgen
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Thresholdは結果が満たすべき条件です。CIで閾値を超えたら失敗させるのに使います。
+type Threshold struct {
+	// Scenarioが空なら全体の値を見ます
+	Scenario string
+	// Metricはp50・p90・p99・p999・mean・max（ミリ秒）、error_rate（0〜1）、rps（1秒あたりのリクエスト数）のどれかです
+	Metric string
+	Op     string // <か>
+	Value  float64
+	raw    string
+}
+
+var metrics = []string{"p50", "p90", "p99", "p999", "mean", "max", "error_rate", "rps"}
+
+// ParseThresholdは"p99<500ms"・"create.p999<2s"・"error_rate<1%"・"rps>100"の形の条件を読みます。
+// レイテンシの単位を省くとミリ秒、error_rateは"%"を付けなければ0〜1の割合です。
+func ParseThreshold(s string) (Threshold, error) {
+	i := strings.IndexAny(s, "<>")
+	if i < 0 {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: want metric<value or metric>value", s)
+	}
+	t := Threshold{Metric: strings.TrimSpace(s[:i]), Op: s[i : i+1], raw: s}
+	if scenario, metric, ok := strings.Cut(t.Metric, "."); ok {
+		if !slices.Contains(scenarios, scenario) {
+			return Threshold{}, fmt.Errorf("invalid threshold %q: unknown scenario %q", s, scenario)
+		}
+		t.Scenario, t.Metric = scenario, metric
+	}
+	if !slices.Contains(metrics, t.Metric) {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: unknown metric %q (choose from %s)", s, t.Metric, strings.Join(metrics, ", "))
+	}
+
+	value := strings.TrimSpace(s[i+1:])
+	var err error
+	switch {
+	case t.Metric == "error_rate" && strings.HasSuffix(value, "%"):
+		t.Value, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		t.Value /= 100
+	case t.Metric == "error_rate" || t.Metric == "rps":
+		t.Value, err = strconv.ParseFloat(value, 64)
+	default:
+		t.Value, err = parseMillis(value)
+	}
+	if err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: %w", s, err)
+	}
+	return t, nil
+}
+
+func parseMillis(s string) (float64, error) {
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		return ms, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return float64(d) / float64(time.Millisecond), nil
+}
+
+func (t Threshold) String() string {
+	return t.raw
+}
+
+// Violationは満たされなかった条件と実際の値です。
+type Violation struct {
+	Threshold Threshold
+	Actual    float64
+}
+
+func (v Violation) String() string {
+	switch v.Threshold.Metric {
+	case "error_rate":
+		return fmt.Sprintf("%s: actual %.2f%%", v.Threshold, v.Actual*100)
+	case "rps":
+		return fmt.Sprintf("%s: actual %.1f", v.Threshold, v.Actual)
+	default:
+		return fmt.Sprintf("%s: actual %s", v.Threshold, formatMillis(v.Actual))
+	}
+}
+
+// Checkはreportがthresholdsを満たすか調べ、満たさなかったものを返します。
+// 実行しなかったシナリオの条件は、リクエストが0件として調べます。
+func Check(report *Report, thresholds []Threshold) []Violation {
+	var violations []Violation
+	for _, t := range thresholds {
+		s := report.Total
+		if t.Scenario != "" {
+			s = ScenarioReport{Name: t.Scenario}
+			for _, scenario := range report.Scenarios {
+				if scenario.Name == t.Scenario {
+					s = scenario
+				}
+			}
+		}
+		actual := s.metric(t.Metric)
+		ok := actual < t.Value
+		if t.Op == ">" {
+			ok = actual > t.Value
+		}
+		if !ok {
+			violations = append(violations, Violation{Threshold: t, Actual: actual})
+		}
+	}
+	return violations
+}
+
+func (s ScenarioReport) metric(name string) float64 {
+	switch name {
+	case "p50":
+		return s.Latency.P50
+	case "p90":
+		return s.Latency.P90
+	case "p99":
+		return s.Latency.P99
+	case "p999":
+		return s.Latency.P999
+	case "mean":
+		return s.Latency.Mean
+	case "max":
+		return s.Latency.Max
+	case "error_rate":
+		return s.ErrorRate
+	default:
+		return s.Throughput
+	}
+}
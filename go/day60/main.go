@@ -6,28 +6,45 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata" // ユーザーのタイムゾーンを扱うため、tzdataの無いコンテナでも動くように埋め込む
 
-  "github.com/gin-contrib/cors"
+	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Todo struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name" binding:"required"`
+	UserID    int        `json:"user_id"`   // 作成者
+	ListID    int        `json:"list_id"`   // 所属リスト（作成時に省略すると個人リスト）
+	ParentID  *int       `json:"parent_id"` // 親TODO（NULLはルート）
+	Completed bool       `json:"completed"`
+	DueAt     *time.Time `json:"due_at"`
+	// Recurrenceは繰り返し規則（RRULEのサブセット）。作成時に指定するとdue_atを初回とするシリーズになる
+	Recurrence string     `json:"recurrence,omitempty"`
+	SeriesID   *int       `json:"series_id,omitempty"`  // 繰り返しシリーズのID
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"` // ゴミ箱に入れた日時
+	Tags       []Tag      `json:"tags"`
+}
+
+type Tag struct {
 	ID     int    `json:"id"`
-	Name   string `json:"name" binding:"required"`
-	UserID int    `json:"user_id"`
+	Name   string `json:"name" binding:"required,max=50"`
+	UserID int    `json:"-"` // タグはユーザーごとの名前空間に属する
 }
 
 type User struct {
@@ -35,64 +52,129 @@ type User struct {
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"-"` // Never return password hash
 	Role         string    `json:"role"`
+	Timezone     string    `json:"timezone"` // IANAタイムゾーン名（繰り返しの計算に使う）
 	CreatedAt    time.Time `json:"created_at"`
+	// DeletionScheduledAtはアカウント削除を申請中の場合に、物理削除される日時
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
 var db *sql.DB
 var jwtSecret []byte
 
+// jwtPreviousSecretはjwt rotateで入れ替える前の秘密鍵です。設定されていれば、発行済みのJWTが期限切れになるまで検証にだけ使います。
+var jwtPreviousSecret []byte
+
 type AppClaims struct {
 	Role string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func authMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
-			return
+// AuthErrorはBearerトークンの認証に失敗した理由です。ErrUnauthenticatedとして扱われます。
+type AuthError struct {
+	Message string
+	Details string // 省略可能な詳細
+}
+
+func (e *AuthError) Error() string {
+	if e.Details == "" {
+		return e.Message
+	}
+	return e.Message + ": " + e.Details
+}
+
+func (e *AuthError) Unwrap() error {
+	return ErrUnauthenticated
+}
+
+// authenticateはAuthorizationヘッダーの値（"Bearer <token>"）を検証し、認証済みのPrincipalを返します。
+// トークンはログインで発行したJWTかパーソナルアクセストークンで、JWTのセッションの取り消しはsessionsの拒否リストで確かめます。
+// 認証に失敗した場合は*AuthError、それ以外（DBのエラーなど）はそのままのエラーを返します。
+// HTTPのauthMiddlewareとgRPCのインターセプターで共有します。
+func authenticate(ctx context.Context, repo *TodoRepository, sessions *SessionRegistry, authHeader string) (*Principal, error) {
+	if authHeader == "" {
+		return nil, &AuthError{Message: "Authorization header is missing"}
+	}
+
+	// "Bearer <token>" という形式を期待
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, &AuthError{Message: "Authorization header is malformed"}
+	}
+	tokenString := parts[1]
+
+	if isPersonalAccessToken(tokenString) {
+		principal, err := repo.AuthenticateToken(ctx, hashToken(tokenString))
+		if errors.Is(err, ErrNotFound) {
+			return nil, &AuthError{Message: "Invalid token", Details: "token is unknown, revoked or expired"}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate access token: %w", err)
 		}
+		return principal, nil
+	}
 
-		// "Bearer <token>" という形式を期待
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is malformed"})
-			return
+	token, err := jwt.ParseWithClaims(tokenString, &AppClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		tokenString := parts[1]
+		if len(jwtPreviousSecret) > 0 {
+			return jwt.VerificationKeySet{Keys: []jwt.VerificationKey{jwtSecret, jwtPreviousSecret}}, nil
+		}
+		return jwtSecret, nil
+	})
 
-		token, err := jwt.ParseWithClaims(tokenString, &AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtSecret, nil
-		})
+	if err != nil {
+		return nil, &AuthError{Message: "Invalid token", Details: err.Error()}
+	}
 
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+	claims, ok := token.Claims.(*AppClaims)
+	if !ok || !token.Valid {
+		return nil, &AuthError{Message: "Invalid token claims"}
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || claims.ID == "" {
+		return nil, &AuthError{Message: "Invalid token claims"}
+	}
+	if sessions.IsRevoked(claims.ID) {
+		return nil, &AuthError{Message: "Invalid token", Details: "session has been revoked"}
+	}
+	sessions.Touch(claims.ID)
+	return &Principal{UserID: userID, Role: claims.Role, SessionID: claims.ID}, nil
+}
+
+// authMiddlewareはBearerトークンをauthenticateで検証し、認証済みのPrincipalをコンテキストに置きます。
+func authMiddleware(repo *TodoRepository, sessions *SessionRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := authenticate(c.Request.Context(), repo, sessions, c.GetHeader("Authorization"))
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			body := gin.H{"error": authErr.Message}
+			if authErr.Details != "" {
+				body["details"] = authErr.Details
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, body)
 			return
 		}
-
-		if claims, ok := token.Claims.(*AppClaims); ok && token.Valid {
-			c.Set("claims", claims)
-			c.Next()
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		if err != nil {
+			log.Printf("Failed to authenticate request: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
 		}
+		c.Set(principalKey, principal)
+		c.Next()
 	}
 }
 
 func adminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		claims, exists := c.Get("claims")
+		principal, exists := c.Get(principalKey)
 		if !exists {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "Not an admin"})
 			return
 		}
 
-		appClaims, ok := claims.(*AppClaims)
-		if !ok || appClaims.Role != "admin" {
+		p, ok := principal.(*Principal)
+		if !ok || p.Role != "admin" {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "Not an admin"})
 			return
 		}
@@ -103,9 +185,35 @@ func adminMiddleware() gin.HandlerFunc {
 
 type AppHandler func(c *gin.Context) error
 
+// statusClientClosedRequestはクライアントがレスポンスを待たずに切断したリクエストのステータスです（nginxの慣例）。
+const statusClientClosedRequest = 499
+
+// conflictMessagesはユニーク制約名ごとの409レスポンスのメッセージです。
+var conflictMessages = map[string]string{
+	"todos_name_unique":                     "Todo with this name already exists",
+	"users_email_key":                       "User with this email already exists",
+	"tags_user_id_name_unique":              "Tag with this name already exists",
+	"list_invitations_list_id_email_unique": "Invitation for this email already exists",
+}
+
+// conflictMessageはユニーク制約違反のメッセージを返します。登録されていない制約は汎用のメッセージです。
+func conflictMessage(constraint string) string {
+	if message, ok := conflictMessages[constraint]; ok {
+		return message
+	}
+	return "Resource already exists"
+}
+
 func errorHandler(handler AppHandler) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if err := handler(c); err != nil {
+			// クライアントが切断してリクエストのコンテキストが取り消された場合。レスポンスを読む相手はいないので、
+			// エラーとして記録せず499（nginxのClient Closed Request）で終える
+			if errors.Is(err, context.Canceled) {
+				c.AbortWithStatus(statusClientClosedRequest)
+				return
+			}
+
 			log.Printf("Error occurred: %v", err)
 
 			// バリデーションエラーの場合
@@ -118,17 +226,73 @@ func errorHandler(handler AppHandler) gin.HandlerFunc {
 				return
 			}
 
-			// PostgreSQLのユニーク制約違反エラーの場合
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) {
-				// "23505"はunique_violationのエラーコード
-				if pgErr.Code == "23505" {
-					c.JSON(http.StatusConflict, gin.H{
-						"error":   "Conflict",
-						"message": "Todo with this name already exists",
-					})
-					return
-				}
+			if errors.Is(err, ErrInvalidInput) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Bad Request",
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if errors.Is(err, ErrTooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error":   "Payload Too Large",
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if errors.Is(err, ErrForbidden) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":   "Forbidden",
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if errors.Is(err, ErrUnauthenticated) {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":   "Unauthorized",
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if errors.Is(err, ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Not Found",
+				})
+				return
+			}
+
+			// ユニーク制約違反エラーの場合（PostgreSQLでもSQLiteでもConflictErrorに変換する）
+			dbErr := translateDBError(err)
+			var conflict *ConflictError
+			if errors.As(dbErr, &conflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":   "Conflict",
+					"message": conflictMessage(conflict.Constraint),
+				})
+				return
+			}
+
+			// リクエストやクエリの期限までにDBの処理が終わらなかった場合
+			if errors.Is(dbErr, ErrTimeout) {
+				c.JSON(http.StatusGatewayTimeout, gin.H{
+					"error":   "Gateway Timeout",
+					"message": "The database did not respond in time",
+				})
+				return
+			}
+
+			// ロック待ちなどでDBが一時的に処理できない場合。少し待てば再試行で成功する見込みがある
+			if errors.Is(dbErr, ErrUnavailable) {
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"error":   "Service Unavailable",
+					"message": "The database is busy, please retry",
+				})
+				return
 			}
 
 			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
@@ -148,17 +312,59 @@ func errorHandler(handler AppHandler) gin.HandlerFunc {
 }
 
 type TodoHandler struct {
-	repo *TodoRepository
+	repo       *TodoRepository
+	recurrence *RecurrenceScheduler
+}
+
+func NewTodoHandler(repo *TodoRepository, recurrence *RecurrenceScheduler) *TodoHandler {
+	return &TodoHandler{repo: repo, recurrence: recurrence}
 }
 
-func NewTodoHandler(repo *TodoRepository) *TodoHandler {
-	return &TodoHandler{repo: repo}
+// currentUserIDは認証済みリクエストのユーザーIDを返します。
+func currentUserID(c *gin.Context) int {
+	return currentPrincipal(c).UserID
 }
 
+// idParamはパスパラメータを正の整数IDとして読み取ります。
+func idParam(c *gin.Context, name string) (int, error) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidInput, name)
+	}
+	return id, nil
+}
+
+// optionalIDQueryは省略可能なIDのクエリパラメータを返します。省略時は0です。
+func optionalIDQuery(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidInput, name)
+	}
+	return id, nil
+}
+
+// getTodosはTODO一覧を返します。
+// ?tag=work&tag=urgent でタグ絞り込みができ、?tag_match=all で全タグ一致、
+// 省略時または?tag_match=any でいずれか一致になります。
 func (h *TodoHandler) getTodos(c *gin.Context) error {
-	claims := c.MustGet("claims").(*AppClaims)
-	userID, _ := strconv.Atoi(claims.Subject)
-	todos, err := h.repo.FindAll(userID)
+	filter := TodoFilter{
+		Tags:     c.QueryArray("tag"),
+		TagMatch: c.DefaultQuery("tag_match", TagMatchAny),
+	}
+	if filter.TagMatch != TagMatchAny && filter.TagMatch != TagMatchAll {
+		return fmt.Errorf("%w: tag_match must be %q or %q", ErrInvalidInput, TagMatchAny, TagMatchAll)
+	}
+	listID, err := optionalIDQuery(c, "list_id")
+	if err != nil {
+		return err
+	}
+	filter.ListID = listID
+
+	todos, err := h.repo.FindAll(c.Request.Context(), currentUserID(c), filter)
 	if err != nil {
 		return err
 	}
@@ -172,17 +378,70 @@ func (h *TodoHandler) createTodo(c *gin.Context) error {
 		return err
 	}
 
-	claims := c.MustGet("claims").(*AppClaims)
-	userID, _ := strconv.Atoi(claims.Subject)
-	newTodo.UserID = userID // TODOにユーザーIDをセット
+	newTodo.UserID = currentUserID(c) // TODOにユーザーIDをセット
+	if newTodo.Recurrence != "" {
+		rule, err := ParseRecurrenceRule(newTodo.Recurrence)
+		if err != nil {
+			return err
+		}
+		newTodo.Recurrence = rule.String()
+	}
 	createdTodo, err := h.repo.CreateTodoWithAudit(c.Request.Context(), newTodo)
 	if err != nil {
 		return err
 	}
+	createdTodo.Tags = []Tag{}
 	c.JSON(http.StatusCreated, createdTodo)
 	return nil
 }
 
+func (h *TodoHandler) getTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	todo, err := h.repo.FindTodo(c.Request.Context(), currentUserID(c), id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, todo)
+	return nil
+}
+
+func (h *TodoHandler) updateTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input Todo
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+
+	userID := currentUserID(c)
+	if _, err := h.repo.UpdateTodoWithAudit(c.Request.Context(), userID, Todo{ID: id, Name: input.Name, DueAt: input.DueAt}); err != nil {
+		return err
+	}
+	todo, err := h.repo.FindTodo(c.Request.Context(), userID, id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, todo)
+	return nil
+}
+
+func (h *TodoHandler) deleteTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DeleteTodoWithAudit(c.Request.Context(), currentUserID(c), id); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
 type AuthHandler struct {
 	repo *TodoRepository
 }
@@ -212,7 +471,7 @@ func (h *AuthHandler) signup(c *gin.Context) error {
 		PasswordHash: string(hashedPassword),
 	}
 
-	createdUser, err := h.repo.CreateUser(user)
+	createdUser, err := h.repo.CreateUser(c.Request.Context(), user)
 	if err != nil {
 		return err
 	}
@@ -224,6 +483,8 @@ func (h *AuthHandler) signup(c *gin.Context) error {
 type LoginInput struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// Rememberがtrueならリフレッシュトークンも返します（2要素認証が有効ならPOST /login/2faで指定する）
+	Remember bool `json:"remember"`
 }
 
 func (h *AuthHandler) login(c *gin.Context) error {
@@ -232,31 +493,118 @@ func (h *AuthHandler) login(c *gin.Context) error {
 		return err
 	}
 
-	user, err := h.repo.FindUserByEmail(input.Email)
+	client := ginSessionClient(c)
+	client.Remember = input.Remember
+	result, err := loginWithPassword(c.Request.Context(), h.repo, input.Email, input.Password, client)
 	if err != nil {
 		return err
 	}
+	writeLoginResult(c, result)
+	return nil
+}
+
+// writeLoginResultはログインの結果を返します。
+// 2要素認証が有効なら、ここではチャレンジトークンだけを返し、POST /login/2faでコードと交換させる
+func writeLoginResult(c *gin.Context, result LoginResult) {
+	if result.MFARequired {
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "challenge_token": result.ChallengeToken, "expires_in": int(loginChallengeTTL.Seconds())})
+		return
+	}
+	c.JSON(http.StatusOK, result.tokens())
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password))
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// refreshはリフレッシュトークンを新しいJWTとリフレッシュトークンに交換します。渡したリフレッシュトークンは使えなくなります。
+func (h *AuthHandler) refresh(c *gin.Context) error {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	result, err := refreshSession(c.Request.Context(), h.repo, input.RefreshToken)
 	if err != nil {
 		return err
 	}
+	c.JSON(http.StatusOK, result.tokens())
+	return nil
+}
+
+// LoginResultはパスワードでのログインの結果です。2要素認証が有効ならTokenの代わりにChallengeTokenが入ります。
+type LoginResult struct {
+	Token          string
+	RefreshToken   string // リフレッシュトークンを要求したときだけ
+	MFARequired    bool
+	ChallengeToken string
+}
+
+// tokensはログインのレスポンスのボディです。refresh_tokenは発行したときだけ含めます。
+func (r LoginResult) tokens() gin.H {
+	body := gin.H{"token": r.Token}
+	if r.RefreshToken != "" {
+		body["refresh_token"] = r.RefreshToken
+	}
+	return body
+}
+
+// loginWithPasswordはメールアドレスとパスワードを確かめ、セッションを始めてJWTを返します。
+// 2要素認証が有効なユーザーにはセッションを始めずにチャレンジトークンを返します。RESTとgRPCのログインで共有します。
+func loginWithPassword(ctx context.Context, repo *TodoRepository, email, password string, client SessionClient) (LoginResult, error) {
+	user, err := repo.FindUserByEmail(ctx, email)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if err := checkPassword(user, password); err != nil {
+		return LoginResult{}, err
+	}
+	return startSessionOrChallenge(ctx, repo, user, client)
+}
+
+// startSessionOrChallengeは1要素目を確かめたユーザーのセッションを始めます。
+// 2要素認証が有効なユーザーにはセッションを始めずにチャレンジトークンを返します。パスワードとSSOのログインで共有します。
+func startSessionOrChallenge(ctx context.Context, repo *TodoRepository, user User, client SessionClient) (LoginResult, error) {
+	mfa, err := repo.TOTPEnabled(ctx, user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if mfa {
+		challenge, err := issueLoginChallenge(user)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
+	return startSession(ctx, repo, user, client)
+}
+
+// checkPasswordはパスワードを照合します。外部のIDプロバイダで作られたユーザーはパスワードを持たないので常に失敗します。
+func checkPassword(user User, password string) error {
+	if user.PasswordHash == "" {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+}
 
+// issueTokenはセッションのアプリケーション用JWTを発行します。ログインではstartSessionを使ってください。
+func issueToken(user User, sessionID string, expiresAt time.Time) (string, error) {
 	claims := AppClaims{
 		user.Role,
 		jwt.RegisteredClaims{
+			ID:        sessionID,
 			Subject:   fmt.Sprint(user.ID),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
-		return fmt.Errorf("failed to create token: %w", err)
+		return "", fmt.Errorf("failed to create token: %w", err)
 	}
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
-	return nil
+	return tokenString, nil
 }
 
 type AdminHandler struct {
@@ -268,7 +616,7 @@ func NewAdminHandler(repo *TodoRepository) *AdminHandler {
 }
 
 func (h *AdminHandler) getAllUsers(c *gin.Context) error {
-	users, err := h.repo.FindAllUsers()
+	users, err := h.repo.FindAllUsers(c.Request.Context())
 	if err != nil {
 		return err
 	}
@@ -285,6 +633,71 @@ func getEnv(key, defaultValue string) string {
 
 func initDB() {
 	var err error
+	if db, err = openDB(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Successfully connected to the database (%s)!", dialectOf(db).Name())
+}
+
+// openDBはDB_DRIVERで選んだDBに接続します。serveと管理コマンドで共有します。
+//   - postgres（既定）: DB_HOSTなどの接続情報でPostgreSQLに接続する。マイグレーションはmigrate CLIで適用する
+//   - sqlite: SQLITE_PATHのファイルを開く（無ければ作る）。1つのバイナリで動かすデモやエッジでの運用向けで、
+//     マイグレーションは開くときに適用する
+//
+// どちらもconfigurePoolでコネクションプールを設定します。
+func openDB() (*sql.DB, error) {
+	var conn *sql.DB
+	var err error
+	switch driver := getEnv("DB_DRIVER", "postgres"); driver {
+	case "postgres":
+		conn, err = openPostgres()
+	case "sqlite":
+		conn, err = openSQLite(getEnv("SQLITE_PATH", "todo.db"))
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q: want postgres or sqlite", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := configurePool(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// configurePoolはコネクションプールの上限と接続の寿命を環境変数から設定します。
+// database/sqlの既定では同時接続数に上限がないので、負荷が高いとPostgreSQLのmax_connectionsを使い切ります。
+// 上限に達したリクエストは接続が空くのを待ち、待っている間もリクエストとクエリの期限が進みます。
+//   - DB_MAX_OPEN_CONNS（既定25）: 同時に開く接続の上限。0なら無制限
+//   - DB_MAX_IDLE_CONNS（既定25）: プールに残しておくアイドル接続の数
+//   - DB_CONN_MAX_LIFETIME（既定30m）: 接続を使い回す最長の時間。フェイルオーバーやPgBouncerの入れ替えの後に古い接続を残さない
+//   - DB_CONN_MAX_IDLE_TIME（既定5m）: アイドルのまま残す最長の時間
+func configurePool(conn *sql.DB) error {
+	maxOpen, err := strconv.Atoi(getEnv("DB_MAX_OPEN_CONNS", "25"))
+	if err != nil {
+		return fmt.Errorf("invalid DB_MAX_OPEN_CONNS: %w", err)
+	}
+	maxIdle, err := strconv.Atoi(getEnv("DB_MAX_IDLE_CONNS", "25"))
+	if err != nil {
+		return fmt.Errorf("invalid DB_MAX_IDLE_CONNS: %w", err)
+	}
+	lifetime, err := time.ParseDuration(getEnv("DB_CONN_MAX_LIFETIME", "30m"))
+	if err != nil {
+		return fmt.Errorf("invalid DB_CONN_MAX_LIFETIME: %w", err)
+	}
+	idleTime, err := time.ParseDuration(getEnv("DB_CONN_MAX_IDLE_TIME", "5m"))
+	if err != nil {
+		return fmt.Errorf("invalid DB_CONN_MAX_IDLE_TIME: %w", err)
+	}
+	conn.SetMaxOpenConns(maxOpen)
+	conn.SetMaxIdleConns(maxIdle)
+	conn.SetConnMaxLifetime(lifetime)
+	conn.SetConnMaxIdleTime(idleTime)
+	return nil
+}
+
+func openPostgres() (*sql.DB, error) {
 	// --- PostgreSQLへの接続情報 (DSN: Data Source Name) ---
 	// 環境変数から接続情報を取得（Docker環境対応）
 	dbHost := getEnv("DB_HOST", "localhost")
@@ -293,18 +706,24 @@ func initDB() {
 	dbPassword := getEnv("DB_PASSWORD", "password")
 	dbName := getEnv("DB_NAME", "todo_db")
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		dbHost, dbUser, dbPassword, dbName, dbPort)
-	db, err = sql.Open("pgx", dsn)
+	// statement_timeoutはサーバー側で1つの文の実行時間を打ち切る（57014 query_canceled）。
+	// アプリのコンテキストの期限が効かない場合（接続が詰まっている、ドライバが取り消しを送れない）でもDBに重いクエリを残さないための保険
+	statementTimeout, err := time.ParseDuration(getEnv("DB_STATEMENT_TIMEOUT", "5s"))
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return nil, fmt.Errorf("invalid DB_STATEMENT_TIMEOUT: %w", err)
 	}
 
-	if err = db.Ping(); err != nil {
-		log.Fatalf("Error connecting to the database: %v", err)
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable statement_timeout=%d",
+		dbHost, dbUser, dbPassword, dbName, dbPort, statementTimeout.Milliseconds())
+	conn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
 	}
-
-	log.Println("Successfully connected to PostgreSQL!")
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to the database: %w", err)
+	}
+	return conn, nil
 }
 
 func requestIDMiddleware() gin.HandlerFunc {
@@ -317,27 +736,375 @@ func requestIDMiddleware() gin.HandlerFunc {
 	}
 }
 
+// untimedRoutesはrequestTimeoutMiddlewareが期限を付けないルート（メソッドとc.FullPath()）です。
+// 件数やファイルの大きさに比例して時間がかかり、レスポンスを書き始めた後に打ち切っても504を返せないルートを並べます。
+// これらのルートでもリポジトリの問い合わせごとの期限（DB_QUERY_TIMEOUT）とクライアントの切断によるキャンセルは効きます。
+var untimedRoutes = map[string]bool{
+	"GET /api/v1/me/export":                           true,
+	"GET /api/v1/todos/export":                        true,
+	"POST /api/v1/todos/import":                       true,
+	"POST /api/v1/todos/:id/attachments":              true,
+	"GET /api/v1/todos/:id/attachments/:attachmentId": true,
+	"GET /blobs/*key":                                 true,
+}
+
+// requestTimeoutMiddlewareはリクエストのコンテキストにtimeoutの期限を付けます。
+// ハンドラはc.Request.Context()をリポジトリに渡すので、期限を過ぎるとDBの処理が取り消され、errorHandlerが504を返します。
+// クライアントが切断した場合も同じコンテキストがキャンセルされます。timeoutが0ならなにもしません。
+func requestTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 || untimedRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// AppDepsはルートのハンドラに注入する依存関係です。
+type AppDeps struct {
+	Repo *TodoRepository
+	// Recurrenceは完了時に次の回の生成を促すスケジューラ。nilの場合は定期実行を待ちます。
+	Recurrence *RecurrenceScheduler
+	// Blobsは添付ファイルの置き場所。LocalBlobStoreなら署名付きURLのダウンロードのルートも登録します
+	Blobs BlobStore
+	// Attachmentsは添付ファイルのサイズ・容量の上限とダウンロード用URLの有効期間。0の項目は既定値です
+	Attachments AttachmentLimits
+	// AccountDeletionGraceはアカウント削除の申請から物理削除までの猶予期間。0なら既定値（7日）です。
+	AccountDeletionGrace time.Duration
+	// OIDCProvidersはログインに使える外部のIDプロバイダ（名前がパスの:providerになる）。空ならOIDCのルートは404です
+	OIDCProviders map[string]*OIDCProvider
+	// Sessionsはセッションの拒否リスト。nilなら定期読み込みをしないものを作ります（このプロセスでの取り消しだけが効く）
+	Sessions *SessionRegistry
+	// TOTPIssuerは認証アプリに表示するサービス名。空なら既定値です
+	TOTPIssuer string
+	// GraphQLはPOST /graphqlのクエリの深さと複雑さの上限。0の項目は既定値です
+	GraphQL GraphQLLimits
+	// ValidateRequestsがtrueなら、openapi.yamlに合わないリクエストをハンドラの前に400で拒否します
+	ValidateRequests bool
+	// APIUsageはバージョンごとの利用状況。nilなら新しく作ります
+	APIUsage *APIUsage
+	// V1Deprecationは/api/v2に後継のある/api/v1のルートで告知する非推奨の日時
+	V1Deprecation APIDeprecation
+	// Notifierはリストへの招待の通知を送る先。nilならLogNotifierです
+	Notifier Notifier
+	// RequestTimeoutは1リクエストの処理の期限（untimedRoutesを除く）。0なら期限を付けません
+	RequestTimeout time.Duration
+}
+
+// registerRoutesはハンドラを構築し、APIのルートを登録します。
+// main()とテスト用ルーターで同じルート定義を共有するために切り出しています。
+func registerRoutes(router *gin.Engine, deps AppDeps) {
+	repo := deps.Repo
+	sessions := deps.Sessions
+	if sessions == nil {
+		sessions = NewSessionRegistry(repo, 0)
+	}
+	notifier := deps.Notifier
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+	// ハンドラのインスタンスを作成し、リポジトリを注入
+	todoHandler := NewTodoHandler(repo, deps.Recurrence)
+	meHandler := NewMeHandler(repo, deps.AccountDeletionGrace)
+	tagHandler := NewTagHandler(repo)
+	listHandler := NewListHandler(repo, notifier)
+	reminderHandler := NewReminderHandler(repo)
+	commentHandler := NewCommentHandler(repo)
+	tokenHandler := NewTokenHandler(repo)
+	attachmentHandler := NewAttachmentHandler(repo, deps.Blobs, deps.Attachments)
+	authHandler := NewAuthHandler(repo)
+	oidcHandler := NewOIDCHandler(repo, deps.OIDCProviders)
+	twoFactorHandler := NewTwoFactorHandler(repo, deps.TOTPIssuer)
+	sessionHandler := NewSessionHandler(repo, sessions)
+	adminHandler := NewAdminHandler(repo)
+	graphqlHandler := NewGraphQLHandler(repo, deps.GraphQL)
+	todoV2Handler := NewTodoV2Handler(repo)
+	usage := deps.APIUsage
+	if usage == nil {
+		usage = NewAPIUsage()
+	}
+
+	router.Use(requestTimeoutMiddleware(deps.RequestTimeout))
+
+	// リクエストの検証は認証の後に行うので、ルーター全体ではなくグループごとに付ける
+	validate := func(c *gin.Context) { c.Next() }
+	if deps.ValidateRequests {
+		spec, err := loadOpenAPISpec()
+		if err != nil {
+			// 仕様はバイナリに埋め込んでいるので、ここで失敗するのはプログラムの誤り
+			panic(err)
+		}
+		validate = openapiValidationMiddleware(spec)
+	}
+
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/openapi.yaml", serveOpenAPISpec)
+	router.GET("/docs", serveAPIDocs)
+	// 認証の要らないルート
+	public := router.Group("/", validate)
+	public.POST("/signup", errorHandler(authHandler.signup))
+	public.POST("/login", errorHandler(authHandler.login))
+	public.POST("/login/2fa", errorHandler(twoFactorHandler.loginSecondFactor))
+	public.POST("/login/refresh", errorHandler(authHandler.refresh))
+	public.GET("/auth/oidc/:provider/start", errorHandler(oidcHandler.start))
+	public.GET("/auth/oidc/:provider/callback", errorHandler(oidcHandler.callback))
+	// GraphQLは/api/v1と同じ認証を通す。パーソナルアクセストークンのスコープはハンドラで操作の種類ごとに確かめる
+	router.POST("/graphql", authMiddleware(repo, sessions), validate, errorHandler(graphqlHandler.serve))
+	if local, ok := deps.Blobs.(*LocalBlobStore); ok {
+		router.GET("/blobs/*key", errorHandler(serveBlob(local)))
+	}
+
+	v1 := router.Group("/api/v1")
+	// このグループのルートは認証ミドルウェアを通る。パーソナルアクセストークンは呼べるルートとスコープを制限する
+	v1.Use(usage.middleware("v1"), authMiddleware(repo, sessions), tokenScopeMiddleware(), validate)
+	// /api/v2に後継のあるルートはDeprecation・Sunsetヘッダーを付ける
+	v1Deprecated := deprecatedRoute(deps.V1Deprecation, "/api/v1", "/api/v2")
+	{
+		v1.GET("/me", errorHandler(meHandler.getMe))
+		v1.PUT("/me", errorHandler(meHandler.updateMe))
+		v1.DELETE("/me", errorHandler(meHandler.deleteMe))
+		v1.DELETE("/me/deletion", errorHandler(meHandler.cancelDeletion))
+		v1.GET("/me/export", errorHandler(meHandler.exportMe))
+		v1.GET("/me/mentions", errorHandler(commentHandler.getMentions))
+		v1.GET("/me/tokens", errorHandler(tokenHandler.getTokens))
+		v1.POST("/me/tokens", errorHandler(tokenHandler.createToken))
+		v1.DELETE("/me/tokens/:id", errorHandler(tokenHandler.revokeToken))
+		v1.GET("/me/sessions", errorHandler(sessionHandler.getSessions))
+		v1.DELETE("/me/sessions/:id", errorHandler(sessionHandler.revokeSession))
+		v1.GET("/me/2fa", errorHandler(twoFactorHandler.getStatus))
+		v1.DELETE("/me/2fa", errorHandler(twoFactorHandler.disable))
+		v1.POST("/me/2fa/enroll", errorHandler(twoFactorHandler.enroll))
+		v1.POST("/me/2fa/confirm", errorHandler(twoFactorHandler.confirm))
+		v1.POST("/me/2fa/recovery-codes", errorHandler(twoFactorHandler.regenerateRecoveryCodes))
+
+		v1.GET("/todos", v1Deprecated, errorHandler(todoHandler.getTodos))
+		v1.POST("/todos", v1Deprecated, errorHandler(todoHandler.createTodo))
+		v1.GET("/todos/trash", errorHandler(todoHandler.getTrash))
+		v1.GET("/todos/export", errorHandler(todoHandler.exportTodos))
+		v1.POST("/todos/import", errorHandler(todoHandler.importTodos))
+		v1.GET("/todos/:id", v1Deprecated, errorHandler(todoHandler.getTodo))
+		v1.PUT("/todos/:id", v1Deprecated, errorHandler(todoHandler.updateTodo))
+		v1.DELETE("/todos/:id", v1Deprecated, errorHandler(todoHandler.deleteTodo))
+		v1.GET("/todos/:id/tree", errorHandler(todoHandler.getTodoTree))
+		v1.POST("/todos/:id/move", errorHandler(todoHandler.moveTodo))
+		v1.POST("/todos/:id/complete", errorHandler(todoHandler.completeTodo))
+		v1.POST("/todos/:id/reopen", errorHandler(todoHandler.reopenTodo))
+		v1.POST("/todos/:id/restore", errorHandler(todoHandler.restoreTodo))
+		v1.DELETE("/todos/:id/recurrence", errorHandler(todoHandler.stopRecurrence))
+		v1.GET("/todos/:id/reminders", errorHandler(reminderHandler.getTodoReminders))
+		v1.POST("/todos/:id/reminders", errorHandler(reminderHandler.createReminder))
+		v1.GET("/todos/:id/attachments", errorHandler(attachmentHandler.getAttachments))
+		v1.POST("/todos/:id/attachments", errorHandler(attachmentHandler.uploadAttachment))
+		v1.GET("/todos/:id/attachments/:attachmentId", errorHandler(attachmentHandler.getAttachment))
+		v1.DELETE("/todos/:id/attachments/:attachmentId", errorHandler(attachmentHandler.deleteAttachment))
+		v1.GET("/todos/:id/comments", errorHandler(commentHandler.getComments))
+		v1.POST("/todos/:id/comments", errorHandler(commentHandler.createComment))
+		v1.PUT("/todos/:id/comments/:commentId", errorHandler(commentHandler.updateComment))
+		v1.DELETE("/todos/:id/comments/:commentId", errorHandler(commentHandler.deleteComment))
+		v1.GET("/todos/:id/comments/:commentId/history", errorHandler(commentHandler.getCommentHistory))
+		v1.PUT("/todos/:id/tags/:tagId", errorHandler(tagHandler.attachTag))
+		v1.DELETE("/todos/:id/tags/:tagId", errorHandler(tagHandler.detachTag))
+
+		v1.GET("/reminders", errorHandler(reminderHandler.getReminders))
+		v1.POST("/reminders/:id/snooze", errorHandler(reminderHandler.snoozeReminder))
+		v1.POST("/reminders/:id/dismiss", errorHandler(reminderHandler.dismissReminder))
+		v1.DELETE("/reminders/:id", errorHandler(reminderHandler.deleteReminder))
+
+		v1.GET("/tags", errorHandler(tagHandler.getTags))
+		v1.POST("/tags", errorHandler(tagHandler.createTag))
+		v1.PUT("/tags/:id", errorHandler(tagHandler.updateTag))
+		v1.DELETE("/tags/:id", errorHandler(tagHandler.deleteTag))
+
+		v1.GET("/lists", errorHandler(listHandler.getLists))
+		v1.POST("/lists", errorHandler(listHandler.createList))
+		v1.GET("/lists/:id/members", errorHandler(listHandler.getMembers))
+		v1.PUT("/lists/:id/members/:userId", errorHandler(listHandler.updateMember))
+		v1.DELETE("/lists/:id/members/:userId", errorHandler(listHandler.removeMember))
+		v1.GET("/lists/:id/invitations", errorHandler(listHandler.getListInvitations))
+		v1.POST("/lists/:id/invitations", errorHandler(listHandler.invite))
+		v1.DELETE("/lists/:id/invitations/:invitationId", errorHandler(listHandler.cancelInvitation))
+
+		v1.GET("/invitations", errorHandler(listHandler.getMyInvitations))
+		v1.POST("/invitations/:id/accept", errorHandler(listHandler.acceptInvitation))
+		v1.DELETE("/invitations/:id", errorHandler(listHandler.declineInvitation))
+
+		adminRoutes := v1.Group("/admin")
+		adminRoutes.Use(adminMiddleware())
+		{
+			adminRoutes.GET("/users", errorHandler(adminHandler.getAllUsers))
+			adminRoutes.GET("/deletions", errorHandler(adminHandler.getPendingDeletions))
+			adminRoutes.DELETE("/users/:id/2fa", errorHandler(twoFactorHandler.adminReset))
+			adminRoutes.DELETE("/users/:id/sessions", errorHandler(sessionHandler.revokeUserSessions))
+			adminRoutes.GET("/api-usage", errorHandler(usage.getReport))
+		}
+	}
+
+	// v2はv1と同じ認証とリポジトリを使い、TODOの表現だけが異なる
+	v2 := router.Group("/api/v2")
+	v2.Use(usage.middleware("v2"), authMiddleware(repo, sessions), tokenScopeMiddleware(), validate)
+	{
+		v2.GET("/todos", errorHandler(todoV2Handler.getTodos))
+		v2.POST("/todos", errorHandler(todoV2Handler.createTodo))
+		v2.GET("/todos/:id", errorHandler(todoV2Handler.getTodo))
+		v2.PUT("/todos/:id", errorHandler(todoV2Handler.updateTodo))
+		v2.DELETE("/todos/:id", errorHandler(todoV2Handler.deleteTodo))
+	}
+}
+
 func main() {
 	// JWT秘密鍵を環境変数から読み取る
 	jwtSecret = []byte(getEnv("JWT_SECRET", "a-very-secret-key"))
+	jwtPreviousSecret = []byte(os.Getenv("JWT_PREVIOUS_SECRET"))
 
+	// サブコマンドが無ければserve（既存のデプロイの起動コマンドのまま動くように）
+	cli := &AdminCLI{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr, OpenDB: openDB, Serve: serve}
+	os.Exit(cli.Run(os.Args[1:]))
+}
+
+// serveはHTTPとgRPCのサーバーとバックグラウンド処理を起動し、SIGINTかSIGTERMを受けたら止めます。
+func serve() {
 	initDB()
 
 	// --- 依存関係の構築 (DI: Dependency Injection) ---
-	// 1. リポジトリのインスタンスを作成
+	// リポジトリのインスタンスを作成し、registerRoutesでハンドラに注入する
 	repo := NewTodoRepository(db)
-	// 2. ハンドラのインスタンスを作成し、リポジトリを注入
-	todoHandler := NewTodoHandler(repo)
-	authHandler := NewAuthHandler(repo)
-	adminHandler := NewAdminHandler(repo)
+
+	// リクエスト全体の期限と、リポジトリのメソッド1回（トランザクションならその全体）の期限
+	requestTimeout, err := time.ParseDuration(getEnv("REQUEST_TIMEOUT", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid REQUEST_TIMEOUT: %v", err)
+	}
+	if repo.QueryTimeout, err = time.ParseDuration(getEnv("DB_QUERY_TIMEOUT", "10s")); err != nil {
+		log.Fatalf("Invalid DB_QUERY_TIMEOUT: %v", err)
+	}
+
+	// 繰り返しTODOのスケジューラ（サーバー内のバックグラウンドgoroutine）
+	recurrenceInterval, err := time.ParseDuration(getEnv("RECURRENCE_INTERVAL", "1m"))
+	if err != nil {
+		log.Fatalf("Invalid RECURRENCE_INTERVAL: %v", err)
+	}
+	recurrence := NewRecurrenceScheduler(repo, recurrenceInterval)
+
+	// リマインダーのディスパッチャ。通知の送り先はNOTIFIERで選ぶ（リストへの招待の通知も同じ送り先）
+	reminderInterval, err := time.ParseDuration(getEnv("REMINDER_INTERVAL", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid REMINDER_INTERVAL: %v", err)
+	}
+	notifier, err := newNotifierFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure notifier: %v", err)
+	}
+	reminders := NewReminderDispatcher(repo, notifier, reminderInterval)
+
+	// 添付ファイルの置き場所（BLOB_STORE=local|s3）と制限
+	blobs, err := newBlobStoreFromEnv([]byte(getEnv("BLOB_SIGNING_SECRET", string(jwtSecret))))
+	if err != nil {
+		log.Fatalf("Failed to configure blob store: %v", err)
+	}
+	var attachmentLimits AttachmentLimits
+	if attachmentLimits.MaxSize, err = strconv.ParseInt(getEnv("ATTACHMENT_MAX_BYTES", "10485760"), 10, 64); err != nil {
+		log.Fatalf("Invalid ATTACHMENT_MAX_BYTES: %v", err)
+	}
+	if attachmentLimits.Quota, err = strconv.ParseInt(getEnv("ATTACHMENT_QUOTA_BYTES", "104857600"), 10, 64); err != nil {
+		log.Fatalf("Invalid ATTACHMENT_QUOTA_BYTES: %v", err)
+	}
+	if attachmentLimits.URLTTL, err = time.ParseDuration(getEnv("ATTACHMENT_URL_TTL", "15m")); err != nil {
+		log.Fatalf("Invalid ATTACHMENT_URL_TTL: %v", err)
+	}
+
+	// ゴミ箱のパージジョブ。TRASH_RETENTIONを過ぎたTODOを物理削除する
+	trashRetention, err := time.ParseDuration(getEnv("TRASH_RETENTION", "720h"))
+	if err != nil {
+		log.Fatalf("Invalid TRASH_RETENTION: %v", err)
+	}
+	purgeInterval, err := time.ParseDuration(getEnv("TRASH_PURGE_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("Invalid TRASH_PURGE_INTERVAL: %v", err)
+	}
+	purger := NewTrashPurger(repo, blobs, trashRetention, purgeInterval)
+
+	// アカウント削除ジョブ。申請からACCOUNT_DELETION_GRACEが過ぎたユーザーを物理削除する
+	deletionGrace, err := time.ParseDuration(getEnv("ACCOUNT_DELETION_GRACE", "168h"))
+	if err != nil {
+		log.Fatalf("Invalid ACCOUNT_DELETION_GRACE: %v", err)
+	}
+	deletionInterval, err := time.ParseDuration(getEnv("ACCOUNT_DELETION_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("Invalid ACCOUNT_DELETION_INTERVAL: %v", err)
+	}
+
+	sessionRefresh, err := time.ParseDuration(getEnv("SESSION_REFRESH_INTERVAL", "15s"))
+	if err != nil {
+		log.Fatalf("Invalid SESSION_REFRESH_INTERVAL: %v", err)
+	}
+	sessions := NewSessionRegistry(repo, sessionRefresh)
+	// 起動直後から取り消し済みのセッションを拒否できるように、リクエストを受け付ける前に読み込む
+	if err := sessions.Refresh(context.Background()); err != nil {
+		log.Fatalf("Failed to load revoked sessions: %v", err)
+	}
+	deleter := NewAccountDeleter(repo, sessions, deletionInterval)
+
+	// gRPCのWatchTodosが新しい変更を確かめる間隔
+	watchInterval, err := time.ParseDuration(getEnv("GRPC_WATCH_INTERVAL", "1s"))
+	if err != nil {
+		log.Fatalf("Invalid GRPC_WATCH_INTERVAL: %v", err)
+	}
+
+	// GraphQLのクエリの上限
+	var graphqlLimits GraphQLLimits
+	if graphqlLimits.MaxDepth, err = strconv.Atoi(getEnv("GRAPHQL_MAX_DEPTH", "10")); err != nil {
+		log.Fatalf("Invalid GRAPHQL_MAX_DEPTH: %v", err)
+	}
+	if graphqlLimits.MaxComplexity, err = strconv.Atoi(getEnv("GRAPHQL_MAX_COMPLEXITY", "5000")); err != nil {
+		log.Fatalf("Invalid GRAPHQL_MAX_COMPLEXITY: %v", err)
+	}
+
+	oidcProviders, err := newOIDCProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid OIDC configuration: %v", err)
+	}
+
+	// OPENAPI_VALIDATIONがtrueなら、openapi.yamlに合わないリクエストをハンドラの前で拒否する
+	validateRequests, err := strconv.ParseBool(getEnv("OPENAPI_VALIDATION", "false"))
+	if err != nil {
+		log.Fatalf("Invalid OPENAPI_VALIDATION: %v", err)
+	}
+
+	// /api/v1のTODOのルートの非推奨の告知（空にするとそのヘッダーを付けない）
+	var v1Deprecation APIDeprecation
+	if v1Deprecation.Since, err = parseOptionalDate(getEnv("API_V1_DEPRECATED_AT", "2026-11-01")); err != nil {
+		log.Fatalf("Invalid API_V1_DEPRECATED_AT: %v", err)
+	}
+	if v1Deprecation.Sunset, err = parseOptionalDate(getEnv("API_V1_SUNSET", "2027-05-01")); err != nil {
+		log.Fatalf("Invalid API_V1_SUNSET: %v", err)
+	}
+
+	// バックグラウンド処理はこのコンテキストのキャンセルで停止する
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	for _, run := range []func(context.Context){recurrence.Run, reminders.Run, purger.Run, deleter.Run, sessions.Run} {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(bgCtx)
+		}()
+	}
 
 	router := gin.New()
 
-  config := cors.DefaultConfig()
-  config.AllowOrigins = []string{"http://localhost:3000"}
-  config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-  config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
-  router.Use(cors.New(config))
+	config := cors.DefaultConfig()
+	config.AllowOrigins = []string{"http://localhost:3000"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	// ブラウザのクライアントからも非推奨の告知を読めるようにする
+	config.ExposeHeaders = []string{"Deprecation", "Sunset", "Link"}
+	router.Use(cors.New(config))
 
 	logFormatter := func(param gin.LogFormatterParams) string {
 		requestID := param.Keys["RequestID"]
@@ -360,24 +1127,21 @@ func main() {
 	// 3. Logger: カスタムフォーマットのロガーを適用する。
 	router.Use(gin.LoggerWithFormatter(logFormatter))
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	registerRoutes(router, AppDeps{
+		Repo:                 repo,
+		Recurrence:           recurrence,
+		Blobs:                blobs,
+		Attachments:          attachmentLimits,
+		AccountDeletionGrace: deletionGrace,
+		OIDCProviders:        oidcProviders,
+		Sessions:             sessions,
+		Notifier:             notifier,
+		TOTPIssuer:           os.Getenv("TOTP_ISSUER"),
+		GraphQL:              graphqlLimits,
+		ValidateRequests:     validateRequests,
+		V1Deprecation:        v1Deprecation,
+		RequestTimeout:       requestTimeout,
 	})
-	router.POST("/signup", errorHandler(authHandler.signup))
-	router.POST("/login", errorHandler(authHandler.login))
-
-	v1 := router.Group("/api/v1")
-	v1.Use(authMiddleware()) // このグループのルートは認証ミドルウェアを通る
-	{
-		v1.GET("/todos", errorHandler(todoHandler.getTodos))
-		v1.POST("/todos", errorHandler(todoHandler.createTodo))
-
-		adminRoutes := v1.Group("/admin")
-		adminRoutes.Use(adminMiddleware())
-		{
-			adminRoutes.GET("/users", errorHandler(adminHandler.getAllUsers))
-		}
-	}
 
 	// --- Graceful Shutdownの実装 ---
 
@@ -397,6 +1161,22 @@ func main() {
 		}
 	}()
 
+	// gRPCサーバーも別のポートで同じリポジトリ・認証を使って起動する
+	// stopWatchesを閉じると、終わらないWatchTodosのストリームが終わってGracefulStopできるようになる
+	grpcPort := getEnv("GRPC_PORT", "9090")
+	grpcListener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.Fatalf("Failed to listen on gRPC port: %v", err)
+	}
+	stopWatches := make(chan struct{})
+	grpcServer := newGRPCServer(repo, sessions, watchInterval, stopWatches)
+	go func() {
+		log.Printf("Starting gRPC server at port %s", grpcPort)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.Fatalf("grpc serve: %s\n", err)
+		}
+	}()
+
 	// 3. 終了シグナルを待機するためのチャネルを作成
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -409,10 +1189,21 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// 5. サーバーをGracefulにシャットダウン
+	// 5. サーバーをGracefulにシャットダウン（gRPCも同じ期限で並行して止める）
+	grpcStopped := make(chan struct{})
+	go func() {
+		defer close(grpcStopped)
+		close(stopWatches)
+		stopGRPCServer(ctx, grpcServer)
+	}()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	<-grpcStopped
+
+	// 6. リクエストの処理が終わってからバックグラウンド処理を止め、終了を待つ
+	stopBackground()
+	background.Wait()
 
 	log.Println("Server exiting")
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MeHandlerはログインユーザー自身のプロフィールと設定を扱います。
+type MeHandler struct {
+	repo *TodoRepository
+	// deletionGraceはアカウント削除の申請から物理削除までの猶予期間
+	deletionGrace time.Duration
+}
+
+// NewMeHandlerはMeHandlerを作成します。deletionGraceが0ならdefaultAccountDeletionGraceを使います。
+func NewMeHandler(repo *TodoRepository, deletionGrace time.Duration) *MeHandler {
+	if deletionGrace == 0 {
+		deletionGrace = defaultAccountDeletionGrace
+	}
+	return &MeHandler{repo: repo, deletionGrace: deletionGrace}
+}
+
+func (h *MeHandler) getMe(c *gin.Context) error {
+	user, err := h.repo.FindUserByID(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, user)
+	return nil
+}
+
+type UpdateMeInput struct {
+	Timezone string `json:"timezone" binding:"required"`
+}
+
+// updateMeはユーザーの設定を変更します。タイムゾーンはIANA名（例: Asia/Tokyo）で指定します。
+// 変更は以降に作成する繰り返しTODOに適用されます。
+func (h *MeHandler) updateMe(c *gin.Context) error {
+	var input UpdateMeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidInput, input.Timezone)
+	}
+
+	userID := currentUserID(c)
+	if err := h.repo.UpdateUserTimezone(c.Request.Context(), userID, input.Timezone); err != nil {
+		return err
+	}
+	user, err := h.repo.FindUserByID(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, user)
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sqliteMigrationsはSQLite用のマイグレーションです。SQLiteのDBは開くときにopenSQLiteが適用するので、migrate CLIは要りません。
+//
+//go:embed sqlite_migrations/*.sql
+var sqliteMigrationFiles embed.FS
+
+var sqliteMigrations, _ = fs.Sub(sqliteMigrationFiles, "sqlite_migrations")
+
+// migrationは"000001_name.up.sql"のファイル1つ分のマイグレーションです。
+type migration struct {
+	version int
+	sql     string
+}
+
+// readMigrationsはfsysの*.up.sqlをバージョン順に読みます。ファイル名はmigrate CLIと同じ"000001_name.up.sql"です。
+func readMigrations(fsys fs.FS) ([]migration, error) {
+	paths, err := fs.Glob(fsys, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []migration
+	for _, p := range paths {
+		prefix, _, _ := strings.Cut(path.Base(p), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version prefix", p)
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, sql: string(b)})
+	}
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations found")
+	}
+	return migrations, nil
+}
+
+// applyMigrationsはまだ適用していないマイグレーションを1つずつトランザクションで実行します。
+// schema_migrationsはmigrate CLIと同じ形で書くので、db checkやmigrate CLIはそのまま使えます。
+func applyMigrations(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return err
+	}
+	return runMigrations(ctx, db, migrations)
+}
+
+func runMigrations(ctx context.Context, db *sql.DB, migrations []migration) error {
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)"); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if err := runMigration(ctx, db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigrationは適用済みのバージョンを読んでからマイグレーションを実行します。
+// 同じDBを同時に開いたプロセスがあっても二重に適用しないように、読むのも同じトランザクションで行います。
+func runMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	var dirty bool
+	err = tx.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	case dirty:
+		return fmt.Errorf("migration %d is dirty; fix it and run migrate force", version)
+	case version >= m.version:
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return fmt.Errorf("migration %d: %w", m.version, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, FALSE)", m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
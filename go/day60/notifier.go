@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifierはリマインダーとリストへの招待の通知を送る先です。
+// 実装は環境変数NOTIFIERで選びます（log / webhook / email）。
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+	NotifyInvitation(ctx context.Context, n InvitationNotification) error
+}
+
+// 通知の種類。WebhookNotifierはX-Notification-Typeヘッダで受信側に伝えます
+const (
+	notificationReminder   = "reminder"
+	notificationInvitation = "invitation"
+)
+
+// newNotifierFromEnvは環境変数の設定からNotifierを作成します。
+func newNotifierFromEnv() (Notifier, error) {
+	switch kind := getEnv("NOTIFIER", "log"); kind {
+	case "log":
+		return LogNotifier{}, nil
+	case "webhook":
+		url := getEnv("WEBHOOK_URL", "")
+		if url == "" {
+			return nil, fmt.Errorf("WEBHOOK_URL is required for NOTIFIER=webhook")
+		}
+		return NewWebhookNotifier(url, getEnv("WEBHOOK_SECRET", "")), nil
+	case "email":
+		host := getEnv("SMTP_HOST", "")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for NOTIFIER=email")
+		}
+		return NewEmailNotifier(host, getEnv("SMTP_PORT", "587"), getEnv("SMTP_USERNAME", ""),
+			getEnv("SMTP_PASSWORD", ""), getEnv("SMTP_FROM", "noreply@example.com")), nil
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q", kind)
+	}
+}
+
+// LogNotifierは通知をログに出力するだけのNotifierです。開発環境向けです。
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf("Reminder %d: todo %d %q for %s (due: %v)", n.ReminderID, n.TodoID, n.TodoName, n.Email, formatDueAt(n.DueAt))
+	return nil
+}
+
+func (LogNotifier) NotifyInvitation(ctx context.Context, n InvitationNotification) error {
+	log.Printf("Invitation %d: list %d %q for %s (role: %s, invited by %s)", n.InvitationID, n.ListID, n.ListName, n.Email, n.Role, n.InvitedBy)
+	return nil
+}
+
+// WebhookNotifierは通知をJSONでURLにPOSTします。通知の種類（reminderかinvitation）はX-Notification-Typeヘッダに入ります。
+// secretを設定すると、本文のHMAC-SHA256署名をX-Signatureヘッダに付けるので、受信側で送信元を検証できます。
+// 2xx以外の応答は失敗として扱います（リマインダーはディスパッチャが再送します）。
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, secret: secret, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return w.post(ctx, notificationReminder, n)
+}
+
+func (w *WebhookNotifier) NotifyInvitation(ctx context.Context, n InvitationNotification) error {
+	return w.post(ctx, notificationInvitation, n)
+}
+
+func (w *WebhookNotifier) post(ctx context.Context, kind string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Notification-Type", kind)
+	if w.secret != "" {
+		req.Header.Set("X-Signature", "sha256="+signPayload(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// signPayloadはbodyのHMAC-SHA256を16進数で返します。
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// EmailNotifierは通知をSMTPでメール送信します。usernameが空なら認証しません。
+type EmailNotifier struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+	// sendMailはテストで差し替えられるようにフィールドにしています。
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewEmailNotifier(host, port, username, password, from string) *EmailNotifier {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &EmailNotifier{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		from:     from,
+		auth:     auth,
+		sendMail: smtp.SendMail,
+	}
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	// net/smtpはコンテキストに対応していないので、送信を始める前にだけ確認する
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.sendMail(e.addr, e.auth, e.from, []string{n.Email}, buildReminderEmail(e.from, n))
+}
+
+func (e *EmailNotifier) NotifyInvitation(ctx context.Context, n InvitationNotification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.sendMail(e.addr, e.auth, e.from, []string{n.Email}, buildInvitationEmail(e.from, n))
+}
+
+// buildReminderEmailはリマインダーのメール本文（ヘッダ付き）を組み立てます。
+func buildReminderEmail(from string, n Notification) []byte {
+	// ヘッダインジェクションを防ぐため、TODO名の改行は空白にする
+	name := singleLine(n.TodoName)
+	var b strings.Builder
+	writeEmailHeader(&b, from, n.Email, "Reminder: "+name)
+	fmt.Fprintf(&b, "This is a reminder for your todo %q.\r\n", name)
+	fmt.Fprintf(&b, "Due: %s\r\n", formatDueAt(n.DueAt))
+	return []byte(b.String())
+}
+
+// buildInvitationEmailはリストへの招待のメール本文（ヘッダ付き）を組み立てます。
+func buildInvitationEmail(from string, n InvitationNotification) []byte {
+	name := singleLine(n.ListName)
+	var b strings.Builder
+	writeEmailHeader(&b, from, n.Email, "Invitation: "+name)
+	fmt.Fprintf(&b, "%s invited you to the list %q as %s.\r\n", singleLine(n.InvitedBy), name, n.Role)
+	b.WriteString("Sign in with this email address and accept the invitation from your pending invitations.\r\n")
+	return []byte(b.String())
+}
+
+// writeEmailHeaderはメールのヘッダと、本文との区切りの空行を書きます。
+func writeEmailHeader(b *strings.Builder, from, to, subject string) {
+	fmt.Fprintf(b, "From: %s\r\n", from)
+	fmt.Fprintf(b, "To: %s\r\n", to)
+	// 日本語の件名もそのままヘッダーに入れられないので、RFC 2047の形にする
+	fmt.Fprintf(b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+}
+
+// singleLineはヘッダに入れる値の改行を空白にします。
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func formatDueAt(dueAt *time.Time) string {
+	if dueAt == nil {
+		return "no due date"
+	}
+	return dueAt.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testNotification() Notification {
+	due := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	return Notification{
+		ReminderID: 7,
+		TodoID:     42,
+		TodoName:   "Pay rent",
+		DueAt:      &due,
+		RemindAt:   due.Add(-30 * time.Minute),
+		UserID:     2,
+		Email:      "user-test@example.com",
+	}
+}
+
+func testInvitationNotification() InvitationNotification {
+	return InvitationNotification{
+		InvitationID: 3,
+		ListID:       5,
+		ListName:     "Team",
+		Role:         RoleEditor,
+		InvitedBy:    "user-test@example.com",
+		Email:        "member@example.com",
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	var signature, kind string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature")
+		kind = r.Header.Get("X-Notification-Type")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, "s3cret")
+	assert.NoError(t, notifier.Notify(context.Background(), testNotification()))
+
+	var got Notification
+	assert.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, 42, got.TodoID)
+	assert.Equal(t, "Pay rent", got.TodoName)
+	assert.Equal(t, "reminder", kind)
+	// 受信側は同じ秘密鍵で本文の署名を検証できる
+	assert.Equal(t, "sha256="+signPayload("s3cret", body), signature)
+
+	// 招待は種類のヘッダで見分ける
+	assert.NoError(t, notifier.NotifyInvitation(context.Background(), testInvitationNotification()))
+	var invitation InvitationNotification
+	assert.NoError(t, json.Unmarshal(body, &invitation))
+	assert.Equal(t, testInvitationNotification(), invitation)
+	assert.Equal(t, "invitation", kind)
+	assert.Equal(t, "sha256="+signPayload("s3cret", body), signature)
+}
+
+func TestWebhookNotifierFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL, "").Notify(context.Background(), testNotification())
+	assert.ErrorContains(t, err, "502")
+}
+
+func TestEmailNotifier(t *testing.T) {
+	notifier := NewEmailNotifier("smtp.example.com", "587", "", "", "noreply@example.com")
+	var addr string
+	var to []string
+	var msg string
+	notifier.sendMail = func(a string, _ smtp.Auth, _ string, rcpt []string, m []byte) error {
+		addr, to, msg = a, rcpt, string(m)
+		return nil
+	}
+
+	n := testNotification()
+	n.TodoName = "Pay rent\r\nBcc: attacker@example.com"
+	assert.NoError(t, notifier.Notify(context.Background(), n))
+	assert.Equal(t, "smtp.example.com:587", addr)
+	assert.Equal(t, []string{"user-test@example.com"}, to)
+	assert.Contains(t, msg, "Subject: Reminder: Pay rent  Bcc: attacker@example.com\r\n")
+	assert.NotContains(t, msg, "\r\nBcc:")
+	assert.Contains(t, msg, "Due: 2026-10-01T09:00:00Z")
+	assert.True(t, strings.HasPrefix(msg, "From: noreply@example.com\r\n"))
+
+	// ASCII以外のTODO名は件名をエンコードし、本文はUTF-8のまま送る
+	n.TodoName = "家賃を払う"
+	assert.NoError(t, notifier.Notify(context.Background(), n))
+	assert.Contains(t, msg, "Subject: =?utf-8?q?Reminder:_=E5=AE=B6=E8=B3=83=E3=82=92=E6=89=95=E3=81=86?=\r\n")
+	subject := msg[strings.Index(msg, "Subject: ")+len("Subject: "):]
+	subject = subject[:strings.Index(subject, "\r\n")]
+	decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+	assert.NoError(t, err)
+	assert.Equal(t, "Reminder: 家賃を払う", decoded)
+	assert.Contains(t, msg, "This is a reminder for your todo \"家賃を払う\".")
+}
+
+func TestEmailNotifierInvitation(t *testing.T) {
+	notifier := NewEmailNotifier("smtp.example.com", "587", "", "", "noreply@example.com")
+	var to []string
+	var msg string
+	notifier.sendMail = func(_ string, _ smtp.Auth, _ string, rcpt []string, m []byte) error {
+		to, msg = rcpt, string(m)
+		return nil
+	}
+
+	n := testInvitationNotification()
+	n.ListName = "Team\r\nBcc: attacker@example.com"
+	assert.NoError(t, notifier.NotifyInvitation(context.Background(), n))
+	assert.Equal(t, []string{"member@example.com"}, to)
+	assert.Contains(t, msg, "To: member@example.com\r\n")
+	assert.Contains(t, msg, "Subject: Invitation: Team  Bcc: attacker@example.com\r\n")
+	assert.NotContains(t, msg, "\r\nBcc:")
+	assert.Contains(t, msg, "user-test@example.com invited you to the list \"Team  Bcc: attacker@example.com\" as editor.")
+}
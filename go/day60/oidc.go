@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCProviderは外部のIDプロバイダ（OpenID Connect）の設定と、ディスカバリ・署名鍵のキャッシュです。
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// RoleClaimはロールの判定に使うIDトークンのクレーム（例: groups）。空ならロールを同期せず、新規ユーザーはuserになります
+	RoleClaim string
+	// AdminValuesはRoleClaimにこのいずれかの値が含まれていればadminにする値です
+	AdminValues []string
+
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+// jwksRefreshIntervalは知らないkidでJWKSを取り直す最短の間隔です。でたらめなkidのトークンでIdPに負荷をかけられないようにします。
+const jwksRefreshInterval = time.Minute
+
+// oidcDiscoveryはディスカバリドキュメント（/.well-known/openid-configuration）のうち使う項目です。
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentityは検証したIDトークンから取り出したユーザーの情報です。
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// Roleはクレームから決めたロール。RoleClaimを設定していなければ空です
+	Role string
+}
+
+// newOIDCProvidersFromEnvはOIDC_PROVIDERS（カンマ区切りのプロバイダ名）と、プロバイダごとの
+// OIDC_<NAME>_ISSUER / _CLIENT_ID / _CLIENT_SECRET / _REDIRECT_URL / _SCOPES / _ROLE_CLAIM / _ADMIN_VALUES からプロバイダを作ります。
+func newOIDCProvidersFromEnv() (map[string]*OIDCProvider, error) {
+	providers := map[string]*OIDCProvider{}
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		env := func(key string) string {
+			return os.Getenv("OIDC_" + strings.ToUpper(name) + "_" + key)
+		}
+		p := &OIDCProvider{
+			Name:         name,
+			Issuer:       env("ISSUER"),
+			ClientID:     env("CLIENT_ID"),
+			ClientSecret: env("CLIENT_SECRET"),
+			RedirectURL:  env("REDIRECT_URL"),
+			Scopes:       splitList(env("SCOPES")),
+			RoleClaim:    env("ROLE_CLAIM"),
+			AdminValues:  splitList(env("ADMIN_VALUES")),
+		}
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return nil, fmt.Errorf("OIDC provider %q requires ISSUER, CLIENT_ID and REDIRECT_URL", name)
+		}
+		providers[name] = p
+	}
+	return providers, nil
+}
+
+// splitListはカンマ区切りの値を空の要素を除いて分割します。
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (p *OIDCProvider) httpClient() *http.Client {
+	if p.client != nil {
+		return p.client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// getJSONはURLをGETしてJSONをvに読み込みます。
+func (p *OIDCProvider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discoverはディスカバリドキュメントを返します。一度取得したものはキャッシュします。
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.Name, err)
+	}
+	// 仕様上、ディスカバリのissuerは設定したIssuerと完全に一致しなければならない
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery for %s: issuer mismatch %q", p.Name, d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery for %s: missing endpoints", p.Name)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// randomTokenはURLに使える乱数の文字列（state・nonce・PKCEのcode_verifier用）を返します。
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallengeはcode_verifierからS256のcode_challengeを作ります（RFC 7636）。
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthURLはユーザーをリダイレクトする認可エンドポイントのURLを返します。
+func (p *OIDCProvider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchangeは認可コードをトークンエンドポイントでIDトークンに交換します。
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint returned %d: %s", ErrUnauthenticated, resp.StatusCode, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", ErrUnauthenticated)
+	}
+	return tokens.IDToken, nil
+}
+
+// publicKeyはIDトークンの署名を検証する鍵をJWKSから返します。
+// 知らないkidのときは鍵のローテーションとみなしてJWKSを取り直します。
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrUnauthenticated, kid)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("oidc jwks for %s: %w", p.Name, err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrUnauthenticated, kid)
+	}
+	return key, nil
+}
+
+// VerifyIDTokenはIDトークンの署名・iss・aud・azp・exp・nonceを検証し、ユーザーの情報を返します。
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (OIDCIdentity, error) {
+	var identity OIDCIdentity
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return identity, fmt.Errorf("%w: invalid id token: %v", ErrUnauthenticated, err)
+	}
+
+	// audが複数あるときは、azpが自分のクライアントでなければならない
+	aud, _ := claims.GetAudience()
+	if azp, ok := claims["azp"].(string); (ok || len(aud) > 1) && azp != p.ClientID {
+		return identity, fmt.Errorf("%w: id token azp does not match client", ErrUnauthenticated)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return identity, fmt.Errorf("%w: id token nonce mismatch", ErrUnauthenticated)
+	}
+
+	identity.Subject, _ = claims.GetSubject()
+	identity.Email, _ = claims["email"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string: // 文字列で返すプロバイダもある
+		identity.EmailVerified = v == "true"
+	}
+	if identity.Subject == "" || identity.Email == "" {
+		return identity, fmt.Errorf("%w: id token has no sub or email", ErrUnauthenticated)
+	}
+	if p.RoleClaim != "" {
+		identity.Role = p.mapRole(claims[p.RoleClaim])
+	}
+	return identity, nil
+}
+
+// mapRoleはロールのクレーム（文字列か文字列の配列）にAdminValuesのいずれかがあればadmin、無ければuserを返します。
+func (p *OIDCProvider) mapRole(claim any) string {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = []string{v}
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, v := range values {
+		if slices.Contains(p.AdminValues, v) {
+			return "admin"
+		}
+	}
+	return "user"
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcFlowCookieは認可リクエストのstate・nonce・code_verifierを、コールバックまでブラウザに預けるクッキーです。
+// サーバー側に状態を持たないように、jwtSecretで署名したJWTにして改ざんを防ぎます。
+const oidcFlowCookie = "oidc_flow"
+
+// oidcFlowTTLはログインを始めてからコールバックまでの有効期間です。
+const oidcFlowTTL = 10 * time.Minute
+
+// oidcFlowAudienceはクッキーのJWTのaudです。同じ鍵で署名するアプリケーションのJWTと取り違えないようにします。
+const oidcFlowAudience = "oidc-flow"
+
+type oidcFlowClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// OIDCHandlerは外部のIDプロバイダ（OpenID Connect）でのログインを扱います。
+type OIDCHandler struct {
+	repo      *TodoRepository
+	providers map[string]*OIDCProvider
+}
+
+func NewOIDCHandler(repo *TodoRepository, providers map[string]*OIDCProvider) *OIDCHandler {
+	return &OIDCHandler{repo: repo, providers: providers}
+}
+
+func (h *OIDCHandler) provider(c *gin.Context) (*OIDCProvider, error) {
+	p, ok := h.providers[c.Param("provider")]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return p, nil
+}
+
+// setFlowCookieはクッキーを設定します。コールバックはIdPからのトップレベルのリダイレクトなのでSameSite=Laxにします。
+func setFlowCookie(c *gin.Context, p *OIDCProvider, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := c.Request.TLS != nil || strings.HasPrefix(p.RedirectURL, "https://")
+	c.SetCookie(oidcFlowCookie, value, maxAge, "/auth/oidc/"+p.Name, "", secure, true)
+}
+
+// startはstate・nonce・PKCEのcode_verifierを作ってクッキーに預け、IDプロバイダの認可エンドポイントへリダイレクトします。
+func (h *OIDCHandler) start(c *gin.Context) error {
+	p, err := h.provider(c)
+	if err != nil {
+		return err
+	}
+	flow := oidcFlowClaims{
+		Provider: p.Name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcFlowAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcFlowTTL)),
+		},
+	}
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		if *v, err = randomToken(); err != nil {
+			return err
+		}
+	}
+	authURL, err := p.AuthURL(c.Request.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		return err
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, flow).SignedString(jwtSecret)
+	if err != nil {
+		return err
+	}
+	setFlowCookie(c, p, signed, int(oidcFlowTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+	return nil
+}
+
+// callbackはstateを確かめて認可コードをIDトークンに交換し、検証したユーザーでログインしてアプリケーションのJWTを返します。
+func (h *OIDCHandler) callback(c *gin.Context) error {
+	p, err := h.provider(c)
+	if err != nil {
+		return err
+	}
+	if idpErr := c.Query("error"); idpErr != "" {
+		return fmt.Errorf("%w: identity provider returned %s: %s", ErrUnauthenticated, idpErr, c.Query("error_description"))
+	}
+
+	cookie, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		return fmt.Errorf("%w: login flow not started or expired", ErrUnauthenticated)
+	}
+	// stateとnonceは一度だけ使う
+	setFlowCookie(c, p, "", -1)
+	var flow oidcFlowClaims
+	_, err = jwt.ParseWithClaims(cookie, &flow, func(token *jwt.Token) (any, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience(oidcFlowAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return fmt.Errorf("%w: login flow not started or expired", ErrUnauthenticated)
+	}
+	state := c.Query("state")
+	if flow.Provider != p.Name || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(flow.State)) != 1 {
+		return fmt.Errorf("%w: state mismatch", ErrUnauthenticated)
+	}
+	code := c.Query("code")
+	if code == "" {
+		return fmt.Errorf("%w: code is required", ErrInvalidInput)
+	}
+
+	ctx := c.Request.Context()
+	rawIDToken, err := p.Exchange(ctx, code, flow.Verifier)
+	if err != nil {
+		return err
+	}
+	identity, err := p.VerifyIDToken(ctx, rawIDToken, flow.Nonce)
+	if err != nil {
+		return err
+	}
+	user, err := h.repo.LoginWithIdentity(ctx, p.Name, identity)
+	if err != nil {
+		return err
+	}
+	// IdPでのログインは1要素目として扱う。2要素認証を登録したユーザーには/loginと同じくチャレンジトークンを返す
+	result, err := startSessionOrChallenge(ctx, h.repo, user, ginSessionClient(c))
+	if err != nil {
+		return err
+	}
+	writeLoginResult(c, result)
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIdPはテスト用のOpenID Connectプロバイダです。ディスカバリ・JWKS・トークンエンドポイントを提供します。
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthRequest
+}
+
+// mockAuthRequestは認可コードに紐づく、認可リクエストのPKCEのチャレンジとIDトークンのクレームです。
+type mockAuthRequest struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+const (
+	mockClientID     = "todo-app"
+	mockClientSecret = "mock-secret"
+	mockRedirectURL  = "http://localhost:8080/auth/oidc/mock/callback"
+)
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{key: key, codes: map[string]mockAuthRequest{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "mock-key",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIdP) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:         "mock",
+		Issuer:       m.server.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+		RoleClaim:    "groups",
+		AdminValues:  []string{"todo-admins"},
+	}
+}
+
+// signはクレームにiss・aud・exp・iatの既定値を補ってIDトークンに署名します。
+func (m *mockIdP) sign(claims jwt.MapClaims) string {
+	full := jwt.MapClaims{
+		"iss": m.server.URL,
+		"aud": mockClientID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, full)
+	token.Header["kid"] = "mock-key"
+	signed, _ := token.SignedString(m.key)
+	return signed
+}
+
+// authorizeはユーザーがIdPでログインしたことにして、認可URLに対する認可コードとstateを返します。
+// claimsはIDトークンに入れるクレームで、nonceは認可リクエストのものが入ります。
+func (m *mockIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	assert.Equal(t, m.server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, mockClientID, q.Get("client_id"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	full := jwt.MapClaims{"nonce": q.Get("nonce")}
+	for k, v := range claims {
+		full[k] = v
+	}
+	code, _ = randomToken()
+	m.mu.Lock()
+	m.codes[code] = mockAuthRequest{challenge: q.Get("code_challenge"), claims: full}
+	m.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (m *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != mockClientID || secret != mockClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	m.mu.Lock()
+	req, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != mockRedirectURL ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(req.claims), "token_type": "Bearer"})
+}
+
+func TestOIDCProviderLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	ctx := t.Context()
+
+	authURL, err := p.AuthURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	code, state := idp.authorize(t, authURL, jwt.MapClaims{
+		"sub": "alice-sub", "email": "alice@example.com", "email_verified": true, "groups": []string{"staff", "todo-admins"},
+	})
+	assert.Equal(t, "state-1", state)
+
+	// code_verifierが違えば交換できない（PKCE）
+	_, err = p.Exchange(ctx, code, "another-verifier")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	code, _ = idp.authorize(t, authURL, jwt.MapClaims{
+		"sub": "alice-sub", "email": "alice@example.com", "email_verified": true, "groups": []string{"staff", "todo-admins"},
+	})
+	rawIDToken, err := p.Exchange(ctx, code, "verifier-1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	identity, err := p.VerifyIDToken(ctx, rawIDToken, "nonce-1")
+	assert.NoError(t, err)
+	assert.Equal(t, OIDCIdentity{Subject: "alice-sub", Email: "alice@example.com", EmailVerified: true, Role: "admin"}, identity)
+
+	_, err = p.VerifyIDToken(ctx, rawIDToken, "nonce-2")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	base := func(extra jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{"sub": "bob-sub", "email": "bob@example.com", "nonce": "n"}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		return claims
+	}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": idp.server.URL, "aud": mockClientID, "sub": "x", "email": "x@example.com", "nonce": "n", "exp": time.Now().Add(time.Hour).Unix()})
+	forged.Header["kid"] = "mock-key"
+	forgedToken, _ := forged.SignedString(otherKey)
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, base(jwt.MapClaims{"iss": idp.server.URL, "aud": mockClientID})).SignedString([]byte("secret"))
+
+	cases := map[string]string{
+		"wrong issuer":        idp.sign(base(jwt.MapClaims{"iss": "https://evil.example.com"})),
+		"wrong audience":      idp.sign(base(jwt.MapClaims{"aud": "another-app"})),
+		"multiple audiences":  idp.sign(base(jwt.MapClaims{"aud": []string{mockClientID, "another-app"}})),
+		"wrong azp":           idp.sign(base(jwt.MapClaims{"azp": "another-app"})),
+		"expired":             idp.sign(base(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"missing nonce":       idp.sign(base(jwt.MapClaims{"nonce": nil})),
+		"missing email":       idp.sign(base(jwt.MapClaims{"email": nil})),
+		"signed by other key": forgedToken,
+		"symmetric algorithm": hmacToken,
+		"not a token":         "garbage",
+	}
+	for name, token := range cases {
+		_, err := p.VerifyIDToken(t.Context(), token, "n")
+		assert.ErrorIs(t, err, ErrUnauthenticated, name)
+	}
+
+	identity, err := p.VerifyIDToken(t.Context(), idp.sign(base(jwt.MapClaims{
+		"aud": []string{mockClientID, "another-app"}, "azp": mockClientID, "email_verified": "true", "groups": "staff",
+	})), "n")
+	assert.NoError(t, err)
+	assert.True(t, identity.EmailVerified)
+	assert.Equal(t, "user", identity.Role)
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	idp := newMockIdP(t)
+	router := gin.New()
+	h := NewOIDCHandler(nil, map[string]*OIDCProvider{"mock": idp.provider()})
+	router.GET("/auth/oidc/:provider/start", errorHandler(h.start))
+	router.GET("/auth/oidc/:provider/callback", errorHandler(h.callback))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/unknown/start", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/mock/start", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.True(t, cookies[0].HttpOnly)
+	code, state := idp.authorize(t, w.Header().Get("Location"), jwt.MapClaims{"sub": "s", "email": "s@example.com"})
+
+	callback := func(query string, withCookie bool) int {
+		req := httptest.NewRequest("GET", "/auth/oidc/mock/callback?"+query, nil)
+		if withCookie {
+			req.AddCookie(cookies[0])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, callback(url.Values{"code": {code}, "state": {state}}.Encode(), false))
+	assert.Equal(t, http.StatusUnauthorized, callback(url.Values{"code": {code}, "state": {"forged"}}.Encode(), true))
+	assert.Equal(t, http.StatusUnauthorized, callback("error=access_denied", true))
+}
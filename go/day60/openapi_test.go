@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSpecTestRouterはDBを使わずに全ルートを登録したルーターを返します。
+func newSpecTestRouter(t *testing.T, deps AppDeps) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	blobs, err := NewLocalBlobStore(t.TempDir(), "", []byte("test-blob-secret"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	deps.Repo = NewTodoRepository(nil)
+	deps.Blobs = blobs
+	deps.Sessions = NewSessionRegistry(nil, time.Minute)
+	router := gin.New()
+	registerRoutes(router, deps)
+	return router
+}
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z]+)`)
+
+// TestOpenAPIRoutesは登録したルートとopenapi.yamlのパスが過不足なく対応していることを確かめます。
+func TestOpenAPIRoutes(t *testing.T) {
+	spec, err := loadOpenAPISpec()
+	if !assert.NoError(t, err) {
+		return
+	}
+	router := newSpecTestRouter(t, AppDeps{})
+
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		path := ginParam.ReplaceAllString(route.Path, "{$1}")
+		registered[route.Method+" "+path] = true
+		item := spec.doc.Paths.Value(path)
+		assert.True(t, item != nil && item.GetOperation(route.Method) != nil, "%s %s is not documented in openapi.yaml", route.Method, path)
+	}
+	for path, item := range spec.doc.Paths.Map() {
+		for method := range item.Operations() {
+			assert.True(t, registered[method+" "+path], "%s %s is documented but not registered", method, path)
+		}
+	}
+}
+
+// TestOpenAPIUnauthorizedResponsesは認証が必要なすべての操作に、トークン無しで401が返り、それが仕様どおりであることを確かめます。
+func TestOpenAPIUnauthorizedResponses(t *testing.T) {
+	spec, err := loadOpenAPISpec()
+	if !assert.NoError(t, err) {
+		return
+	}
+	router := newSpecTestRouter(t, AppDeps{})
+
+	for path, item := range spec.doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			security := spec.doc.Security
+			if op.Security != nil {
+				security = *op.Security
+			}
+			if len(security) == 0 {
+				continue
+			}
+			// パスパラメータは数値のIDにする（プロバイダ名やBlobのキーは認証が要らない）
+			target := regexp.MustCompile(`\{[A-Za-z]+\}`).ReplaceAllString(path, "1")
+			req := httptest.NewRequest(method, target, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if !assert.Equal(t, http.StatusUnauthorized, w.Code, "%s %s", method, path) {
+				continue
+			}
+			assert.NotNil(t, op.Responses.Status(http.StatusUnauthorized), "%s %s does not document 401", method, path)
+			err := spec.validateResponse(context.Background(), req, w.Code, w.Header(), w.Body.Bytes())
+			assert.NoError(t, err, "%s %s", method, path)
+		}
+	}
+}
+
+func TestOpenAPIValidationMiddleware(t *testing.T) {
+	router := newSpecTestRouter(t, AppDeps{ValidateRequests: true})
+	token, err := issueToken(User{ID: 7, Role: "user"}, "session-a", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 仕様に合わないリクエストはハンドラ（リポジトリがnilなので呼ばれるとpanicする）まで届かない
+	for _, tt := range []struct{ method, path, body string }{
+		{"POST", "/api/v1/todos", `{"name": 123}`},
+		{"POST", "/api/v1/todos", `{}`},
+		{"PUT", "/api/v1/todos/abc", `{"name": "x"}`},
+		{"POST", "/api/v1/todos", `{"name": "x", "due_at": "tomorrow"}`},
+		{"GET", "/api/v1/todos?tag_match=some", ""},
+	} {
+		w := send(tt.method, tt.path, tt.body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%s %s %s", tt.method, tt.path, tt.body)
+		assert.Contains(t, w.Body.String(), "Validation Failed")
+		assert.Contains(t, w.Body.String(), "has an error")
+	}
+
+	// 認証していないリクエストは、ボディが仕様に合わなくても検証の詳細を返さずに401にする
+	req := httptest.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"name": 123}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "Validation Failed")
+
+	// 仕様どおりのリクエストと、仕様に無いルートは通す
+	assert.Equal(t, http.StatusOK, send("GET", "/health", "").Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/no-such-route", "").Code)
+
+	// ボディを読んだ後もハンドラはボディを読める
+	w = send("POST", "/login/2fa", `{"challenge_token": "bad", "code": "123456"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	router := newSpecTestRouter(t, AppDeps{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.yaml", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.Equal(openapiYAML, w.Body.Bytes()))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/openapi.yaml"`)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKeyは認証済みのPrincipalをgin.Contextに置くキーです。
+const principalKey = "principal"
+
+// Principalは認証済みのリクエストの主体です。JWT（ログインセッション）でもパーソナルアクセストークンでも同じ形で扱います。
+type Principal struct {
+	UserID int
+	Role   string
+	// Scopesはトークンで許可された操作。JWTのセッションではnilで、すべての操作を許可します
+	Scopes []string
+	// TokenIDはパーソナルアクセストークンのID。JWTのセッションでは0です
+	TokenID int
+	// SessionIDはJWTのセッションのID（jti）。パーソナルアクセストークンでは空です
+	SessionID string
+}
+
+// IsTokenはパーソナルアクセストークンで認証されたかを返します。
+func (p *Principal) IsToken() bool {
+	return p.TokenID != 0
+}
+
+// HasScopeはスコープが許可されているかを返します。JWTのセッションは常にtrueです。
+func (p *Principal) HasScope(scope string) bool {
+	return !p.IsToken() || slices.Contains(p.Scopes, scope)
+}
+
+// currentPrincipalは認証済みリクエストのPrincipalを返します。authMiddlewareを通ったルートでだけ呼べます。
+func currentPrincipal(c *gin.Context) *Principal {
+	return c.MustGet(principalKey).(*Principal)
+}
+
+// tokenRoutesはパーソナルアクセストークンで呼べるルートです。末尾が"/*"ならその下のすべてのルートを含みます。
+// ここに無いルート（プロフィール、トークン管理、リストのメンバー管理、管理者APIなど）はログインセッションが必要です。
+var tokenRoutes = []string{
+	"/api/v1/todos",
+	"/api/v1/todos/*",
+	"/api/v1/tags",
+	"/api/v1/tags/*",
+	"/api/v1/reminders",
+	"/api/v1/reminders/*",
+	"/api/v1/lists",
+	"/api/v1/me/mentions",
+	"/api/v2/todos",
+	"/api/v2/todos/*",
+}
+
+func tokenRouteAllowed(fullPath string) bool {
+	for _, route := range tokenRoutes {
+		if prefix, ok := strings.CutSuffix(route, "/*"); ok {
+			if strings.HasPrefix(fullPath, prefix+"/") {
+				return true
+			}
+		} else if fullPath == route {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredScopeはメソッドに必要なスコープです。読み取りはtodos:read、それ以外はtodos:writeが必要です。
+func requiredScope(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return ScopeTodosRead
+	}
+	return ScopeTodosWrite
+}
+
+// tokenScopeMiddlewareはパーソナルアクセストークンのリクエストを、呼べるルートとスコープで制限します。
+// authMiddlewareの後に置きます。JWTのセッションはそのまま通します。
+func tokenScopeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := currentPrincipal(c)
+		if !p.IsToken() {
+			c.Next()
+			return
+		}
+		if !tokenRouteAllowed(c.FullPath()) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "This endpoint requires a login session"})
+			return
+		}
+		if scope := requiredScope(c.Request.Method); !p.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "Token is missing scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 対応する繰り返しの頻度（RFC 5545 RRULEのFREQのサブセット）
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// maxRecurrencePeriodsは次の発生日時を探すときに調べる期間数の上限です。
+// 例えば「毎月31日」を隔月で指定した場合など、条件に合う日が存在しない規則で無限ループしないようにします。
+const maxRecurrencePeriods = 1000
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RecurrenceRuleはRFC 5545 RRULEのサブセットです。
+//
+//	FREQ=DAILY|WEEKLY|MONTHLY（必須）
+//	INTERVAL=N            N日/N週/Nか月ごと（既定値1）
+//	BYDAY=MO,WE,...       WEEKLYのみ。発生する曜日（既定値は開始日の曜日）
+//	BYMONTHDAY=N          MONTHLYのみ。発生する日(1-31)。その日が無い月はスキップ（既定値は開始日の日）
+//	COUNT=N / UNTIL=...   発生回数または終了日時（どちらか一方）
+//
+// 日付の計算はユーザーのタイムゾーンで行い、時刻は開始日時のローカル時刻を保ちます。
+type RecurrenceRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay int
+	Count      int
+	Until      time.Time
+}
+
+// ParseRecurrenceRuleは "FREQ=WEEKLY;BYDAY=MO,TH" のような文字列を解析します。先頭の "RRULE:" は省略できます。
+func ParseRecurrenceRule(s string) (RecurrenceRule, error) {
+	rule := RecurrenceRule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return rule, fmt.Errorf("%w: recurrence rule is empty", ErrInvalidInput)
+	}
+
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return rule, fmt.Errorf("%w: malformed recurrence rule part %q", ErrInvalidInput, part)
+		}
+		if seen[key] {
+			return rule, fmt.Errorf("%w: duplicate %s in recurrence rule", ErrInvalidInput, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly {
+				return rule, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidInput, value)
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			rule.Interval, err = parsePositiveInt(key, value, 1000)
+		case "COUNT":
+			rule.Count, err = parsePositiveInt(key, value, 10000)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parsePositiveInt(key, value, 31)
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := rruleWeekdays[d]
+				if !ok {
+					return rule, fmt.Errorf("%w: unsupported BYDAY value %q", ErrInvalidInput, d)
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "UNTIL":
+			rule.Until, err = parseRRuleTime(value)
+		default:
+			return rule, fmt.Errorf("%w: unsupported recurrence rule part %s", ErrInvalidInput, key)
+		}
+		if err != nil {
+			return rule, err
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return rule, fmt.Errorf("%w: FREQ is required", ErrInvalidInput)
+	case len(rule.ByDay) > 0 && rule.Freq != FreqWeekly:
+		return rule, fmt.Errorf("%w: BYDAY is only supported with FREQ=WEEKLY", ErrInvalidInput)
+	case rule.ByMonthDay != 0 && rule.Freq != FreqMonthly:
+		return rule, fmt.Errorf("%w: BYMONTHDAY is only supported with FREQ=MONTHLY", ErrInvalidInput)
+	case rule.Count != 0 && !rule.Until.IsZero():
+		return rule, fmt.Errorf("%w: COUNT and UNTIL cannot be used together", ErrInvalidInput)
+	}
+	sort.Slice(rule.ByDay, func(i, j int) bool { return weekdayOffset(rule.ByDay[i]) < weekdayOffset(rule.ByDay[j]) })
+	return rule, nil
+}
+
+func parsePositiveInt(key, value string, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%w: %s must be between 1 and %d", ErrInvalidInput, key, max)
+	}
+	return n, nil
+}
+
+// parseRRuleTimeはUNTILの値（20261231 / 20261231T235959Z）を解析します。
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// 日付のみの場合はその日の終わりまでを含める
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ", ErrInvalidInput)
+}
+
+// Stringは正規化したRRULE文字列を返します。
+func (r RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTHDAY=%d", r.ByMonthDay))
+	}
+	if r.Count != 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// weekdayOffsetは月曜始まり(RFC 5545のWKST=MO)での曜日の位置を返します。
+func weekdayOffset(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+// Nextはdtstartを起点とする発生日時のうち、afterより後で最初のものを返します。
+// 計算はlocのタイムゾーンで行います。UNTILを過ぎる、または見つからない場合はfalseを返します。
+// COUNTによる打ち切りは発生回数を保持している呼び出し側で判定します。
+func (r RecurrenceRule) Next(dtstart, after time.Time, loc *time.Location) (time.Time, bool) {
+	start := dtstart.In(loc)
+	// 同じローカル時刻で、日付だけを変えた日時を作る
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, start.Hour(), start.Minute(), start.Second(), 0, loc)
+	}
+
+	// afterの少し手前の期間から探し始める（毎回dtstartから数えないため）
+	first := 0
+	if after.After(start) {
+		switch r.Freq {
+		case FreqDaily:
+			first = int(after.Sub(start).Hours()/24)/r.Interval - 1
+		case FreqWeekly:
+			first = int(after.Sub(start).Hours()/(24*7))/r.Interval - 1
+		case FreqMonthly:
+			a := after.In(loc)
+			months := (a.Year()-start.Year())*12 + int(a.Month()-start.Month())
+			first = months/r.Interval - 1
+		}
+		if first < 0 {
+			first = 0
+		}
+	}
+
+	for p := first; p < first+maxRecurrencePeriods; p++ {
+		var candidates []time.Time
+		switch r.Freq {
+		case FreqDaily:
+			candidates = []time.Time{at(start.Year(), start.Month(), start.Day()+p*r.Interval)}
+		case FreqWeekly:
+			// 開始日を含む週の月曜日からp*Interval週後の週
+			monday := start.Day() - weekdayOffset(start.Weekday()) + p*r.Interval*7
+			days := r.ByDay
+			if len(days) == 0 {
+				days = []time.Weekday{start.Weekday()}
+			}
+			for _, wd := range days {
+				candidates = append(candidates, at(start.Year(), start.Month(), monday+weekdayOffset(wd)))
+			}
+		case FreqMonthly:
+			day := r.ByMonthDay
+			if day == 0 {
+				day = start.Day()
+			}
+			month := time.Date(start.Year(), start.Month()+time.Month(p*r.Interval), 1, 0, 0, 0, 0, loc)
+			if day > daysIn(month.Year(), month.Month()) {
+				continue // 31日が無い月などはスキップ（RFC 5545と同じ扱い）
+			}
+			candidates = []time.Time{at(month.Year(), month.Month(), day)}
+		}
+
+		for _, c := range candidates {
+			if c.Before(start) || !c.After(after) {
+				continue
+			}
+			if !r.Until.IsZero() && c.After(r.Until) {
+				return time.Time{}, false
+			}
+			return c, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stopRecurrenceはTODOが属するシリーズの繰り返しを止めます。生成済みの回は残ります。
+func (h *TodoHandler) stopRecurrence(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.StopRecurrence(c.Request.Context(), currentUserID(c), id); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
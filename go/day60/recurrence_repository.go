@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// createSeriesは繰り返しTODOのシリーズを作成します。todoが初回になり、その期限が起点(dtstart)です。
+// 日付の計算には作成者のタイムゾーンを使います。
+func createSeries(ctx context.Context, tx *sql.Tx, todo Todo) (int, error) {
+	if todo.DueAt == nil {
+		return 0, fmt.Errorf("%w: due_at is required for a recurring todo", ErrInvalidInput)
+	}
+	var seriesID int
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO todo_series (list_id, user_id, name, rule, timezone, dtstart, last_due_at)
+		SELECT $1, $2, $3, $4, users.timezone, $5, $5 FROM users WHERE users.id = $2
+		RETURNING id`,
+		todo.ListID, todo.UserID, todo.Name, todo.Recurrence, todo.DueAt).Scan(&seriesID)
+	return seriesID, err
+}
+
+// StopRecurrenceはTODOが属するシリーズの繰り返しを止めます。既に生成済みの回はそのまま残ります。
+func (r *TodoRepository) StopRecurrence(ctx context.Context, userID, todoID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		if _, err := requireTodoRole(ctx, tx, todoID, userID, RoleEditor); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `
+			UPDATE todo_series SET active = FALSE
+			WHERE id = (SELECT series_id FROM todos WHERE id = $1) AND active`, todoID)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(res); err != nil {
+			return err
+		}
+		return insertAuditLog(ctx, tx, todoID, "unrepeat", nil)
+	})
+}
+
+// todoSeriesは次の回を生成する対象として取り出したシリーズです。
+type todoSeries struct {
+	ID          int
+	ListID      int
+	UserID      int
+	Name        string
+	Rule        string
+	Timezone    string
+	DTStart     time.Time
+	LastDueAt   time.Time
+	Occurrences int
+}
+
+// GenerateNextOccurrenceは次の回を生成すべきシリーズを1つ取り出し、次の回のTODOを作成します。
+// 処理したシリーズがなければfalseを返します。
+//
+// 次の回が必要なのは、最新の回が完了した・削除された（ゴミ箱に入れられた）・期限を過ぎたシリーズです。
+// 行をFOR UPDATE SKIP LOCKEDで取り出すので、複数のレプリカが同時に実行しても同じシリーズを二重に処理しません。
+// さらに(series_id, due_at)のユニークインデックスにより、再起動などで同じ回を再生成しようとしても重複は作られません。
+func (r *TodoRepository) GenerateNextOccurrence(ctx context.Context, now time.Time) (bool, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	processed := false
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		var s todoSeries
+		err := tx.QueryRowContext(ctx, `
+			SELECT s.id, s.list_id, s.user_id, s.name, s.rule, s.timezone, s.dtstart, s.last_due_at, s.occurrences
+			FROM todo_series s
+			LEFT JOIN todos t ON t.series_id = s.id AND t.due_at = s.last_due_at AND t.deleted_at IS NULL
+			WHERE s.active AND (t.id IS NULL OR t.completed OR s.last_due_at <= $1)
+			ORDER BY s.last_due_at
+			LIMIT 1
+			FOR UPDATE OF s SKIP LOCKED`, now).Scan(
+			&s.ID, &s.ListID, &s.UserID, &s.Name, &s.Rule, &s.Timezone, &s.DTStart, &s.LastDueAt, &s.Occurrences)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		processed = true
+		return generateOccurrence(ctx, tx, s, now)
+	})
+	return processed, err
+}
+
+// generateOccurrenceはシリーズの次の回を作成し、シリーズの状態を進めます。
+// 次の回がない（COUNTやUNTILに達した）場合はシリーズを終了します。
+func generateOccurrence(ctx context.Context, tx *sql.Tx, s todoSeries, now time.Time) error {
+	rule, err := ParseRecurrenceRule(s.Rule)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// 最新の回の期限と現在時刻の遅い方より後の、最初の発生日時を次の回にする。
+	// 長く止まっていたサーバーが再開しても、過去の回を大量に生成しない。
+	after := s.LastDueAt
+	if now.After(after) {
+		after = now
+	}
+	next, ok := rule.Next(s.DTStart, after, loc)
+	if !ok || (rule.Count != 0 && s.Occurrences >= rule.Count) {
+		_, err := tx.ExecContext(ctx, "UPDATE todo_series SET active = FALSE WHERE id = $1", s.ID)
+		return err
+	}
+
+	// ゴミ箱にない最新の回の親を引き継ぐ
+	var parentID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `SELECT parent_id FROM todos WHERE series_id = $1 AND deleted_at IS NULL ORDER BY due_at DESC LIMIT 1`, s.ID).Scan(&parentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// TODO名はユニークなので、各回の名前には期限の日付を付ける
+	name := fmt.Sprintf("%s (%s)", s.Name, next.In(loc).Format("2006-01-02"))
+	todoID, err := insertOccurrence(ctx, tx, s, name, next, nullIntPtr(parentID))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE todo_series SET last_due_at = $1, occurrences = occurrences + 1 WHERE id = $2", next, s.ID)
+	if err != nil {
+		return err
+	}
+	if todoID == 0 {
+		return nil // 既に生成済みだった
+	}
+	return insertAuditLog(ctx, tx, todoID, "create", map[string]any{"series_id": s.ID, "due_at": next})
+}
+
+// insertOccurrenceは繰り返しの1回分のTODOを作成し、IDを返します。同じ回が既にあれば0を返します。
+// 同名のTODOがユーザー側で既に作られていた場合は、シリーズIDを付けた名前で作り直します。
+func insertOccurrence(ctx context.Context, tx *sql.Tx, s todoSeries, name string, dueAt time.Time, parentID *int) (int, error) {
+	for _, n := range []string{name, fmt.Sprintf("%s #%d", name, s.ID)} {
+		var id int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO todos (name, user_id, list_id, parent_id, due_at, series_id)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT DO NOTHING
+			RETURNING id`, n, s.UserID, s.ListID, parentID, dueAt, s.ID).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		// 衝突したのが同じ回（series_id, due_at）なら生成済み
+		var exists bool
+		err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE series_id = $1 AND due_at = $2)", s.ID, dueAt).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("could not create occurrence of series %d: name %q is already taken", s.ID, name)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// maxOccurrencesPerRunは1回の実行で生成する回の上限です。大量のシリーズがあっても1回の実行が長引かないようにします。
+const maxOccurrencesPerRun = 500
+
+// RecurrenceSchedulerは繰り返しTODOの次の回を生成するバックグラウンド処理です。
+// 一定間隔で実行するほか、TODOが完了したときにNotifyで起こすとすぐに実行します。
+// 状態はすべてDBにあるので、再起動しても複数レプリカで動かしても結果は同じです。
+type RecurrenceScheduler struct {
+	repo     *TodoRepository
+	interval time.Duration
+	wake     chan struct{}
+	now      func() time.Time
+}
+
+func NewRecurrenceScheduler(repo *TodoRepository, interval time.Duration) *RecurrenceScheduler {
+	return &RecurrenceScheduler{
+		repo:     repo,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+		now:      time.Now,
+	}
+}
+
+// Notifyはスケジューラにすぐ実行するよう伝えます。実行待ちの通知が既にあれば何もしません（ブロックしません）。
+func (s *RecurrenceScheduler) Notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Runはctxがキャンセルされるまでスケジューラを動かします。
+func (s *RecurrenceScheduler) Run(ctx context.Context) {
+	log.Printf("Recurrence scheduler started (interval: %s)", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Recurrence scheduler stopped")
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// runOnceは次の回が必要なシリーズがなくなるまで（または上限まで）生成します。
+func (s *RecurrenceScheduler) runOnce(ctx context.Context) {
+	generated := 0
+	for generated < maxOccurrencesPerRun && ctx.Err() == nil {
+		ok, err := s.repo.GenerateNextOccurrence(ctx, s.now())
+		if err != nil {
+			log.Printf("Recurrence scheduler: failed to generate occurrence: %v", err)
+			return
+		}
+		if !ok {
+			break
+		}
+		generated++
+	}
+	if generated > 0 {
+		log.Printf("Recurrence scheduler: processed %d series", generated)
+	}
+}
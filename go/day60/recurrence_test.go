@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecurrenceRule(t *testing.T) {
+	rule, err := ParseRecurrenceRule("RRULE:freq=weekly;byday=TH,MO;interval=2")
+	assert.NoError(t, err)
+	assert.Equal(t, FreqWeekly, rule.Freq)
+	assert.Equal(t, 2, rule.Interval)
+	assert.Equal(t, []time.Weekday{time.Monday, time.Thursday}, rule.ByDay)
+	assert.Equal(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", rule.String())
+
+	invalid := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYMONTHDAY=3",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;COUNT=3;UNTIL=20261231",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;BYHOUR=9",
+	}
+	for _, s := range invalid {
+		_, err := ParseRecurrenceRule(s)
+		assert.True(t, errors.Is(err, ErrInvalidInput), "expected invalid input for %q, got %v", s, err)
+	}
+}
+
+func TestRecurrenceRuleNext(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-10-19(月) 09:00 JST 開始
+	dtstart := time.Date(2026, 10, 19, 9, 0, 0, 0, tokyo)
+
+	tests := []struct {
+		name  string
+		rule  string
+		after time.Time
+		want  time.Time
+	}{
+		{"daily", "FREQ=DAILY", dtstart, time.Date(2026, 10, 20, 9, 0, 0, 0, tokyo)},
+		{"every 3 days", "FREQ=DAILY;INTERVAL=3", dtstart.Add(100 * time.Hour), time.Date(2026, 10, 25, 9, 0, 0, 0, tokyo)},
+		{"weekly on MO,TH", "FREQ=WEEKLY;BYDAY=MO,TH", dtstart, time.Date(2026, 10, 22, 9, 0, 0, 0, tokyo)},
+		{"weekly wraps to next week", "FREQ=WEEKLY;BYDAY=MO,TH", time.Date(2026, 10, 22, 9, 0, 0, 0, tokyo), time.Date(2026, 10, 26, 9, 0, 0, 0, tokyo)},
+		{"biweekly", "FREQ=WEEKLY;INTERVAL=2", dtstart, time.Date(2026, 11, 2, 9, 0, 0, 0, tokyo)},
+		{"monthly on day 31 skips short months", "FREQ=MONTHLY;BYMONTHDAY=31", dtstart, time.Date(2026, 10, 31, 9, 0, 0, 0, tokyo)},
+		{"monthly on day 31 after october", "FREQ=MONTHLY;BYMONTHDAY=31", time.Date(2026, 10, 31, 9, 0, 0, 0, tokyo), time.Date(2026, 12, 31, 9, 0, 0, 0, tokyo)},
+		{"far in the future", "FREQ=DAILY", time.Date(2030, 1, 1, 12, 0, 0, 0, tokyo), time.Date(2030, 1, 2, 9, 0, 0, 0, tokyo)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRecurrenceRule(tt.rule)
+			assert.NoError(t, err)
+			got, ok := rule.Next(dtstart, tt.after, tokyo)
+			assert.True(t, ok)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+func TestRecurrenceRuleNextKeepsLocalTimeAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 夏時間が終わる2026-11-01をまたいでも、毎日08:00(ローカル)のまま
+	dtstart := time.Date(2026, 10, 31, 8, 0, 0, 0, ny)
+	rule, _ := ParseRecurrenceRule("FREQ=DAILY")
+
+	next, ok := rule.Next(dtstart, dtstart, ny)
+	assert.True(t, ok)
+	assert.Equal(t, 8, next.In(ny).Hour())
+	assert.Equal(t, 25*time.Hour, next.Sub(dtstart))
+}
+
+func TestRecurrenceRuleNextStopsAtUntil(t *testing.T) {
+	dtstart := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	rule, _ := ParseRecurrenceRule("FREQ=DAILY;UNTIL=20261020")
+
+	next, ok := rule.Next(dtstart, dtstart, time.UTC)
+	assert.True(t, ok)
+	assert.Equal(t, 20, next.Day())
+
+	_, ok = rule.Next(dtstart, next, time.UTC)
+	assert.False(t, ok)
+}
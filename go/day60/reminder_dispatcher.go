@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// maxRemindersPerRunは1回の実行で送信するリマインダーの上限です。
+	maxRemindersPerRun = 500
+	// reminderSendTimeoutは通知1件の送信にかける時間の上限です。
+	reminderSendTimeout = 30 * time.Second
+)
+
+// ReminderDispatcherは通知日時を過ぎたリマインダーをNotifierで送信するバックグラウンド処理です。
+// RecurrenceSchedulerと同じく、状態はすべてDBにあり、複数レプリカで動かしても二重送信しません
+// （送信中にプロセスが止まった場合だけ、reminderLeaseが過ぎた後でもう一度送ります）。
+type ReminderDispatcher struct {
+	repo     *TodoRepository
+	notifier Notifier
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewReminderDispatcher(repo *TodoRepository, notifier Notifier, interval time.Duration) *ReminderDispatcher {
+	return &ReminderDispatcher{
+		repo:     repo,
+		notifier: notifier,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Runはctxがキャンセルされるまでディスパッチャを動かします。
+func (d *ReminderDispatcher) Run(ctx context.Context) {
+	log.Printf("Reminder dispatcher started (interval: %s)", d.interval)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Reminder dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnceは送信すべきリマインダーがなくなるまで（または上限まで）送信します。
+// 停止の指示はリマインダーの間でだけ確認し、送信中の1件は最後まで送ってから記録します。
+// 送ったのに送信済みとして記録できず、再起動後にもう一度送る、ということを避けるためです。
+func (d *ReminderDispatcher) runOnce(ctx context.Context) {
+	sent := 0
+	for sent < maxRemindersPerRun && ctx.Err() == nil {
+		ok, err := d.repo.DispatchDueReminder(context.WithoutCancel(ctx), d.now(), d.send)
+		if err != nil {
+			log.Printf("Reminder dispatcher: failed to dispatch reminder: %v", err)
+			return
+		}
+		if !ok {
+			break
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("Reminder dispatcher: processed %d reminders", sent)
+	}
+}
+
+func (d *ReminderDispatcher) send(ctx context.Context, n Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, reminderSendTimeout)
+	defer cancel()
+	if err := d.notifier.Notify(ctx, n); err != nil {
+		log.Printf("Reminder dispatcher: failed to send reminder %d: %v", n.ReminderID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSnoozeMinutesはスヌーズ時間を指定しなかった場合の延期時間です。
+const defaultSnoozeMinutes = 10
+
+type ReminderHandler struct {
+	repo *TodoRepository
+}
+
+func NewReminderHandler(repo *TodoRepository) *ReminderHandler {
+	return &ReminderHandler{repo: repo}
+}
+
+// SnoozeInputはスヌーズの入力です。until（絶対日時）かminutes（今から何分後か）で指定します。どちらもなければ10分後です。
+type SnoozeInput struct {
+	Until   *time.Time `json:"until"`
+	Minutes int        `json:"minutes" binding:"omitempty,min=1,max=525600"`
+}
+
+func (h *ReminderHandler) getReminders(c *gin.Context) error {
+	status := c.Query("status")
+	switch status {
+	case "", ReminderPending, ReminderSending, ReminderSent, ReminderDismissed, ReminderFailed:
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidInput, status)
+	}
+	reminders, err := h.repo.FindReminders(c.Request.Context(), currentUserID(c), 0, status)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, reminders)
+	return nil
+}
+
+func (h *ReminderHandler) getTodoReminders(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	reminders, err := h.repo.FindReminders(c.Request.Context(), currentUserID(c), todoID, "")
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, reminders)
+	return nil
+}
+
+func (h *ReminderHandler) createReminder(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input ReminderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	reminder, err := h.repo.CreateReminder(c.Request.Context(), currentUserID(c), todoID, input)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, reminder)
+	return nil
+}
+
+func (h *ReminderHandler) snoozeReminder(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input SnoozeInput
+	// 本文なしでも既定の時間でスヌーズできる
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			return err
+		}
+	}
+	if input.Until != nil && input.Minutes != 0 {
+		return fmt.Errorf("%w: specify either until or minutes, not both", ErrInvalidInput)
+	}
+	until := time.Now().Add(defaultSnoozeMinutes * time.Minute)
+	switch {
+	case input.Until != nil:
+		if !input.Until.After(time.Now()) {
+			return fmt.Errorf("%w: until must be in the future", ErrInvalidInput)
+		}
+		until = *input.Until
+	case input.Minutes != 0:
+		until = time.Now().Add(time.Duration(input.Minutes) * time.Minute)
+	}
+
+	reminder, err := h.repo.SnoozeReminder(c.Request.Context(), currentUserID(c), id, until)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, reminder)
+	return nil
+}
+
+func (h *ReminderHandler) dismissReminder(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	reminder, err := h.repo.DismissReminder(c.Request.Context(), currentUserID(c), id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, reminder)
+	return nil
+}
+
+func (h *ReminderHandler) deleteReminder(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DeleteReminder(c.Request.Context(), currentUserID(c), id); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
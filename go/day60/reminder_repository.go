@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// リマインダーの状態
+const (
+	ReminderPending   = "pending"
+	ReminderSending   = "sending" // ディスパッチャが送信中
+	ReminderSent      = "sent"
+	ReminderDismissed = "dismissed"
+	ReminderFailed    = "failed"
+)
+
+// maxReminderAttemptsは送信に失敗したリマインダーを再送する回数の上限です。これを超えるとfailedになります。
+const maxReminderAttempts = 5
+
+// reminderLeaseは送信中（sending）のリマインダーを他のディスパッチャが取り直さない期間です。reminderSendTimeoutより長くします。
+const reminderLease = 2 * time.Minute
+
+// ReminderはTODOのリマインダーです。作成したユーザー本人にだけ通知されます。
+type Reminder struct {
+	ID            int        `json:"id"`
+	TodoID        int        `json:"todo_id"`
+	UserID        int        `json:"-"`
+	RemindAt      time.Time  `json:"remind_at"`
+	OffsetMinutes *int       `json:"offset_minutes,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ReminderInputはリマインダー作成時の入力です。remind_at（絶対日時）とoffset_minutes（期限の何分前か）のどちらか一方を指定します。
+type ReminderInput struct {
+	RemindAt      *time.Time `json:"remind_at"`
+	OffsetMinutes *int       `json:"offset_minutes" binding:"omitempty,min=0,max=525600"`
+}
+
+const reminderColumns = "id, todo_id, user_id, remind_at, offset_minutes, status, attempts, COALESCE(last_error, ''), sent_at, created_at"
+
+func scanReminder(row rowScanner) (Reminder, error) {
+	var rem Reminder
+	var offset sql.NullInt64
+	var sentAt sql.NullTime
+	err := row.Scan(&rem.ID, &rem.TodoID, &rem.UserID, &rem.RemindAt, &offset, &rem.Status,
+		&rem.Attempts, &rem.LastError, &sentAt, &rem.CreatedAt)
+	if err != nil {
+		return rem, err
+	}
+	rem.OffsetMinutes = nullIntPtr(offset)
+	if sentAt.Valid {
+		rem.SentAt = &sentAt.Time
+	}
+	return rem, nil
+}
+
+// CreateReminderはTODOにリマインダーを作成します。TODOが見えるユーザー（viewer以上）なら誰でも自分用に作成できます。
+// offset_minutesで指定した場合はTODOの期限が必要で、期限が変わると通知日時も追従します。
+func (r *TodoRepository) CreateReminder(ctx context.Context, userID, todoID int, input ReminderInput) (Reminder, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if (input.RemindAt == nil) == (input.OffsetMinutes == nil) {
+		return Reminder{}, fmt.Errorf("%w: specify exactly one of remind_at or offset_minutes", ErrInvalidInput)
+	}
+	var rem Reminder
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		if _, err := requireTodoRole(ctx, tx, todoID, userID, RoleViewer); err != nil {
+			return err
+		}
+		remindAt := input.RemindAt
+		if input.OffsetMinutes != nil {
+			var dueAt sql.NullTime
+			if err := tx.QueryRowContext(ctx, "SELECT due_at FROM todos WHERE id = $1", todoID).Scan(&dueAt); err != nil {
+				return err
+			}
+			if !dueAt.Valid {
+				return fmt.Errorf("%w: offset_minutes requires the todo to have due_at", ErrInvalidInput)
+			}
+			t := dueAt.Time.Add(-time.Duration(*input.OffsetMinutes) * time.Minute)
+			remindAt = &t
+		}
+		var err error
+		rem, err = scanReminder(tx.QueryRowContext(ctx, `
+			INSERT INTO reminders (todo_id, user_id, remind_at, offset_minutes)
+			VALUES ($1, $2, $3, $4)
+			RETURNING `+reminderColumns, todoID, userID, remindAt, input.OffsetMinutes))
+		return err
+	})
+	return rem, err
+}
+
+// FindRemindersはユーザーのリマインダーを通知日時順に返します。todoIDが0でなければそのTODOのものだけ、statusが空でなければその状態のものだけを返します。
+func (r *TodoRepository) FindReminders(ctx context.Context, userID, todoID int, status string) ([]Reminder, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if todoID != 0 {
+		if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleViewer); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+reminderColumns+` FROM reminders
+		WHERE user_id = $1 AND ($2 = 0 OR todo_id = $2) AND ($3 = '' OR status = $3)
+		ORDER BY remind_at, id`, userID, todoID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		rem, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, rem)
+	}
+	return reminders, rows.Err()
+}
+
+// SnoozeReminderはリマインダーをuntilまで延期します。送信済みや却下済みのリマインダーも、延期すると再び通知待ちになります。
+func (r *TodoRepository) SnoozeReminder(ctx context.Context, userID, reminderID int, until time.Time) (Reminder, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rem, err := scanReminder(r.db.QueryRowContext(ctx, `
+		UPDATE reminders SET remind_at = $1, status = 'pending', attempts = 0, last_error = NULL, sent_at = NULL
+		WHERE id = $2 AND user_id = $3
+		RETURNING `+reminderColumns, until, reminderID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rem, ErrNotFound
+	}
+	return rem, err
+}
+
+// DismissReminderはリマインダーを却下し、以後通知しないようにします。
+func (r *TodoRepository) DismissReminder(ctx context.Context, userID, reminderID int) (Reminder, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rem, err := scanReminder(r.db.QueryRowContext(ctx, `
+		UPDATE reminders SET status = 'dismissed'
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+reminderColumns, reminderID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rem, ErrNotFound
+	}
+	return rem, err
+}
+
+func (r *TodoRepository) DeleteReminder(ctx context.Context, userID, reminderID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, "DELETE FROM reminders WHERE id = $1 AND user_id = $2", reminderID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// rescheduleRemindersはTODOの期限の変更に合わせて、期限からの相対指定のリマインダーの通知日時を計算し直します。
+// 期限が消えた場合は通知日時をそのままにします。
+func (r *TodoRepository) rescheduleReminders(ctx context.Context, q querier, todoID int, dueAt *time.Time) error {
+	if dueAt == nil {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, `
+		UPDATE reminders SET remind_at = `+r.dialect.AddMinutes("$1", "-offset_minutes")+`
+		WHERE todo_id = $2 AND offset_minutes IS NOT NULL AND status = 'pending'`, *dueAt, todoID)
+	return err
+}
+
+// Notificationは通知1件分の内容です。
+type Notification struct {
+	ReminderID int        `json:"reminder_id"`
+	TodoID     int        `json:"todo_id"`
+	TodoName   string     `json:"todo_name"`
+	DueAt      *time.Time `json:"due_at"`
+	RemindAt   time.Time  `json:"remind_at"`
+	UserID     int        `json:"user_id"`
+	Email      string     `json:"email"`
+}
+
+// DispatchDueReminderは通知日時を過ぎたリマインダーを1つ取り出してsendで送信し、結果を記録します。
+// 処理したリマインダーがなければfalseを返します。
+//
+// 送信の間はトランザクションもロックも持ちません。
+//   - 短いトランザクションで行をFOR UPDATE SKIP LOCKEDで取り出し、sendingにしてコミットする（取り出しで回数を数える）
+//   - トランザクションの外でsendを呼ぶ。時間はQueryTimeoutではなく呼び出し元のctx（reminderSendTimeout）に従う
+//   - 結果を1つのUPDATEで記録する。送信中に延期・却下されたリマインダーは上書きしない
+//
+// 複数のディスパッチャが同時に動いても、sendingのリマインダーはreminderLeaseの間は取り直さないので二重に送りません。
+// 送信中にプロセスが止まった場合は、期限が過ぎた後で再送します（maxReminderAttemptsに達していればfailedにします）。
+// 完了したTODO・ゴミ箱のTODOのリマインダーは送らずに残し、通知先がもうTODOを見られない（リストから外れた）リマインダーはfailedにします。
+// sendが失敗した場合は少し後に再送し、maxReminderAttemptsに達したらfailedにします。
+func (r *TodoRepository) DispatchDueReminder(ctx context.Context, now time.Time, send func(context.Context, Notification) error) (bool, error) {
+	n, attempts, ok, err := r.claimDueReminder(ctx, now)
+	if err != nil || !ok {
+		return ok, err
+	}
+	if n.ReminderID == 0 {
+		// 送らずにfailedにした
+		return true, nil
+	}
+
+	sendErr := send(ctx, n)
+	qctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	// 取り出したときの回数と一致しなければ、送信中に延期された（回数が0に戻る）か、期限切れで取り直されている
+	if sendErr != nil {
+		status := ReminderPending
+		if attempts >= maxReminderAttempts {
+			status = ReminderFailed
+		}
+		// 失敗するたびに再送までの間隔を延ばす（1分, 2分, 4分, ...）
+		retryAt := now.Add(time.Minute << (attempts - 1))
+		_, err := r.db.ExecContext(qctx, `
+			UPDATE reminders SET status = $1, last_error = $2, remind_at = $3, lease_expires_at = NULL
+			WHERE id = $4 AND status = 'sending' AND attempts = $5`, status, sendErr.Error(), retryAt, n.ReminderID, attempts)
+		return true, err
+	}
+	_, err = r.db.ExecContext(qctx, `
+		UPDATE reminders SET status = 'sent', sent_at = $1, last_error = NULL, lease_expires_at = NULL
+		WHERE id = $2 AND status = 'sending' AND attempts = $3`, now, n.ReminderID, attempts)
+	return true, err
+}
+
+// claimDueReminderは送信するリマインダーを1つ取り出し、sendingにして回数を数えます。
+// 通知先がもうTODOを見られないリマインダーはfailedにして、ReminderIDがゼロのNotificationを返します。
+func (r *TodoRepository) claimDueReminder(ctx context.Context, now time.Time) (Notification, int, bool, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var n Notification
+	var attempts int
+	claimed := false
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		var dueAt sql.NullTime
+		var member bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT rm.id, rm.todo_id, t.name, t.due_at, rm.remind_at, rm.user_id, u.email, rm.attempts, lm.user_id IS NOT NULL
+			FROM reminders rm
+			JOIN todos t ON t.id = rm.todo_id
+			JOIN users u ON u.id = rm.user_id
+			LEFT JOIN list_members lm ON lm.list_id = t.list_id AND lm.user_id = rm.user_id
+			WHERE (rm.status = 'pending' AND rm.remind_at <= $1 OR rm.status = 'sending' AND rm.lease_expires_at <= $1)
+				AND NOT t.completed AND t.deleted_at IS NULL
+			ORDER BY rm.remind_at
+			LIMIT 1
+			FOR UPDATE OF rm SKIP LOCKED`, now).Scan(
+			&n.ReminderID, &n.TodoID, &n.TodoName, &dueAt, &n.RemindAt, &n.UserID, &n.Email, &attempts, &member)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		claimed = true
+		if dueAt.Valid {
+			n.DueAt = &dueAt.Time
+		}
+
+		if !member {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE reminders SET status = 'failed', last_error = 'the user is no longer a member of the list', lease_expires_at = NULL
+				WHERE id = $1`, n.ReminderID)
+			n = Notification{}
+			return err
+		}
+		// 送信中に止まったものを取り直した場合も、1回の試行として数える
+		if attempts >= maxReminderAttempts {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE reminders SET status = 'failed', last_error = 'the dispatcher stopped while sending', lease_expires_at = NULL
+				WHERE id = $1`, n.ReminderID)
+			n = Notification{}
+			return err
+		}
+		attempts++
+		_, err = tx.ExecContext(ctx, `
+			UPDATE reminders SET status = 'sending', attempts = $1, lease_expires_at = $2 WHERE id = $3`,
+			attempts, now.Add(reminderLease), n.ReminderID)
+		return err
+	})
+	return n, attempts, claimed, err
+}
@@ -3,35 +3,148 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 )
 
 type TodoRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect Dialect
+	// QueryTimeoutは1回のメソッド呼び出し（トランザクションならその全体）の期限です。0なら呼び出し元のctxの期限だけに従います。
+	// ExportTodosなど1件ずつ書き出すエクスポートは件数に比例して長くなるので、この期限を付けません
+	QueryTimeout time.Duration
 }
 
 func NewTodoRepository(db *sql.DB) *TodoRepository {
-	return &TodoRepository{db: db}
+	return &TodoRepository{db: db, dialect: dialectOf(db)}
 }
 
-func (r *TodoRepository) FindAll(userID int) ([]Todo, error) {
-	rows, err := r.db.Query("SELECT id, name, user_id FROM todos WHERE user_id = $1", userID)
+// memberTodosCondはユーザーがメンバーになっているリストのTODOだけに絞り込むWHERE条件です。
+// プレースホルダ$1にユーザーIDを渡します。
+const memberTodosCond = "todos.list_id IN (SELECT list_id FROM list_members WHERE user_id = $1)"
+
+// visibleTodosCondはmemberTodosCondに加えてゴミ箱のTODOを除外します。TODOを読むクエリはすべてこの条件を通します。
+const visibleTodosCond = "todos.deleted_at IS NULL AND " + memberTodosCond
+
+// todoColumnsはTODOを読むクエリのSELECT句です。scanTodoと列の順番を合わせてください。
+const todoColumns = "todos.id, todos.name, todos.user_id, todos.list_id, todos.parent_id, todos.completed, todos.due_at, todos.series_id, todos.deleted_at, " +
+	"(SELECT rule FROM todo_series WHERE todo_series.id = todos.series_id AND todo_series.active)"
+
+// rowScannerは*sql.Rowと*sql.Rowsの共通部分です。
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTodoはtodoColumnsの順に並んだ行をTodoに読み込みます。
+func scanTodo(row rowScanner) (Todo, error) {
+	var t Todo
+	var parentID, seriesID sql.NullInt64
+	var dueAt, deletedAt sql.NullTime
+	var recurrence sql.NullString
+	if err := row.Scan(&t.ID, &t.Name, &t.UserID, &t.ListID, &parentID, &t.Completed, &dueAt, &seriesID, &deletedAt, &recurrence); err != nil {
+		return t, err
+	}
+	t.ParentID = nullIntPtr(parentID)
+	t.SeriesID = nullIntPtr(seriesID)
+	if dueAt.Valid {
+		t.DueAt = &dueAt.Time
+	}
+	if deletedAt.Valid {
+		t.DeletedAt = &deletedAt.Time
+	}
+	t.Recurrence = recurrence.String
+	return t, nil
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	i := int(n.Int64)
+	return &i
+}
+
+// FindAllはユーザーが閲覧できるTODO一覧を取得します。filterでリストやタグによる絞り込みができ、
+// 各TODOのタグはloadTagsでまとめて読み込みます。
+func (r *TodoRepository) FindAll(ctx context.Context, userID int, filter TodoFilter) ([]Todo, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + todoColumns + " FROM todos WHERE " + visibleTodosCond
+	args := []any{userID}
+	if filter.ListID != 0 {
+		args = append(args, filter.ListID)
+		query += fmt.Sprintf(" AND todos.list_id = $%d", len(args))
+	}
+	if len(filter.IDs) > 0 {
+		args = append(args, filter.IDs)
+		query += fmt.Sprintf(" AND todos.id = ANY($%d)", len(args))
+	}
+	if len(filter.ParentIDs) > 0 {
+		args = append(args, filter.ParentIDs)
+		query += fmt.Sprintf(" AND todos.parent_id = ANY($%d)", len(args))
+	}
+	if filter.AfterID != 0 {
+		args = append(args, filter.AfterID)
+		query += fmt.Sprintf(" AND todos.id > $%d", len(args))
+	}
+	where, args := tagFilterClause(filter, args)
+	query += where + " ORDER BY id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var todos []Todo
+	todos := []Todo{}
 	for rows.Next() {
-		var t Todo
-		if err := rows.Scan(&t.ID, &t.Name, &t.UserID); err != nil {
+		t, err := scanTodo(rows)
+		if err != nil {
 			return nil, err
 		}
 		todos = append(todos, t)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.loadTags(ctx, userID, todos); err != nil {
+		return nil, err
+	}
 	return todos, nil
 }
 
+// FindTodoはユーザーが閲覧できるTODOを1件取得します。見えない場合はErrNotFoundです。
+func (r *TodoRepository) FindTodo(ctx context.Context, userID, todoID int) (Todo, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	t, err := scanTodo(r.db.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE todos.id = $2 AND "+visibleTodosCond,
+		userID, todoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+	todos := []Todo{t}
+	if err := r.loadTags(ctx, userID, todos); err != nil {
+		return t, err
+	}
+	return todos[0], nil
+}
+
+// withQueryTimeoutはctxにQueryTimeoutの期限を付けます。返したcancelは問い合わせの結果を読み終えてから呼んでください。
+func (r *TodoRepository) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.QueryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.QueryTimeout)
+}
+
 // execTxはトランザクションを実行するためのヘルパー関数です。
 // トランザクションを開始し、渡された関数(fn)を実行します。
 // fnがエラーを返した場合、トランザクションはロールバックされます。
@@ -54,58 +167,252 @@ func (r *TodoRepository) execTx(ctx context.Context, fn func(*sql.Tx) error) err
 	return tx.Commit()
 }
 
-// createTodoInTxはトランザクション内でTODOと監査ログを作成します。
-func (r *TodoRepository) createTodoInTx(tx *sql.Tx, todo Todo) (Todo, error) {
-	// 1. todosテーブルに新しいTODOを挿入し、IDを取得
+// createTodoInTxはトランザクション内でTODOと監査ログを作成します。auditDetailsは監査ログの詳細です（不要ならnil）。
+// ParentIDがあれば親と同じリストに、ListIDが0の場合は作成者の個人リストに入れます。
+// 作成者はリストのeditor以上である必要があります。
+func (r *TodoRepository) createTodoInTx(ctx context.Context, tx *sql.Tx, todo Todo, auditDetails any) (Todo, error) {
+	// 1. 所属リストを決め、権限を確認
+	if todo.ParentID != nil {
+		listID, err := checkNewParent(ctx, tx, todo.UserID, *todo.ParentID, 1)
+		if err != nil {
+			return todo, err
+		}
+		if todo.ListID != 0 && todo.ListID != listID {
+			return todo, fmt.Errorf("%w: parent must be in the same list", ErrInvalidInput)
+		}
+		todo.ListID = listID
+	}
+	if todo.ListID == 0 {
+		listID, err := ensurePersonalList(ctx, tx, todo.UserID)
+		if err != nil {
+			return todo, err
+		}
+		todo.ListID = listID
+	}
+	if err := requireListRole(ctx, tx, todo.ListID, todo.UserID, RoleEditor); err != nil {
+		return todo, err
+	}
+
+	// 2. 繰り返し指定があればシリーズを作成（このTODOが初回になる）
+	if todo.Recurrence != "" {
+		seriesID, err := createSeries(ctx, tx, todo)
+		if err != nil {
+			return todo, err
+		}
+		todo.SeriesID = &seriesID
+	}
+
+	// 3. todosテーブルに新しいTODOを挿入し、IDを取得
 	var id int
-	err := tx.QueryRow("INSERT INTO todos (name, user_id) VALUES ($1, $2) RETURNING id", todo.Name, todo.UserID).Scan(&id)
+	err := tx.QueryRowContext(ctx, `INSERT INTO todos (name, user_id, list_id, parent_id, due_at, series_id)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		todo.Name, todo.UserID, todo.ListID, todo.ParentID, todo.DueAt, todo.SeriesID).Scan(&id)
 	if err != nil {
 		return todo, err
 	}
 	todo.ID = id
 
-	// 2. todo_audit_logsテーブルに監査ログを挿入
-	_, err = tx.Exec("INSERT INTO todo_audit_logs (todo_id, operation) VALUES ($1, $2)", id, "create")
-	if err != nil {
+	// 4. todo_audit_logsテーブルに監査ログを挿入
+	if err := insertAuditLog(ctx, tx, id, "create", auditDetails); err != nil {
 		return todo, err
 	}
 
 	return todo, nil
 }
 
+// insertAuditLogはtodo_audit_logsに操作の記録を1行追加します。
+// detailsはJSONとしてdetailsカラムに保存されます（nilの場合はNULL）。
+func insertAuditLog(ctx context.Context, q querier, todoID int, operation string, details any) error {
+	var detailsJSON any // nilのままならNULL
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		detailsJSON = string(b)
+	}
+	_, err := q.ExecContext(ctx, "INSERT INTO todo_audit_logs (todo_id, operation, details) VALUES ($1, $2, $3)",
+		todoID, operation, detailsJSON)
+	return err
+}
+
+// UpdateTodoWithAuditはTODO名と期限を変更し、監査ログを記録します。リストのeditor以上が実行できます。
+// 期限からの相対指定のリマインダーは新しい期限に合わせて通知日時を計算し直します。
+func (r *TodoRepository) UpdateTodoWithAudit(ctx context.Context, userID int, todo Todo) (Todo, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		listID, err := requireTodoRole(ctx, tx, todo.ID, userID, RoleEditor)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, "UPDATE todos SET name = $1, due_at = $2 WHERE id = $3 RETURNING user_id",
+			todo.Name, todo.DueAt, todo.ID).Scan(&todo.UserID)
+		if err != nil {
+			return err
+		}
+		todo.ListID = listID
+		if err := r.rescheduleReminders(ctx, tx, todo.ID, todo.DueAt); err != nil {
+			return err
+		}
+		return insertAuditLog(ctx, tx, todo.ID, "update", nil)
+	})
+	return todo, err
+}
+
+// DeleteTodoWithAuditはTODOをゴミ箱に入れ、監査ログを記録します。リストのeditor以上が実行できます。
+// サブタスクも同じ日時で一緒にゴミ箱に入れ、そのサブツリーの形を監査ログに残します。
+// ゴミ箱のTODOはRestoreTodoで戻すことができ、保持期間を過ぎるとPurgeTrashで物理削除されます。
+func (r *TodoRepository) DeleteTodoWithAudit(ctx context.Context, userID, todoID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		if _, err := requireTodoRole(ctx, tx, todoID, userID, RoleEditor); err != nil {
+			return err
+		}
+		todos, err := querySubtree(ctx, tx, todoID)
+		if err != nil {
+			return err
+		}
+		tree := buildTree(todos)
+		if _, err := tx.ExecContext(ctx, "UPDATE todos SET deleted_at = NOW() WHERE id = ANY($1)", tree.ids()); err != nil {
+			return err
+		}
+		var details any
+		if len(todos) > 1 {
+			details = map[string]any{"subtree": tree.shape()}
+		}
+		return insertAuditLog(ctx, tx, todoID, "delete", details)
+	})
+}
+
 // CreateTodoWithAuditはトランザクションを使用してTODOと監査ログを作成します。
 func (r *TodoRepository) CreateTodoWithAudit(ctx context.Context, todo Todo) (Todo, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
 	var createdTodo Todo
 	err := r.execTx(ctx, func(tx *sql.Tx) error {
 		var err error
-		createdTodo, err = r.createTodoInTx(tx, todo)
+		createdTodo, err = r.createTodoInTx(ctx, tx, todo, nil)
 		return err
 	})
 
 	return createdTodo, err
 }
 
-func (r *TodoRepository) CreateUser(user User) (User, error) {
-	err := r.db.QueryRow(
-		"INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id, created_at, role",
-		user.Email, user.PasswordHash).Scan(&user.ID, &user.CreatedAt, &user.Role)
+// CreateUserはユーザーを作成し、同じトランザクションで個人リストも作成します。
+// user.Roleが空なら一般ユーザー（'user'）です。
+func (r *TodoRepository) CreateUser(ctx context.Context, user User) (User, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			"INSERT INTO users (email, password_hash, role) VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'user')) RETURNING id, created_at, role, timezone",
+			user.Email, user.PasswordHash, user.Role).Scan(&user.ID, &user.CreatedAt, &user.Role, &user.Timezone)
+		if err != nil {
+			return err
+		}
+		_, err = ensurePersonalList(ctx, tx, user.ID)
+		return err
+	})
+	return user, err
+}
+
+// userColumnsはユーザーを読むクエリのSELECT句です。scanUserと列の順番を合わせてください。
+const userColumns = "id, email, password_hash, created_at, role, timezone, deletion_scheduled_at"
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var deletionScheduledAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.Role, &user.Timezone, &deletionScheduledAt)
+	if deletionScheduledAt.Valid {
+		user.DeletionScheduledAt = &deletionScheduledAt.Time
+	}
+	return user, err
+}
+
+func (r *TodoRepository) FindUserByID(ctx context.Context, id int) (User, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	user, err := scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *TodoRepository) FindUserByEmail(ctx context.Context, email string) (User, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	user, err := scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email))
 	if err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
-func (r *TodoRepository) FindUserByEmail(email string) (User, error) {
-	var user User
-	err := r.db.QueryRow("SELECT id, email, password_hash, created_at, role FROM users WHERE email = $1", email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.Role)
+// UpdateUserTimezoneはユーザーのタイムゾーン（IANA名）を変更します。
+func (r *TodoRepository) UpdateUserTimezone(ctx context.Context, userID int, timezone string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET timezone = $1 WHERE id = $2", timezone, userID)
 	if err != nil {
-		return user, err
+		return err
 	}
-	return user, nil
+	return requireAffected(res)
 }
 
-func (r *TodoRepository) FindAllUsers() ([]User, error) {
-	rows, err := r.db.Query("SELECT id, email, created_at, role FROM users")
+// UpdateUserPasswordはユーザーのパスワードのハッシュを置き換えます。
+func (r *TodoRepository) UpdateUserPassword(ctx context.Context, userID int, passwordHash string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2", passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// UpdateUserRoleはユーザーのロール（userかadmin）を変更します。
+func (r *TodoRepository) UpdateUserRole(ctx context.Context, userID int, role string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", role, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// CountUsersByRoleはロールのユーザー数を返します。削除を申請中のユーザーも含みます。
+func (r *TodoRepository) CountUsersByRole(ctx context.Context, role string) (int, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var n int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE role = $1", role).Scan(&n)
+	return n, err
+}
+
+// SchemaVersionはgolang-migrateが記録した適用済みのマイグレーションのバージョンと、途中で失敗したか（dirty）を返します。
+// まだ1つも適用していなければErrNotFoundです。
+func (r *TodoRepository) SchemaVersion(ctx context.Context) (int, bool, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var version int
+	var dirty bool
+	err := r.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) || r.dialect.IsUndefinedTable(err) {
+		// schema_migrationsがまだ無い
+		return 0, false, ErrNotFound
+	}
+	return version, dirty, err
+}
+
+// FindUsersByIDsはIDで指定したユーザーをまとめて返します。存在しないIDは結果に含めません。
+func (r *TodoRepository) FindUsersByIDs(ctx context.Context, ids []int) ([]User, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ANY($1) ORDER BY id", ids)
 	if err != nil {
 		return nil, err
 	}
@@ -113,8 +420,28 @@ func (r *TodoRepository) FindAllUsers() ([]User, error) {
 
 	var users []User
 	for rows.Next() {
-		var u User
-		if err := rows.Scan(&u.ID, &u.Email, &u.CreatedAt, &u.Role); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *TodoRepository) FindAllUsers(ctx context.Context) ([]User, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		users = append(users, u)
@@ -0,0 +1,431 @@
+// Package seedgenは負荷試験やデモの環境に入れる架空のデータを作ります。
+//
+// 同じConfig（Seedを含む）からは常に同じデータができるので、性能の問題を別の環境でも再現できます。
+// データはユーザーごとに独立した乱数列から作るため、全体をメモリに持たずにテーブルごとに順番に読み出せます。
+package seedgen
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Passwordは生成したユーザー全員のパスワードです。
+const Password = "password123"
+
+// passwordHashはPasswordのbcryptハッシュです（testdata/seed.sqlと同じ）。毎回ハッシュを計算すると結果が変わるので固定にしています。
+const passwordHash = "$2a$10$kxtxAB6YnV5vub0dbnc9z.DmL92hzshSp/X32LFR8G8//BxSx2Us6"
+
+// Configは作るデータの量と分布です。
+type Config struct {
+	Users int
+	// TodosPerUserは1ユーザーあたりのTODO数の平均です。実際の数はユーザーごとに大きくばらつきます（対数正規分布）
+	TodosPerUser int
+	// Teamsは複数のユーザーで共有するリストの数、TeamSizeはそのメンバー数です
+	Teams    int
+	TeamSize int
+	// SharedRatioはチームのメンバーのTODOのうち、チームのリストに入れる割合です
+	SharedRatio float64
+	// JapaneseRatioは日本語のユーザーの割合です。残りは英語のユーザーになります
+	JapaneseRatio float64
+	Seed          uint64
+	// Nowは生成するデータの「現在」です。期限や監査ログの日時はこれを基準にします
+	Now time.Time
+}
+
+// Presetsはよく使う規模の設定です。
+var Presets = map[string]Config{
+	// 画面の確認やデモ用の小さなデータ
+	"demo": {Users: 25, TodosPerUser: 12, Teams: 2, TeamSize: 5, SharedRatio: 0.3, JapaneseRatio: 0.6},
+	// 約100万件のTODO。インデックスの無い検索がSeq Scanで遅くなるのを再現できる規模
+	"load-1m": {Users: 10000, TodosPerUser: 100, Teams: 50, TeamSize: 20, SharedRatio: 0.1, JapaneseRatio: 0.6},
+	// 少数の大きな共有リストにTODOが集まる、組織での利用を想定したデータ
+	"tenant-heavy": {Users: 5000, TodosPerUser: 40, Teams: 10, TeamSize: 500, SharedRatio: 0.7, JapaneseRatio: 0.6},
+}
+
+// DefaultNowはConfig.Nowを指定しないときの基準日時です。実行した日によって結果が変わらないように固定しています。
+var DefaultNow = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Validateは設定が作れる値になっているかを確かめます。
+func (c Config) Validate() error {
+	switch {
+	case c.Users <= 0:
+		return fmt.Errorf("users must be positive")
+	case c.TodosPerUser < 0:
+		return fmt.Errorf("todos per user must not be negative")
+	case c.Teams < 0 || c.TeamSize < 0:
+		return fmt.Errorf("teams and team size must not be negative")
+	case c.Teams > 0 && c.TeamSize < 1:
+		return fmt.Errorf("team size must be positive when there are teams")
+	case c.Teams*c.TeamSize > c.Users:
+		return fmt.Errorf("%d teams of %d members need at least %d users", c.Teams, c.TeamSize, c.Teams*c.TeamSize)
+	case c.SharedRatio < 0 || c.SharedRatio > 1 || c.JapaneseRatio < 0 || c.JapaneseRatio > 1:
+		return fmt.Errorf("ratios must be between 0 and 1")
+	}
+	return nil
+}
+
+// IDsは各テーブルで使用済みのIDの最大値です。既存のデータの後ろに続けて作るために使います。
+type IDs struct {
+	User, List, Tag, Todo int
+}
+
+type User struct {
+	ID        int
+	Email     string
+	Role      string
+	Timezone  string
+	CreatedAt time.Time
+}
+
+type List struct {
+	ID         int
+	Name       string
+	OwnerID    int
+	IsPersonal bool
+	CreatedAt  time.Time
+}
+
+type ListMember struct {
+	ListID, UserID int
+	Role           string
+	CreatedAt      time.Time
+}
+
+type Tag struct {
+	ID        int
+	UserID    int
+	Name      string
+	CreatedAt time.Time
+}
+
+type Todo struct {
+	ID        int
+	Name      string
+	UserID    int
+	ListID    int
+	ParentID  *int
+	Completed bool
+	DueAt     *time.Time
+	DeletedAt *time.Time
+	TagIDs    []int
+	// Eventsは監査ログ（todo_audit_logs）に記録する操作で、日時の順に並んでいます
+	Events []Event
+}
+
+type Event struct {
+	Operation string
+	At        time.Time
+	Details   map[string]any
+}
+
+// Generatorは設定からデータを作ります。Users・Todosなどは何度呼んでも同じ結果を返します。
+type Generator struct {
+	cfg   Config
+	base  IDs
+	users []userPlan
+	teams []teamPlan
+}
+
+// userPlanはユーザーごとに先に決めておく値です。TODOのIDを連番で割り当てるために、TODOの数もここで決めます。
+type userPlan struct {
+	User
+	vocab       *vocabulary
+	tags        []string
+	firstTagID  int
+	todoCount   int
+	firstTodoID int
+	// teamは所属するチームの番号（所属しなければ-1）、teamRoleはそのリストでのロールです
+	team     int
+	teamRole string
+	joinedAt time.Time
+}
+
+type teamPlan struct {
+	List
+	members []int // ユーザーの番号
+}
+
+// 乱数列の種類。ユーザーごと・種類ごとに別の乱数列を使うので、ある種類の作り方を変えても他には影響しません
+const (
+	streamUser uint64 = iota
+	streamTeam
+	streamTodos
+)
+
+func (g *Generator) rng(index int, stream uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(g.cfg.Seed, uint64(index)<<8|stream))
+}
+
+// Newは生成の準備をします。baseより大きいIDを使います。
+func New(cfg Config, base IDs) (*Generator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Now.IsZero() {
+		cfg.Now = DefaultNow
+	}
+	g := &Generator{cfg: cfg, base: base}
+	nextTag, nextTodo := base.Tag+1, base.Todo+1
+	for i := range cfg.Users {
+		r := g.rng(i, streamUser)
+		vocab := &english
+		if r.Float64() < cfg.JapaneseRatio {
+			vocab = &japanese
+		}
+		u := userPlan{vocab: vocab, team: -1}
+		u.ID = base.User + i + 1
+		u.Role = "user"
+		if i == 0 {
+			// 最初のユーザーを管理者にして、管理者用の画面も確かめられるようにする
+			u.Role = "admin"
+		}
+		u.Email = fmt.Sprintf("%s.%s%d@%s", pick(r, vocab.givenNames), pick(r, vocab.familyNames), u.ID, vocab.domain)
+		u.Timezone = pick(r, vocab.timezones)
+		u.CreatedAt = cfg.Now.Add(-randDuration(r, 730*24*time.Hour)).Truncate(time.Second)
+
+		// タグを使わないユーザーもいる
+		n := r.IntN(len(vocab.tags) + 1)
+		u.tags = slices.Clone(vocab.tags)
+		r.Shuffle(len(u.tags), func(a, b int) { u.tags[a], u.tags[b] = u.tags[b], u.tags[a] })
+		u.tags = u.tags[:n]
+		u.firstTagID = nextTag
+		nextTag += n
+
+		u.todoCount = skewedCount(r, cfg.TodosPerUser)
+		u.firstTodoID = nextTodo
+		nextTodo += u.todoCount
+		g.users = append(g.users, u)
+	}
+
+	for t := range cfg.Teams {
+		r := g.rng(t, streamTeam)
+		team := teamPlan{}
+		for m := range cfg.TeamSize {
+			team.members = append(team.members, t*cfg.TeamSize+m)
+		}
+		owner := &g.users[team.members[0]]
+		team.ID = base.List + cfg.Users + t + 1
+		team.Name = owner.vocab.teams[t%len(owner.vocab.teams)]
+		if t >= len(owner.vocab.teams) {
+			team.Name += " " + strconv.Itoa(t/len(owner.vocab.teams)+1)
+		}
+		team.OwnerID = owner.ID
+		team.CreatedAt = owner.CreatedAt.Add(randDuration(r, cfg.Now.Sub(owner.CreatedAt)/10)).Truncate(time.Second)
+		for k, index := range team.members {
+			u := &g.users[index]
+			u.team = t
+			switch {
+			case k == 0:
+				u.teamRole = "owner"
+			case r.Float64() < 0.8:
+				u.teamRole = "editor"
+			default:
+				u.teamRole = "viewer"
+			}
+			u.joinedAt = latest(team.CreatedAt, u.CreatedAt)
+		}
+		g.teams = append(g.teams, team)
+	}
+	return g, nil
+}
+
+// MaxIDsは生成した後の各テーブルのIDの最大値です（シーケンスの更新用）。
+func (g *Generator) MaxIDs() IDs {
+	ids := IDs{User: g.base.User + g.cfg.Users, List: g.base.List + g.cfg.Users + g.cfg.Teams, Tag: g.base.Tag, Todo: g.base.Todo}
+	if len(g.users) > 0 {
+		last := g.users[len(g.users)-1]
+		ids.Tag = last.firstTagID + len(last.tags) - 1
+		ids.Todo = last.firstTodoID + last.todoCount - 1
+	}
+	return ids
+}
+
+func (g *Generator) Users() iter.Seq[User] {
+	return func(yield func(User) bool) {
+		for _, u := range g.users {
+			if !yield(u.User) {
+				return
+			}
+		}
+	}
+}
+
+// Listsはユーザーごとの個人リストとチームの共有リストを返します。
+func (g *Generator) Lists() iter.Seq[List] {
+	return func(yield func(List) bool) {
+		for _, u := range g.users {
+			if !yield(g.personalList(u)) {
+				return
+			}
+		}
+		for _, t := range g.teams {
+			if !yield(t.List) {
+				return
+			}
+		}
+	}
+}
+
+func (g *Generator) personalList(u userPlan) List {
+	// サインアップのときと同じ名前
+	return List{ID: u.ID - g.base.User + g.base.List, Name: "Personal", OwnerID: u.ID, IsPersonal: true, CreatedAt: u.CreatedAt}
+}
+
+func (g *Generator) ListMembers() iter.Seq[ListMember] {
+	return func(yield func(ListMember) bool) {
+		for _, u := range g.users {
+			if !yield(ListMember{ListID: g.personalList(u).ID, UserID: u.ID, Role: "owner", CreatedAt: u.CreatedAt}) {
+				return
+			}
+		}
+		for _, t := range g.teams {
+			for _, index := range t.members {
+				u := g.users[index]
+				if !yield(ListMember{ListID: t.ID, UserID: u.ID, Role: u.teamRole, CreatedAt: u.joinedAt}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (g *Generator) Tags() iter.Seq[Tag] {
+	return func(yield func(Tag) bool) {
+		for _, u := range g.users {
+			for k, name := range u.tags {
+				if !yield(Tag{ID: u.firstTagID + k, UserID: u.ID, Name: name, CreatedAt: u.CreatedAt}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// TodosはユーザーごとにTODOを作成日時の順に返します。
+func (g *Generator) Todos() iter.Seq[Todo] {
+	return func(yield func(Todo) bool) {
+		for i := range g.users {
+			for todo := range g.userTodos(i) {
+				if !yield(todo) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (g *Generator) userTodos(index int) iter.Seq[Todo] {
+	return func(yield func(Todo) bool) {
+		u := g.users[index]
+		r := g.rng(index, streamTodos)
+		now := g.cfg.Now
+		personal := g.personalList(u).ID
+
+		created := make([]time.Time, u.todoCount)
+		for k := range created {
+			created[k] = u.CreatedAt.Add(randDuration(r, now.Sub(u.CreatedAt))).Truncate(time.Second)
+		}
+		slices.SortFunc(created, func(a, b time.Time) int { return a.Compare(b) })
+
+		// サブタスクの親の候補（リストごとの、ゴミ箱に入っていないルートのTODO）
+		roots := map[int][]int{}
+		for k, createdAt := range created {
+			todo := Todo{ID: u.firstTodoID + k, UserID: u.ID, ListID: personal}
+			if u.team >= 0 && u.teamRole != "viewer" && !createdAt.Before(u.joinedAt) && r.Float64() < g.cfg.SharedRatio {
+				todo.ListID = g.teams[u.team].ID
+			}
+			if candidates := roots[todo.ListID]; len(candidates) > 0 && r.Float64() < 0.15 {
+				parent := pick(r, candidates)
+				todo.ParentID = &parent
+			}
+			// todos.nameは全体で一意なので、IDを付けて重複を避ける
+			todo.Name = fmt.Sprintf("%s #%d", u.vocab.title(r), todo.ID)
+
+			if r.Float64() < 0.6 {
+				due := now.Add(randDuration(r, 90*24*time.Hour) - 30*24*time.Hour).Truncate(30 * time.Minute)
+				todo.DueAt = &due
+			}
+			completedRate := 0.3
+			if todo.DueAt != nil && todo.DueAt.Before(now) {
+				completedRate = 0.75
+			}
+			todo.Completed = r.Float64() < completedRate
+			deleted := r.Float64() < 0.03
+
+			if len(u.tags) > 0 && r.Float64() < 0.4 {
+				for _, k := range r.Perm(len(u.tags))[:min(len(u.tags), 1+r.IntN(2))] {
+					todo.TagIDs = append(todo.TagIDs, u.firstTagID+k)
+				}
+				slices.Sort(todo.TagIDs)
+			}
+
+			// 監査ログ。作成の後の操作は、その前の操作から現在までの間に起きたことにする
+			at := createdAt
+			todo.Events = []Event{{Operation: "create", At: at}}
+			next := func() time.Time {
+				at = at.Add(randDuration(r, now.Sub(at))).Truncate(time.Second)
+				return at
+			}
+			if r.Float64() < 0.3 {
+				todo.Events = append(todo.Events, Event{Operation: "update", At: next()})
+			}
+			if todo.Completed {
+				todo.Events = append(todo.Events, Event{Operation: "complete", At: next(), Details: map[string]any{"cascade": false}})
+			}
+			if deleted {
+				deletedAt := next()
+				todo.DeletedAt = &deletedAt
+				todo.Events = append(todo.Events, Event{Operation: "delete", At: deletedAt})
+			} else if todo.ParentID == nil {
+				roots[todo.ListID] = append(roots[todo.ListID], todo.ID)
+			}
+			if !yield(todo) {
+				return
+			}
+		}
+	}
+}
+
+// titleはテンプレートの{contact}などを語彙から選んだ言葉で置き換えたTODOのタイトルを返します。
+func (v *vocabulary) title(r *rand.Rand) string {
+	return strings.NewReplacer(
+		"{contact}", pick(r, v.contacts),
+		"{item}", pick(r, v.items),
+		"{document}", pick(r, v.documents),
+		"{place}", pick(r, v.places),
+		"{topic}", pick(r, v.topics),
+	).Replace(pick(r, v.templates))
+}
+
+// skewedCountは平均がmeanの対数正規分布から個数を選びます。
+// 少数のユーザーがTODOを大量に持ち、多くのユーザーは少ししか持たない偏りを再現します（上限は平均の50倍）。
+func skewedCount(r *rand.Rand, mean int) int {
+	const sigma = 1.2
+	n := float64(mean) * math.Exp(sigma*r.NormFloat64()-sigma*sigma/2)
+	return min(int(math.Round(n)), mean*50)
+}
+
+func pick[T any](r *rand.Rand, values []T) T {
+	return values[r.IntN(len(values))]
+}
+
+// randDurationは[0, max)の長さをランダムに返します。
+func randDuration(r *rand.Rand, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(r.Int64N(int64(max)))
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
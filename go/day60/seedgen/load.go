@@ -0,0 +1,173 @@
+package seedgen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// LoadOptionsはLoadの動作を変えます。
+type LoadOptions struct {
+	// Truncateなら読み込む前にユーザー・リスト・TODOなどをすべて消し、IDを1からにします。
+	// 既存のデータの後ろに続けるとIDがずれるので、環境をまたいで同じデータにしたいときに使います
+	Truncate bool
+}
+
+// Statsは読み込んだ行数です。
+type Stats struct {
+	Users, Lists, ListMembers, Tags, Todos, TodoTags, AuditLogs int64
+}
+
+// truncateTablesはTruncateで消すテーブルです。CASCADEで、これらを参照するセッションや添付ファイルなども消えます。
+const truncateTables = "users, lists, tags, todos, todo_series, todo_audit_logs"
+
+// Loadはcfgのデータを生成してCOPYでdbに書き込みます。1つのトランザクションで書くので、失敗したときは何も残りません。
+// 書き込んだ後にシーケンスを進めてANALYZEするので、そのままアプリケーションや負荷試験に使えます。
+func Load(ctx context.Context, db *sql.DB, cfg Config, opts LoadOptions) (Stats, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer conn.Close()
+
+	var stats Stats
+	// COPYはpgxのConnにしか無いので、database/sqlの接続からpgxの接続を取り出す
+	err = conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		return pgx.BeginFunc(ctx, pgConn, func(tx pgx.Tx) error {
+			// TRUNCATEも同じトランザクションで行うので、読み込みに失敗すると元のデータに戻る
+			if opts.Truncate {
+				if _, err := tx.Exec(ctx, "TRUNCATE "+truncateTables+" RESTART IDENTITY CASCADE"); err != nil {
+					return err
+				}
+			}
+			var base IDs
+			err := tx.QueryRow(ctx, `SELECT
+				(SELECT COALESCE(MAX(id), 0) FROM users),
+				(SELECT COALESCE(MAX(id), 0) FROM lists),
+				(SELECT COALESCE(MAX(id), 0) FROM tags),
+				(SELECT COALESCE(MAX(id), 0) FROM todos)`).Scan(&base.User, &base.List, &base.Tag, &base.Todo)
+			if err != nil {
+				return err
+			}
+			g, err := New(cfg, base)
+			if err != nil {
+				return err
+			}
+			stats, err = copyAll(ctx, tx, g)
+			if err != nil {
+				return err
+			}
+			// IDを指定して書き込んだので、アプリケーションが次に作る行のIDが重ならないようにシーケンスを進める
+			for _, table := range []string{"users", "lists", "tags", "todos"} {
+				_, err := tx.Exec(ctx, fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), GREATEST((SELECT MAX(id) FROM %[1]s), 1))", table))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	// 実行計画が実際の件数に基づくように統計情報を更新する
+	if _, err := db.ExecContext(ctx, "ANALYZE users, lists, list_members, tags, todos, todo_tags, todo_audit_logs"); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+func copyAll(ctx context.Context, tx pgx.Tx, g *Generator) (Stats, error) {
+	var stats Stats
+	steps := []struct {
+		table   string
+		columns []string
+		rows    iter.Seq[[]any]
+		count   *int64
+	}{
+		{"users", []string{"id", "email", "password_hash", "role", "timezone", "created_at"}, rows(g.Users(), func(u User, yield func([]any) bool) bool {
+			return yield([]any{u.ID, u.Email, passwordHash, u.Role, u.Timezone, u.CreatedAt})
+		}), &stats.Users},
+		{"lists", []string{"id", "name", "owner_id", "is_personal", "created_at"}, rows(g.Lists(), func(l List, yield func([]any) bool) bool {
+			return yield([]any{l.ID, l.Name, l.OwnerID, l.IsPersonal, l.CreatedAt})
+		}), &stats.Lists},
+		{"list_members", []string{"list_id", "user_id", "role", "created_at"}, rows(g.ListMembers(), func(m ListMember, yield func([]any) bool) bool {
+			return yield([]any{m.ListID, m.UserID, m.Role, m.CreatedAt})
+		}), &stats.ListMembers},
+		{"tags", []string{"id", "user_id", "name", "created_at"}, rows(g.Tags(), func(t Tag, yield func([]any) bool) bool {
+			return yield([]any{t.ID, t.UserID, t.Name, t.CreatedAt})
+		}), &stats.Tags},
+		{"todos", []string{"id", "name", "user_id", "list_id", "parent_id", "completed", "due_at", "deleted_at"}, rows(g.Todos(), func(t Todo, yield func([]any) bool) bool {
+			return yield([]any{t.ID, t.Name, t.UserID, t.ListID, t.ParentID, t.Completed, t.DueAt, t.DeletedAt})
+		}), &stats.Todos},
+		{"todo_tags", []string{"todo_id", "tag_id"}, rows(g.Todos(), func(t Todo, yield func([]any) bool) bool {
+			for _, tagID := range t.TagIDs {
+				if !yield([]any{t.ID, tagID}) {
+					return false
+				}
+			}
+			return true
+		}), &stats.TodoTags},
+		// 監査ログのIDはシーケンスに任せる
+		{"todo_audit_logs", []string{"todo_id", "operation", "created_at", "details"}, rows(g.Todos(), func(t Todo, yield func([]any) bool) bool {
+			for _, e := range t.Events {
+				var details any // nilのままならNULL
+				if e.Details != nil {
+					details = e.Details
+				}
+				if !yield([]any{t.ID, e.Operation, e.At, details}) {
+					return false
+				}
+			}
+			return true
+		}), &stats.AuditLogs},
+	}
+	for _, step := range steps {
+		next, stop := iter.Pull(step.rows)
+		n, err := tx.CopyFrom(ctx, pgx.Identifier{step.table}, step.columns, &seqSource{next: next})
+		stop()
+		if err != nil {
+			return stats, fmt.Errorf("copy %s: %w", step.table, err)
+		}
+		*step.count = n
+	}
+	return stats, nil
+}
+
+// rowsはvaluesの各要素をCOPYの行（0行以上）に変換します。
+func rows[T any](values iter.Seq[T], toRows func(T, func([]any) bool) bool) iter.Seq[[]any] {
+	return func(yield func([]any) bool) {
+		for v := range values {
+			if !toRows(v, yield) {
+				return
+			}
+		}
+	}
+}
+
+// seqSourceはiter.Pullで取り出した行をpgx.CopyFromSourceとして渡します。
+type seqSource struct {
+	next func() ([]any, bool)
+	row  []any
+}
+
+func (s *seqSource) Next() bool {
+	var ok bool
+	s.row, ok = s.next()
+	return ok
+}
+
+func (s *seqSource) Values() ([]any, error) {
+	if s.row == nil {
+		return nil, errors.New("no current row")
+	}
+	return s.row, nil
+}
+
+func (s *seqSource) Err() error { return nil }
@@ -0,0 +1,57 @@
+package seedgen
+
+// 生成に使う名前や語彙です。ユーザーの言語（日本語か英語）ごとに用意しています。
+// usersテーブルに氏名の列は無いので、名前はメールアドレスとTODOのタイトルに使います。
+
+type vocabulary struct {
+	domain     string
+	timezones  []string
+	givenNames []string
+	// familyNamesはメールアドレス用のローマ字、contactsはタイトルに入れる表記です
+	familyNames []string
+	contacts    []string
+	items       []string
+	documents   []string
+	places      []string
+	topics      []string
+	// templatesの{name}などをそれぞれの語彙で置き換えます
+	templates []string
+	tags      []string
+	teams     []string
+}
+
+var japanese = vocabulary{
+	domain:      "example.jp",
+	timezones:   []string{"Asia/Tokyo"},
+	givenNames:  []string{"haruto", "sota", "yuto", "ren", "minato", "himari", "yui", "mei", "sakura", "aoi", "kenji", "naoko", "takashi", "yoko", "hiroshi"},
+	familyNames: []string{"sato", "suzuki", "takahashi", "tanaka", "watanabe", "ito", "yamamoto", "nakamura", "kobayashi", "kato", "yoshida", "yamada", "sasaki", "yamaguchi", "matsumoto"},
+	contacts:    []string{"佐藤", "鈴木", "高橋", "田中", "渡辺", "伊藤", "山本", "中村", "小林", "加藤", "吉田", "山田"},
+	items:       []string{"牛乳", "卵", "電池", "トイレットペーパー", "コーヒー豆", "洗剤", "プリンターのインク", "お米", "切手", "傘"},
+	documents:   []string{"見積書", "議事録", "週報", "提案書", "経費精算", "請求書", "設計書", "契約書", "年末調整の書類", "障害報告書"},
+	places:      []string{"歯医者", "美容院", "会議室", "レストラン", "新幹線", "ホテル", "病院", "車検"},
+	topics:      []string{"来期の予算", "採用", "リリース計画", "新機能", "顧客対応", "移行作業", "研修", "オフィス移転"},
+	templates: []string{
+		"{contact}さんに電話する", "{item}を買う", "{document}を確認する", "{document}を提出する", "{contact}さんと{topic}の打ち合わせ",
+		"{place}を予約する", "{topic}の資料を作る", "{contact}さんに{document}を送る", "{item}を補充する", "{topic}について{contact}さんに相談",
+	},
+	tags:  []string{"仕事", "家", "買い物", "至急", "経理", "健康", "家族", "あとで"},
+	teams: []string{"営業部", "開発チーム", "総務部", "マーケティング", "カスタマーサポート", "経理部", "人事部", "企画室"},
+}
+
+var english = vocabulary{
+	domain:      "example.com",
+	timezones:   []string{"America/New_York", "America/Los_Angeles", "Europe/London", "Europe/Berlin", "Australia/Sydney", "UTC"},
+	givenNames:  []string{"james", "olivia", "liam", "emma", "noah", "ava", "oliver", "sophia", "elijah", "mia", "lucas", "amelia", "mason", "harper", "ethan"},
+	familyNames: []string{"smith", "johnson", "williams", "brown", "jones", "garcia", "miller", "davis", "wilson", "taylor", "clark", "lewis", "walker", "hall", "young"},
+	contacts:    []string{"Emma", "Liam", "Olivia", "Noah", "Ava", "Mason", "Sophia", "Lucas", "Mia", "Ethan", "Grace", "Henry"},
+	items:       []string{"milk", "eggs", "batteries", "coffee beans", "detergent", "printer ink", "bread", "stamps", "light bulbs", "dog food"},
+	documents:   []string{"the quote", "meeting notes", "the weekly report", "the proposal", "expense report", "the invoice", "the design doc", "the contract", "tax forms", "the incident report"},
+	places:      []string{"dentist", "hair salon", "meeting room", "restaurant", "flight", "hotel", "doctor", "car service"},
+	topics:      []string{"next year's budget", "hiring", "the release plan", "the new feature", "a customer escalation", "the migration", "onboarding", "the office move"},
+	templates: []string{
+		"Call {contact}", "Buy {item}", "Review {document}", "Submit {document}", "Meet {contact} about {topic}",
+		"Book the {place}", "Prepare slides on {topic}", "Send {document} to {contact}", "Restock {item}", "Ask {contact} about {topic}",
+	},
+	tags:  []string{"work", "home", "errands", "urgent", "finance", "health", "family", "someday"},
+	teams: []string{"Sales", "Platform Team", "Operations", "Marketing", "Customer Support", "Finance", "People", "Design"},
+}
@@ -0,0 +1,151 @@
+package seedgen
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministic(t *testing.T) {
+	cfg := Presets["demo"]
+	cfg.Seed = 42
+	a, err := New(cfg, IDs{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	b, _ := New(cfg, IDs{})
+	assert.Equal(t, slices.Collect(a.Users()), slices.Collect(b.Users()))
+	assert.Equal(t, slices.Collect(a.Todos()), slices.Collect(b.Todos()))
+	// 同じGeneratorから何度読んでも同じ
+	assert.Equal(t, slices.Collect(a.Todos()), slices.Collect(a.Todos()))
+
+	cfg.Seed = 43
+	c, _ := New(cfg, IDs{})
+	assert.NotEqual(t, slices.Collect(a.Users()), slices.Collect(c.Users()))
+}
+
+func TestGeneratedRows(t *testing.T) {
+	cfg := Presets["demo"]
+	base := IDs{User: 2, List: 2, Tag: 0, Todo: 1} // testdata/seed.sqlの後ろに続ける
+	g, err := New(cfg, base)
+	if !assert.NoError(t, err) {
+		return
+	}
+	users := slices.Collect(g.Users())
+	lists := slices.Collect(g.Lists())
+	members := slices.Collect(g.ListMembers())
+	tags := slices.Collect(g.Tags())
+	todos := slices.Collect(g.Todos())
+
+	assert.Len(t, users, cfg.Users)
+	assert.Len(t, lists, cfg.Users+cfg.Teams)
+	assert.Len(t, members, cfg.Users+cfg.Teams*cfg.TeamSize)
+	assert.Equal(t, 3, users[0].ID)
+	assert.Equal(t, "admin", users[0].Role)
+
+	emails := map[string]bool{}
+	userIDs := map[int]bool{}
+	for _, u := range users {
+		assert.False(t, emails[u.Email], u.Email)
+		emails[u.Email] = true
+		userIDs[u.ID] = true
+		_, err := time.LoadLocation(u.Timezone)
+		assert.NoError(t, err)
+	}
+	listIDs := map[int]bool{}
+	for _, l := range lists {
+		assert.Greater(t, l.ID, base.List)
+		assert.True(t, userIDs[l.OwnerID])
+		listIDs[l.ID] = true
+	}
+	// メンバーはユーザーごとに1つのリストに1回だけ
+	type membership struct{ list, user int }
+	memberOf := map[membership]bool{}
+	for _, m := range members {
+		assert.False(t, memberOf[membership{m.ListID, m.UserID}])
+		memberOf[membership{m.ListID, m.UserID}] = true
+	}
+	tagOwner := map[int]int{}
+	for _, tag := range tags {
+		tagOwner[tag.ID] = tag.UserID
+	}
+
+	names := map[string]bool{}
+	todoByID := map[int]Todo{}
+	maxIDs := g.MaxIDs()
+	for i, todo := range todos {
+		if i > 0 {
+			assert.Equal(t, todos[i-1].ID+1, todo.ID, "IDs are sequential")
+		}
+		assert.False(t, names[todo.Name], todo.Name)
+		names[todo.Name] = true
+		// TODOは作成者がメンバーになっているリストに入る
+		assert.True(t, listIDs[todo.ListID])
+		assert.True(t, memberOf[membership{todo.ListID, todo.UserID}], "todo %d", todo.ID)
+		if todo.ParentID != nil {
+			parent, ok := todoByID[*todo.ParentID]
+			if assert.True(t, ok, "parent is created first") {
+				assert.Equal(t, todo.ListID, parent.ListID)
+				assert.Nil(t, parent.DeletedAt)
+			}
+		}
+		for _, tagID := range todo.TagIDs {
+			assert.Equal(t, todo.UserID, tagOwner[tagID])
+		}
+		if assert.NotEmpty(t, todo.Events) {
+			assert.Equal(t, "create", todo.Events[0].Operation)
+			assert.True(t, slices.IsSortedFunc(todo.Events, func(a, b Event) int { return a.At.Compare(b.At) }))
+			last := todo.Events[len(todo.Events)-1]
+			assert.False(t, last.At.After(DefaultNow))
+			if todo.DeletedAt != nil {
+				assert.Equal(t, "delete", last.Operation)
+			}
+		}
+		todoByID[todo.ID] = todo
+	}
+	assert.Equal(t, todos[len(todos)-1].ID, maxIDs.Todo)
+	assert.Equal(t, tags[len(tags)-1].ID, maxIDs.Tag)
+	assert.Equal(t, lists[len(lists)-1].ID, maxIDs.List)
+}
+
+func TestSkewedCounts(t *testing.T) {
+	cfg := Config{Users: 2000, TodosPerUser: 20, JapaneseRatio: 0.5, Seed: 7}
+	g, err := New(cfg, IDs{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	counts := make([]int, 0, cfg.Users)
+	total, japaneseUsers := 0, 0
+	for _, u := range g.users {
+		counts = append(counts, u.todoCount)
+		total += u.todoCount
+		if u.vocab == &japanese {
+			japaneseUsers++
+		}
+	}
+	slices.Sort(counts)
+	mean := float64(total) / float64(cfg.Users)
+	assert.InDelta(t, cfg.TodosPerUser, mean, 3)
+	// 中央値は平均より小さく、上位1%は平均の数倍を持つ
+	assert.Less(t, counts[len(counts)/2], cfg.TodosPerUser)
+	assert.Greater(t, counts[len(counts)*99/100], cfg.TodosPerUser*4)
+	assert.InDelta(t, cfg.Users/2, japaneseUsers, float64(cfg.Users)/10)
+}
+
+func TestPresets(t *testing.T) {
+	for name, cfg := range Presets {
+		assert.NoError(t, cfg.Validate(), name)
+	}
+	assert.Equal(t, 1_000_000, Presets["load-1m"].Users*Presets["load-1m"].TodosPerUser)
+
+	for _, cfg := range []Config{
+		{},
+		{Users: 10, TodosPerUser: -1},
+		{Users: 10, Teams: 3, TeamSize: 4},
+		{Users: 10, SharedRatio: 1.5},
+	} {
+		assert.Error(t, cfg.Validate(), "%+v", cfg)
+	}
+}
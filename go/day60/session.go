@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// sessionTTLはログインで発行するJWT（セッション）の有効期間です。
+const sessionTTL = 24 * time.Hour
+
+// refreshTokenTTLはリフレッシュトークンの有効期間です。リフレッシュのたびに延びるので、この期間使わなければ再ログインが必要になります。
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// refreshTokenPrefixはリフレッシュトークンの先頭に付く文字列です。
+const refreshTokenPrefix = "tdr_"
+
+// SessionRegistryは取り消し済みセッションの拒否リストと、セッションの最終利用日時をメモリに持ちます。
+//
+// authMiddlewareはリクエストごとにDBを引かずに、この拒否リストでセッションの取り消しを確かめます。
+// このインスタンスで取り消したセッションはすぐに拒否リストに入り、他のインスタンスで取り消したものはRunの定期読み込みで反映されます。
+// 最終利用日時も同じタイミングでまとめてDBに書き込みます。
+type SessionRegistry struct {
+	repo     *TodoRepository
+	interval time.Duration
+	now      func() time.Time
+
+	mu sync.RWMutex
+	// revokedは取り消し済みのセッション。値はこのインスタンスで取り消した時刻（DBから読み込んだものはゼロ値）
+	revoked map[string]time.Time
+	seen    map[string]struct{} // 前回の書き込みから使われたセッション
+}
+
+func NewSessionRegistry(repo *TodoRepository, interval time.Duration) *SessionRegistry {
+	return &SessionRegistry{
+		repo:     repo,
+		interval: interval,
+		now:      time.Now,
+		revoked:  map[string]time.Time{},
+		seen:     map[string]struct{}{},
+	}
+}
+
+// IsRevokedはセッションが取り消されているかを返します。
+func (s *SessionRegistry) IsRevoked(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[id]
+	return ok
+}
+
+// Touchはセッションが使われたことを記録します。DBへは次の定期処理でまとめて書き込みます。
+func (s *SessionRegistry) Touch(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[id] = struct{}{}
+}
+
+// Revokeはこのインスタンスの拒否リストにセッションを加えます。DBの更新は呼び出し側が行います。
+func (s *SessionRegistry) Revoke(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for _, id := range ids {
+		s.revoked[id] = now
+	}
+}
+
+// Refreshは拒否リストをDBの取り消し済みセッションで置き換えます。期限を過ぎたセッションは拒否リストから外れます（JWTの検証で拒否される）。
+// 読み込みの間にこのインスタンスで取り消したセッションは、読み込み結果に無くても残します。
+func (s *SessionRegistry) Refresh(ctx context.Context) error {
+	start := s.now()
+	ids, err := s.repo.FindRevokedSessionIDs(ctx)
+	if err != nil {
+		return err
+	}
+	revoked := make(map[string]time.Time, len(ids))
+	for _, id := range ids {
+		revoked[id] = time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, at := range s.revoked {
+		if !at.Before(start) {
+			revoked[id] = at
+		}
+	}
+	s.revoked = revoked
+	return nil
+}
+
+// flushSeenは使われたセッションの最終利用日時をDBに書き込みます。
+func (s *SessionRegistry) flushSeen(ctx context.Context) error {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.seen))
+	for id := range s.seen {
+		ids = append(ids, id)
+	}
+	s.seen = map[string]struct{}{}
+	s.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.repo.TouchSessions(ctx, ids, s.now())
+}
+
+// Runはctxがキャンセルされるまで、拒否リストの読み込みと最終利用日時の書き込みを定期的に行います。
+// 終了時に残っている最終利用日時も書き込みます。
+func (s *SessionRegistry) Run(ctx context.Context) {
+	log.Printf("Session registry started (interval: %s)", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// ctxは既にキャンセルされているので、最後の書き込みはキャンセルを引き継がないコンテキストで行う
+			if err := s.flushSeen(context.WithoutCancel(ctx)); err != nil {
+				log.Printf("Session registry: failed to record last seen: %v", err)
+			}
+			log.Println("Session registry stopped")
+			return
+		case <-ticker.C:
+			s.runOnce(ctx)
+		}
+	}
+}
+
+func (s *SessionRegistry) runOnce(ctx context.Context) {
+	if err := s.Refresh(ctx); err != nil {
+		log.Printf("Session registry: failed to load revoked sessions: %v", err)
+	}
+	if err := s.flushSeen(ctx); err != nil {
+		log.Printf("Session registry: failed to record last seen: %v", err)
+	}
+	if n, err := s.repo.DeleteExpiredSessions(ctx); err != nil {
+		log.Printf("Session registry: failed to delete expired sessions: %v", err)
+	} else if n > 0 {
+		log.Printf("Session registry: deleted %d expired sessions", n)
+	}
+}
+
+// SessionClientはセッションを始めたクライアントです。セッション一覧で端末を見分けるために記録します。
+type SessionClient struct {
+	UserAgent string
+	IP        string
+	// Rememberがtrueならリフレッシュトークンも発行します（CLIなど、ログインを保ち続けるクライアント用）
+	Remember bool
+}
+
+// ginSessionClientはHTTPリクエストのクライアントを返します。
+func ginSessionClient(c *gin.Context) SessionClient {
+	return SessionClient{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+// startSessionはログインしたユーザーのセッションを記録し、そのjtiを入れたアプリケーションのJWTを返します。
+// client.Rememberならリフレッシュトークンも返します。
+func startSession(ctx context.Context, repo *TodoRepository, user User, client SessionClient) (LoginResult, error) {
+	now := time.Now()
+	session := Session{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		ExpiresAt: now.Add(sessionTTL),
+	}
+	var result LoginResult
+	if client.Remember {
+		refreshToken, hash, err := generateSecret(refreshTokenPrefix)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		session.RefreshTokenHash = hash
+		session.ExpiresAt = now.Add(refreshTokenTTL)
+		result.RefreshToken = refreshToken
+	}
+	if err := repo.CreateSession(ctx, session); err != nil {
+		return LoginResult{}, err
+	}
+	token, err := issueToken(user, session.ID, now.Add(sessionTTL))
+	if err != nil {
+		return LoginResult{}, err
+	}
+	result.Token = token
+	return result, nil
+}
+
+// refreshSessionはリフレッシュトークンを新しいものと交換し、同じセッション（jti）のJWTを発行し直します。
+// 取り消したセッションのリフレッシュトークンは使えません。
+func refreshSession(ctx context.Context, repo *TodoRepository, refreshToken string) (LoginResult, error) {
+	newToken, newHash, err := generateSecret(refreshTokenPrefix)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	now := time.Now()
+	session, err := repo.RotateRefreshToken(ctx, hashToken(refreshToken), newHash, now.Add(refreshTokenTTL))
+	if errors.Is(err, ErrNotFound) {
+		return LoginResult{}, fmt.Errorf("%w: refresh token is invalid or expired", ErrUnauthenticated)
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+	user, err := repo.FindUserByID(ctx, session.UserID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	token, err := issueToken(user, session.ID, now.Add(sessionTTL))
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{Token: token, RefreshToken: newToken}, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandlerはログインセッションの一覧と取り消しを扱います。
+type SessionHandler struct {
+	repo     *TodoRepository
+	sessions *SessionRegistry
+}
+
+func NewSessionHandler(repo *TodoRepository, sessions *SessionRegistry) *SessionHandler {
+	return &SessionHandler{repo: repo, sessions: sessions}
+}
+
+// getSessionsはログインユーザーの有効なセッションを返します。このリクエストのセッションにはcurrentが付きます。
+func (h *SessionHandler) getSessions(c *gin.Context) error {
+	p := currentPrincipal(c)
+	sessions, err := h.repo.FindSessions(c.Request.Context(), p.UserID)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == p.SessionID
+	}
+	c.JSON(http.StatusOK, sessions)
+	return nil
+}
+
+// revokeSessionはログインユーザーのセッションを取り消します（このリクエストのセッションも取り消せる＝ログアウト）。
+func (h *SessionHandler) revokeSession(c *gin.Context) error {
+	id := c.Param("id")
+	if err := h.repo.RevokeSession(c.Request.Context(), currentUserID(c), id); err != nil {
+		return err
+	}
+	h.sessions.Revoke(id)
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// revokeUserSessionsはユーザーのすべてのセッションを管理者が取り消します（乗っ取られたアカウントの対応用）。
+func (h *SessionHandler) revokeUserSessions(c *gin.Context) error {
+	userID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	ids, err := h.repo.RevokeUserSessions(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+	h.sessions.Revoke(ids...)
+	c.JSON(http.StatusOK, gin.H{"revoked": len(ids)})
+	return nil
+}
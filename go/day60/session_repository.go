@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sessionはログインセッション（発行したJWT）です。IDはJWTのjtiです。
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Currentはこの一覧を取得したリクエストのセッションか
+	Current bool `json:"current"`
+	// RefreshTokenHashはリフレッシュトークンのハッシュ。rememberを指定したログインのセッションだけが持ちます
+	RefreshTokenHash string `json:"-"`
+}
+
+// CreateSessionはセッションを記録します。
+func (r *TodoRepository) CreateSession(ctx context.Context, s Session) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, user_agent, ip, expires_at, refresh_token_hash)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`, s.ID, s.UserID, s.UserAgent, s.IP, s.ExpiresAt, s.RefreshTokenHash)
+	return err
+}
+
+// RotateRefreshTokenはリフレッシュトークンを新しいものに置き換え、セッションの期限をexpiresAtまで延ばします。
+// 古いトークンはこれで使えなくなります。トークンが見つからないか、セッションが取り消し済み・期限切れならErrNotFoundです。
+func (r *TodoRepository) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (Session, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	s := Session{RefreshTokenHash: newHash, ExpiresAt: expiresAt}
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE sessions SET refresh_token_hash = $2, expires_at = $3, last_seen_at = NOW()
+		WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id`, oldHash, newHash, expiresAt).Scan(&s.ID, &s.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, ErrNotFound
+	}
+	return s, err
+}
+
+// FindSessionsはユーザーの有効な（取り消されておらず期限内の）セッションを、最近使われた順に返します。
+func (r *TodoRepository) FindSessions(ctx context.Context, userID int) ([]Session, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_agent, ip, created_at, last_seen_at, expires_at FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC, created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		s := Session{UserID: userID}
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSessionはユーザーのセッションを取り消します。見つからないか取り消し済みならErrNotFoundです。
+func (r *TodoRepository) RevokeSession(ctx context.Context, userID int, id string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessionsはユーザーの有効なセッションをすべて取り消し、取り消したセッションのIDを返します。
+// ユーザーが存在しなければErrNotFoundです。
+func (r *TodoRepository) RevokeUserSessions(ctx context.Context, userID int) ([]string, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSessionIDs(rows)
+}
+
+// RevokeAllSessionsは全ユーザーの有効なセッションを取り消し、取り消したセッションのIDを返します（JWTの秘密鍵の漏洩時など）。
+func (r *TodoRepository) RevokeAllSessions(ctx context.Context) ([]string, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE revoked_at IS NULL AND expires_at > NOW()
+		RETURNING id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanSessionIDs(rows)
+}
+
+// FindRevokedSessionIDsは取り消し済みでまだ期限内のセッションのIDを返します（拒否リストの読み込み用）。
+func (r *TodoRepository) FindRevokedSessionIDs(ctx context.Context) ([]string, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT id FROM sessions WHERE revoked_at IS NOT NULL AND expires_at > NOW()")
+	if err != nil {
+		return nil, err
+	}
+	return scanSessionIDs(rows)
+}
+
+func scanSessionIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// TouchSessionsはセッションの最終利用日時をまとめて更新します。
+func (r *TodoRepository) TouchSessions(ctx context.Context, ids []string, at time.Time) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = $2 WHERE id = ANY($1::text[]::uuid[]) AND last_seen_at < $2", ids, at)
+	return err
+}
+
+// DeleteExpiredSessionsは期限を過ぎたセッションを削除し、削除した件数を返します。
+func (r *TodoRepository) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
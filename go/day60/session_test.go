@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthMiddlewareSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sessions := NewSessionRegistry(nil, time.Minute)
+	router := gin.New()
+	router.GET("/me", authMiddleware(nil, sessions), func(c *gin.Context) {
+		c.String(http.StatusOK, currentPrincipal(c).SessionID)
+	})
+	get := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := User{ID: 7, Role: "user"}
+	token, err := issueToken(user, "session-a", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	other, err := issueToken(user, "session-b", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	w := get(token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "session-a", w.Body.String())
+	assert.Contains(t, sessions.seen, "session-a")
+
+	// 取り消したセッションだけが拒否される
+	sessions.Revoke("session-a")
+	assert.True(t, sessions.IsRevoked("session-a"))
+	assert.Equal(t, http.StatusUnauthorized, get(token).Code)
+	assert.Equal(t, http.StatusOK, get(other).Code)
+
+	// jtiの無いトークン（セッションとして記録されていない）は受け付けない
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, AppClaims{"user", jwt.RegisteredClaims{
+		Subject:   "7",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}).SignedString(jwtSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, get(legacy).Code)
+}
+
+func TestRefreshTokenFormat(t *testing.T) {
+	token, hash, err := generateSecret(refreshTokenPrefix)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, hashToken(token), hash)
+	// リフレッシュトークンはAPIトークンとしては受け付けない
+	assert.False(t, isPersonalAccessToken(token))
+
+	assert.Equal(t, gin.H{"token": "jwt"}, LoginResult{Token: "jwt"}.tokens())
+	assert.Equal(t, gin.H{"token": "jwt", "refresh_token": token}, LoginResult{Token: "jwt", RefreshToken: token}.tokens())
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// SQLiteはDB_DRIVER=sqliteのときに使います（1つのバイナリで動かすデモやエッジでの運用向け）。
+// mattn/go-sqlite3をsqliteDriverで包み、PostgreSQLの書き方のクエリをSQLiteで実行できる形に書き換えます。
+//
+// 日時はすべてUTCの"2006-01-02 15:04:05.000000000+00:00"（sqliteTimeLayout）の文字列で保存します。
+// 長さのそろった同じ形なので、文字列のまま比較・並べ替えができます。
+//
+// mattn/go-sqlite3はcgoを使うので、ドライバ（sqlite_driver.go）はcgoを有効にしたビルドにだけ入ります。
+// このファイルにはクエリの書き換えなど、ドライバに依存しない部分を置きます。
+
+// sqliteDriverNameはsql.Openに渡すドライバ名です。
+const sqliteDriverName = "sqlite"
+
+// sqliteTimeLayoutはGoから渡す日時を保存する形です。
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000000+00:00"
+
+// sqliteTimeFormatはsqliteTimeLayoutと同じ形の文字列を作るstrftimeの書式です（SQLiteの精度はミリ秒まで）。
+const sqliteTimeFormat = "'%Y-%m-%d %H:%M:%f000000+00:00'"
+
+const sqliteNow = "strftime(" + sqliteTimeFormat + ", 'now')"
+
+var sqliteTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{9}\+00:00$`)
+
+// rebindSQLiteの書き換え。文字列リテラルの中は書き換えない
+var sqliteRewrites = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// = ANY($1)はJSONの配列にした引数をjson_eachで展開する（キャストはこの後で消す）
+	{regexp.MustCompile(`(?i)=\s*ANY\s*\(\s*\$(\d+)((?:::\w+(?:\[\])?)*)\s*\)`), "IN (SELECT value FROM json_each(?$1))"},
+	// 書き込むトランザクションはBEGIN IMMEDIATEでDB全体をロックしているので、行のロックは要らない
+	{regexp.MustCompile(`(?i)\s+FOR\s+(?:UPDATE|SHARE)(?:\s+OF\s+\w+(?:\s*,\s*\w+)*)?(?:\s+SKIP\s+LOCKED|\s+NOWAIT)?`), ""},
+	{regexp.MustCompile(`::\w+(?:\[\])?`), ""},
+	{regexp.MustCompile(`\$(\d+)`), "?$1"},
+	{regexp.MustCompile(`(?i)\bNOW\(\)`), sqliteNow},
+	{regexp.MustCompile(`(?i)\bjson_agg\(`), "json_group_array("},
+	// 配列の列はJSONの配列で保存している
+	{regexp.MustCompile(`(?i)\barray_to_json\(`), "json("},
+}
+
+// sqliteRebindCacheは書き換えたクエリです。クエリの種類は限られているので消さずに持ちます
+var sqliteRebindCache sync.Map
+
+// rebindSQLiteはPostgreSQLの書き方のクエリをSQLiteで実行できる形にします。
+// プレースホルダ（$1→?1）、配列の引数（= ANY($1)）、キャスト（::text[]）、FOR UPDATE、NOW()などを書き換えます。
+func rebindSQLite(query string) string {
+	if cached, ok := sqliteRebindCache.Load(query); ok {
+		return cached.(string)
+	}
+	var b strings.Builder
+	rest := query
+	for rest != "" {
+		// 文字列リテラル（'...'、''はエスケープされた'）はそのまま残す
+		start := strings.IndexByte(rest, '\'')
+		if start < 0 {
+			b.WriteString(rewriteSQLite(rest))
+			break
+		}
+		b.WriteString(rewriteSQLite(rest[:start]))
+		end := start + 1
+		for end < len(rest) {
+			if rest[end] == '\'' {
+				if end+1 < len(rest) && rest[end+1] == '\'' {
+					end += 2
+					continue
+				}
+				break
+			}
+			end++
+		}
+		end = min(end+1, len(rest))
+		b.WriteString(rest[start:end])
+		rest = rest[end:]
+	}
+	rebound := b.String()
+	sqliteRebindCache.Store(query, rebound)
+	return rebound
+}
+
+func rewriteSQLite(sql string) string {
+	for _, r := range sqliteRewrites {
+		sql = r.pattern.ReplaceAllString(sql, r.replacement)
+	}
+	return sql
+}
+
+var (
+	sqliteNoSuchTable       = regexp.MustCompile(`^no such table: `)
+	sqliteUniqueViolationRe = regexp.MustCompile(`^UNIQUE constraint failed: (.+)$`)
+)
+
+// sqliteUniqueConstraintsはSQLiteのユニーク制約違反のメッセージに出る列から、PostgreSQLでの制約名を引きます。
+var sqliteUniqueConstraints = map[string]string{
+	"users.email":                                                "users_email_key",
+	"todos.name":                                                 "todos_name_unique",
+	"todos.series_id, todos.due_at":                              "todos_series_id_due_at_unique",
+	"tags.user_id, tags.name":                                    "tags_user_id_name_unique",
+	"todo_tags.todo_id, todo_tags.tag_id":                        "todo_tags_pkey",
+	"lists.owner_id":                                             "lists_personal_unique",
+	"list_members.list_id, list_members.user_id":                 "list_members_pkey",
+	"list_invitations.list_id, list_invitations.email":           "list_invitations_list_id_email_unique",
+	"attachments.blob_key":                                       "attachments_blob_key_key",
+	"comment_mentions.comment_id, comment_mentions.user_id":      "comment_mentions_pkey",
+	"personal_access_tokens.token_hash":                          "personal_access_tokens_token_hash_key",
+	"user_identities.provider, user_identities.subject":          "user_identities_provider_subject_unique",
+	"user_totp.user_id":                                          "user_totp_pkey",
+	"user_recovery_codes.user_id, user_recovery_codes.code_hash": "user_recovery_codes_user_id_code_hash_unique",
+	"sessions.id":                                                "sessions_pkey",
+	"sessions.refresh_token_hash":                                "idx_sessions_refresh_token_hash",
+}
+
+// sqliteConstraintNameはSQLiteのユニーク制約違反のエラーメッセージから制約名を返します。分からなければ空です。
+func sqliteConstraintName(message string) string {
+	m := sqliteUniqueViolationRe.FindStringSubmatch(message)
+	if m == nil {
+		return ""
+	}
+	return sqliteUniqueConstraints[m[1]]
+}
@@ -0,0 +1,160 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sql.Register(sqliteDriverName, &sqliteDriver{})
+}
+
+// openSQLiteはpathのSQLiteのDBを開き、埋め込んだマイグレーションを適用します。
+// 外部キー制約を有効にし、書き込むトランザクションは最初から書き込みのロックを取ります（PostgreSQLのFOR UPDATEの代わり）。
+func openSQLite(path string) (*sql.DB, error) {
+	params := url.Values{
+		"_foreign_keys": {"on"},
+		"_journal_mode": {"WAL"},
+		"_busy_timeout": {"10000"},
+		"_txlock":       {"immediate"},
+	}
+	db, err := sql.Open(sqliteDriverName, "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	if err := applyMigrations(context.Background(), db, sqliteMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating the database: %w", err)
+	}
+	return db, nil
+}
+
+// sqliteDriverはmattn/go-sqlite3の接続をsqliteConnで包みます。
+type sqliteDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// sqliteConnはクエリをrebindSQLiteで書き換えてから実行し、引数と結果の型をSQLiteに合わせます。
+type sqliteConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.SQLiteConn.Prepare(rebindSQLite(query))
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.SQLiteConn.PrepareContext(ctx, rebindSQLite(query))
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.SQLiteConn.ExecContext(ctx, rebindSQLite(query), args)
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.SQLiteConn.QueryContext(ctx, rebindSQLite(query), args)
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteRows(rows.(*sqlite3.SQLiteRows)), nil
+}
+
+// CheckNamedValueは= ANY($1)などに渡すスライスをJSONの配列にし、日時をsqliteTimeLayoutの文字列にします。
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v := reflect.ValueOf(nv.Value); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		b, err := json.Marshal(nv.Value)
+		if err != nil {
+			return err
+		}
+		if v.IsNil() {
+			b = []byte("[]")
+		}
+		nv.Value = string(b)
+		return nil
+	}
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC().Format(sqliteTimeLayout)
+	}
+	nv.Value = value
+	return nil
+}
+
+// sqliteRowsは式の結果の列（宣言された型が無いのでドライバが文字列のまま返す）の日時をtime.Timeにします。
+// テーブルの列はTIMESTAMPで宣言しているので、ドライバがtime.Timeにします。
+type sqliteRows struct {
+	*sqlite3.SQLiteRows
+	untyped []bool
+}
+
+func newSQLiteRows(rows *sqlite3.SQLiteRows) *sqliteRows {
+	untyped := make([]bool, len(rows.Columns()))
+	for i := range untyped {
+		untyped[i] = rows.ColumnTypeDatabaseTypeName(i) == ""
+	}
+	return &sqliteRows{SQLiteRows: rows, untyped: untyped}
+}
+
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	if err := r.SQLiteRows.Next(dest); err != nil {
+		return err
+	}
+	for i, v := range dest {
+		if s, ok := v.(string); ok && r.untyped[i] && sqliteTimestamp.MatchString(s) {
+			if t, err := time.ParseInLocation(sqliteTimeLayout, s, time.UTC); err == nil {
+				dest[i] = t
+			}
+		}
+	}
+	return nil
+}
+
+// isSQLiteはdbがDB_DRIVER=sqliteで開いたDBならtrueを返します。
+func isSQLite(db *sql.DB) bool {
+	_, ok := db.Driver().(*sqliteDriver)
+	return ok
+}
+
+// translateSQLiteErrorはSQLiteのエラーをtranslateDBErrorと同じドメインエラーに変換します。
+// 変換しないエラーならokはfalseです。
+func translateSQLiteError(err error) (translated error, ok bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err, false
+	}
+	switch {
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+		return &ConflictError{Constraint: sqliteConstraintName(sqliteErr.Error()), Err: err}, true
+	case sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked:
+		return fmt.Errorf("%w: %w", ErrUnavailable, err), true
+	}
+	return err, false
+}
+
+// isSQLiteNoSuchTableはテーブルが無いことによるSQLiteのエラーならtrueを返します。
+func isSQLiteNoSuchTable(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrError && sqliteNoSuchTable.MatchString(sqliteErr.Error())
+}
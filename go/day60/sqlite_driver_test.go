@@ -0,0 +1,103 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateSQLiteError(t *testing.T) {
+	assert.ErrorIs(t, translateDBError(sqlite3.Error{Code: sqlite3.ErrBusy}), ErrUnavailable)
+
+	// SQLiteのエラーも同じ制約名のConflictErrorになる
+	var conflict *ConflictError
+	db, err := openSQLite(filepath.Join(t.TempDir(), "todo.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+		INSERT INTO users (id, email, password_hash) VALUES (1, 'a@example.com', 'x');
+		INSERT INTO lists (id, name, owner_id, is_personal) VALUES (1, 'Personal', 1, TRUE);
+		INSERT INTO tags (user_id, name) VALUES (1, 'work');
+		INSERT INTO todos (name, user_id, list_id, deleted_at) VALUES ('trashed', 1, 1, $1)`, time.Now())
+	if !assert.NoError(t, err) {
+		return
+	}
+	for query, want := range map[string]string{
+		"INSERT INTO users (email, password_hash) VALUES ('a@example.com', 'x')":       "users_email_key",
+		"INSERT INTO tags (user_id, name) VALUES (1, 'work')":                          "tags_user_id_name_unique",
+		"INSERT INTO lists (name, owner_id, is_personal) VALUES ('Personal', 1, TRUE)": "lists_personal_unique",
+	} {
+		_, err := db.Exec(query)
+		if assert.ErrorAs(t, translateDBError(err), &conflict, query) {
+			assert.Equal(t, want, conflict.Constraint, query)
+		}
+	}
+	// ゴミ箱のTODOと同じ名前は部分ユニークインデックスに含まれないので作れる
+	_, err = db.Exec("INSERT INTO todos (name, user_id, list_id) VALUES ('trashed', 1, 1)")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO todos (name, user_id, list_id) VALUES ('trashed', 1, 1)")
+	if assert.ErrorAs(t, translateDBError(err), &conflict) {
+		assert.Equal(t, "todos_name_unique", conflict.Constraint)
+	}
+	_, err = db.Exec("INSERT INTO todos (name, user_id, list_id) VALUES ('no list', 1, 99)")
+	assert.False(t, errors.As(translateDBError(err), &conflict), "foreign key violations are not conflicts")
+}
+
+// TestSQLiteMigrationsMatchPostgresは、SQLite用のマイグレーションがdb/migrationsと同じテーブル・列・NOT NULLになることを確かめます。
+// 型・既定値・インデックスは書き方がDBごとに違うので比べません。
+func TestSQLiteMigrationsMatchPostgres(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	lite, err := openSQLite(filepath.Join(t.TempDir(), "schema.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer lite.Close()
+
+	want, err := schemaColumns(ctx, newTestDB(t))
+	assert.NoError(t, err)
+	got, err := schemaColumns(ctx, lite)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+// schemaColumnsはDBのテーブルの列を"テーブル.列"をキーに、NOT NULLかどうかを値にして返します。
+// SQLiteの主キーの列はNULLを禁止と表示されないことがあるので、NOT NULLとして扱います（PostgreSQLでは常にNOT NULL）。
+func schemaColumns(ctx context.Context, db *sql.DB) (map[string]bool, error) {
+	query := `
+		SELECT c.table_name, c.column_name, c.is_nullable = 'NO'
+		FROM information_schema.columns c
+		JOIN information_schema.tables tb ON tb.table_schema = c.table_schema AND tb.table_name = c.table_name
+		WHERE c.table_schema = current_schema() AND tb.table_type = 'BASE TABLE'`
+	if isSQLite(db) {
+		query = `
+			SELECT m.name, c.name, c."notnull" OR c.pk > 0
+			FROM sqlite_master m JOIN pragma_table_info(m.name) c
+			WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'`
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := map[string]bool{}
+	for rows.Next() {
+		var table, column string
+		var notNull bool
+		if err := rows.Scan(&table, &column, &notNull); err != nil {
+			return nil, err
+		}
+		columns[table+"."+column] = notNull
+	}
+	return columns, rows.Err()
+}
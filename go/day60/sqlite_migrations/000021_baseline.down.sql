@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS comment_mentions;
+DROP TABLE IF EXISTS comment_revisions;
+DROP TABLE IF EXISTS comments;
+DROP TRIGGER IF EXISTS attachments_enqueue_blob_deletion;
+DROP TABLE IF EXISTS blob_deletions;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS reminders;
+DROP TABLE IF EXISTS todo_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS todo_audit_logs;
+DROP TABLE IF EXISTS todos;
+DROP TABLE IF EXISTS todo_series;
+DROP TABLE IF EXISTS list_invitations;
+DROP TABLE IF EXISTS list_members;
+DROP TABLE IF EXISTS lists;
+DROP TABLE IF EXISTS users;
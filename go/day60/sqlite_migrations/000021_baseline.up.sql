@@ -0,0 +1,240 @@
+-- SQLite用のスキーマ（DB_DRIVER=sqlite）。db/migrationsの000001から000021までを適用したPostgreSQLのスキーマと同じ形にする
+-- db/migrationsにマイグレーションを足したら、同じバージョンのマイグレーションをここにも足すこと
+--
+-- PostgreSQLとの違い
+--   - SERIALはINTEGER PRIMARY KEY AUTOINCREMENT、JSONBとTEXT[]はJSONのTEXT、UUIDはTEXT
+--   - 日時はTIMESTAMPと宣言し、UTCの文字列で保存する（ドライバがtime.Timeに変換する）
+--   - blob_deletionsへの積み込みはplpgsqlの関数ではなくトリガーの本体に書く
+
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    deletion_requested_at TIMESTAMP,
+    deletion_scheduled_at TIMESTAMP
+);
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+CREATE TABLE lists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    is_personal BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+CREATE UNIQUE INDEX lists_personal_unique ON lists(owner_id) WHERE is_personal;
+
+CREATE TABLE list_members (
+    list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    PRIMARY KEY (list_id, user_id)
+);
+CREATE INDEX idx_list_members_user_id ON list_members(user_id);
+
+CREATE TABLE list_invitations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    invited_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    CONSTRAINT list_invitations_list_id_email_unique UNIQUE (list_id, email)
+);
+CREATE INDEX idx_list_invitations_email ON list_invitations(email);
+
+CREATE TABLE todo_series (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    timezone VARCHAR(64) NOT NULL,
+    dtstart TIMESTAMP NOT NULL,
+    last_due_at TIMESTAMP NOT NULL,
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+CREATE INDEX idx_todo_series_active_last_due_at ON todo_series(last_due_at) WHERE active;
+
+CREATE TABLE todos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT,
+    user_id INTEGER,
+    list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    due_at TIMESTAMP,
+    series_id INTEGER REFERENCES todo_series(id) ON DELETE SET NULL,
+    deleted_at TIMESTAMP,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT todos_parent_not_self CHECK (parent_id <> id)
+);
+CREATE INDEX idx_todos_name ON todos(name);
+CREATE UNIQUE INDEX todos_name_unique ON todos(name) WHERE deleted_at IS NULL;
+CREATE INDEX idx_todos_list_id ON todos(list_id);
+CREATE INDEX idx_todos_parent_id ON todos(parent_id);
+CREATE UNIQUE INDEX todos_series_id_due_at_unique ON todos(series_id, due_at) WHERE series_id IS NOT NULL;
+CREATE INDEX idx_todos_deleted_at ON todos(deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE todo_audit_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL,
+    operation VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    details TEXT
+);
+
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    CONSTRAINT tags_user_id_name_unique UNIQUE (user_id, name)
+);
+
+CREATE TABLE todo_tags (
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+CREATE INDEX idx_todo_tags_tag_id ON todo_tags(tag_id);
+
+CREATE TABLE reminders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    remind_at TIMESTAMP NOT NULL,
+    offset_minutes INTEGER CHECK (offset_minutes >= 0),
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dismissed', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+CREATE INDEX idx_reminders_pending_remind_at ON reminders(remind_at) WHERE status = 'pending';
+CREATE INDEX idx_reminders_todo_id ON reminders(todo_id);
+
+CREATE TABLE attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes >= 0),
+    blob_key TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+CREATE INDEX idx_attachments_todo_id ON attachments(todo_id);
+CREATE INDEX idx_attachments_user_id ON attachments(user_id);
+
+CREATE TABLE blob_deletions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    blob_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+-- 外部キーのON DELETE CASCADEで消えた行でもトリガーは動く
+CREATE TRIGGER attachments_enqueue_blob_deletion
+AFTER DELETE ON attachments
+FOR EACH ROW
+BEGIN
+    INSERT INTO blob_deletions (blob_key) VALUES (OLD.blob_key);
+END;
+
+CREATE TABLE comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    edited_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+CREATE INDEX idx_comments_todo_id ON comments(todo_id);
+CREATE INDEX idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX idx_comments_user_id ON comments(user_id);
+
+CREATE TABLE comment_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_comment_revisions_comment_id ON comment_revisions(comment_id);
+
+CREATE TABLE comment_mentions (
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    PRIMARY KEY (comment_id, user_id)
+);
+CREATE INDEX idx_comment_mentions_user_id ON comment_mentions(user_id);
+
+CREATE TABLE personal_access_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    -- JSONの文字列の配列
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
+
+CREATE TABLE user_identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    last_login_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    CONSTRAINT user_identities_provider_subject_unique UNIQUE (provider, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+CREATE TABLE user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE TABLE user_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    CONSTRAINT user_recovery_codes_user_id_code_hash_unique UNIQUE (user_id, code_hash)
+);
+
+CREATE TABLE sessions (
+    -- UUIDの文字列
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    refresh_token_hash CHAR(64)
+);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_revoked ON sessions(expires_at) WHERE revoked_at IS NOT NULL;
+CREATE UNIQUE INDEX idx_sessions_refresh_token_hash ON sessions(refresh_token_hash) WHERE refresh_token_hash IS NOT NULL;
@@ -0,0 +1,19 @@
+CREATE TABLE sessions_new (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    refresh_token_hash CHAR(64)
+);
+INSERT INTO sessions_new (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, refresh_token_hash)
+SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, refresh_token_hash FROM sessions
+WHERE user_id IS NOT NULL;
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_revoked ON sessions(expires_at) WHERE revoked_at IS NOT NULL;
+CREATE UNIQUE INDEX idx_sessions_refresh_token_hash ON sessions(refresh_token_hash) WHERE refresh_token_hash IS NOT NULL;
@@ -0,0 +1,21 @@
+-- db/migrations/000022と同じ変更。SQLiteは外部キーを変えられないので、テーブルを作り直す
+CREATE TABLE sessions_new (
+    -- UUIDの文字列
+    id TEXT PRIMARY KEY,
+    -- 削除したユーザーのセッションはNULLになり、取り消したまま期限まで残る
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    refresh_token_hash CHAR(64)
+);
+INSERT INTO sessions_new (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, refresh_token_hash)
+SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, refresh_token_hash FROM sessions;
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_revoked ON sessions(expires_at) WHERE revoked_at IS NOT NULL;
+CREATE UNIQUE INDEX idx_sessions_refresh_token_hash ON sessions(refresh_token_hash) WHERE refresh_token_hash IS NOT NULL;
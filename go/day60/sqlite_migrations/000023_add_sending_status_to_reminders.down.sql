@@ -0,0 +1,19 @@
+CREATE TABLE reminders_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    remind_at TIMESTAMP NOT NULL,
+    offset_minutes INTEGER CHECK (offset_minutes >= 0),
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dismissed', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+INSERT INTO reminders_new (id, todo_id, user_id, remind_at, offset_minutes, status, attempts, last_error, sent_at, created_at)
+SELECT id, todo_id, user_id, remind_at, offset_minutes, CASE status WHEN 'sending' THEN 'pending' ELSE status END,
+    attempts, last_error, sent_at, created_at FROM reminders;
+DROP TABLE reminders;
+ALTER TABLE reminders_new RENAME TO reminders;
+CREATE INDEX idx_reminders_pending_remind_at ON reminders(remind_at) WHERE status = 'pending';
+CREATE INDEX idx_reminders_todo_id ON reminders(todo_id);
@@ -0,0 +1,29 @@
+//go:build !cgo
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// cgoを無効にしたビルド（CGO_ENABLED=0の静的バイナリ）にはmattn/go-sqlite3が入らないので、DB_DRIVER=sqliteは使えません。
+// PostgreSQLだけで動かすバイナリのために、sqlite_driver.goと同じ関数をSQLiteを使わない形で用意します。
+
+var errSQLiteUnavailable = errors.New("DB_DRIVER=sqlite is not available: this binary was built without cgo (rebuild with CGO_ENABLED=1)")
+
+func openSQLite(path string) (*sql.DB, error) {
+	return nil, errSQLiteUnavailable
+}
+
+func isSQLite(db *sql.DB) bool {
+	return false
+}
+
+func translateSQLiteError(err error) (error, bool) {
+	return err, false
+}
+
+func isSQLiteNoSuchTable(err error) bool {
+	return false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagHandler struct {
+	repo *TodoRepository
+}
+
+func NewTagHandler(repo *TodoRepository) *TagHandler {
+	return &TagHandler{repo: repo}
+}
+
+func (h *TagHandler) getTags(c *gin.Context) error {
+	tags, err := h.repo.FindTagsByUser(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, tags)
+	return nil
+}
+
+func (h *TagHandler) createTag(c *gin.Context) error {
+	var tag Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		return err
+	}
+	tag.UserID = currentUserID(c)
+
+	createdTag, err := h.repo.CreateTag(c.Request.Context(), tag)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, createdTag)
+	return nil
+}
+
+func (h *TagHandler) updateTag(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var tag Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		return err
+	}
+	tag.ID = id
+	tag.UserID = currentUserID(c)
+
+	updatedTag, err := h.repo.RenameTag(c.Request.Context(), tag)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, updatedTag)
+	return nil
+}
+
+func (h *TagHandler) deleteTag(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DeleteTag(c.Request.Context(), currentUserID(c), id); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (h *TagHandler) attachTag(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	tagID, err := idParam(c, "tagId")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.AttachTag(c.Request.Context(), currentUserID(c), todoID, tagID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (h *TagHandler) detachTag(c *gin.Context) error {
+	todoID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	tagID, err := idParam(c, "tagId")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DetachTag(c.Request.Context(), currentUserID(c), todoID, tagID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
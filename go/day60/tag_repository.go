@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// タグ絞り込みのモード
+const (
+	TagMatchAny = "any" // 指定タグのいずれかが付いているTODO
+	TagMatchAll = "all" // 指定タグがすべて付いているTODO
+)
+
+// TodoFilterはTODO一覧取得時の絞り込み条件です。
+type TodoFilter struct {
+	ListID    int // 0の場合はすべてのリスト
+	Tags      []string
+	TagMatch  string
+	IDs       []int // 空でなければこのIDのTODOだけ
+	ParentIDs []int // 空でなければこれらのTODOのサブタスクだけ
+	AfterID   int   // 0でなければこのIDより後のTODOだけ（ID順のページ分け）
+	Limit     int   // 0なら件数の上限なし
+}
+
+func (r *TodoRepository) FindTagsByUser(ctx context.Context, userID int) ([]Tag, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, user_id FROM tags WHERE user_id = $1 ORDER BY name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.UserID); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (r *TodoRepository) CreateTag(ctx context.Context, tag Tag) (Tag, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	err := r.db.QueryRowContext(ctx, "INSERT INTO tags (user_id, name) VALUES ($1, $2) RETURNING id", tag.UserID, tag.Name).Scan(&tag.ID)
+	return tag, err
+}
+
+// RenameTagはユーザー自身のタグ名を変更します。他ユーザーのタグはErrNotFoundになります。
+func (r *TodoRepository) RenameTag(ctx context.Context, tag Tag) (Tag, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	err := r.db.QueryRowContext(ctx, "UPDATE tags SET name = $1 WHERE id = $2 AND user_id = $3 RETURNING id",
+		tag.Name, tag.ID, tag.UserID).Scan(&tag.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tag, ErrNotFound
+	}
+	return tag, err
+}
+
+// DeleteTagはタグを削除します。todo_tagsの紐付けはON DELETE CASCADEで消えます。
+func (r *TodoRepository) DeleteTag(ctx context.Context, userID, tagID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, "DELETE FROM tags WHERE id = $1 AND user_id = $2", tagID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// AttachTagは閲覧できるTODOに自分のタグを付けます。
+// タグはユーザー個人のラベルなので、共有リストのviewerでも自分用のタグは付けられます。
+// すでに付いている場合は何もしません（冪等）。
+func (r *TodoRepository) AttachTag(ctx context.Context, userID, todoID, tagID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleViewer); err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO todo_tags (todo_id, tag_id)
+		SELECT $1, tg.id FROM tags tg WHERE tg.id = $2 AND tg.user_id = $3
+		ON CONFLICT (todo_id, tag_id) DO NOTHING`, todoID, tagID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	// 0件の場合は「既に付いている」か「自分のタグではない」のどちらかなので確認する
+	var exists bool
+	err = r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM tags WHERE id = $1 AND user_id = $2)", tagID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DetachTagはTODOから自分のタグを外します。
+func (r *TodoRepository) DetachTag(ctx context.Context, userID, todoID, tagID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err := requireTodoRole(ctx, r.db, todoID, userID, RoleViewer); err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM todo_tags
+		WHERE todo_id = $1 AND tag_id = $2 AND tag_id IN (SELECT id FROM tags WHERE user_id = $3)`,
+		todoID, tagID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// loadTagsはTODOのスライスに、userIDのユーザーのタグをまとめて読み込みます。
+// 共有リストのTODOでも、他のメンバーが付けたタグは含めません。
+// TODOごとにクエリを発行せず(N+1を避け)、1回のクエリで全TODO分を取得します。
+func (r *TodoRepository) loadTags(ctx context.Context, userID int, todos []Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	ids := make([]int, len(todos))
+	index := make(map[int]int, len(todos))
+	for i := range todos {
+		ids[i] = todos[i].ID
+		index[todos[i].ID] = i
+		todos[i].Tags = []Tag{}
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT tt.todo_id, tg.id, tg.name, tg.user_id
+		FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.todo_id = ANY($1) AND tg.user_id = $2
+		ORDER BY tg.name`, ids, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID int
+		var t Tag
+		if err := rows.Scan(&todoID, &t.ID, &t.Name, &t.UserID); err != nil {
+			return err
+		}
+		i := index[todoID]
+		todos[i].Tags = append(todos[i].Tags, t)
+	}
+	return rows.Err()
+}
+
+// tagFilterClauseはTodoFilterのタグ条件をWHERE句の断片に変換します。
+// argsには既存のプレースホルダ引数を渡し（$1はユーザーID）、追加した引数を含めて返します。
+func tagFilterClause(filter TodoFilter, args []any) (string, []any) {
+	names := uniqueStrings(filter.Tags)
+	if len(names) == 0 {
+		return "", args
+	}
+	args = append(args, names)
+	tagsArg := len(args)
+
+	if filter.TagMatch == TagMatchAll {
+		// 指定されたタグ名のうち、付いている種類数が指定数と一致するものだけを残す
+		args = append(args, len(names))
+		return fmt.Sprintf(` AND (SELECT COUNT(DISTINCT tg.name) FROM todo_tags tt
+			JOIN tags tg ON tg.id = tt.tag_id
+			WHERE tt.todo_id = todos.id AND tg.user_id = $1 AND tg.name = ANY($%d)) = $%d`, tagsArg, len(args)), args
+	}
+	return fmt.Sprintf(` AND EXISTS (SELECT 1 FROM todo_tags tt
+		JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.todo_id = todos.id AND tg.user_id = $1 AND tg.name = ANY($%d))`, tagsArg), args
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
+
+// requireAffectedは更新・削除で1件も対象がなかった場合にErrNotFoundを返します。
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// TodoEventはTODOの変更1件です。監査ログの1行を、変更されたTODOと一緒に返します（gRPCのWatchTodos用）。
+type TodoEvent struct {
+	ID        int
+	TodoID    int
+	Operation string
+	CreatedAt time.Time
+	// Todoは読み込んだ時点のTODO。ゴミ箱に入ったTODOではnilです
+	Todo *Todo
+}
+
+// LatestTodoEventIDは最新の監査ログのIDを返します。監査ログが無ければ0です。
+func (r *TodoRepository) LatestTodoEventID(ctx context.Context) (int, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var id int
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM todo_audit_logs").Scan(&id)
+	return id, err
+}
+
+// SettledTodoEventIDはlagより前に書かれた監査ログのうち、最大のIDを返します。無ければ0です。
+//
+// IDは書き込んだときに決まりますが、行が見えるのはトランザクションのコミット後なので、小さいIDの行が後から見えることがあります。
+// トランザクションはDB_QUERY_TIMEOUTで打ち切られるので、lagをそれより十分長くすれば、このID以下の行はすべてコミット済みです。
+func (r *TodoRepository) SettledTodoEventID(ctx context.Context, lag time.Duration) (int, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var id int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(id), 0) FROM todo_audit_logs
+		WHERE created_at < `+r.dialect.AddMinutes("NOW()", "$1"), -int(lag/time.Minute)).Scan(&id)
+	return id, err
+}
+
+// FindTodoEventIDsはafterIDより後、upToID以下の監査ログのIDを返します。
+func (r *TodoRepository) FindTodoEventIDs(ctx context.Context, afterID, upToID int) ([]int, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT id FROM todo_audit_logs WHERE id > $1 AND id <= $2", afterID, upToID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FindTodoEventsはユーザーがメンバーのリストにあるTODOの変更を、afterIDより後から古い順にlimit件まで返します。
+// 物理削除されたTODOや、メンバーでなくなったリストのTODOの変更は含めません。
+func (r *TodoRepository) FindTodoEvents(ctx context.Context, userID, afterID, limit int) ([]TodoEvent, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.todo_id, a.operation, a.created_at
+		FROM todo_audit_logs a
+		JOIN todos ON todos.id = a.todo_id
+		WHERE a.id > $2 AND `+memberTodosCond+`
+		ORDER BY a.id
+		LIMIT $3`, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []TodoEvent
+	var ids []int
+	for rows.Next() {
+		var e TodoEvent
+		if err := rows.Scan(&e.ID, &e.TodoID, &e.Operation, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+		ids = append(ids, e.TodoID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return events, nil
+	}
+
+	// 変更後のTODOはまとめて読み込む（ゴミ箱のTODOはFindAllに含まれない）
+	todos, err := r.FindAll(ctx, userID, TodoFilter{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*Todo, len(todos))
+	for i := range todos {
+		byID[todos[i].ID] = &todos[i]
+	}
+	for i := range events {
+		events[i].Todo = byID[events[i].TodoID]
+	}
+	return events, nil
+}
@@ -0,0 +1,523 @@
+package todoctl
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: todoctl [--profile NAME] <command> [flags] [args]
+
+Commands:
+  login    --server URL --email EMAIL      ログインしてトークンを保存する（パスワードはTODOCTL_PASSWORDか標準入力）
+  logout                                   保存したトークンを消す
+  profile  ls | use NAME | rm NAME         プロファイルの一覧・既定の切り替え・削除
+  ls       [--status open|done|all] [--list ID] [--tag TAG]... [--all-tags] [--limit N] [-o table|json]
+  add      TITLE [--due TIME] [--list ID] [--parent ID] [--repeat RRULE]
+  done     ID...                           完了にする
+  edit     ID [--title TITLE] [--due TIME | --no-due]
+  rm       ID...                           ゴミ箱に入れる
+  export   [--format csv|json] [--list ID] [-f FILE]
+
+PROFILEは--profile、TODOCTL_PROFILE、profile useで選んだもの、defaultの順に決まります。
+TIMEはRFC 3339（2026-01-02T09:00:00+09:00）、2026-01-02 09:00、2026-01-02のいずれか（タイムゾーンが無ければローカル時刻）です。
+`
+
+// errUsageはコマンドの使い方の誤りです。Runは使い方を表示して終了コード2にします。
+var errUsage = errors.New("usage error")
+
+// Appはtodoctlの1回の実行です。テストでは設定ファイルの場所と入出力を差し替えます。
+type App struct {
+	ConfigPath string
+	Stdin      io.Reader
+	Stdout     io.Writer
+	Stderr     io.Writer
+	// Getenvは環境変数を読みます。nilならos.Getenvです
+	Getenv func(string) string
+	// HTTPClientはAPIへのリクエストに使います。nilなら既定のクライアントです
+	HTTPClient *http.Client
+
+	stdin *bufio.Reader
+}
+
+// Runはコマンドを実行し、終了コードを返します。
+func (a *App) Run(args []string) int {
+	err := a.run(args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		if err != errUsage {
+			fmt.Fprintf(a.Stderr, "todoctl: %v\n\n", err)
+		}
+		fmt.Fprint(a.Stderr, usage)
+		return 2
+	case errors.Is(err, ErrNotLoggedIn):
+		fmt.Fprintln(a.Stderr, "todoctl: not logged in (run: todoctl login)")
+		return 1
+	default:
+		fmt.Fprintf(a.Stderr, "todoctl: %v\n", err)
+		return 1
+	}
+}
+
+func (a *App) getenv(key string) string {
+	if a.Getenv != nil {
+		return a.Getenv(key)
+	}
+	return os.Getenv(key)
+}
+
+func (a *App) run(args []string) error {
+	global := flag.NewFlagSet("todoctl", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	profileName := global.String("profile", "", "")
+	if err := global.Parse(args); err != nil {
+		return errUsage
+	}
+	if global.NArg() == 0 {
+		return errUsage
+	}
+	if *profileName == "" {
+		*profileName = a.getenv("TODOCTL_PROFILE")
+	}
+	cfg, err := LoadConfig(a.ConfigPath)
+	if err != nil {
+		return err
+	}
+	cmd, rest := global.Arg(0), global.Args()[1:]
+
+	switch cmd {
+	case "login":
+		return a.login(cfg, *profileName, rest)
+	case "logout":
+		return a.logout(cfg, *profileName)
+	case "profile":
+		return a.profile(cfg, rest)
+	case "help":
+		fmt.Fprint(a.Stdout, usage)
+		return nil
+	}
+
+	name, p, ok := cfg.Profile(*profileName)
+	if !ok {
+		return fmt.Errorf("%w: profile %q", ErrNotLoggedIn, name)
+	}
+	client := NewClient(p, a.HTTPClient, cfg.Save)
+	switch cmd {
+	case "ls":
+		return a.list(client, rest)
+	case "add":
+		return a.add(client, rest)
+	case "done":
+		return a.complete(client, rest)
+	case "edit":
+		return a.edit(client, rest)
+	case "rm":
+		return a.remove(client, rest)
+	case "export":
+		return a.export(client, rest)
+	default:
+		return errUsage
+	}
+}
+
+// parseFlagsはフラグと位置引数が混ざった引数を読み、位置引数を返します（todoctl add 買い物 --due 2026-01-02 のように書ける）。
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// promptは標準入力から1行読みます。
+func (a *App) prompt(label string) (string, error) {
+	if a.stdin == nil {
+		a.stdin = bufio.NewReader(a.Stdin)
+	}
+	fmt.Fprint(a.Stderr, label)
+	line, err := a.stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("could not read %s: %w", strings.TrimSuffix(label, ": "), err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (a *App) login(cfg *Config, profileName string, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	server := fs.String("server", "", "")
+	email := fs.String("email", "", "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, p, ok := cfg.Profile(profileName)
+	if !ok {
+		p = &Profile{}
+	}
+	if *server != "" {
+		p.Server = *server
+	}
+	if *email != "" {
+		p.Email = *email
+	}
+	if p.Server == "" {
+		return fmt.Errorf("%w: --server is required for a new profile", errUsage)
+	}
+	var err error
+	if p.Email == "" {
+		if p.Email, err = a.prompt("Email: "); err != nil {
+			return err
+		}
+	}
+	password := a.getenv("TODOCTL_PASSWORD")
+	if password == "" {
+		if password, err = a.prompt("Password: "); err != nil {
+			return err
+		}
+	}
+
+	client := NewClient(p, a.HTTPClient, nil)
+	pair, err := client.Login(p.Email, password)
+	if err != nil {
+		return err
+	}
+	if pair.MFARequired {
+		code, err := a.prompt("2FA code: ")
+		if err != nil {
+			return err
+		}
+		if pair, err = client.LoginSecondFactor(pair.ChallengeToken, code); err != nil {
+			return err
+		}
+	}
+	p.Token, p.RefreshToken = pair.Token, pair.RefreshToken
+	cfg.Profiles[name] = p
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Logged in to %s as %s (profile %s)\n", p.Server, p.Email, name)
+	return nil
+}
+
+func (a *App) logout(cfg *Config, profileName string) error {
+	name, p, ok := cfg.Profile(profileName)
+	if !ok {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+	p.Token, p.RefreshToken = "", ""
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Logged out (profile %s)\n", name)
+	return nil
+}
+
+func (a *App) profile(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch {
+	case args[0] == "ls" && len(args) == 1:
+		current, _, _ := cfg.Profile("")
+		for _, name := range cfg.ProfileNames() {
+			p := cfg.Profiles[name]
+			mark := " "
+			if name == current {
+				mark = "*"
+			}
+			status := "logged out"
+			if p.Token != "" {
+				status = "logged in as " + p.Email
+			}
+			fmt.Fprintf(a.Stdout, "%s %s\t%s\t%s\n", mark, name, p.Server, status)
+		}
+		return nil
+	case args[0] == "use" && len(args) == 2:
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return fmt.Errorf("profile %q does not exist", args[1])
+		}
+		cfg.Current = args[1]
+		return cfg.Save()
+	case args[0] == "rm" && len(args) == 2:
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return fmt.Errorf("profile %q does not exist", args[1])
+		}
+		delete(cfg.Profiles, args[1])
+		if cfg.Current == args[1] {
+			cfg.Current = ""
+		}
+		return cfg.Save()
+	default:
+		return errUsage
+	}
+}
+
+// stringsFlagは繰り返し指定できるフラグです（--tag work --tag urgent）。
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+// Todoは/api/v2のTODOの表現です。
+type Todo struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Status     string     `json:"status"`
+	OwnerID    int        `json:"owner_id"`
+	ListID     int        `json:"list_id"`
+	ParentID   *int       `json:"parent_id"`
+	DueAt      *time.Time `json:"due_at"`
+	Recurrence *string    `json:"recurrence"`
+	Tags       []string   `json:"tags"`
+}
+
+type todoPage struct {
+	Items         []Todo `json:"items"`
+	NextPageToken string `json:"next_page_token"`
+}
+
+func (a *App) list(client *Client, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	status := fs.String("status", "open", "")
+	listID := fs.Int("list", 0, "")
+	var tags stringsFlag
+	fs.Var(&tags, "tag", "")
+	allTags := fs.Bool("all-tags", false, "")
+	limit := fs.Int("limit", 0, "")
+	output := fs.String("o", "table", "")
+	if positional, err := parseFlags(fs, args); err != nil || len(positional) > 0 {
+		return errUsage
+	}
+	if *status != "open" && *status != "done" && *status != "all" {
+		return fmt.Errorf("%w: --status must be open, done or all", errUsage)
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("%w: -o must be table or json", errUsage)
+	}
+
+	query := url.Values{}
+	if *listID != 0 {
+		query.Set("list_id", strconv.Itoa(*listID))
+	}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	if *allTags {
+		query.Set("tag_match", "all")
+	}
+	query.Set("page_size", "200")
+	// APIには状態の絞り込みが無いので、全ページを読みながら絞り込む
+	todos := []Todo{}
+	for {
+		var page todoPage
+		if err := client.Do(http.MethodGet, "/api/v2/todos?"+query.Encode(), nil, &page); err != nil {
+			return err
+		}
+		for _, t := range page.Items {
+			if *status == "all" || t.Status == *status {
+				todos = append(todos, t)
+			}
+		}
+		if page.NextPageToken == "" || (*limit > 0 && len(todos) >= *limit) {
+			break
+		}
+		query.Set("page_token", page.NextPageToken)
+	}
+	if *limit > 0 && len(todos) > *limit {
+		todos = todos[:*limit]
+	}
+	if *output == "json" {
+		return writeJSON(a.Stdout, todos)
+	}
+	return writeTable(a.Stdout, todos, time.Local)
+}
+
+// parseTimeはコマンドラインの日時を読み取ります。タイムゾーンが無ければlocの時刻です。
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid time %q", errUsage, value)
+}
+
+// parseIDsはTODOのIDの引数を読み取ります。#12のように#を付けてもかまいません。
+func parseIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, errUsage
+	}
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("%w: invalid id %q", errUsage, arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (a *App) add(client *Client, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	due := fs.String("due", "", "")
+	listID := fs.Int("list", 0, "")
+	parentID := fs.Int("parent", 0, "")
+	repeat := fs.String("repeat", "", "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return errUsage
+	}
+	body := map[string]any{"title": strings.Join(positional, " ")}
+	if *due != "" {
+		t, err := parseTime(*due, time.Local)
+		if err != nil {
+			return err
+		}
+		body["due_at"] = t
+	}
+	if *listID != 0 {
+		body["list_id"] = *listID
+	}
+	if *parentID != 0 {
+		body["parent_id"] = *parentID
+	}
+	if *repeat != "" {
+		body["recurrence"] = *repeat
+	}
+	var created Todo
+	if err := client.Do(http.MethodPost, "/api/v2/todos", body, &created); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Created #%d %s\n", created.ID, created.Title)
+	return nil
+}
+
+func (a *App) complete(client *Client, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := client.Do(http.MethodPost, fmt.Sprintf("/api/v1/todos/%d/complete", id), nil, nil); err != nil {
+			return fmt.Errorf("#%d: %w", id, err)
+		}
+		fmt.Fprintf(a.Stdout, "Completed #%d\n", id)
+	}
+	return nil
+}
+
+func (a *App) edit(client *Client, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	title := fs.String("title", "", "")
+	due := fs.String("due", "", "")
+	noDue := fs.Bool("no-due", false, "")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	ids, err := parseIDs(positional)
+	if err != nil || len(ids) != 1 || (*due != "" && *noDue) {
+		return errUsage
+	}
+	path := fmt.Sprintf("/api/v2/todos/%d", ids[0])
+
+	// PUTは期限を省略すると期限を外すので、変えない項目は今の値を送る
+	var todo Todo
+	if err := client.Do(http.MethodGet, path, nil, &todo); err != nil {
+		return err
+	}
+	if *title != "" {
+		todo.Title = *title
+	}
+	switch {
+	case *noDue:
+		todo.DueAt = nil
+	case *due != "":
+		t, err := parseTime(*due, time.Local)
+		if err != nil {
+			return err
+		}
+		todo.DueAt = &t
+	}
+	var updated Todo
+	if err := client.Do(http.MethodPut, path, map[string]any{"title": todo.Title, "due_at": todo.DueAt}, &updated); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Updated #%d %s\n", updated.ID, updated.Title)
+	return nil
+}
+
+func (a *App) remove(client *Client, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := client.Do(http.MethodDelete, fmt.Sprintf("/api/v2/todos/%d", id), nil, nil); err != nil {
+			return fmt.Errorf("#%d: %w", id, err)
+		}
+		fmt.Fprintf(a.Stdout, "Moved #%d to trash\n", id)
+	}
+	return nil
+}
+
+func (a *App) export(client *Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "")
+	listID := fs.Int("list", 0, "")
+	file := fs.String("f", "", "")
+	if positional, err := parseFlags(fs, args); err != nil || len(positional) > 0 {
+		return errUsage
+	}
+	query := url.Values{"format": {*format}}
+	if *listID != 0 {
+		query.Set("list_id", strconv.Itoa(*listID))
+	}
+	path := "/api/v1/todos/export?" + query.Encode()
+	if *file == "" {
+		return client.Do(http.MethodGet, path, nil, a.Stdout)
+	}
+	// 書き出しに失敗したときに中途半端なファイルを残さないよう、一時ファイルに書いてから置き換える
+	f, err := os.CreateTemp(filepath.Dir(*file), ".todoctl-export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := client.Do(http.MethodGet, path, nil, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), *file); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stderr, "Exported to %s\n", *file)
+	return nil
+}
@@ -0,0 +1,162 @@
+package todoctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotLoggedInはプロファイルにトークンが無いか、リフレッシュもできなくなったときのエラーです。
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// APIErrorはAPIが返したエラーレスポンスです。
+type APIError struct {
+	Status  int
+	Kind    string `json:"error"`
+	Message string `json:"message"`
+	Details string `json:"details"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, e.Kind)
+	if e.Kind == "" {
+		msg = fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	return msg
+}
+
+// Clientはプロファイルのトークンでリクエストを送るAPIクライアントです。
+// 401が返ったときはリフレッシュトークンで新しいトークンを取り直し、一度だけ送り直します。
+type Client struct {
+	profile *Profile
+	http    *http.Client
+	// onRefreshはトークンを取り直したときに呼ばれます（設定ファイルへの保存用）
+	onRefresh func() error
+}
+
+func NewClient(profile *Profile, httpClient *http.Client, onRefresh func() error) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{profile: profile, http: httpClient, onRefresh: onRefresh}
+}
+
+// TokenPairはログインとリフレッシュのレスポンスです。
+type TokenPair struct {
+	Token          string `json:"token"`
+	RefreshToken   string `json:"refresh_token"`
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// Loginはメールアドレスとパスワードでログインします。リフレッシュトークンも要求します。
+// 2要素認証が有効なユーザーならMFARequiredとChallengeTokenだけが返るので、LoginSecondFactorに続けます。
+func (c *Client) Login(email, password string) (TokenPair, error) {
+	var pair TokenPair
+	err := c.send(http.MethodPost, "/login", "", map[string]any{"email": email, "password": password, "remember": true}, &pair)
+	return pair, err
+}
+
+// LoginSecondFactorはLoginのチャレンジトークンとTOTPのコードを交換します。
+func (c *Client) LoginSecondFactor(challengeToken, code string) (TokenPair, error) {
+	var pair TokenPair
+	err := c.send(http.MethodPost, "/login/2fa", "", map[string]any{"challenge_token": challengeToken, "code": code, "remember": true}, &pair)
+	return pair, err
+}
+
+// refreshはリフレッシュトークンで新しいトークンを取り、プロファイルを更新します。
+func (c *Client) refresh() error {
+	if c.profile.RefreshToken == "" {
+		return ErrNotLoggedIn
+	}
+	var pair TokenPair
+	err := c.send(http.MethodPost, "/login/refresh", "", map[string]string{"refresh_token": c.profile.RefreshToken}, &pair)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+		// 期限切れか取り消し済み。使えないトークンは消しておく
+		c.profile.Token, c.profile.RefreshToken = "", ""
+		if c.onRefresh != nil {
+			c.onRefresh()
+		}
+		return ErrNotLoggedIn
+	}
+	if err != nil {
+		return err
+	}
+	c.profile.Token, c.profile.RefreshToken = pair.Token, pair.RefreshToken
+	if c.onRefresh != nil {
+		return c.onRefresh()
+	}
+	return nil
+}
+
+// Doは認証付きのリクエストを送り、レスポンスをoutに読み込みます（outについてはsendを参照）。
+func (c *Client) Do(method, path string, body, out any) error {
+	if c.profile.Token == "" {
+		return ErrNotLoggedIn
+	}
+	err := c.send(method, path, c.profile.Token, body, out)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		return err
+	}
+	if err := c.refresh(); err != nil {
+		return err
+	}
+	return c.send(method, path, c.profile.Token, body, out)
+}
+
+// sendはリクエストを1回送ります。outがio.Writerならボディをそのまま書き込み、それ以外ならJSONとして読み込みます。
+func (c *Client) send(method, path, token string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.profile.Server, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", "todoctl")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{Status: resp.StatusCode}
+		b, _ := io.ReadAll(resp.Body)
+		json.Unmarshal(b, apiErr)
+		return apiErr
+	}
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case io.Writer:
+		_, err := io.Copy(out, resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
@@ -0,0 +1,114 @@
+// Package todoctlはTODO APIのコマンドラインクライアントです。
+//
+// 接続先とトークンはプロファイルごとにユーザーの設定ディレクトリ（Linuxなら~/.config/todoctl/config.json）に保存します。
+// トークンを含むので、ファイルは所有者だけが読み書きできる権限（0600）で作ります。
+package todoctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DefaultProfileは--profileもTODOCTL_PROFILEも指定せず、既定のプロファイルも選んでいないときに使うプロファイルです。
+const DefaultProfile = "default"
+
+// Profileは1つの接続先とそのログイン情報です。
+type Profile struct {
+	Server       string `json:"server"`
+	Email        string `json:"email,omitempty"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// Configは設定ファイルの中身です。
+type Config struct {
+	// CurrentはPROFILEを指定しないときに使うプロファイル（todoctl profile useで選ぶ）
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+
+	path string
+}
+
+// DefaultConfigPathはユーザーの設定ディレクトリにある設定ファイルのパスを返します。
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "todoctl", "config.json"), nil
+}
+
+// LoadConfigは設定ファイルを読み込みます。ファイルが無ければ空の設定を返します。
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]*Profile{}, path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+// Saveは設定ファイルを書き込みます。途中で失敗しても元のファイルが壊れないように、一時ファイルに書いてから置き換えます。
+func (c *Config) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTempは0600で作るが、umaskや既存のファイルの権限に関係なく0600にしておく
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Profileは名前のプロファイルを返します。nameが空ならCurrent、それも空ならDefaultProfileです。
+func (c *Config) Profile(name string) (string, *Profile, bool) {
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	p, ok := c.Profiles[name]
+	return name, p, ok
+}
+
+// ProfileNamesはプロファイルの名前を名前順に返します。
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,69 @@
+package todoctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+)
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// displayWidthは端末で表示したときの文字列の幅です。全角の文字は2として数えます。
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// writeTableはTODOを表にして書き出します。期限はlocの時刻で表示します。
+// text/tabwriterは全角の文字を1文字として数えて列がずれるので、表示幅で揃えます。
+func writeTable(w io.Writer, todos []Todo, loc *time.Location) error {
+	rows := [][]string{{"ID", "STATUS", "DUE", "TITLE", "TAGS"}}
+	for _, t := range todos {
+		due := "-"
+		if t.DueAt != nil {
+			due = t.DueAt.In(loc).Format("2006-01-02 15:04")
+		}
+		title := t.Title
+		if t.Recurrence != nil {
+			// 繰り返しTODOには印を付ける
+			title += " ↻"
+		}
+		rows = append(rows, []string{strconv.Itoa(t.ID), t.Status, due, title, strings.Join(t.Tags, ",")})
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-displayWidth(cell)+2))
+			}
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line.String(), " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package todoctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todoctl", "config.json")
+	cfg, err := LoadConfig(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, cfg.Profiles)
+
+	cfg.Profiles["work"] = &Profile{Server: "https://todo.example.com", Email: "a@example.com", Token: "t", RefreshToken: "r"}
+	cfg.Current = "work"
+	if !assert.NoError(t, cfg.Save()) {
+		return
+	}
+	// トークンを含むので所有者だけが読める
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+	dir, err := os.Stat(filepath.Dir(path))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0o700), dir.Mode().Perm())
+	}
+
+	// 既存のファイルの権限が緩くても、保存し直すと0600になる
+	assert.NoError(t, os.Chmod(path, 0o644))
+	assert.NoError(t, cfg.Save())
+	info, _ = os.Stat(path)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	loaded, err := LoadConfig(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	name, p, ok := loaded.Profile("")
+	assert.True(t, ok)
+	assert.Equal(t, "work", name)
+	assert.Equal(t, *cfg.Profiles["work"], *p)
+	_, _, ok = loaded.Profile("home")
+	assert.False(t, ok)
+}
+
+func TestParseTime(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"2026-01-02T09:00:00Z", time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"2026-01-02 09:30", time.Date(2026, 1, 2, 9, 30, 0, 0, jst)},
+		{"2026-01-02T09:30", time.Date(2026, 1, 2, 9, 30, 0, 0, jst)},
+		{"2026-01-02", time.Date(2026, 1, 2, 0, 0, 0, 0, jst)},
+	} {
+		got, err := parseTime(tt.in, jst)
+		assert.NoError(t, err, tt.in)
+		assert.True(t, tt.want.Equal(got), "%s: %v", tt.in, got)
+	}
+	_, err := parseTime("tomorrow", jst)
+	assert.ErrorIs(t, err, errUsage)
+}
+
+func TestWriteTable(t *testing.T) {
+	due := time.Date(2026, 1, 2, 0, 30, 0, 0, time.UTC)
+	rule := "FREQ=DAILY"
+	var buf bytes.Buffer
+	err := writeTable(&buf, []Todo{
+		{ID: 1, Title: "牛乳を買う", Status: "open", DueAt: &due, Tags: []string{"home", "errands"}},
+		{ID: 12, Title: "日報", Status: "done", Recurrence: &rule, Tags: []string{}},
+	}, time.FixedZone("JST", 9*60*60))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"ID  STATUS  DUE               TITLE       TAGS",
+		"1   open    2026-01-02 09:30  牛乳を買う  home,errands",
+		"12  done    -                 日報 ↻",
+		"",
+	}, "\n"), buf.String())
+}
+
+// newFakeServerは、トークンaccess-2だけを受け付け、リフレッシュトークンrefresh-1をaccess-2とrefresh-2に交換するサーバーです。
+func newFakeServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/refresh", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.RefreshToken != "refresh-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Unauthorized","message":"refresh token is invalid or expired"}`))
+			return
+		}
+		w.Write([]byte(`{"token":"access-2","refresh_token":"refresh-2"}`))
+	})
+	mux.HandleFunc("GET /api/v2/todos", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"items":[{"id":1,"title":"a","status":"open","tags":[]},{"id":2,"title":"b","status":"done","tags":[]}]}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+	server := newFakeServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg, _ := LoadConfig(path)
+	cfg.Profiles[DefaultProfile] = &Profile{Server: server.URL, Token: "access-1", RefreshToken: "refresh-1"}
+	assert.NoError(t, cfg.Save())
+
+	var stdout, stderr bytes.Buffer
+	app := &App{ConfigPath: path, Stdout: &stdout, Stderr: &stderr}
+	// 期限切れのトークンで401になったら、リフレッシュして送り直す
+	assert.Equal(t, 0, app.Run([]string{"ls", "-o", "json", "--status", "all"}))
+	var todos []Todo
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &todos))
+	assert.Len(t, todos, 2)
+
+	// 新しいトークンは設定ファイルに保存される
+	saved, _ := LoadConfig(path)
+	assert.Equal(t, "access-2", saved.Profiles[DefaultProfile].Token)
+	assert.Equal(t, "refresh-2", saved.Profiles[DefaultProfile].RefreshToken)
+
+	// リフレッシュトークンも使えなければ、トークンを消して再ログインを促す
+	saved.Profiles[DefaultProfile].Token = "access-1"
+	assert.NoError(t, saved.Save())
+	stderr.Reset()
+	assert.Equal(t, 1, app.Run([]string{"ls"}))
+	assert.Contains(t, stderr.String(), "not logged in")
+	saved, _ = LoadConfig(path)
+	assert.Empty(t, saved.Profiles[DefaultProfile].Token)
+	assert.Empty(t, saved.Profiles[DefaultProfile].RefreshToken)
+}
+
+func TestProfiles(t *testing.T) {
+	server := newFakeServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg, _ := LoadConfig(path)
+	cfg.Profiles["work"] = &Profile{Server: server.URL, Email: "w@example.com", Token: "access-2"}
+	cfg.Profiles["home"] = &Profile{Server: "http://127.0.0.1:1", Email: "h@example.com"}
+	assert.NoError(t, cfg.Save())
+
+	var stdout, stderr bytes.Buffer
+	app := &App{ConfigPath: path, Stdout: &stdout, Stderr: &stderr, Getenv: func(string) string { return "" }}
+	assert.Equal(t, 0, app.Run([]string{"profile", "use", "work"}))
+	assert.Equal(t, 0, app.Run([]string{"profile", "ls"}))
+	assert.Equal(t, "  home\thttp://127.0.0.1:1\tlogged out\n* work\t"+server.URL+"\tlogged in as w@example.com\n", stdout.String())
+
+	// 既定のプロファイルはwork、--profileで切り替えられる
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"ls"}))
+	assert.Contains(t, stdout.String(), "a")
+	assert.NotContains(t, stdout.String(), "done")
+	assert.Equal(t, 1, app.Run([]string{"--profile", "home", "ls"}))
+	assert.Equal(t, 1, app.Run([]string{"--profile", "missing", "ls"}))
+
+	assert.Equal(t, 2, app.Run([]string{"profile"}))
+	assert.Equal(t, 1, app.Run([]string{"profile", "use", "missing"}))
+	assert.Equal(t, 0, app.Run([]string{"profile", "rm", "work"}))
+	saved, _ := LoadConfig(path)
+	assert.Empty(t, saved.Current)
+	assert.Equal(t, []string{"home"}, saved.ProfileNames())
+}
+
+func TestUsageErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"login"},
+		{"ls", "--status", "later"},
+		{"done"},
+		{"done", "abc"},
+		{"edit", "1", "--due", "2026-01-02", "--no-due"},
+	} {
+		var stderr bytes.Buffer
+		app := &App{ConfigPath: path, Stdout: &bytes.Buffer{}, Stderr: &stderr, Getenv: func(string) string { return "" }}
+		cfg, _ := LoadConfig(path)
+		cfg.Profiles[DefaultProfile] = &Profile{Server: "http://127.0.0.1:1", Token: "t"}
+		cfg.Save()
+		if len(args) > 0 && args[0] == "login" {
+			// 新しいプロファイルには--serverが要る
+			os.Remove(path)
+		}
+		assert.Equal(t, 2, app.Run(args), "%v", args)
+		assert.Contains(t, stderr.String(), "Usage: todoctl")
+	}
+}
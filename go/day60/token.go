@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// パーソナルアクセストークンのスコープ
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+// tokenPrefixはパーソナルアクセストークンの先頭に付く文字列です。JWTと見分けるのに使います。
+const tokenPrefix = "tdp_"
+
+// tokenDisplayLenは一覧で見せるトークンの先頭部分の長さです（tokenPrefixを含む）。
+const tokenDisplayLen = 12
+
+var knownScopes = []string{ScopeTodosRead, ScopeTodosWrite}
+
+// PersonalAccessTokenはスクリプトやCLIから使うAPIトークンです。トークン本体は作成時に一度だけ返し、ハッシュだけを保存します。
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // トークンの先頭部分（どのトークンかを見分けるため）
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// generateTokenは新しいトークンを作り、トークン本体とそのハッシュを返します。
+func generateToken() (token, hash string, err error) {
+	return generateSecret(tokenPrefix)
+}
+
+// generateSecretはprefixで始まる推測できないトークンを作り、トークン本体とそのハッシュを返します。
+func generateSecret(prefix string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashTokenはトークンを保存・照合用のSHA-256（16進数）にします。
+// トークンは十分な乱数なので、パスワードと違ってbcryptのような遅いハッシュは要りません。
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isPersonalAccessTokenはBearerトークンがパーソナルアクセストークンの形式かを返します。
+func isPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, tokenPrefix)
+}
+
+// normalizeScopesはスコープを検証し、重複を除いて並べ替えたものを返します。
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidInput)
+	}
+	normalized := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !slices.Contains(knownScopes, s) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidInput, s)
+		}
+		if !slices.Contains(normalized, s) {
+			normalized = append(normalized, s)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenHandlerはログインユーザーのパーソナルアクセストークンを扱います。
+type TokenHandler struct {
+	repo *TodoRepository
+}
+
+func NewTokenHandler(repo *TodoRepository) *TokenHandler {
+	return &TokenHandler{repo: repo}
+}
+
+type CreateTokenInput struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"` // 省略時は無期限
+}
+
+// CreatedTokenは作成したトークンです。Tokenはこのレスポンスでしか返さないので、呼び出し側で控えてもらいます。
+type CreatedToken struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+func (h *TokenHandler) getTokens(c *gin.Context) error {
+	tokens, err := h.repo.FindTokens(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, tokens)
+	return nil
+}
+
+// createTokenはトークンを発行します。
+func (h *TokenHandler) createToken(c *gin.Context) error {
+	var input CreateTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	scopes, err := normalizeScopes(input.Scopes)
+	if err != nil {
+		return err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidInput)
+	}
+
+	token, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	created, err := h.repo.CreateToken(c.Request.Context(), currentUserID(c), input.Name, token[:tokenDisplayLen], hash, scopes, input.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, CreatedToken{PersonalAccessToken: created, Token: token})
+	return nil
+}
+
+// revokeTokenはトークンを取り消します。取り消したトークンではすぐに認証できなくなります。
+func (h *TokenHandler) revokeToken(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.RevokeToken(c.Request.Context(), currentUserID(c), id); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
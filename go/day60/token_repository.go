@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// tokenTouchIntervalはlast_used_atを更新する間隔です。リクエストのたびに書き込まないように間引きます。
+const tokenTouchInterval = time.Minute
+
+// tokenColumnsはトークンを読むクエリのSELECT句です。scanTokenと列の順番を合わせてください。
+const tokenColumns = "id, name, token_prefix, array_to_json(scopes), expires_at, last_used_at, created_at"
+
+func scanToken(row rowScanner) (PersonalAccessToken, error) {
+	var t PersonalAccessToken
+	var scopes []byte
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &expiresAt, &lastUsedAt, &t.CreatedAt); err != nil {
+		return t, err
+	}
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	err := json.Unmarshal(scopes, &t.Scopes)
+	return t, err
+}
+
+// CreateTokenはトークンのハッシュを保存し、作成したトークンの情報を返します。
+func (r *TodoRepository) CreateToken(ctx context.Context, userID int, name, prefix, hash string, scopes []string, expiresAt *time.Time) (PersonalAccessToken, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return scanToken(r.db.QueryRowContext(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5::text[], $6)
+		RETURNING `+tokenColumns, userID, name, prefix, hash, scopes, expiresAt))
+}
+
+// FindTokensはユーザーの取り消していないトークンを新しい順に返します。期限切れのものも含みます。
+func (r *TodoRepository) FindTokens(ctx context.Context, userID int) ([]PersonalAccessToken, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+tokenColumns+` FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeTokenはユーザーのトークンを取り消します。見つからないか取り消し済みならErrNotFoundです。
+func (r *TodoRepository) RevokeToken(ctx context.Context, userID, tokenID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE personal_access_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AuthenticateTokenはトークンのハッシュから認証済みのPrincipalを返します。
+// 見つからない・取り消し済み・期限切れのトークンはErrNotFoundです。
+func (r *TodoRepository) AuthenticateToken(ctx context.Context, hash string) (*Principal, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	p := &Principal{}
+	var scopes []byte
+	var lastUsedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, u.role, array_to_json(t.scopes), t.last_used_at
+		FROM personal_access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > NOW())`,
+		hash).Scan(&p.TokenID, &p.UserID, &p.Role, &scopes, &lastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &p.Scopes); err != nil {
+		return nil, err
+	}
+
+	if !lastUsedAt.Valid || time.Since(lastUsedAt.Time) >= tokenTouchInterval {
+		if _, err := r.db.ExecContext(ctx, "UPDATE personal_access_tokens SET last_used_at = NOW() WHERE id = $1", p.TokenID); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
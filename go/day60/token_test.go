@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, hash, err := generateToken()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, isPersonalAccessToken(token))
+	assert.Len(t, token, len(tokenPrefix)+43)
+	assert.Equal(t, hashToken(token), hash)
+	assert.Len(t, hash, 64)
+
+	other, _, err := generateToken()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEqual(t, token, other)
+	assert.False(t, isPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig"))
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := normalizeScopes([]string{"todos:write", "todos:read", "todos:write"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"todos:read", "todos:write"}, scopes)
+
+	_, err = normalizeScopes(nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = normalizeScopes([]string{"todos:read", "admin"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestTokenScopeMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(p *Principal) *gin.Engine {
+		r := gin.New()
+		v1 := r.Group("/api/v1")
+		v1.Use(func(c *gin.Context) { c.Set(principalKey, p) }, tokenScopeMiddleware())
+		ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+		v1.GET("/todos", ok)
+		v1.POST("/todos/:id/complete", ok)
+		v1.GET("/lists", ok)
+		v1.GET("/lists/:id/members", ok)
+		v1.GET("/me", ok)
+		v1.POST("/me/tokens", ok)
+		return r
+	}
+	do := func(r *gin.Engine, method, path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	session := newRouter(&Principal{UserID: 1, Role: "user"})
+	readOnly := newRouter(&Principal{UserID: 1, Role: "user", TokenID: 7, Scopes: []string{ScopeTodosRead}})
+	readWrite := newRouter(&Principal{UserID: 1, Role: "user", TokenID: 8, Scopes: []string{ScopeTodosRead, ScopeTodosWrite}})
+
+	cases := []struct {
+		router       *gin.Engine
+		method, path string
+		want         int
+	}{
+		{session, http.MethodPost, "/api/v1/me/tokens", http.StatusNoContent},
+		{session, http.MethodGet, "/api/v1/me", http.StatusNoContent},
+		{readOnly, http.MethodGet, "/api/v1/todos", http.StatusNoContent},
+		{readOnly, http.MethodPost, "/api/v1/todos/1/complete", http.StatusForbidden},
+		{readOnly, http.MethodGet, "/api/v1/lists", http.StatusNoContent},
+		{readWrite, http.MethodPost, "/api/v1/todos/1/complete", http.StatusNoContent},
+		// トークンではプロフィールやトークン管理、リストのメンバー管理は呼べない
+		{readWrite, http.MethodGet, "/api/v1/me", http.StatusForbidden},
+		{readWrite, http.MethodPost, "/api/v1/me/tokens", http.StatusForbidden},
+		{readWrite, http.MethodGet, "/api/v1/lists/1/members", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, do(tc.router, tc.method, tc.path), "%s %s", tc.method, tc.path)
+	}
+}
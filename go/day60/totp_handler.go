@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// loginChallengeTTLはパスワードを確かめてから2要素認証のコードを入力するまでの有効期間です。
+const loginChallengeTTL = 5 * time.Minute
+
+// loginChallengeAudienceはチャレンジトークンのaudです。同じ鍵で署名するアプリケーションのJWTとして使えないようにします。
+const loginChallengeAudience = "login-2fa"
+
+// defaultTOTPIssuerは認証アプリに表示するサービス名の既定値です。
+const defaultTOTPIssuer = "Todo App"
+
+// TwoFactorHandlerはTOTPによる2要素認証の登録と、ログインの2段階目を扱います。
+type TwoFactorHandler struct {
+	repo   *TodoRepository
+	issuer string
+}
+
+func NewTwoFactorHandler(repo *TodoRepository, issuer string) *TwoFactorHandler {
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	return &TwoFactorHandler{repo: repo, issuer: issuer}
+}
+
+// SecondFactorInputはTOTPのコードかリカバリーコードのどちらか一方です。
+type SecondFactorInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (in SecondFactorInput) validate() error {
+	if (in.Code == "") == (in.RecoveryCode == "") {
+		return fmt.Errorf("%w: exactly one of code or recovery_code is required", ErrInvalidInput)
+	}
+	return nil
+}
+
+type LoginSecondFactorInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	SecondFactorInput
+	// Rememberがtrueならリフレッシュトークンも返します
+	Remember bool `json:"remember"`
+}
+
+type ConfirmTOTPInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// issueLoginChallengeはパスワードを確かめたユーザーに、2要素認証のコードと交換するチャレンジトークンを発行します。
+func issueLoginChallenge(user User) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Subject:   fmt.Sprint(user.ID),
+		Audience:  jwt.ClaimStrings{loginChallengeAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(loginChallengeTTL)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+}
+
+// parseLoginChallengeはチャレンジトークンを検証してユーザーIDを返します。
+func parseLoginChallenge(tokenString string) (int, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience(loginChallengeAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, fmt.Errorf("%w: challenge token is invalid or expired", ErrUnauthenticated)
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, fmt.Errorf("%w: challenge token is invalid or expired", ErrUnauthenticated)
+	}
+	return userID, nil
+}
+
+// loginSecondFactorはチャレンジトークンとTOTPのコード（またはリカバリーコード）を確かめて、アプリケーションのJWTを返します。
+func (h *TwoFactorHandler) loginSecondFactor(c *gin.Context) error {
+	var input LoginSecondFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	client := ginSessionClient(c)
+	client.Remember = input.Remember
+	result, err := loginWithSecondFactor(c.Request.Context(), h.repo, input.ChallengeToken, input.SecondFactorInput, client)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, result.tokens())
+	return nil
+}
+
+// loginWithSecondFactorはチャレンジトークンと2要素目を確かめてセッションを始め、JWTを返します。RESTとgRPCのログインで共有します。
+func loginWithSecondFactor(ctx context.Context, repo *TodoRepository, challengeToken string, input SecondFactorInput, client SessionClient) (LoginResult, error) {
+	if err := input.validate(); err != nil {
+		return LoginResult{}, err
+	}
+	userID, err := parseLoginChallenge(challengeToken)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if err := repo.VerifySecondFactor(ctx, userID, input.Code, input.RecoveryCode); err != nil {
+		return LoginResult{}, err
+	}
+	user, err := repo.FindUserByID(ctx, userID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return startSession(ctx, repo, user, client)
+}
+
+func (h *TwoFactorHandler) getStatus(c *gin.Context) error {
+	status, err := h.repo.FindTwoFactorStatus(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, status)
+	return nil
+}
+
+// enrollは共有シークレットを作り、認証アプリに登録するotpauth://のURIを返します。confirmで確かめるまでは有効になりません。
+func (h *TwoFactorHandler) enroll(c *gin.Context) error {
+	user, err := h.repo.FindUserByID(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return err
+	}
+	if err := h.repo.StartTOTPEnrollment(c.Request.Context(), user.ID, secret); err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": totpURI(h.issuer, user.Email, secret)})
+	return nil
+}
+
+// newRecoveryCodesはリカバリーコードと、保存するそのハッシュを作ります。
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// confirmは認証アプリのコードを確かめて2要素認証を有効にし、リカバリーコードを返します。リカバリーコードはこのレスポンスでしか返しません。
+func (h *TwoFactorHandler) confirm(c *gin.Context) error {
+	var input ConfirmTOTPInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := h.repo.ConfirmTOTP(c.Request.Context(), currentUserID(c), input.Code, hashes); err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	return nil
+}
+
+// regenerateRecoveryCodesは現在のコードを確かめて、リカバリーコードを作り直します。
+func (h *TwoFactorHandler) regenerateRecoveryCodes(c *gin.Context) error {
+	var input SecondFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	userID := currentUserID(c)
+	ctx := c.Request.Context()
+	if err := h.repo.VerifySecondFactor(ctx, userID, input.Code, input.RecoveryCode); err != nil {
+		return err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := h.repo.RegenerateRecoveryCodes(ctx, userID, hashes); err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	return nil
+}
+
+// disableは現在のコードを確かめて、2要素認証を無効にします。
+func (h *TwoFactorHandler) disable(c *gin.Context) error {
+	var input SecondFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	userID := currentUserID(c)
+	ctx := c.Request.Context()
+	if err := h.repo.VerifySecondFactor(ctx, userID, input.Code, input.RecoveryCode); err != nil {
+		return err
+	}
+	if err := h.repo.DisableTOTP(ctx, userID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// adminResetは認証アプリもリカバリーコードも失くしたユーザーの2要素認証を、管理者が無効にします。
+func (h *TwoFactorHandler) adminReset(c *gin.Context) error {
+	userID, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.repo.DisableTOTP(c.Request.Context(), userID); err != nil {
+		return err
+	}
+	c.Status(http.StatusNoContent)
+	return nil
+}
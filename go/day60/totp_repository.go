@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 2要素認証のコードの入力を続けて間違えたときのロック
+const (
+	maxSecondFactorAttempts = 5
+	secondFactorLockout     = 15 * time.Minute
+)
+
+// TwoFactorStatusはユーザーの2要素認証の状態です。
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// StartTOTPEnrollmentは確認前の共有シークレットを保存します。確認前のものがあれば置き換えます。
+// 既に2要素認証が有効ならErrInvalidInputです。
+func (r *TodoRepository) StartTOTPEnrollment(ctx context.Context, userID int, secret string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL`, userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: two-factor authentication is already enabled", ErrInvalidInput)
+	}
+	return nil
+}
+
+// ConfirmTOTPは認証アプリのコードを確かめて2要素認証を有効にし、リカバリーコードのハッシュを保存します。
+// 登録を始めていなければErrNotFound、コードが違えばErrInvalidInputです。
+func (r *TodoRepository) ConfirmTOTP(ctx context.Context, userID int, code string, recoveryHashes []string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		var secret string
+		err := tx.QueryRowContext(ctx, "SELECT secret FROM user_totp WHERE user_id = $1 AND confirmed_at IS NULL FOR UPDATE", userID).Scan(&secret)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		step, ok := verifyTOTP(secret, code, time.Now(), 0)
+		if !ok {
+			return fmt.Errorf("%w: code is incorrect", ErrInvalidInput)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $1 WHERE user_id = $2", step, userID); err != nil {
+			return err
+		}
+		return r.replaceRecoveryCodes(ctx, tx, userID, recoveryHashes)
+	})
+}
+
+func (r *TodoRepository) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, hashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) SELECT $1, value FROM "+r.dialect.Elements("$2", "text"), userID, hashes)
+	return err
+}
+
+// TOTPEnabledはユーザーの2要素認証が有効（登録を確認済み）かを返します。
+func (r *TodoRepository) TOTPEnabled(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var enabled bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)", userID).Scan(&enabled)
+	return enabled, err
+}
+
+// FindTwoFactorStatusはユーザーの2要素認証の状態を返します。
+func (r *TodoRepository) FindTwoFactorStatus(ctx context.Context, userID int) (TwoFactorStatus, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var status TwoFactorStatus
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL),
+			(SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL)`,
+		userID).Scan(&status.Enabled, &status.RecoveryCodesRemaining)
+	return status, err
+}
+
+// VerifySecondFactorはTOTPのコードかリカバリーコード（使うと無効になる）を確かめます。
+// 間違いが続くとしばらくロックし、ロック中や間違ったコードはErrUnauthenticated、2要素認証が無効ならErrNotFoundです。
+func (r *TodoRepository) VerifySecondFactor(ctx context.Context, userID int, code, recoveryCode string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	// 失敗した回数は記録として残すので、間違いのときもトランザクションはコミットして後でエラーを返す
+	var failure error
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		var secret string
+		var lastStep int64
+		var lockedUntil sql.NullTime
+		err := tx.QueryRowContext(ctx, `
+			SELECT secret, last_used_step, locked_until FROM user_totp
+			WHERE user_id = $1 AND confirmed_at IS NOT NULL
+			FOR UPDATE`, userID).Scan(&secret, &lastStep, &lockedUntil)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: two-factor authentication is not enabled", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+			return fmt.Errorf("%w: too many failed attempts, try again later", ErrUnauthenticated)
+		}
+
+		ok := false
+		if code != "" {
+			var step int64
+			if step, ok = verifyTOTP(secret, code, now, lastStep); ok {
+				if _, err := tx.ExecContext(ctx, "UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2", step, userID); err != nil {
+					return err
+				}
+			}
+		} else if recoveryCode != "" {
+			result, err := tx.ExecContext(ctx, `
+				UPDATE user_recovery_codes SET used_at = NOW()
+				WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, hashRecoveryCode(recoveryCode))
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			ok = n > 0
+		}
+
+		if ok {
+			_, err = tx.ExecContext(ctx, "UPDATE user_totp SET failed_attempts = 0, locked_until = NULL WHERE user_id = $1", userID)
+			return err
+		}
+		failure = fmt.Errorf("%w: code is incorrect", ErrUnauthenticated)
+		_, err = tx.ExecContext(ctx, `
+			UPDATE user_totp SET
+				failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+				locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3::timestamptz ELSE locked_until END
+			WHERE user_id = $1`, userID, maxSecondFactorAttempts, now.Add(secondFactorLockout))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return failure
+}
+
+// RegenerateRecoveryCodesはリカバリーコードを作り直します。以前のコードは使えなくなります。
+func (r *TodoRepository) RegenerateRecoveryCodes(ctx context.Context, userID int, recoveryHashes []string) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		return r.replaceRecoveryCodes(ctx, tx, userID, recoveryHashes)
+	})
+}
+
+// DisableTOTPはユーザーの2要素認証の設定とリカバリーコードを削除します。設定が無ければErrNotFoundです。
+// 本人が無効にする場合も、認証アプリを失くしたユーザーを管理者がリセットする場合もこれを使います。
+func (r *TodoRepository) DisableTOTP(ctx context.Context, userID int) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+		return err
+	})
+}
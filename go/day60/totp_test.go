@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 付録BのSHA-1のテストベクタ（8桁の下6桁）
+	key := []byte("12345678901234567890")
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range cases {
+		assert.Equal(t, want, totpCode(key, totpStep(time.Unix(unix, 0))), "t=%d", unix)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	step, ok := verifyTOTP(secret, "050471", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now), step)
+
+	// 前後1ステップまでは時計のずれとして受け付ける
+	_, ok = verifyTOTP(secret, "050471", now.Add(totpPeriod*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = verifyTOTP(secret, "050471", now.Add(2*totpPeriod*time.Second), 0)
+	assert.False(t, ok)
+
+	// 使用済みのステップのコードは受け付けない
+	_, ok = verifyTOTP(secret, "050471", now, step)
+	assert.False(t, ok)
+	_, ok = verifyTOTP(secret, "000000", now, 0)
+	assert.False(t, ok)
+	_, ok = verifyTOTP(secret, "05047", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	u, err := url.Parse(totpURI("Todo App", "alice@example.com", secret))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Todo App:alice@example.com", u.Path)
+	assert.Equal(t, secret, u.Query().Get("secret"))
+	assert.Equal(t, "Todo App", u.Query().Get("issuer"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`, codes[0])
+	assert.NotEqual(t, codes[0], codes[1])
+
+	// 区切りや大文字小文字が違っても同じコードとして扱う
+	assert.Equal(t, hashRecoveryCode(codes[0]), hashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+}
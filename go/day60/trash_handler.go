@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getTrashはゴミ箱にあるTODOの一覧を返します。
+func (h *TodoHandler) getTrash(c *gin.Context) error {
+	todos, err := h.repo.FindTrash(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, todos)
+	return nil
+}
+
+// restoreTodoはゴミ箱のTODOをサブタスクごと元に戻します。
+func (h *TodoHandler) restoreTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	todo, err := h.repo.RestoreTodo(c.Request.Context(), currentUserID(c), id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, todo)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// purgeBatchSizeは1回のトランザクションで物理削除するTODOの数です。大量に溜まっていてもロックを長く持たないようにします。
+const purgeBatchSize = 500
+
+// blobDeleteBatchSizeは1回に読み出す削除待ちのBLOBの数です。
+const blobDeleteBatchSize = 100
+
+// TrashPurgerは保持期間を過ぎたゴミ箱のTODOを物理削除するバックグラウンド処理です。
+// 削除されたTODOの添付ファイルなど、削除待ちのBLOBもBlobStoreから削除します。
+type TrashPurger struct {
+	repo      *TodoRepository
+	blobs     BlobStore
+	retention time.Duration
+	interval  time.Duration
+	now       func() time.Time
+}
+
+func NewTrashPurger(repo *TodoRepository, blobs BlobStore, retention, interval time.Duration) *TrashPurger {
+	return &TrashPurger{
+		repo:      repo,
+		blobs:     blobs,
+		retention: retention,
+		interval:  interval,
+		now:       time.Now,
+	}
+}
+
+// Runはctxがキャンセルされるまでパージジョブを動かします。
+func (p *TrashPurger) Run(ctx context.Context) {
+	log.Printf("Trash purger started (retention: %s, interval: %s)", p.retention, p.interval)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Trash purger stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnceは保持期間を過ぎたTODOがなくなるまでバッチ単位で物理削除します。
+func (p *TrashPurger) runOnce(ctx context.Context) {
+	before := p.now().Add(-p.retention)
+	total := 0
+	for ctx.Err() == nil {
+		n, err := p.repo.PurgeTrash(ctx, before, purgeBatchSize)
+		if err != nil {
+			log.Printf("Trash purger: failed to purge todos: %v", err)
+			return
+		}
+		total += n
+		if n < purgeBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Trash purger: purged %d todos", total)
+	}
+	p.deleteBlobs(ctx)
+}
+
+// deleteBlobsは削除待ちのBLOBをBlobStoreから削除します。
+// 削除に失敗したBLOBは削除待ちに残し、次の実行で再試行します。
+func (p *TrashPurger) deleteBlobs(ctx context.Context) {
+	total := 0
+	for ctx.Err() == nil {
+		deletions, err := p.repo.FindBlobDeletions(ctx, blobDeleteBatchSize)
+		if err != nil {
+			log.Printf("Trash purger: failed to find blobs to delete: %v", err)
+			return
+		}
+		var done []int
+		for _, d := range deletions {
+			if err := p.blobs.Delete(ctx, d.Key); err != nil {
+				log.Printf("Trash purger: failed to delete blob %s: %v", d.Key, err)
+				continue
+			}
+			done = append(done, d.ID)
+		}
+		if len(done) > 0 {
+			if err := p.repo.CompleteBlobDeletions(ctx, done); err != nil {
+				log.Printf("Trash purger: failed to complete blob deletions: %v", err)
+				return
+			}
+		}
+		total += len(done)
+		// 全件失敗した場合に同じBLOBを繰り返さないよう、次の実行まで待つ
+		if len(deletions) < blobDeleteBatchSize || len(done) == 0 {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Trash purger: deleted %d blobs", total)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FindTrashはユーザーが閲覧できるリストのゴミ箱にあるTODOを、新しく捨てた順に返します。
+// 親と一緒にゴミ箱に入ったサブタスクは親を戻せば一緒に戻るので、一覧には親だけを出します。
+func (r *TodoRepository) FindTrash(ctx context.Context, userID int) ([]Todo, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+todoColumns+` FROM todos
+		WHERE todos.deleted_at IS NOT NULL AND `+memberTodosCond+`
+		AND NOT EXISTS (SELECT 1 FROM todos p WHERE p.id = todos.parent_id AND p.deleted_at IS NOT NULL)
+		ORDER BY todos.deleted_at DESC, todos.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []Todo{}
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.loadTags(ctx, userID, todos); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// RestoreTodoはゴミ箱のTODOを元に戻します。リストのeditor以上が実行できます。
+// 一緒にゴミ箱に入った（deleted_atが同じ）サブタスクも戻し、それより前に個別に捨てたサブタスクはゴミ箱に残します。
+// 親がゴミ箱にある場合は先に親を戻す必要があります。
+// 同じ名前のTODOが既にある場合は、名前のユニークインデックスにより競合エラーになります。
+func (r *TodoRepository) RestoreTodo(ctx context.Context, userID, todoID int) (Todo, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		var deletedAt sql.NullTime
+		var parentID sql.NullInt64
+		var role ListRole
+		var parentTrashed bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT t.deleted_at, t.parent_id, lm.role, COALESCE(p.deleted_at IS NOT NULL, FALSE)
+			FROM todos t
+			JOIN list_members lm ON lm.list_id = t.list_id AND lm.user_id = $2
+			LEFT JOIN todos p ON p.id = t.parent_id
+			WHERE t.id = $1`, todoID, userID).Scan(&deletedAt, &parentID, &role, &parentTrashed)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !deletedAt.Valid) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !role.Allows(RoleEditor) {
+			return fmt.Errorf("%w: %s role required", ErrForbidden, RoleEditor)
+		}
+		if parentTrashed {
+			return fmt.Errorf("%w: parent todo is in the trash; restore it first", ErrInvalidInput)
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM todos WHERE id = $1
+				UNION ALL
+				SELECT t.id FROM todos t JOIN subtree s ON t.parent_id = s.id
+				WHERE t.deleted_at = $2
+			)
+			UPDATE todos SET deleted_at = NULL WHERE id IN (SELECT id FROM subtree)
+			RETURNING id`, todoID, deletedAt.Time)
+		if err != nil {
+			return err
+		}
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// ゴミ箱にある間に親が移動して深くなっていることがあるので、階層数を確かめ直す
+		if parentID.Valid {
+			todos, err := querySubtree(ctx, tx, todoID)
+			if err != nil {
+				return err
+			}
+			if _, err := checkNewParent(ctx, tx, userID, int(parentID.Int64), buildTree(todos).height()); err != nil {
+				return err
+			}
+		}
+		var details any
+		if len(ids) > 1 {
+			details = map[string]any{"restored_ids": ids}
+		}
+		return insertAuditLog(ctx, tx, todoID, "restore", details)
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return r.FindTodo(ctx, userID, todoID)
+}
+
+// PurgeTrashはbeforeより前にゴミ箱に入れたTODOを最大limit件物理削除し、削除した件数を返します。
+// 行をFOR UPDATE SKIP LOCKEDで取り出すので、複数のレプリカが同時に実行しても競合しません。
+// リマインダーなどTODOに紐づく行はON DELETE CASCADEで一緒に削除されます。
+func (r *TodoRepository) PurgeTrash(ctx context.Context, before time.Time, limit int) (int, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	purged := 0
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			DELETE FROM todos WHERE id IN (
+				SELECT id FROM todos
+				WHERE deleted_at < $1
+				ORDER BY deleted_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id`, before, limit)
+		if err != nil {
+			return err
+		}
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := insertAuditLog(ctx, tx, id, "purge", nil); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getTodoTreeはTODOとそのサブタスクを入れ子で返します。
+func (h *TodoHandler) getTodoTree(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	tree, err := h.repo.FindTree(c.Request.Context(), currentUserID(c), id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, tree)
+	return nil
+}
+
+// MoveTodoInputは移動先の親です。parent_idにnullを指定するとルートに戻します。
+type MoveTodoInput struct {
+	ParentID *int `json:"parent_id"`
+}
+
+func (h *TodoHandler) moveTodo(c *gin.Context) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input MoveTodoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return err
+	}
+
+	userID := currentUserID(c)
+	if _, err := h.repo.MoveTodo(c.Request.Context(), userID, id, input.ParentID); err != nil {
+		return err
+	}
+	todo, err := h.repo.FindTodo(c.Request.Context(), userID, id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, todo)
+	return nil
+}
+
+// CompleteTodoInputはcascadeがtrueの場合にサブタスクにも同じ状態を反映します。ボディは省略できます。
+type CompleteTodoInput struct {
+	Cascade bool `json:"cascade"`
+}
+
+func (h *TodoHandler) completeTodo(c *gin.Context) error {
+	return h.setCompleted(c, true)
+}
+
+func (h *TodoHandler) reopenTodo(c *gin.Context) error {
+	return h.setCompleted(c, false)
+}
+
+func (h *TodoHandler) setCompleted(c *gin.Context, completed bool) error {
+	id, err := idParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input CompleteTodoInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			return err
+		}
+	}
+
+	userID := currentUserID(c)
+	if err := h.repo.SetCompleted(c.Request.Context(), userID, id, completed, input.Cascade); err != nil {
+		return err
+	}
+	if completed && h.recurrence != nil {
+		// 繰り返しTODOなら次の回をすぐに生成させる
+		h.recurrence.Notify()
+	}
+	tree, err := h.repo.FindTree(c.Request.Context(), userID, id)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, tree)
+	return nil
+}
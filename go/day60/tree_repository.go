@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// maxTodoDepthはサブタスクの最大階層数です（ルートのTODOを1階層目と数えます）。
+const maxTodoDepth = 5
+
+// TodoNodeはサブツリーの1ノードです。
+type TodoNode struct {
+	Todo
+	Children []*TodoNode `json:"children"`
+}
+
+// heightはこのノードを根とするサブツリーの階層数を返します（子がなければ1）。
+func (n *TodoNode) height() int {
+	h := 0
+	for _, child := range n.Children {
+		if ch := child.height(); ch > h {
+			h = ch
+		}
+	}
+	return h + 1
+}
+
+// ids はサブツリーに含まれるTODOのIDを返します。
+func (n *TodoNode) ids() []int {
+	ids := []int{n.ID}
+	for _, child := range n.Children {
+		ids = append(ids, child.ids()...)
+	}
+	return ids
+}
+
+// treeShapeは監査ログに記録するサブツリーの形（IDの入れ子）です。
+type treeShape struct {
+	ID       int         `json:"id"`
+	Children []treeShape `json:"children,omitempty"`
+}
+
+func (n *TodoNode) shape() treeShape {
+	s := treeShape{ID: n.ID}
+	for _, child := range n.Children {
+		s.Children = append(s.Children, child.shape())
+	}
+	return s
+}
+
+// querySubtreeは再帰CTEでrootIDを根とするサブツリーのTODOを、浅い順に取得します。ゴミ箱にあるサブタスクは含めません。
+func querySubtree(ctx context.Context, q querier, rootID int) ([]Todo, error) {
+	rows, err := q.QueryContext(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id, 0 AS depth FROM todos WHERE id = $1
+			UNION ALL
+			SELECT t.id, s.depth + 1 FROM todos t JOIN subtree s ON t.parent_id = s.id
+			WHERE t.deleted_at IS NULL
+		)
+		SELECT `+todoColumns+` FROM todos JOIN subtree ON subtree.id = todos.id
+		ORDER BY subtree.depth, todos.id`, rootID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []Todo
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(todos) == 0 {
+		return nil, ErrNotFound
+	}
+	return todos, nil
+}
+
+// buildTreeは浅い順に並んだTODOのスライスから入れ子のツリーを組み立てます。先頭が根です。
+func buildTree(todos []Todo) *TodoNode {
+	nodes := make(map[int]*TodoNode, len(todos))
+	var root *TodoNode
+	for _, t := range todos {
+		node := &TodoNode{Todo: t, Children: []*TodoNode{}}
+		nodes[t.ID] = node
+		if root == nil {
+			root = node
+			continue
+		}
+		if parent, ok := nodes[*t.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	return root
+}
+
+// todoLevelはTODOが何階層目にあるかを返します（ルートが1）。
+func todoLevel(ctx context.Context, q querier, todoID int) (int, error) {
+	var level int
+	err := q.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM todos WHERE id = $1
+			UNION ALL
+			SELECT t.id, t.parent_id FROM todos t JOIN ancestors a ON t.id = a.parent_id
+		)
+		SELECT COUNT(*) FROM ancestors`, todoID).Scan(&level)
+	return level, err
+}
+
+// lockListはリストの行をロックし、同じリスト内のツリー変更（移動・子の追加）を直列化します。
+// 同時に2つの移動が走って循環や最大階層超えが起きるのを防ぎます。
+func lockList(ctx context.Context, tx querier, listID int) error {
+	var id int
+	return tx.QueryRowContext(ctx, "SELECT id FROM lists WHERE id = $1 FOR UPDATE", listID).Scan(&id)
+}
+
+// checkNewParentは、高さsubtreeHeightのサブツリーをparentIDの下に置けるかを確認し、親のリストIDを返します。
+// 親のリストでeditor以上のロールが必要で、置いた結果がmaxTodoDepthを超えてはいけません。
+func checkNewParent(ctx context.Context, tx querier, userID, parentID, subtreeHeight int) (int, error) {
+	listID, err := requireTodoRole(ctx, tx, parentID, userID, RoleEditor)
+	if err != nil {
+		return 0, fmt.Errorf("parent todo: %w", err)
+	}
+	if err := lockList(ctx, tx, listID); err != nil {
+		return 0, err
+	}
+	level, err := todoLevel(ctx, tx, parentID)
+	if err != nil {
+		return 0, err
+	}
+	if level+subtreeHeight > maxTodoDepth {
+		return 0, fmt.Errorf("%w: subtasks can be nested at most %d levels deep", ErrInvalidInput, maxTodoDepth)
+	}
+	return listID, nil
+}
+
+// FindTreeはTODOとそのすべてのサブタスクを入れ子で返します。
+func (r *TodoRepository) FindTree(ctx context.Context, userID, todoID int) (*TodoNode, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	// 根が見えれば、同じリストにある子孫もすべて見える
+	if _, err := r.FindTodo(ctx, userID, todoID); err != nil {
+		return nil, err
+	}
+	todos, err := querySubtree(ctx, r.db, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadTags(ctx, userID, todos); err != nil {
+		return nil, err
+	}
+	return buildTree(todos), nil
+}
+
+// MoveTodoはTODOをサブツリーごと別の親の下へ移動します。newParentIDがnilならルートに戻します。
+// 自分自身や子孫の下への移動（循環）と、最大階層を超える移動はErrInvalidInputになります。
+// 移動前後の親とサブツリーの形を監査ログに記録します。
+func (r *TodoRepository) MoveTodo(ctx context.Context, userID, todoID int, newParentID *int) (Todo, error) {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	var moved Todo
+	err := r.execTx(ctx, func(tx *sql.Tx) error {
+		listID, err := requireTodoRole(ctx, tx, todoID, userID, RoleEditor)
+		if err != nil {
+			return err
+		}
+		if err := lockList(ctx, tx, listID); err != nil {
+			return err
+		}
+		todos, err := querySubtree(ctx, tx, todoID)
+		if err != nil {
+			return err
+		}
+		tree := buildTree(todos)
+
+		if newParentID != nil {
+			for _, id := range tree.ids() {
+				if id == *newParentID {
+					return fmt.Errorf("%w: cannot move a todo under itself or its subtasks", ErrInvalidInput)
+				}
+			}
+			parentListID, err := checkNewParent(ctx, tx, userID, *newParentID, tree.height())
+			if err != nil {
+				return err
+			}
+			if parentListID != listID {
+				return fmt.Errorf("%w: parent must be in the same list", ErrInvalidInput)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE todos SET parent_id = $1 WHERE id = $2", newParentID, todoID); err != nil {
+			return err
+		}
+		moved = tree.Todo
+		details := map[string]any{
+			"from_parent_id": moved.ParentID,
+			"to_parent_id":   newParentID,
+			"subtree":        tree.shape(),
+		}
+		moved.ParentID = newParentID
+		return insertAuditLog(ctx, tx, todoID, "move", details)
+	})
+	return moved, err
+}
+
+// SetCompletedはTODOの完了状態を変更します。cascadeがtrueの場合はすべてのサブタスクにも同じ状態を反映します。
+// 反映したサブツリーの形を監査ログに記録します。
+func (r *TodoRepository) SetCompleted(ctx context.Context, userID, todoID int, completed, cascade bool) error {
+	ctx, cancel := r.withQueryTimeout(ctx)
+	defer cancel()
+	return r.execTx(ctx, func(tx *sql.Tx) error {
+		if _, err := requireTodoRole(ctx, tx, todoID, userID, RoleEditor); err != nil {
+			return err
+		}
+		ids := []int{todoID}
+		details := map[string]any{"cascade": cascade}
+		if cascade {
+			todos, err := querySubtree(ctx, tx, todoID)
+			if err != nil {
+				return err
+			}
+			tree := buildTree(todos)
+			ids = tree.ids()
+			details["subtree"] = tree.shape()
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE todos SET completed = $1 WHERE id = ANY($2)", completed, ids); err != nil {
+			return err
+		}
+		operation := "complete"
+		if !completed {
+			operation = "reopen"
+		}
+		return insertAuditLog(ctx, tx, todoID, operation, details)
+	})
+}
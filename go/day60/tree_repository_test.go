@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func intPtr(i int) *int { return &i }
+
+func TestBuildTree(t *testing.T) {
+	// 1 ─┬─ 2 ── 4
+	//    └─ 3
+	todos := []Todo{
+		{ID: 1},
+		{ID: 2, ParentID: intPtr(1)},
+		{ID: 3, ParentID: intPtr(1)},
+		{ID: 4, ParentID: intPtr(2)},
+	}
+	tree := buildTree(todos)
+
+	assert.Equal(t, 1, tree.ID)
+	assert.Len(t, tree.Children, 2)
+	assert.Equal(t, 3, tree.height())
+	assert.ElementsMatch(t, []int{1, 2, 3, 4}, tree.ids())
+	assert.Equal(t, treeShape{ID: 1, Children: []treeShape{
+		{ID: 2, Children: []treeShape{{ID: 4}}},
+		{ID: 3},
+	}}, tree.shape())
+}
+
+func TestBuildTreeSingleNode(t *testing.T) {
+	tree := buildTree([]Todo{{ID: 7, ParentID: intPtr(3)}})
+
+	assert.Equal(t, 7, tree.ID)
+	assert.Empty(t, tree.Children)
+	assert.Equal(t, 1, tree.height())
+}
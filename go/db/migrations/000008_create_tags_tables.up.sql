@@ -0,0 +1,19 @@
+-- ユーザーごとのタグ名前空間を持つtagsテーブルを作成します
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- 同じユーザー内でタグ名は一意（別ユーザーなら同名タグを持てる）
+    CONSTRAINT tags_user_id_name_unique UNIQUE (user_id, name)
+);
+
+-- TODOとタグの多対多を表す中間テーブルです
+CREATE TABLE IF NOT EXISTS todo_tags (
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+
+-- タグ側からの絞り込み(?tag=...)用のインデックス
+CREATE INDEX idx_todo_tags_tag_id ON todo_tags(tag_id);
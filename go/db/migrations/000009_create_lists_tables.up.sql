@@ -0,0 +1,54 @@
+-- TODOを所有するリスト（プロジェクト）テーブルを作成します
+CREATE TABLE IF NOT EXISTS lists (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- ユーザーごとのデフォルトの個人リストかどうか
+    is_personal BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- 個人リストはユーザーごとに1つだけ
+CREATE UNIQUE INDEX lists_personal_unique ON lists(owner_id) WHERE is_personal;
+
+-- リストのメンバーとロール（viewer: 閲覧のみ, editor: TODOの編集可, owner: メンバー管理可）
+CREATE TABLE IF NOT EXISTS list_members (
+    list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, user_id)
+);
+CREATE INDEX idx_list_members_user_id ON list_members(user_id);
+
+-- メールアドレス宛ての招待。招待されたメールアドレスのユーザーが承諾するとメンバーになる
+CREATE TABLE IF NOT EXISTS list_invitations (
+    id SERIAL PRIMARY KEY,
+    list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    invited_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT list_invitations_list_id_email_unique UNIQUE (list_id, email)
+);
+CREATE INDEX idx_list_invitations_email ON list_invitations(email);
+
+-- todosをリストに所属させます
+ALTER TABLE todos ADD COLUMN list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE;
+CREATE INDEX idx_todos_list_id ON todos(list_id);
+
+-- 既存データの移行: 全ユーザーに個人リストを作り、既存のTODOをそこへ移す
+INSERT INTO lists (name, owner_id, is_personal)
+SELECT 'Personal', id, TRUE FROM users;
+
+INSERT INTO list_members (list_id, user_id, role)
+SELECT id, owner_id, 'owner' FROM lists WHERE is_personal;
+
+UPDATE todos SET list_id = lists.id
+FROM lists
+WHERE lists.owner_id = todos.user_id AND lists.is_personal;
+
+-- 作成者のいないTODOは移行前から誰にも見えず、移す先の個人リストも無いので削除する
+DELETE FROM todos WHERE list_id IS NULL;
+
+-- 移行後のTODOは必ずどれかのリストに所属する
+ALTER TABLE todos ALTER COLUMN list_id SET NOT NULL;
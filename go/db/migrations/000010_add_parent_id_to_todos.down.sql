@@ -0,0 +1,4 @@
+ALTER TABLE todo_audit_logs DROP COLUMN IF EXISTS details;
+ALTER TABLE todos DROP COLUMN IF EXISTS completed;
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_parent_not_self;
+ALTER TABLE todos DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,11 @@
+-- サブタスク: todosに親TODOへの参照を追加します（NULLはルートのTODO）
+-- 親が削除されたら子も一緒に削除する
+ALTER TABLE todos ADD COLUMN parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE;
+ALTER TABLE todos ADD CONSTRAINT todos_parent_not_self CHECK (parent_id <> id);
+CREATE INDEX idx_todos_parent_id ON todos(parent_id);
+
+-- 完了状態（親の完了を子に伝播できるようにする）
+ALTER TABLE todos ADD COLUMN completed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 監査ログに操作の詳細（移動前後の親やサブツリーの形）を記録するためのカラム
+ALTER TABLE todo_audit_logs ADD COLUMN details JSONB;
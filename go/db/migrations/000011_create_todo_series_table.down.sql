@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS todos_series_id_due_at_unique;
+ALTER TABLE todos DROP COLUMN IF EXISTS series_id;
+DROP TABLE IF EXISTS todo_series;
+ALTER TABLE todos DROP COLUMN IF EXISTS due_at;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,26 @@
+-- 繰り返しの計算に使うユーザーのタイムゾーン（IANA名）
+ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- TODOの期限
+ALTER TABLE todos ADD COLUMN due_at TIMESTAMPTZ;
+
+-- 繰り返しTODOのシリーズ。各回のTODOはtodos.series_idでシリーズを参照する
+CREATE TABLE IF NOT EXISTS todo_series (
+    id SERIAL PRIMARY KEY,
+    list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,                 -- 各回のTODO名の元になる名前
+    rule TEXT NOT NULL,                 -- RRULE（RFC 5545のサブセット）
+    timezone VARCHAR(64) NOT NULL,      -- 作成時のユーザーのタイムゾーン
+    dtstart TIMESTAMPTZ NOT NULL,       -- 初回の期限
+    last_due_at TIMESTAMPTZ NOT NULL,   -- 最後に生成した回の期限
+    occurrences INTEGER NOT NULL DEFAULT 1, -- 生成した回数（COUNTの判定用）
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- スケジューラが次の回を生成すべきシリーズを探すためのインデックス
+CREATE INDEX idx_todo_series_active_last_due_at ON todo_series(last_due_at) WHERE active;
+
+ALTER TABLE todos ADD COLUMN series_id INTEGER REFERENCES todo_series(id) ON DELETE SET NULL;
+-- 同じシリーズの同じ期限の回は1つだけ。複数レプリカや再起動で生成が重複しても2つ目は作られない
+CREATE UNIQUE INDEX todos_series_id_due_at_unique ON todos(series_id, due_at) WHERE series_id IS NOT NULL;
@@ -0,0 +1,18 @@
+-- TODOのリマインダー。通知先はリマインダーを作成したユーザー
+CREATE TABLE IF NOT EXISTS reminders (
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- 通知する日時。期限からの相対指定やスヌーズの場合も計算済みの日時を入れる
+    remind_at TIMESTAMPTZ NOT NULL,
+    -- 期限(due_at)の何分前か。NULLなら絶対日時での指定
+    offset_minutes INTEGER CHECK (offset_minutes >= 0),
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dismissed', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- ディスパッチャが送信対象を探すためのインデックス
+CREATE INDEX idx_reminders_pending_remind_at ON reminders(remind_at) WHERE status = 'pending';
+CREATE INDEX idx_reminders_todo_id ON reminders(todo_id);
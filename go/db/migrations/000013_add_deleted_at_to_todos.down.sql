@@ -0,0 +1,7 @@
+-- ゴミ箱のTODOは名前が重複している可能性があるため、元のユニーク制約に戻す前に物理削除する
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_todos_deleted_at;
+DROP INDEX IF EXISTS todos_name_unique;
+ALTER TABLE todos ADD CONSTRAINT todos_name_unique UNIQUE (name);
+ALTER TABLE todos DROP COLUMN IF EXISTS deleted_at;
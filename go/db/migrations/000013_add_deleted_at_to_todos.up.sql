@@ -0,0 +1,10 @@
+-- 論理削除（ゴミ箱）。deleted_atが入っているTODOはゴミ箱にあり、保持期間を過ぎるとパージジョブが物理削除する
+ALTER TABLE todos ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- TODO名のユニーク制約はゴミ箱のTODOを除外する部分ユニークインデックスに置き換える
+-- （制約違反時のエラーで同じ名前が返るよう、インデックス名はtodos_name_uniqueのままにする）
+ALTER TABLE todos DROP CONSTRAINT todos_name_unique;
+CREATE UNIQUE INDEX todos_name_unique ON todos(name) WHERE deleted_at IS NULL;
+
+-- パージジョブとゴミ箱一覧のためのインデックス
+CREATE INDEX idx_todos_deleted_at ON todos(deleted_at) WHERE deleted_at IS NOT NULL;
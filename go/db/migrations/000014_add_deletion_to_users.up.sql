@@ -0,0 +1,5 @@
+-- アカウント削除の申請。deletion_scheduled_atを過ぎるとユーザーを物理削除し、
+-- TODOなどはfk_userなどの外部キー(ON DELETE CASCADE)で一緒に削除される。猶予期間中は申請を取り消せる
+ALTER TABLE users ADD COLUMN deletion_requested_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
@@ -0,0 +1,34 @@
+-- TODOの添付ファイル。ファイルの中身はBlobStoreに置き、ここにはメタデータだけを持つ
+CREATE TABLE IF NOT EXISTS attachments (
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    -- アップロードしたユーザー。容量の上限はこのユーザーに対して数える
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    -- 中身から判定したContent-Type（クライアントの申告値は使わない）
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes >= 0),
+    blob_key TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_attachments_todo_id ON attachments(todo_id);
+CREATE INDEX idx_attachments_user_id ON attachments(user_id);
+
+-- 削除待ちのBLOB。添付ファイルの行が消えたら（TODOやユーザーの削除によるCASCADEを含む）ここに積み、
+-- ゴミ箱のパージジョブがBlobStoreから削除する
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    id SERIAL PRIMARY KEY,
+    blob_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE FUNCTION enqueue_blob_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO blob_deletions (blob_key) VALUES (OLD.blob_key);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER attachments_enqueue_blob_deletion
+AFTER DELETE ON attachments
+FOR EACH ROW EXECUTE FUNCTION enqueue_blob_deletion();
@@ -0,0 +1,35 @@
+-- TODOのコメント。parent_idで返信のスレッドを作る
+CREATE TABLE IF NOT EXISTS comments (
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    -- 投稿者。アカウントが削除されたらNULLにしてスレッドの形は残す（本文はアカウント削除時に消す）
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    edited_at TIMESTAMPTZ,
+    -- 削除されたコメントは返信のスレッドを保つために行を残し、本文を空にする
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX idx_comments_todo_id ON comments(todo_id);
+CREATE INDEX idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX idx_comments_user_id ON comments(user_id);
+
+-- コメントの編集履歴。編集前の本文を1版ずつ残す
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id SERIAL PRIMARY KEY,
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    -- この本文が書かれた日時（投稿または前回の編集の日時）
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_comment_revisions_comment_id ON comment_revisions(comment_id);
+
+-- コメント中の@メールアドレスで言及されたユーザー
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (comment_id, user_id)
+);
+CREATE INDEX idx_comment_mentions_user_id ON comment_mentions(user_id);
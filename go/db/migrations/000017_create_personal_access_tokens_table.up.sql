@@ -0,0 +1,16 @@
+-- パーソナルアクセストークン（スクリプトやCLIからパスワードなしでAPIを呼ぶためのトークン）
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    -- トークンの先頭部分（例: tdp_AbCdEfGh）。一覧でどのトークンかを見分けるために平文で持つ
+    token_prefix VARCHAR(16) NOT NULL,
+    -- トークン全体のSHA-256（平文のトークンは保存しない）
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
@@ -0,0 +1,14 @@
+-- 外部のIDプロバイダ（OpenID Connect）のアカウントとユーザーの紐付け
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- 設定したプロバイダの名前（OIDC_PROVIDERSの値）
+    provider VARCHAR(50) NOT NULL,
+    -- IDトークンのsubクレーム（プロバイダの中で一意なユーザーID）
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT user_identities_provider_subject_unique UNIQUE (provider, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
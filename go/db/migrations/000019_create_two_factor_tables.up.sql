@@ -0,0 +1,23 @@
+-- TOTP（RFC 6238）による2要素認証の設定。confirmed_atがNULLの間は登録の途中で、ログインには使わない
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- Base32の共有シークレット（コードの検証に平文が必要）
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    -- 最後に受け付けたコードの時間ステップ。同じコードを二度使えないようにする
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    -- 連続して失敗した回数と、失敗が続いたときにロックする期限
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 認証アプリを使えないときのリカバリーコード（SHA-256で保存し、一度だけ使える）
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT user_recovery_codes_user_id_code_hash_unique UNIQUE (user_id, code_hash)
+);
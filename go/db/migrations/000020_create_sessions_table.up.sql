@@ -0,0 +1,15 @@
+-- ログインセッション。発行したJWTのjtiをIDにして、端末の情報と最後に使われた日時を記録する
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- JWTの有効期限。これを過ぎたセッションは削除してよい
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+-- 各インスタンスが定期的に読み込む取り消し済みセッションの一覧用
+CREATE INDEX idx_sessions_revoked ON sessions(expires_at) WHERE revoked_at IS NOT NULL;
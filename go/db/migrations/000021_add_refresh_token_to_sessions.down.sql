@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sessions_refresh_token_hash;
+ALTER TABLE sessions DROP COLUMN IF EXISTS refresh_token_hash;
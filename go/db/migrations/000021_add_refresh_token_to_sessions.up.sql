@@ -0,0 +1,4 @@
+-- リフレッシュトークン（SHA-256で保存）。ログイン時にrememberを指定したセッションだけが持つ
+-- これを持つセッションのexpires_atはJWTではなくリフレッシュトークンの有効期限で、リフレッシュのたびに延びる
+ALTER TABLE sessions ADD COLUMN refresh_token_hash CHAR(64);
+CREATE UNIQUE INDEX idx_sessions_refresh_token_hash ON sessions(refresh_token_hash) WHERE refresh_token_hash IS NOT NULL;
@@ -0,0 +1,8 @@
+DELETE FROM sessions WHERE user_id IS NULL;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_id_fkey;
+ALTER TABLE sessions
+ADD CONSTRAINT sessions_user_id_fkey
+FOREIGN KEY (user_id)
+REFERENCES users(id)
+ON DELETE CASCADE;
+ALTER TABLE sessions ALTER COLUMN user_id SET NOT NULL;
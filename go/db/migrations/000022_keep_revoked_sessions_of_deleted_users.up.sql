@@ -0,0 +1,9 @@
+-- アカウントを物理削除しても、取り消したセッションは期限まで残す（各インスタンスの拒否リストが読み込めるように）
+-- 削除したユーザーのセッションはuser_idがNULLになる
+ALTER TABLE sessions ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_id_fkey;
+ALTER TABLE sessions
+ADD CONSTRAINT sessions_user_id_fkey
+FOREIGN KEY (user_id)
+REFERENCES users(id)
+ON DELETE SET NULL;
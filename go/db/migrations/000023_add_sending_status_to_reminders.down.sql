@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_reminders_sending_lease_expires_at;
+UPDATE reminders SET status = 'pending' WHERE status = 'sending';
+ALTER TABLE reminders DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE reminders DROP CONSTRAINT IF EXISTS reminders_status_check;
+ALTER TABLE reminders
+ADD CONSTRAINT reminders_status_check
+CHECK (status IN ('pending', 'sent', 'dismissed', 'failed'));
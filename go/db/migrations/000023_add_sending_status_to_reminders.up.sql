@@ -0,0 +1,8 @@
+-- ディスパッチャは送信の前にリマインダーをsendingにしてコミットし、送信はトランザクションの外で行う
+-- lease_expires_atまでに結果を記録できなかった（送信中にプロセスが止まった）リマインダーは、再び送信対象になる
+ALTER TABLE reminders DROP CONSTRAINT IF EXISTS reminders_status_check;
+ALTER TABLE reminders
+ADD CONSTRAINT reminders_status_check
+CHECK (status IN ('pending', 'sending', 'sent', 'dismissed', 'failed'));
+ALTER TABLE reminders ADD COLUMN lease_expires_at TIMESTAMPTZ;
+CREATE INDEX idx_reminders_sending_lease_expires_at ON reminders(lease_expires_at) WHERE status = 'sending';
@@ -13,9 +13,19 @@ INSERT INTO users (id, email, password_hash, role)
 VALUES (2, 'user-test@example.com', '$2a$10$kxtxAB6YnV5vub0dbnc9z.DmL92hzshSp/X32LFR8G8//BxSx2Us6', 'user')
 ON CONFLICT (id) DO NOTHING;
 
+-- 各ユーザーの個人リスト（サインアップ時と同じくownerとして登録）
+INSERT INTO lists (id, name, owner_id, is_personal)
+VALUES (1, 'Personal', 1, TRUE), (2, 'Personal', 2, TRUE)
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO list_members (list_id, user_id, role)
+VALUES (1, 1, 'owner'), (2, 2, 'owner')
+ON CONFLICT (list_id, user_id) DO NOTHING;
+
 -- Normal User's Todo
-INSERT INTO todos (name, user_id)
-VALUES ('Todo for user 2', 2);
+INSERT INTO todos (name, user_id, list_id)
+VALUES ('Todo for user 2', 2, 2);
 
 -- IDのシーケンスがずれないように、手動挿入したIDの最大値に更新する
 SELECT setval('users_id_seq', (SELECT MAX(id) FROM users));
+SELECT setval('lists_id_seq', (SELECT MAX(id) FROM lists));